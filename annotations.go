@@ -0,0 +1,60 @@
+package conf
+
+import "strings"
+
+// pragmaPrefix is the annotation name of pragmas, as in # conf:deprecated.
+const pragmaPrefix = "conf"
+
+// Comment returns the comment following t on the line it ends on, without
+// the '#' or '//' and surrounding spaces, such as "units: seconds" for
+//
+//	timeout = 30 # units: seconds
+//
+// It is "" when there is none.
+func (t *Token) Comment() string {
+	return t.comment
+}
+
+// Annotation returns the value of the comment of t when it is written as
+// an annotation called name, as units in # units: seconds.
+func (t *Token) Annotation(name string) (string, bool) {
+	return annotation(t.comment, name)
+}
+
+// annotation returns the value of comment when it is written as an
+// annotation called name.
+func annotation(comment, name string) (string, bool) {
+	k, v, ok := strings.Cut(comment, ":")
+	if !ok || strings.TrimSpace(k) != name {
+		return "", false
+	}
+	return strings.TrimSpace(v), true
+}
+
+// Pragmas returns the words of the comment of t when it is a pragma for
+// tools reading the config, such as deprecated and secret in
+//
+//	password = s3cr3t # conf:deprecated,secret
+func (t *Token) Pragmas() []string {
+	v, ok := t.Annotation(pragmaPrefix)
+	if !ok {
+		return nil
+	}
+	return pragmaWords(v)
+}
+
+// pragmaWords splits the value of a pragma annotation into its words.
+func pragmaWords(v string) []string {
+	return strings.FieldsFunc(v, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+}
+
+// attachComment sets the text of the comment item it as the comment of
+// the last value set, when that ended on the same line.
+func (p *parser) attachComment(it item) {
+	if p.last != nil && p.lastLine == it.Line {
+		p.last.comment = strings.TrimSpace(it.Val)
+	}
+	p.last = nil
+}
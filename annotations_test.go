@@ -0,0 +1,68 @@
+package conf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenComment(t *testing.T) {
+	m, err := ParseWithChecks(`
+		# leading comment
+		timeout = 30 # units: seconds
+		password = s3cr3t // conf:deprecated, secret
+		a = 1, b = 2 # b only
+		cluster { # not a value
+			port = 6222
+		} # cluster
+		routes = [
+			a # first
+			b
+		]
+		plain = 1
+		# next line
+	`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	token := func(path string) *Token {
+		t.Helper()
+		v, ok := Lookup(m, path)
+		tk, isToken := v.(*Token)
+		if !ok || !isToken {
+			t.Fatalf("Expected a token at '%s', got %+v", path, v)
+		}
+		return tk
+	}
+
+	for _, tc := range []struct {
+		path, comment string
+	}{
+		{"timeout", "units: seconds"},
+		{"password", "conf:deprecated, secret"},
+		{"a", ""},
+		{"b", "b only"},
+		{"cluster", "cluster"},
+		{"cluster.port", ""},
+		{"routes[0]", "first"},
+		{"routes[1]", ""},
+		{"plain", ""},
+	} {
+		if got := token(tc.path).Comment(); got != tc.comment {
+			t.Fatalf("Mismatch for '%s':\nReceived: '%+v'\nExpected: '%+v'\n", tc.path, got, tc.comment)
+		}
+	}
+
+	if v, ok := token("timeout").Annotation("units"); !ok || v != "seconds" {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", v, "seconds")
+	}
+	if _, ok := token("b").Annotation("units"); ok {
+		t.Fatal("Expected no units annotation")
+	}
+	expected := []string{"deprecated", "secret"}
+	if got := token("password").Pragmas(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", got, expected)
+	}
+	if got := token("timeout").Pragmas(); got != nil {
+		t.Fatalf("Unexpected pragmas: %+v", got)
+	}
+}
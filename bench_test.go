@@ -0,0 +1,213 @@
+package conf
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// benchConfig returns a config of n blocks of server settings, each a
+// map with scalars of every kind, a nested map and an array.
+func benchConfig(n int) string {
+	var sb strings.Builder
+	sb.WriteString("# generated for benchmarks\nPORT = 4222\n")
+	for i := range n {
+		fmt.Fprintf(&sb, `server_%d {
+	host = "10.0.%d.%d"
+	port = $PORT
+	debug = false
+	ratio = 0.75
+	max_payload = 1MB
+	timeout = "2s"
+	tls { cert = "/etc/ssl/%d.pem", verify = true }
+	routes = [nats://a:%d, nats://b:%d]
+}
+`, i, i/256, i%256, i, i, i)
+	}
+	return sb.String()
+}
+
+// benchNested returns a config of maps nested depth levels deep.
+func benchNested(depth int) string {
+	return strings.Repeat("a { ", depth) + "x = 1" + strings.Repeat(" }", depth)
+}
+
+// benchMinified returns a minified JSON document of n objects, all on a
+// single line.
+func benchMinified(n int) string {
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i := range n {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		fmt.Fprintf(&sb, `"server_%d":{"host":"10.0.%d.%d","port":%d,"tls":{"verify":true},"routes":["a","b"]}`, i, i/256, i%256, i)
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+var benchSizes = []struct {
+	name   string
+	blocks int
+}{
+	{"small", 1},
+	{"medium", 100},
+	{"huge", 10000},
+}
+
+func benchParse(b *testing.B, data string, pedantic bool) {
+	b.Helper()
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for range b.N {
+		if _, err := parseData(data, "", pedantic); err != nil {
+			b.Fatalf("Unexpected error: %v", err)
+		}
+	}
+}
+
+// Sub-benchmarks are named key=value so benchstat can group them, as in
+// benchstat -col /mode old.txt new.txt.
+func BenchmarkParse(b *testing.B) {
+	for _, size := range benchSizes {
+		data := benchConfig(size.blocks)
+		for _, mode := range []string{"normal", "pedantic"} {
+			b.Run(fmt.Sprintf("size=%s/mode=%s", size.name, mode), func(b *testing.B) {
+				benchParse(b, data, mode == "pedantic")
+			})
+		}
+	}
+}
+
+func BenchmarkParseNested(b *testing.B) {
+	for _, depth := range []int{10, 100, 1000} {
+		data := benchNested(depth)
+		b.Run(fmt.Sprintf("depth=%d", depth), func(b *testing.B) {
+			benchParse(b, data, false)
+		})
+	}
+}
+
+func BenchmarkParseMinified(b *testing.B) {
+	for _, n := range []int{1000, 20000} {
+		data := benchMinified(n)
+		b.Run(fmt.Sprintf("keys=%d", n), func(b *testing.B) {
+			benchParse(b, data, true)
+		})
+	}
+}
+
+func BenchmarkParseIncludes(b *testing.B) {
+	for _, n := range []int{10, 100} {
+		dir := b.TempDir()
+		var main strings.Builder
+		for i := range n {
+			name := fmt.Sprintf("inc_%d.conf", i)
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(benchConfig(1)), 0644); err != nil {
+				b.Fatal(err)
+			}
+			fmt.Fprintf(&main, "part_%d { include %s }\n", i, name)
+		}
+		fp := filepath.Join(dir, "main.conf")
+		if err := os.WriteFile(fp, []byte(main.String()), 0644); err != nil {
+			b.Fatal(err)
+		}
+		for _, cache := range []string{"none", "warm"} {
+			b.Run(fmt.Sprintf("files=%d/cache=%s", n, cache), func(b *testing.B) {
+				var opts []Option
+				if cache == "warm" {
+					opts = append(opts, WithIncludeCache(NewIncludeCache()))
+				}
+				b.ReportAllocs()
+				for range b.N {
+					if _, err := ParseFile(fp, opts...); err != nil {
+						b.Fatalf("Unexpected error: %v", err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkLoadRelease(b *testing.B) {
+	fp := filepath.Join(b.TempDir(), "app.conf")
+	if err := os.WriteFile(fp, []byte(benchConfig(100)), 0644); err != nil {
+		b.Fatal(err)
+	}
+	for _, release := range []bool{false, true} {
+		b.Run(fmt.Sprintf("release=%t", release), func(b *testing.B) {
+			b.ReportAllocs()
+			for range b.N {
+				r, err := Load(fp)
+				if err != nil {
+					b.Fatalf("Unexpected error: %v", err)
+				}
+				if release {
+					r.Release()
+				}
+			}
+		})
+	}
+}
+
+// TestParseAllocs fails when a change makes parsing allocate noticeably
+// more than it used to. The budgets leave some headroom over the measured
+// allocations; raise them only for a change that is worth the cost.
+func TestParseAllocs(t *testing.T) {
+	if testing.CoverMode() != "" {
+		t.Skip("coverage instrumentation changes allocations")
+	}
+	for _, test := range []struct {
+		name     string
+		data     string
+		pedantic bool
+		budget   float64
+	}{
+		{"small", benchConfig(1), false, 150},
+		{"small pedantic", benchConfig(1), true, 170},
+		{"medium", benchConfig(100), false, 11000},
+		{"medium pedantic", benchConfig(100), true, 12500},
+		{"nested", benchNested(100), false, 7000},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			allocs := testing.AllocsPerRun(10, func() {
+				if _, err := parseData(test.data, "", test.pedantic); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			})
+			if allocs > test.budget {
+				t.Fatalf("Parse allocated %.0f times, over the budget of %.0f", allocs, test.budget)
+			}
+		})
+	}
+}
+
+// TestParseLinear fails when the time to parse a document stops growing
+// linearly with its size on a single line, as it does when every value
+// scans the rest of the line. Parsing 20 times the data may take somewhat
+// longer per byte on a loaded machine, but not several times longer.
+func TestParseLinear(t *testing.T) {
+	if testing.Short() {
+		t.Skip("timing test")
+	}
+	perByte := func(data string) float64 {
+		best := time.Duration(math.MaxInt64)
+		for range 3 {
+			start := time.Now()
+			if _, err := parseData(data, "", true); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			best = min(best, time.Since(start))
+		}
+		return float64(best) / float64(len(data))
+	}
+	small, large := perByte(benchMinified(1000)), perByte(benchMinified(20000))
+	if large > 2*small {
+		t.Fatalf("Parsing took %.1fns per byte for 20000 keys on a line, over twice the %.1fns for 1000", large, small)
+	}
+}
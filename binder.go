@@ -0,0 +1,154 @@
+package conf
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Binder overlays values from environment variables and command-line flags
+// on top of a parsed config. Precedence from lowest to highest is:
+//
+//	config file < environment variables < flags
+//
+// Values are parsed with the same rules as values in a config file, so
+// "4222" becomes an integer and "[a, b]" an array, when all of the value is
+// a single value as ParseExactValue reads it. Other values, such as "a b c"
+// or "x; y=1", are strings, as are the values of string flags.
+type Binder struct {
+	envPrefix string
+	env       bool
+	environ   func() []string
+
+	flagSets []*flag.FlagSet
+	visitors []func(fn func(name, value string))
+	flagKeys map[string]string
+}
+
+// NewBinder returns a Binder with no sources bound.
+func NewBinder() *Binder {
+	return &Binder{
+		environ:  os.Environ,
+		flagKeys: make(map[string]string),
+	}
+}
+
+// BindEnv overlays environment variables starting with prefix. The rest of
+// the variable name is lower cased and split into key path levels on double
+// underscores, so with prefix "MYAPP_" the variable MYAPP_SERVER__MAX_CONN
+// sets server.max_conn.
+func (b *Binder) BindEnv(prefix string) *Binder {
+	b.env = true
+	b.envPrefix = prefix
+	return b
+}
+
+// BindFlagSet overlays the flags of fs that were set on the command line.
+// Flag names are key paths unless mapped otherwise with MapFlag.
+func (b *Binder) BindFlagSet(fs *flag.FlagSet) *Binder {
+	b.flagSets = append(b.flagSets, fs)
+	return b
+}
+
+// BindFlagVisitor overlays flags from other flag packages. visit must call
+// fn for each flag that was set on the command line, e.g. for pflag:
+//
+//	b.BindFlagVisitor(func(fn func(name, value string)) {
+//		fs.Visit(func(f *pflag.Flag) { fn(f.Name, f.Value.String()) })
+//	})
+func (b *Binder) BindFlagVisitor(visit func(fn func(name, value string))) *Binder {
+	b.visitors = append(b.visitors, visit)
+	return b
+}
+
+// MapFlag sets the key path the flag with the given name overrides.
+func (b *Binder) MapFlag(name, path string) *Binder {
+	b.flagKeys[name] = path
+	return b
+}
+
+// Apply sets the bound environment variables and flags in m.
+func (b *Binder) Apply(m map[string]any) error {
+	if b.env {
+		for _, kv := range b.environ() {
+			name, val, ok := strings.Cut(kv, "=")
+			if !ok || !strings.HasPrefix(name, b.envPrefix) || name == b.envPrefix {
+				continue
+			}
+			path := strings.ToLower(strings.ReplaceAll(name[len(b.envPrefix):], "__", "."))
+			if err := bindValue(m, path, val, false); err != nil {
+				return fmt.Errorf("environment variable %s: %v", name, err)
+			}
+		}
+	}
+
+	var err error
+	setFlag := func(name, val string, literal bool) {
+		if err != nil {
+			return
+		}
+		path, ok := b.flagKeys[name]
+		if !ok {
+			path = name
+		}
+		if berr := bindValue(m, path, val, literal); berr != nil {
+			err = fmt.Errorf("flag -%s: %v", name, berr)
+		}
+	}
+	for _, fs := range b.flagSets {
+		fs.Visit(func(f *flag.Flag) {
+			_, literal := flagValue(f).(string)
+			setFlag(f.Name, f.Value.String(), literal)
+		})
+	}
+	for _, visit := range b.visitors {
+		visit(func(name, value string) { setFlag(name, value, false) })
+	}
+	return err
+}
+
+// flagValue returns the value of f, or nil for values that do not implement
+// flag.Getter.
+func flagValue(f *flag.Flag) any {
+	if g, ok := f.Value.(flag.Getter); ok {
+		return g.Get()
+	}
+	return nil
+}
+
+// bindValue sets path in m to val, as the value it holds unless literal is
+// set or it is not a single value.
+func bindValue(m map[string]any, path, val string, literal bool) error {
+	var v any = val
+	if !literal {
+		if ev, ok := ParseExactValue(val); ok {
+			v = ev
+		}
+	}
+	return setPath(m, path, v)
+}
+
+// setPath sets the value at the dotted key path in m, creating maps for
+// missing levels.
+func setPath(m map[string]any, path string, v any) error {
+	parts, err := pathKeys(path)
+	if err != nil {
+		return err
+	}
+	var parent string
+	for _, part := range parts[:len(parts)-1] {
+		parent = joinPath(parent, part)
+		next, ok := plainValue(m[part]).(map[string]any)
+		if !ok {
+			if _, exists := m[part]; exists {
+				return fmt.Errorf("'%s' is not a map", parent)
+			}
+			next = make(map[string]any)
+			m[part] = next
+		}
+		m = next
+	}
+	m[parts[len(parts)-1]] = v
+	return nil
+}
@@ -0,0 +1,103 @@
+package conf
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestBinder(t *testing.T) {
+	m, err := Parse(`
+		server { port = 4222; host = localhost }
+		debug = false
+		name = file
+	`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int("server.port", 0, "")
+	fs.Bool("debug", false, "")
+	fs.String("log", "", "")
+	fs.String("unset", "default", "")
+	if err := fs.Parse([]string{"-server.port=5222", "-log=/tmp/x.log"}); err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewBinder().BindEnv("MYAPP_").BindFlagSet(fs).MapFlag("log", "logging.file")
+	b.environ = func() []string {
+		return []string{
+			"MYAPP_SERVER__PORT=4333",
+			"MYAPP_SERVER__HOST=0.0.0.0",
+			"MYAPP_DEBUG=true",
+			"MYAPP_TAGS=[a, b]",
+			"OTHER_NAME=x",
+		}
+	}
+	b.BindFlagVisitor(func(fn func(name, value string)) { fn("name", "flag") })
+	if err := b.Apply(m); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ex := map[string]any{
+		"server":  map[string]any{"port": int64(5222), "host": "0.0.0.0"},
+		"debug":   true,
+		"name":    "flag",
+		"tags":    []any{"a", "b"},
+		"logging": map[string]any{"file": "/tmp/x.log"},
+	}
+	if !reflect.DeepEqual(m, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, ex)
+	}
+}
+
+func TestBinderRawValues(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("token", "", "")
+	fs.Int("port", 0, "")
+	if err := fs.Parse([]string{"-token=4222", "-port=80"}); err != nil {
+		t.Fatal(err)
+	}
+	b := NewBinder().BindEnv("APP_").BindFlagSet(fs)
+	b.environ = func() []string {
+		return []string{
+			"APP_A=x; y=1",
+			"APP_B=s3cr3t}",
+			"APP_C=hello // x",
+			"APP_D=a b c",
+			"APP_E=$HOME",
+			"APP_F=http://x:80/y",
+			"APP_G=\"quoted\"",
+			"APP_H=",
+		}
+	}
+	m := make(map[string]any)
+	if err := b.Apply(m); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ex := map[string]any{
+		"a":     "x; y=1",
+		"b":     "s3cr3t}",
+		"c":     "hello // x",
+		"d":     "a b c",
+		"e":     "$HOME",
+		"f":     "http://x:80/y",
+		"g":     "quoted",
+		"h":     "",
+		"token": "4222",
+		"port":  int64(80),
+	}
+	if !reflect.DeepEqual(m, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, ex)
+	}
+}
+
+func TestBinderNotAMap(t *testing.T) {
+	m := map[string]any{"server": "x"}
+	b := NewBinder().BindEnv("APP_")
+	b.environ = func() []string { return []string{"APP_SERVER__PORT=1"} }
+	if err := b.Apply(m); err == nil {
+		t.Fatal("Expected error overriding a key below a scalar")
+	}
+}
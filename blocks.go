@@ -0,0 +1,60 @@
+package conf
+
+// WithRepeatedBlocks collects the maps set more than once for the same key
+// into an array, instead of the later one replacing the earlier one, for
+// configs that repeat a block for every listener or upstream:
+//
+//	server { listen: 80 }
+//	server { listen: 443 }
+//
+// parses to server: [{listen: 80}, {listen: 443}]. A key set once holds
+// its map as usual. Values other than maps, and maps set for a key that
+// holds an array written in the config, replace the value as usual.
+func WithRepeatedBlocks() Option {
+	return func(o *options) {
+		o.repeatedBlocks = true
+	}
+}
+
+// collects reports whether val, set for the key at path holding prev, is
+// collected with it as a repeated block.
+func (p *parser) collects(path string, prev, val any) bool {
+	if !p.opts.repeatedBlocks {
+		return false
+	}
+	if _, ok := plainValue(val).(map[string]any); !ok {
+		return false
+	}
+	switch plainValue(prev).(type) {
+	case map[string]any:
+		return true
+	case []any:
+		return p.state.blocks[path]
+	}
+	return false
+}
+
+// collectBlock returns the value to set for key, at path in ctx, when
+// repeated blocks are collected: val itself, or the array of the maps set
+// for key so far ending in val.
+func (p *parser) collectBlock(ctx map[string]any, path, key string, val any) any {
+	prev, ok := ctx[key]
+	if !ok || !p.collects(path, prev, val) {
+		return val
+	}
+	var blocks []any
+	switch pv := plainValue(prev).(type) {
+	case map[string]any:
+		blocks = []any{prev, val}
+	case []any:
+		blocks = append(pv, val)
+	}
+	if p.state.blocks == nil {
+		p.state.blocks = make(map[string]bool)
+	}
+	p.state.blocks[path] = true
+	if tk, ok := val.(*Token); ok {
+		return &Token{item: tk.item, value: blocks, sourceFile: tk.sourceFile}
+	}
+	return blocks
+}
@@ -0,0 +1,63 @@
+package conf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRepeatedBlocks(t *testing.T) {
+	for _, tc := range []struct {
+		name, data string
+		expected   map[string]any
+	}{
+		{"once", "server { listen: 80 }", map[string]any{
+			"server": map[string]any{"listen": int64(80)},
+		}},
+		{"repeated", "server { listen: 80 }\nserver { listen: 443 }\nserver { listen: 8080 }", map[string]any{
+			"server": []any{
+				map[string]any{"listen": int64(80)},
+				map[string]any{"listen": int64(443)},
+				map[string]any{"listen": int64(8080)},
+			},
+		}},
+		{"nested", "http { upstream { host: a }\nupstream = { host: b } }", map[string]any{
+			"http": map[string]any{"upstream": []any{
+				map[string]any{"host": "a"},
+				map[string]any{"host": "b"},
+			}},
+		}},
+		{"scalars", "port = 1\nport = 2", map[string]any{"port": int64(2)}},
+		{"written array", "server = [{listen: 80}]\nserver { listen: 443 }", map[string]any{
+			"server": map[string]any{"listen": int64(443)},
+		}},
+		{"replaced by scalar", "server { listen: 80 }\nserver { listen: 443 }\nserver = off", map[string]any{
+			"server": false,
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := Parse(tc.data, WithRepeatedBlocks())
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(m, tc.expected) {
+				t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, tc.expected)
+			}
+		})
+	}
+
+	m, err := Parse("server { listen: 80 }\nserver { listen: 443 }")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := map[string]any{"listen": int64(443)}; !reflect.DeepEqual(m["server"], expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m["server"], expected)
+	}
+
+	m, err = ParseWithChecks("server { listen: 80 }\nserver { listen: 443 }", WithRepeatedBlocks())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if v, ok := Lookup(m, "server[1].listen"); !ok || stripValue(v) != int64(443) {
+		t.Fatalf("Unexpected config: %+v", m)
+	}
+}
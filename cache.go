@@ -0,0 +1,175 @@
+package conf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// IncludeCache stores parsed include files so repeated parses (reload loops,
+// many files including the same base config) can skip re-parsing them.
+//
+// A cache should only be shared by parses using the same options. Includes
+// that look up environment variables or call functions other than file(),
+// directly or in the files they include, are not cached, so every parse
+// evaluates them again.
+type IncludeCache interface {
+	// Get returns the cached include for key. Entries that are Stale must
+	// not be returned, the parse uses whatever Get returns.
+	Get(key IncludeKey) (*CachedInclude, bool)
+	Put(key IncludeKey, ci *CachedInclude)
+}
+
+// IncludeKey identifies a cached include file.
+type IncludeKey struct {
+	// Path is the absolute path of the include file.
+	Path string
+	// Pedantic is set when the include was parsed with checks, in which
+	// case the cached values are tokens.
+	Pedantic bool
+	// Options identifies the options the include was parsed with that
+	// change its values, such as the key normalizer, the environment
+	// policy or the decryptor, so parses with other options sharing the
+	// cache parse the include themselves.
+	Options string
+}
+
+// CachedInclude is the parsed result of an include file.
+type CachedInclude struct {
+	Mapping map[string]any
+
+	// Value is set instead of Mapping for include files holding a single
+	// value, such as a bare array.
+	Value any
+
+	// Deps maps the include file and every file it includes in turn to
+	// the hash of their contents when they were parsed.
+	Deps map[string]string
+
+	// bytes, includes and keys count what the include read and set,
+	// including the files it includes in turn, for the limits and stats
+	// of parses hitting it.
+	bytes    int64
+	includes int
+	keys     int
+
+	// secrets are the values the include decrypted or read with file().
+	secrets []string
+}
+
+// Stale reports whether any of the files the include was built from
+// changed on disk since it was parsed. Optional includes that were missing
+// are recorded with an empty hash and make it stale once they exist.
+func (ci *CachedInclude) Stale() bool {
+	for fp, sum := range ci.Deps {
+		data, err := os.ReadFile(fp)
+		if sum == "" && errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil || hashData(data) != sum {
+			return true
+		}
+	}
+	return false
+}
+
+// CacheStats reports the usage of a MemoryCache.
+type CacheStats struct {
+	Hits    uint64
+	Misses  uint64
+	Entries int
+}
+
+// MemoryCache is an in-memory IncludeCache safe for concurrent use.
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[IncludeKey]*CachedInclude
+	hits    atomic.Uint64
+	misses  atomic.Uint64
+}
+
+// NewIncludeCache returns an empty in-memory include cache.
+func NewIncludeCache() *MemoryCache {
+	return &MemoryCache{entries: make(map[IncludeKey]*CachedInclude)}
+}
+
+// Get returns the cached include for key. Entries whose files changed
+// since they were cached are dropped and reported as a miss.
+func (c *MemoryCache) Get(key IncludeKey) (*CachedInclude, bool) {
+	c.mu.Lock()
+	ci, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && ci.Stale() {
+		c.mu.Lock()
+		delete(c.entries, key)
+		c.mu.Unlock()
+		ok = false
+	}
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.hits.Add(1)
+	return ci, true
+}
+
+// Put stores the parsed include under key.
+func (c *MemoryCache) Put(key IncludeKey, ci *CachedInclude) {
+	c.mu.Lock()
+	c.entries[key] = ci
+	c.mu.Unlock()
+}
+
+// Stats returns the cache hit and miss counters.
+func (c *MemoryCache) Stats() CacheStats {
+	c.mu.Lock()
+	n := len(c.entries)
+	c.mu.Unlock()
+	return CacheStats{
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+		Entries: n,
+	}
+}
+
+func hashData(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// deepCopyMap returns a copy of m that shares no maps, arrays or tokens
+// with the original.
+func deepCopyMap(m map[string]any) map[string]any {
+	if m == nil {
+		return nil
+	}
+	cp := make(map[string]any, len(m))
+	for k, v := range m {
+		cp[k] = deepCopy(v)
+	}
+	return cp
+}
+
+func deepCopy(v any) any {
+	switch vv := v.(type) {
+	case map[string]any:
+		return deepCopyMap(vv)
+	case []any:
+		cp := make([]any, len(vv))
+		for i, e := range vv {
+			cp[i] = deepCopy(e)
+		}
+		return cp
+	case []byte:
+		return append([]byte(nil), vv...)
+	case *Token:
+		tk := *vv
+		tk.value = deepCopy(vv.value)
+		return &tk
+	}
+	return v
+}
@@ -0,0 +1,149 @@
+package conf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIncludeCache(t *testing.T) {
+	dir := t.TempDir()
+	main := filepath.Join(dir, "main.conf")
+	base := filepath.Join(dir, "base.conf")
+	if err := os.WriteFile(main, []byte("include 'base.conf'\nname = main"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(base, []byte("port = 4222\nopts { debug = true }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := NewIncludeCache()
+	for i := 0; i < 3; i++ {
+		m, err := ParseFile(main, WithIncludeCache(cache))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if m["port"] != int64(4222) {
+			t.Fatalf("Expected port 4222, got %v", m["port"])
+		}
+		// Mutating the result must not leak into the cache.
+		m["opts"].(map[string]any)["debug"] = false
+	}
+	if st := cache.Stats(); st.Hits != 2 || st.Misses != 1 || st.Entries != 1 {
+		t.Fatalf("Unexpected cache stats: %+v", st)
+	}
+
+	if err := os.WriteFile(base, []byte("port = 4223"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := ParseFile(main, WithIncludeCache(cache))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m["port"] != int64(4223) {
+		t.Fatalf("Expected stale include to be reparsed, got %v", m["port"])
+	}
+	if st := cache.Stats(); st.Misses != 2 {
+		t.Fatalf("Expected stale entry to count as a miss: %+v", st)
+	}
+}
+
+func TestIncludeCacheNestedStale(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.conf": "include 'mid.conf'",
+		"mid.conf":  "include 'leaf.conf'",
+		"leaf.conf": "val = 1",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cache := NewIncludeCache()
+	main := filepath.Join(dir, "main.conf")
+	if _, err := ParseFile(main, WithIncludeCache(cache)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "leaf.conf"), []byte("val = 2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := ParseFile(main, WithIncludeCache(cache))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m["val"] != int64(2) {
+		t.Fatalf("Expected nested include change to be picked up, got %v", m["val"])
+	}
+}
+
+func TestIncludeCacheOptionalCreated(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.conf": "include 'mid.conf'",
+		"mid.conf":  "val = 1\ninclude? 'local.conf'",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cache := NewIncludeCache()
+	main := filepath.Join(dir, "main.conf")
+	for i := 0; i < 2; i++ {
+		if _, err := ParseFile(main, WithIncludeCache(cache)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if s := cache.Stats(); s.Hits != 1 {
+		t.Fatalf("Expected missing optional include to be cacheable, got %+v", s)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "local.conf"), []byte("val = 2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := ParseFile(main, WithIncludeCache(cache))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m["val"] != int64(2) {
+		t.Fatalf("Expected created optional include to be picked up, got %v", m["val"])
+	}
+}
+
+func TestIncludeCacheOptions(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "base.conf"), []byte("Size = 1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	main := filepath.Join(root, "main.conf")
+	if err := os.WriteFile(main, []byte("include '../base.conf'"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := NewIncludeCache()
+	if _, err := ParseFile(main, WithIncludeCache(cache)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	m, err := ParseFile(main, WithIncludeCache(cache), WithKeyNormalizer(strings.ToLower))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := map[string]any{"size": int64(1)}; !reflect.DeepEqual(m, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, expected)
+	}
+	if s := cache.Stats(); s.Hits != 0 {
+		t.Fatalf("Expected parses with other options not to share entries, got %+v", s)
+	}
+
+	// The include is cached now, but still outside the root.
+	if _, err := ParseFile(main, WithIncludeCache(cache), WithIncludeRoot(root)); !errors.Is(err, ErrOutsideRoot) {
+		t.Fatalf("Expected include outside the root to fail, got %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package conf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Checksum returns a stable hash of the values of a parsed config, as a
+// hex encoded SHA-256. It covers the effective config, after includes
+// were merged and variables resolved, so configs written differently but
+// holding the same values, such as with keys in another order or a size
+// of 1k instead of 1000, have the same checksum. Values of different
+// types, such as the integer 1 and the string "1", hash differently.
+// Positions of tokens from a parse with checks are ignored.
+//
+// Services can report the checksum as the version of the config they
+// run, and skip reloads that do not change it.
+func Checksum(m map[string]any) string {
+	h := sha256.New()
+	hashValue(h, m)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hashValue writes v to h, tagged with its type and prefixed with its
+// length where needed, so distinct values never write the same bytes.
+func hashValue(h hash.Hash, v any) {
+	v = plainValue(v)
+	if n, ok := unitValue(v); ok {
+		v = n
+	}
+	write := func(tag byte, s string) {
+		fmt.Fprintf(h, "%c%d:%s", tag, len(s), s)
+	}
+	switch vv := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(vv))
+		for k := range vv {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(h, "m%d:", len(keys))
+		for _, k := range keys {
+			write('k', k)
+			hashValue(h, vv[k])
+		}
+	case []any:
+		fmt.Fprintf(h, "a%d:", len(vv))
+		for _, e := range vv {
+			hashValue(h, e)
+		}
+	case string:
+		write('s', vv)
+	case int64:
+		write('i', strconv.FormatInt(vv, 10))
+	case float64:
+		write('f', strconv.FormatUint(math.Float64bits(vv), 16))
+	case bool:
+		write('b', strconv.FormatBool(vv))
+	case time.Time:
+		write('t', vv.UTC().Format(time.RFC3339Nano))
+	case []byte:
+		write('x', string(vv))
+	case nil:
+		h.Write([]byte{'n'})
+	default:
+		write('?', fmt.Sprintf("%T:%v", vv, vv))
+	}
+}
@@ -0,0 +1,86 @@
+package conf
+
+import "testing"
+
+func TestChecksum(t *testing.T) {
+	sum := func(data string) string {
+		t.Helper()
+		m, err := Parse(data, WithStripVariables())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return Checksum(m)
+	}
+
+	base := sum("port = 4222\nhost = localhost\ncluster { routes = [a, b] }\nmax = 1k")
+	same := []string{
+		"host: localhost, port: 4222, max: 1000, cluster: {routes: [a, b]}",
+		"port = 4222\nmax = 1000\nhost = \"localhost\"\ncluster { routes = [\n  a\n  b\n] }",
+		"p = 4222\nport = $p\nhost = localhost\ncluster { routes = [a, b] }\nmax = 1k",
+	}
+	for _, data := range same {
+		if got := sum(data); got != base {
+			t.Fatalf("Mismatch for %q:\nReceived: '%+v'\nExpected: '%+v'\n", data, got, base)
+		}
+	}
+
+	different := []string{
+		"port = 4223\nhost = localhost\ncluster { routes = [a, b] }\nmax = 1k",
+		"port = \"4222\"\nhost = localhost\ncluster { routes = [a, b] }\nmax = 1k",
+		"port = 4222\nhost = localhost\ncluster { routes = [b, a] }\nmax = 1k",
+		"port = 4222\nhost = localhost\ncluster { routes = [\"a, b\"] }\nmax = 1k",
+		"port = 4222\nhost = localhost\ncluster { routes = [a, b] }",
+	}
+	for _, data := range different {
+		if got := sum(data); got == base {
+			t.Fatalf("Expected a different checksum for %q", data)
+		}
+	}
+
+	m, err := ParseWithChecks("port = 4222\nhost = localhost\ncluster { routes = [a, b] }\nmax = 1k")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := Checksum(m); got != base {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", got, base)
+	}
+}
+
+func TestStoreChecksum(t *testing.T) {
+	docs := []string{"port = 4222", "port: 4222", "port = 4333"}
+	s, err := NewStoreFunc(func() (map[string]any, error) {
+		m, err := Parse(docs[0])
+		docs = docs[1:]
+		return m, err
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	first := s.Checksum()
+	if first != Checksum(s.Load()) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", first, Checksum(s.Load()))
+	}
+
+	notified := 0
+	s.Subscribe(func([]Change) { notified++ })
+	changes, err := s.Reload()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(changes) != 0 || notified != 0 || s.Checksum() != first {
+		t.Fatalf("Unexpected no-op reload: %+v", changes)
+	}
+	if len(s.History()) != 1 {
+		t.Fatalf("Expected the no-op reload to keep the current version")
+	}
+
+	if _, err := s.Reload(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if notified != 1 || s.Checksum() == first {
+		t.Fatalf("Expected the reload to change the checksum")
+	}
+	if h := s.History(); h[len(h)-1].Checksum != s.Checksum() {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", h[len(h)-1].Checksum, s.Checksum())
+	}
+}
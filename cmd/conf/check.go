@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	conf "github.com/ninepeach/go-conf"
+)
+
+const checkUsage = "check file.conf..."
+
+// runCheck tests that each file parses, includes and variables resolved,
+// and matches its schema blocks and sidecar schema file, as a service would
+// load it, before the file is deployed. Warnings are printed but do not
+// fail the check.
+func runCheck(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(stderr, "usage: conf", checkUsage)
+		return 2
+	}
+
+	status := 0
+	for _, fp := range fs.Args() {
+		r, err := conf.Load(fp)
+		if err != nil {
+			fmt.Fprintf(stderr, "conf check: %v\n", err)
+			status = 1
+			continue
+		}
+		for _, w := range r.Warnings {
+			fmt.Fprintf(stderr, "conf check: warning: %s\n", w)
+		}
+		fmt.Fprintf(stdout, "%s: ok\n", fp)
+	}
+	return status
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+
+	conf "github.com/ninepeach/go-conf"
+)
+
+const diffUsage = "diff [-format text|json] old.conf new.conf"
+
+// jsonChange is a conf.Change as written by conf diff -format json.
+type jsonChange struct {
+	Kind string `json:"kind"`
+	Path string `json:"path"`
+	Old  any    `json:"old,omitempty"`
+	New  any    `json:"new,omitempty"`
+}
+
+// runDiff prints the changes between the effective values of two files,
+// with includes and variables resolved.
+func runDiff(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	format := fs.String("format", "text", "output `format`, text or json")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 || (*format != "text" && *format != "json") {
+		fmt.Fprintln(stderr, "usage: conf", diffUsage)
+		return 2
+	}
+
+	var maps [2]map[string]any
+	for i, fp := range fs.Args() {
+		m, err := conf.ParseFile(fp)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		maps[i] = m
+	}
+	changes := conf.Diff(maps[0], maps[1])
+
+	if *format == "json" {
+		out := make([]jsonChange, len(changes))
+		for i, c := range changes {
+			out[i] = jsonChange{Kind: c.Kind.String(), Path: c.Path, Old: c.Old, New: c.New}
+		}
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+	} else {
+		for _, c := range changes {
+			fmt.Fprintln(stdout, c)
+		}
+	}
+	if len(changes) > 0 {
+		return 1
+	}
+	return 0
+}
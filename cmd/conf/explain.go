@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	conf "github.com/ninepeach/go-conf"
+)
+
+const explainUsage = "explain key.path file.conf"
+
+// runExplain prints the value of a key, where it was set and how it was
+// resolved.
+func runExplain(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("explain", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fmt.Fprintln(stderr, "usage: conf", explainUsage)
+		return 2
+	}
+	m, err := conf.ParseFileWithChecks(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	e, err := conf.Explain(m, fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	fmt.Fprint(stdout, e)
+	return 0
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	conf "github.com/ninepeach/go-conf"
+)
+
+const lintUsage = "lint [-disable rule,...] file..."
+
+// runLint checks each file with the default lint rules and prints the
+// findings.
+func runLint(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	disable := fs.String("disable", "", "comma separated `rules` not to check")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(stderr, "usage: conf", lintUsage)
+		return 2
+	}
+
+	skip := make(map[string]bool)
+	for _, name := range strings.Split(*disable, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			skip[name] = true
+		}
+	}
+	var rules []conf.Rule
+	for _, r := range conf.DefaultRules {
+		if skip[r.Name()] {
+			delete(skip, r.Name())
+			continue
+		}
+		rules = append(rules, r)
+	}
+	for name := range skip {
+		fmt.Fprintf(stderr, "conf lint: unknown rule %q\n", name)
+		return 2
+	}
+	if len(rules) == 0 {
+		return 0
+	}
+
+	status := 0
+	for _, fp := range fs.Args() {
+		m, err := conf.ParseFileWithChecks(fp)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			status = 2
+			continue
+		}
+		for _, f := range conf.Lint(m, rules...) {
+			fmt.Fprintln(stdout, f)
+			if status == 0 {
+				status = 1
+			}
+		}
+	}
+	return status
+}
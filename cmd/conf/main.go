@@ -0,0 +1,62 @@
+// Command conf checks and inspects config files.
+//
+// Usage:
+//
+//	conf <command> [flags] [args]
+//
+// Run conf without arguments for the list of commands. Commands exit with
+// status 1 when they find problems or differences and 2 on usage or parse
+// errors.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+type command struct {
+	usage string
+	run   func(args []string, stdout, stderr io.Writer) int
+}
+
+var commands = map[string]command{
+	"check":   {checkUsage, runCheck},
+	"diff":    {diffUsage, runDiff},
+	"explain": {explainUsage, runExplain},
+	"lint":    {lintUsage, runLint},
+	"merge":   {mergeUsage, runMerge},
+	"watch":   {watchUsage, runWatch},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "conf: unknown command %q\n", args[0])
+		usage(stderr)
+		return 2
+	}
+	return cmd.run(args[1:], stdout, stderr)
+}
+
+func usage(w io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(w, "usage: conf <command> [flags] [args]")
+	fmt.Fprintln(w, "\ncommands:")
+	for _, name := range names {
+		fmt.Fprintf(w, "  conf %s\n", commands[name].usage)
+	}
+}
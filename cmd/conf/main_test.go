@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// runConf runs the command line and returns its exit status and output.
+func runConf(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	status := run(args, &stdout, &stderr)
+	return status, stdout.String(), stderr.String()
+}
+
+func writeFile(t *testing.T, dir, name, data string) string {
+	t.Helper()
+	fp := filepath.Join(dir, name)
+	if err := os.WriteFile(fp, []byte(data), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return fp
+}
+
+func TestUsage(t *testing.T) {
+	status, _, stderr := runConf(t)
+	if status != 2 || !strings.Contains(stderr, "conf lint") {
+		t.Fatalf("Unexpected usage output with status %d:\n%s", status, stderr)
+	}
+	status, _, stderr = runConf(t, "bogus")
+	if status != 2 || !strings.Contains(stderr, `unknown command "bogus"`) {
+		t.Fatalf("Unexpected output with status %d:\n%s", status, stderr)
+	}
+}
+
+func TestLint(t *testing.T) {
+	dir := t.TempDir()
+	clean := writeFile(t, dir, "clean.conf", "port = 4222\n")
+	dirty := writeFile(t, dir, "dirty.conf", "port = 4222\nport = 4333\ndebug = \"true\"\n")
+	broken := writeFile(t, dir, "broken.conf", "port = [\n")
+
+	if status, stdout, _ := runConf(t, "lint", clean); status != 0 || stdout != "" {
+		t.Fatalf("Unexpected output with status %d:\n%s", status, stdout)
+	}
+
+	status, stdout, _ := runConf(t, "lint", dirty)
+	if status != 1 {
+		t.Fatalf("Expected status 1, got %d", status)
+	}
+	expected := "port: key was already set at " + dirty + ":1:0 [duplicate-keys] (" + dirty + ":2:1)\n" +
+		"debug: string 'true' reads as a bool, remove the quotes if a bool is meant [suspicious-bools] (" + dirty + ":3:1)\n"
+	if stdout != expected {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", stdout, expected)
+	}
+
+	if status, stdout, _ := runConf(t, "lint", "-disable", "duplicate-keys,suspicious-bools", dirty); status != 0 || stdout != "" {
+		t.Fatalf("Unexpected output with status %d:\n%s", status, stdout)
+	}
+	if status, _, stderr := runConf(t, "lint", "-disable", "bogus", dirty); status != 2 || !strings.Contains(stderr, `unknown rule "bogus"`) {
+		t.Fatalf("Unexpected output with status %d:\n%s", status, stderr)
+	}
+	if status, _, stderr := runConf(t, "lint", broken); status != 2 || stderr == "" {
+		t.Fatalf("Unexpected output with status %d:\n%s", status, stderr)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "limits.conf", "max_payload = 1MB\n")
+	a := writeFile(t, dir, "old.conf", "port = 4222\nhost = a\ninclude limits.conf\n")
+	b := writeFile(t, dir, "new.conf", "PORT = 4333\nport = $PORT\ndebug = true\nmax_payload = 1MB\n")
+
+	status, stdout, _ := runConf(t, "diff", a, b)
+	if status != 1 {
+		t.Fatalf("Expected status 1, got %d", status)
+	}
+	expected := "+ PORT = 4333\n+ debug = true\n- host = a\n~ port: 4222 -> 4333\n"
+	if stdout != expected {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", stdout, expected)
+	}
+
+	status, stdout, _ = runConf(t, "diff", "-format", "json", a, b)
+	if status != 1 {
+		t.Fatalf("Expected status 1, got %d", status)
+	}
+	for _, s := range []string{`"kind": "modified"`, `"path": "port"`, `"old": 4222`, `"new": 4333`, `"kind": "removed"`} {
+		if !strings.Contains(stdout, s) {
+			t.Fatalf("Expected %s in:\n%s", s, stdout)
+		}
+	}
+
+	if status, stdout, _ := runConf(t, "diff", a, a); status != 0 || stdout != "" {
+		t.Fatalf("Unexpected output with status %d:\n%s", status, stdout)
+	}
+	if status, stdout, _ := runConf(t, "diff", "--format=json", a, a); status != 0 || stdout != "[]\n" {
+		t.Fatalf("Unexpected output with status %d:\n%s", status, stdout)
+	}
+	if status, _, _ := runConf(t, "diff", "-format", "yaml", a, b); status != 2 {
+		t.Fatalf("Expected status 2, got %d", status)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	dir := t.TempDir()
+	base := writeFile(t, dir, "base.conf", "port = 4222\nroutes = [a, b]\ntls { cert = base.pem; key = base.key }\n")
+	prod := writeFile(t, dir, "prod.conf", "routes = [b, c]\ntls { cert = prod.pem }\n")
+
+	status, stdout, stderr := runConf(t, "merge", base, prod)
+	if status != 0 {
+		t.Fatalf("Unexpected status %d: %s", status, stderr)
+	}
+	expected := "port: 4222\nroutes: [\n  \"b\"\n  \"c\"\n]\ntls {\n  cert: \"prod.pem\"\n  key: \"base.key\"\n}\n"
+	if stdout != expected {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", stdout, expected)
+	}
+
+	out := filepath.Join(dir, "out.conf")
+	if status, _, stderr := runConf(t, "merge", "--array-strategy", "unique", "-o", out, base, prod); status != 0 {
+		t.Fatalf("Unexpected status %d: %s", status, stderr)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(string(data), "routes: [\n  \"a\"\n  \"b\"\n  \"c\"\n]\n") {
+		t.Fatalf("Expected unique routes in:\n%s", data)
+	}
+
+	if status, _, stderr := runConf(t, "merge", "-array-strategy", "bogus", base); status != 2 || !strings.Contains(stderr, "unknown array strategy") {
+		t.Fatalf("Unexpected output with status %d:\n%s", status, stderr)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	dir := t.TempDir()
+	fp := writeFile(t, dir, "server.conf", "PORT = 4333\nserver {\n  port = 4222\n  port = $PORT\n}\n")
+
+	status, stdout, stderr := runConf(t, "explain", "server.port", fp)
+	if status != 0 {
+		t.Fatalf("Unexpected status %d: %s", status, stderr)
+	}
+	expected := "server.port = 4333\n" +
+		"  set at " + fp + ":4:3\n" +
+		"  from $PORT defined at " + fp + ":1:0\n" +
+		"  overrides 4222 set at " + fp + ":3:3\n"
+	if stdout != expected {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", stdout, expected)
+	}
+
+	if status, _, stderr := runConf(t, "explain", "server.host", fp); status != 1 || !strings.Contains(stderr, "not set") {
+		t.Fatalf("Unexpected output with status %d:\n%s", status, stderr)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	fp := writeFile(t, dir, "server.conf", "port = 4222\n")
+	out := filepath.Join(dir, "hook.out")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ready := make(chan struct{})
+	defer func(orig func() (context.Context, context.CancelFunc)) { watchContext = orig }(watchContext)
+	watchContext = func() (context.Context, context.CancelFunc) {
+		close(ready)
+		return ctx, cancel
+	}
+
+	var stdout, stderr syncBuffer
+	done := make(chan int)
+	go func() {
+		done <- run([]string{"watch", "-interval", "5ms", "-pid", "42", "-exec", "echo reload %p %f >> " + out, fp}, &stdout, &stderr)
+	}()
+	<-ready
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for %s, stderr:\n%s", what, stderr.String())
+			}
+		}
+	}
+
+	// Edits are renamed into place so the watch never sees them half
+	// written.
+	edit := func(data string) {
+		t.Helper()
+		if err := os.Rename(writeFile(t, dir, "server.conf.tmp", data), fp); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	// A broken edit never runs the hook.
+	edit("port = [\n")
+	waitFor("the parse error", func() bool { return strings.Contains(stderr.String(), "keeping the current config") })
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Fatalf("Expected the hook not to run, got %v", err)
+	}
+
+	edit("port = 4333\n")
+	waitFor("the hook", func() bool {
+		data, _ := os.ReadFile(out)
+		return len(data) > 0
+	})
+	cancel()
+	if status := <-done; status != 0 {
+		t.Fatalf("Unexpected status %d: %s", status, stderr.String())
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := "reload 42 " + fp + "\n"; string(data) != expected {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", string(data), expected)
+	}
+	if !strings.Contains(stdout.String(), "port") {
+		t.Fatalf("Expected the changes in the output, got:\n%s", stdout.String())
+	}
+
+	if status, _, stderr := runConf(t, "watch", "-exec", "kill -HUP %p", fp); status != 2 || !strings.Contains(stderr, "-pid") {
+		t.Fatalf("Unexpected output with status %d:\n%s", status, stderr)
+	}
+}
+
+func TestRunHook(t *testing.T) {
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "it's $(touch pwned) a.conf")
+	out := filepath.Join(dir, "hook.out")
+	hook := `cd ` + shellQuote(dir) + ` && printf '%s|%s' %f "$CONF_FILE" > ` + shellQuote(out)
+	var stdout, stderr bytes.Buffer
+	if err := runHook(hook, fp, 0, "", &stdout, &stderr); err != nil {
+		t.Fatalf("Unexpected error: %v: %s", err, stderr.String())
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := fp + "|" + fp; string(data) != expected {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", string(data), expected)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pwned")); !os.IsNotExist(err) {
+		t.Fatalf("Expected the file name not to run as a command, got %v", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	good := writeFile(t, dir, "good.conf", "port = 4222\n")
+	writeFile(t, dir, "typed.schema", "port: int\n")
+	typed := writeFile(t, dir, "typed.conf", "port = \"4222\"\n")
+	broken := writeFile(t, dir, "broken.conf", "port = [\n")
+
+	status, stdout, _ := runConf(t, "check", good)
+	if expected := good + ": ok\n"; status != 0 || stdout != expected {
+		t.Fatalf("Mismatch with status %d:\nReceived: '%+v'\nExpected: '%+v'\n", status, stdout, expected)
+	}
+	status, stdout, stderr := runConf(t, "check", typed, broken, good)
+	if status != 1 || stdout != good+": ok\n" || strings.Count(stderr, "conf check: ") != 2 || !strings.Contains(stderr, typed) {
+		t.Fatalf("Unexpected output with status %d:\n%s%s", status, stdout, stderr)
+	}
+	if status, _, _ := runConf(t, "check"); status != 2 {
+		t.Fatalf("Expected status 2, got %d", status)
+	}
+}
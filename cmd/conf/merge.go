@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	conf "github.com/ninepeach/go-conf"
+)
+
+const mergeUsage = "merge [-array-strategy replace|append|unique] [-o out.conf] file..."
+
+var arrayStrategies = []conf.ArrayStrategy{conf.ArrayReplace, conf.ArrayAppend, conf.ArrayUnique}
+
+// runMerge merges the files in order, later files taking precedence, and
+// writes the result in the conf format.
+func runMerge(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("merge", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	strategy := fs.String("array-strategy", conf.ArrayReplace.String(), "how to merge arrays, replace, append or unique")
+	out := fs.String("o", "", "write the result to `file` instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(stderr, "usage: conf", mergeUsage)
+		return 2
+	}
+	var opts []conf.Option
+	for _, s := range arrayStrategies {
+		if s.String() == *strategy {
+			opts = append(opts, conf.WithArrayStrategy(s))
+		}
+	}
+	if len(opts) == 0 {
+		fmt.Fprintf(stderr, "conf merge: unknown array strategy %q\n", *strategy)
+		return 2
+	}
+
+	m, err := conf.ParseFiles(fs.Args(), opts...)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	data, err := conf.Marshal(m)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if *out == "" {
+		stdout.Write(data)
+		return 0
+	}
+	if err := os.WriteFile(*out, data, 0o644); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	conf "github.com/ninepeach/go-conf"
+)
+
+const watchUsage = "watch [-interval d] [-exec cmd] [-pid n | -pidfile file] file.conf"
+
+// watchContext returns the context conf watch runs in, done on interrupt.
+var watchContext = func() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// runWatch reloads a file and its includes whenever they change and runs
+// the exec hook after every reload that changed the config. Edits that do
+// not parse are reported and never reach the hook.
+func runWatch(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	interval := fs.Duration("interval", time.Second, "how often to check the files for changes")
+	hook := fs.String("exec", "", "shell `command` to run after a reload, %p is replaced with the pid and %f with the quoted file, also in $CONF_FILE")
+	pid := fs.Int("pid", 0, "process `id` to replace %p with")
+	pidFile := fs.String("pidfile", "", "`file` to read the process id to replace %p with from")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 || *interval <= 0 || (*pid != 0 && *pidFile != "") {
+		fmt.Fprintln(stderr, "usage: conf", watchUsage)
+		return 2
+	}
+	if strings.Contains(*hook, "%p") && *pid == 0 && *pidFile == "" {
+		fmt.Fprintf(stderr, "conf watch: -exec uses %s but neither -pid nor -pidfile is set\n", "%p")
+		return 2
+	}
+	fp := fs.Arg(0)
+
+	s, err := conf.NewStore(fp)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	ctx, cancel := watchContext()
+	defer cancel()
+	s.Watch(ctx, *interval, func(changes []conf.Change, err error) {
+		if err != nil {
+			fmt.Fprintf(stderr, "conf watch: keeping the current config: %v\n", err)
+			return
+		}
+		if len(changes) == 0 {
+			return
+		}
+		for _, c := range changes {
+			fmt.Fprintln(stdout, c)
+		}
+		if *hook == "" {
+			return
+		}
+		if err := runHook(*hook, fp, *pid, *pidFile, stdout, stderr); err != nil {
+			fmt.Fprintf(stderr, "conf watch: %v\n", err)
+		}
+	})
+	return 0
+}
+
+// runHook runs the exec hook through the shell. The pid file is read on
+// every run, as the process may have been restarted in between. The file
+// is quoted for the shell, so names with spaces or $ stay one word, and is
+// passed in CONF_FILE as well.
+func runHook(hook, fp string, pid int, pidFile string, stdout, stderr io.Writer) error {
+	if pidFile != "" {
+		data, err := os.ReadFile(pidFile)
+		if err != nil {
+			return err
+		}
+		pid, err = strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			return fmt.Errorf("invalid pid in '%s': %v", pidFile, err)
+		}
+	}
+	cmd := strings.NewReplacer("%p", strconv.Itoa(pid), "%f", shellQuote(fp)).Replace(hook)
+	c := exec.Command("sh", "-c", cmd)
+	c.Env = append(os.Environ(), "CONF_FILE="+fp)
+	c.Stdout = stdout
+	c.Stderr = stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("hook '%s' failed: %v", cmd, err)
+	}
+	return nil
+}
+
+// shellQuote quotes s as a single word for sh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
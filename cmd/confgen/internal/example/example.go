@@ -0,0 +1,48 @@
+// Package example holds the types the decoders of confgen are tested with.
+package example
+
+import "time"
+
+//go:generate go run github.com/ninepeach/go-conf/cmd/confgen -type Server
+
+// Mode is a named string type.
+type Mode string
+
+// Ports is a named slice type.
+type Ports []uint16
+
+type Server struct {
+	Listen
+	Name       string
+	Mode       Mode
+	Debug      bool `conf:"verbose"`
+	MaxPayload int64
+	Workers    int
+	Ratio      float64
+	Timeout    time.Duration
+	Started    time.Time
+	Ports      Ports
+	TLS        *TLS
+	Routes     []Route
+	Limits     map[string]int32
+	Tags       map[string]any
+	Extra      any
+	Ignored    string `conf:"-"`
+	internal   string
+}
+
+type Listen struct {
+	Host string
+	Port int
+}
+
+type TLS struct {
+	Cert   string
+	Verify bool
+}
+
+type Route struct {
+	URL    string `conf:"url"`
+	Weight uint8
+	Hops   [][]string
+}
@@ -0,0 +1,131 @@
+package example
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	conf "github.com/ninepeach/go-conf"
+)
+
+func TestDecodeConf(t *testing.T) {
+	m, err := conf.Parse(`
+		host = localhost
+		port = 4222
+		name = "edge"
+		mode = fast
+		verbose = true
+		max_payload = 1MB
+		workers = 8
+		ratio = 1
+		timeout = "1m30s"
+		started = 2024-01-02T03:04:05Z
+		ports = [80, 443]
+		tls { cert = a.pem, verify = true }
+		routes = [{url: nats://a, weight: 2, hops: [[x, y], [z]]}]
+		limits { conns = 100 }
+		tags { team = core, tier = 1 }
+		extra = [1, two]
+		ignored = "set"
+		unknown = 1
+	`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	v := Server{Name: "default", Ignored: "kept"}
+	if err := v.DecodeConf(m); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := Server{
+		Listen:     Listen{Host: "localhost", Port: 4222},
+		Name:       "edge",
+		Mode:       "fast",
+		Debug:      true,
+		MaxPayload: 1 << 20,
+		Workers:    8,
+		Ratio:      1,
+		Timeout:    90 * time.Second,
+		Started:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Ports:      Ports{80, 443},
+		TLS:        &TLS{Cert: "a.pem", Verify: true},
+		Routes:     []Route{{URL: "nats://a", Weight: 2, Hops: [][]string{{"x", "y"}, {"z"}}}},
+		Limits:     map[string]int32{"conns": 100},
+		Tags:       map[string]any{"team": "core", "tier": int64(1)},
+		Extra:      []any{int64(1), "two"},
+		Ignored:    "kept",
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", v, expected)
+	}
+
+	// Tokens of a parse with checks decode the same.
+	m, err = conf.ParseWithChecks("name = edge\ntls { cert = a.pem }\nports = [80]")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	v = Server{}
+	if err := v.DecodeConf(m); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if v.Name != "edge" || v.TLS.Cert != "a.pem" || !reflect.DeepEqual(v.Ports, Ports{80}) {
+		t.Fatalf("Unexpected decoded value: %+v", v)
+	}
+}
+
+func TestDecodeConfErrors(t *testing.T) {
+	for _, test := range []struct {
+		data     string
+		expected string
+	}{
+		{"name = 1", "name: cannot decode integer '1' into string"},
+		{"ports = [80, 70000]", "ports[1]: cannot decode integer '70000' into uint16"},
+		{"ports = [-1]", "ports[0]: cannot decode integer '-1' into uint16"},
+		{"routes = [{weight: 256}]", "routes[0].weight: cannot decode integer '256' into uint8"},
+		{"tls = yes", "tls: cannot decode bool 'true' into map"},
+		{"timeout = 5", "timeout: cannot decode integer '5' into time.Duration"},
+		{"limits { 'a.b' = x }", "limits.\"a.b\": cannot decode string 'x' into int32"},
+	} {
+		m, err := conf.Parse(test.data)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		var v Server
+		err = v.DecodeConf(m)
+		if err == nil || err.Error() != test.expected {
+			t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", err, test.expected)
+		}
+	}
+}
+
+func TestMarshalStructRoundTrip(t *testing.T) {
+	v := Server{
+		Listen:     Listen{Host: "localhost", Port: 4222},
+		Name:       "edge",
+		Mode:       "fast",
+		MaxPayload: 1 << 20,
+		Ratio:      0.5,
+		Timeout:    90 * time.Second,
+		Started:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Ports:      Ports{80, 443},
+		TLS:        &TLS{Cert: "a.pem"},
+		Routes:     []Route{{URL: "nats://a", Weight: 2, Hops: [][]string{{"x"}}}},
+		Limits:     map[string]int32{"conns": 100},
+		Tags:       map[string]any{"team": "core"},
+		Extra:      "any",
+	}
+	data, err := conf.MarshalStruct(v)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	m, err := conf.Parse(string(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var got Server
+	if err := got.DecodeConf(m); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, v) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", got, v)
+	}
+}
@@ -0,0 +1,240 @@
+// Code generated by confgen; DO NOT EDIT.
+
+package example
+
+import (
+	"fmt"
+
+	conf "github.com/ninepeach/go-conf"
+)
+
+// DecodeConf sets the fields of v from the parsed config m.
+func (v *Server) DecodeConf(m map[string]any) error {
+	return decodeConfServer(v, m, "")
+}
+
+func decodeConfServer(v *Server, m map[string]any, path string) error {
+	if err := decodeConfListen(&v.Listen, m, path); err != nil {
+		return err
+	}
+	if x, ok := m["name"]; ok {
+		v1, err := conf.DecodeString(x, conf.JoinPath(path, "name"))
+		if err != nil {
+			return err
+		}
+		v.Name = v1
+	}
+	if x, ok := m["mode"]; ok {
+		v2, err := conf.DecodeString(x, conf.JoinPath(path, "mode"))
+		if err != nil {
+			return err
+		}
+		v.Mode = Mode(v2)
+	}
+	if x, ok := m["verbose"]; ok {
+		v3, err := conf.DecodeBool(x, conf.JoinPath(path, "verbose"))
+		if err != nil {
+			return err
+		}
+		v.Debug = v3
+	}
+	if x, ok := m["max_payload"]; ok {
+		v4, err := conf.DecodeInt(x, conf.JoinPath(path, "max_payload"), 64)
+		if err != nil {
+			return err
+		}
+		v.MaxPayload = v4
+	}
+	if x, ok := m["workers"]; ok {
+		v5, err := conf.DecodeInt(x, conf.JoinPath(path, "workers"), 32<<(^uint(0)>>63))
+		if err != nil {
+			return err
+		}
+		v.Workers = int(v5)
+	}
+	if x, ok := m["ratio"]; ok {
+		v6, err := conf.DecodeFloat(x, conf.JoinPath(path, "ratio"))
+		if err != nil {
+			return err
+		}
+		v.Ratio = v6
+	}
+	if x, ok := m["timeout"]; ok {
+		v7, err := conf.DecodeDuration(x, conf.JoinPath(path, "timeout"))
+		if err != nil {
+			return err
+		}
+		v.Timeout = v7
+	}
+	if x, ok := m["started"]; ok {
+		v8, err := conf.DecodeTime(x, conf.JoinPath(path, "started"))
+		if err != nil {
+			return err
+		}
+		v.Started = v8
+	}
+	if x, ok := m["ports"]; ok {
+		var v9 []uint16
+		v10 := conf.JoinPath(path, "ports")
+		v11, err := conf.DecodeArray(x, v10)
+		if err != nil {
+			return err
+		}
+		v12 := make([]uint16, len(v11))
+		for v13, e := range v11 {
+			v14, err := conf.DecodeUint(e, fmt.Sprintf("%s[%d]", v10, v13), 16)
+			if err != nil {
+				return err
+			}
+			v12[v13] = uint16(v14)
+		}
+		v9 = v12
+		v.Ports = Ports(v9)
+	}
+	if x, ok := m["tls"]; ok {
+		v15 := new(TLS)
+		v16 := conf.JoinPath(path, "tls")
+		v17, err := conf.DecodeMap(x, v16)
+		if err != nil {
+			return err
+		}
+		if err := decodeConfTLS(v15, v17, v16); err != nil {
+			return err
+		}
+		v.TLS = v15
+	}
+	if x, ok := m["routes"]; ok {
+		v18 := conf.JoinPath(path, "routes")
+		v19, err := conf.DecodeArray(x, v18)
+		if err != nil {
+			return err
+		}
+		v20 := make([]Route, len(v19))
+		for v21, e := range v19 {
+			v22 := fmt.Sprintf("%s[%d]", v18, v21)
+			v23, err := conf.DecodeMap(e, v22)
+			if err != nil {
+				return err
+			}
+			if err := decodeConfRoute(&v20[v21], v23, v22); err != nil {
+				return err
+			}
+		}
+		v.Routes = v20
+	}
+	if x, ok := m["limits"]; ok {
+		v24 := conf.JoinPath(path, "limits")
+		v25, err := conf.DecodeMap(x, v24)
+		if err != nil {
+			return err
+		}
+		v26 := make(map[string]int32, len(v25))
+		for v27, x := range v25 {
+			var v28 int32
+			v29, err := conf.DecodeInt(x, conf.JoinPath(v24, v27), 32)
+			if err != nil {
+				return err
+			}
+			v28 = int32(v29)
+			v26[v27] = v28
+		}
+		v.Limits = v26
+	}
+	if x, ok := m["tags"]; ok {
+		v30 := conf.JoinPath(path, "tags")
+		v31, err := conf.DecodeMap(x, v30)
+		if err != nil {
+			return err
+		}
+		v32 := make(map[string]any, len(v31))
+		for v33, x := range v31 {
+			var v34 any
+			v34 = conf.DecodeAny(x)
+			v32[v33] = v34
+		}
+		v.Tags = v32
+	}
+	if x, ok := m["extra"]; ok {
+		v.Extra = conf.DecodeAny(x)
+	}
+	return nil
+}
+
+func decodeConfListen(v *Listen, m map[string]any, path string) error {
+	if x, ok := m["host"]; ok {
+		v35, err := conf.DecodeString(x, conf.JoinPath(path, "host"))
+		if err != nil {
+			return err
+		}
+		v.Host = v35
+	}
+	if x, ok := m["port"]; ok {
+		v36, err := conf.DecodeInt(x, conf.JoinPath(path, "port"), 32<<(^uint(0)>>63))
+		if err != nil {
+			return err
+		}
+		v.Port = int(v36)
+	}
+	return nil
+}
+
+func decodeConfTLS(v *TLS, m map[string]any, path string) error {
+	if x, ok := m["cert"]; ok {
+		v37, err := conf.DecodeString(x, conf.JoinPath(path, "cert"))
+		if err != nil {
+			return err
+		}
+		v.Cert = v37
+	}
+	if x, ok := m["verify"]; ok {
+		v38, err := conf.DecodeBool(x, conf.JoinPath(path, "verify"))
+		if err != nil {
+			return err
+		}
+		v.Verify = v38
+	}
+	return nil
+}
+
+func decodeConfRoute(v *Route, m map[string]any, path string) error {
+	if x, ok := m["url"]; ok {
+		v39, err := conf.DecodeString(x, conf.JoinPath(path, "url"))
+		if err != nil {
+			return err
+		}
+		v.URL = v39
+	}
+	if x, ok := m["weight"]; ok {
+		v40, err := conf.DecodeUint(x, conf.JoinPath(path, "weight"), 8)
+		if err != nil {
+			return err
+		}
+		v.Weight = uint8(v40)
+	}
+	if x, ok := m["hops"]; ok {
+		v41 := conf.JoinPath(path, "hops")
+		v42, err := conf.DecodeArray(x, v41)
+		if err != nil {
+			return err
+		}
+		v43 := make([][]string, len(v42))
+		for v44, e := range v42 {
+			v45 := fmt.Sprintf("%s[%d]", v41, v44)
+			v46, err := conf.DecodeArray(e, v45)
+			if err != nil {
+				return err
+			}
+			v47 := make([]string, len(v46))
+			for v48, e := range v46 {
+				v49, err := conf.DecodeString(e, fmt.Sprintf("%s[%d]", v45, v48))
+				if err != nil {
+					return err
+				}
+				v47[v48] = v49
+			}
+			v43[v44] = v47
+		}
+		v.Hops = v43
+	}
+	return nil
+}
@@ -0,0 +1,420 @@
+// Command confgen generates decoders that set the fields of Go structs
+// from a parsed config without reflection, for services that reload their
+// config often and for targets such as tinygo and wasm where reflection is
+// costly.
+//
+// Usage:
+//
+//	confgen -type Server[,Type...] [-output file] [dir]
+//
+// confgen reads the package in dir, the current directory by default, and
+// writes a file, type_conf.go after the first type by default, with a
+// method for each type:
+//
+//	func (v *Server) DecodeConf(m map[string]any) error
+//
+// It is meant to be run by go generate:
+//
+//	//go:generate go run github.com/ninepeach/go-conf/cmd/confgen -type Server
+//
+// Fields are set from the key named by their conf tag, or from the snake
+// case of their name, such as max_payload for MaxPayload. Fields tagged
+// conf:"-" and unexported fields are skipped. The fields of embedded
+// structs are set from the keys of the struct embedding them. Keys missing
+// from the config leave their fields unchanged, so defaults can be set
+// before decoding, and keys without a field are ignored.
+//
+// Fields can be strings, bools, integers, floats, time.Duration from
+// strings such as "1m30s", time.Time, any, structs of the package, and
+// pointers, slices and maps with string keys of those, as well as named
+// types of the package based on them. Decoders of the structs of the
+// package used by the types are generated as well.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	conf "github.com/ninepeach/go-conf"
+)
+
+const usage = "usage: confgen -type Server[,Type...] [-output file] [dir]"
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stderr))
+}
+
+func run(args []string, stderr io.Writer) int {
+	fs := flag.NewFlagSet("confgen", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	typeNames := fs.String("type", "", "comma separated `names` of the struct types to generate decoders for")
+	output := fs.String("output", "", "output `file`, type_conf.go in dir by default")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *typeNames == "" || fs.NArg() > 1 {
+		fmt.Fprintln(stderr, usage)
+		return 2
+	}
+	dir := "."
+	if fs.NArg() == 1 {
+		dir = fs.Arg(0)
+	}
+	names := strings.Split(*typeNames, ",")
+	if *output == "" {
+		*output = filepath.Join(dir, strings.ToLower(names[0])+"_conf.go")
+	}
+
+	src, err := generate(dir, names, filepath.Base(*output))
+	if err != nil {
+		fmt.Fprintf(stderr, "confgen: %v\n", err)
+		return 1
+	}
+	if err := os.WriteFile(*output, src, 0o644); err != nil {
+		fmt.Fprintf(stderr, "confgen: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// generate returns the source of the decoders of the named types of the
+// package in dir, leaving out the file skip, a previous output.
+func generate(dir string, names []string, skip string) ([]byte, error) {
+	pkgName, types, err := loadTypes(dir, skip)
+	if err != nil {
+		return nil, err
+	}
+	g := &generator{types: types, done: make(map[string]bool)}
+	for _, name := range names {
+		if _, ok := types[name].(*ast.StructType); !ok {
+			return nil, fmt.Errorf("no struct type %s in %s", name, dir)
+		}
+		g.queue = append(g.queue, name)
+	}
+	for len(g.queue) > 0 {
+		name := g.queue[0]
+		g.queue = g.queue[1:]
+		if g.done[name] {
+			continue
+		}
+		g.done[name] = true
+		if err := g.decoder(name, types[name].(*ast.StructType)); err != nil {
+			return nil, err
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by confgen; DO NOT EDIT.\n\npackage %s\n\nimport (\n", pkgName)
+	if g.fmt {
+		out.WriteString("\t\"fmt\"\n")
+	}
+	if g.time {
+		out.WriteString("\t\"time\"\n")
+	}
+	out.WriteString("\n\tconf \"github.com/ninepeach/go-conf\"\n)\n")
+	for _, name := range names {
+		fmt.Fprintf(&out, `
+// DecodeConf sets the fields of v from the parsed config m.
+func (v *%s) DecodeConf(m map[string]any) error {
+	return decodeConf%s(v, m, "")
+}
+`, name, name)
+	}
+	out.Write(g.buf.Bytes())
+	return format.Source(out.Bytes())
+}
+
+// loadTypes returns the name of the package in dir and its type
+// declarations by name.
+func loadTypes(dir, skip string) (string, map[string]ast.Expr, error) {
+	fset := token.NewFileSet()
+	matches, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return "", nil, err
+	}
+	sort.Strings(matches)
+	var pkgName string
+	types := make(map[string]ast.Expr)
+	for _, fp := range matches {
+		base := filepath.Base(fp)
+		if base == skip || strings.HasSuffix(base, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, fp, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return "", nil, err
+		}
+		if pkgName == "" {
+			pkgName = f.Name.Name
+		}
+		for _, decl := range f.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				ts := spec.(*ast.TypeSpec)
+				if ts.TypeParams == nil {
+					types[ts.Name.Name] = ts.Type
+				}
+			}
+		}
+	}
+	if pkgName == "" {
+		return "", nil, fmt.Errorf("no Go files in %s", dir)
+	}
+	return pkgName, types, nil
+}
+
+// generator writes the decoders of struct types.
+type generator struct {
+	types map[string]ast.Expr
+	queue []string
+	done  map[string]bool
+	buf   bytes.Buffer
+	vars  int
+	// fmt and time are set when the decoders use these packages.
+	fmt  bool
+	time bool
+}
+
+// decoder writes the function decoding the struct type name.
+func (g *generator) decoder(name string, st *ast.StructType) error {
+	fmt.Fprintf(&g.buf, "\nfunc decodeConf%s(v *%s, m map[string]any, path string) error {\n", name, name)
+	for _, f := range st.Fields.List {
+		if len(f.Names) == 0 {
+			// Embedded structs are decoded from the same map.
+			id, ok := f.Type.(*ast.Ident)
+			if !ok {
+				return fmt.Errorf("%s: unsupported embedded field %s", name, exprString(f.Type))
+			}
+			if _, ok := g.types[id.Name].(*ast.StructType); !ok {
+				return fmt.Errorf("%s: unsupported embedded field %s", name, id.Name)
+			}
+			g.queue = append(g.queue, id.Name)
+			fmt.Fprintf(&g.buf, "if err := decodeConf%s(&v.%s, m, path); err != nil {\nreturn err\n}\n", id.Name, id.Name)
+			continue
+		}
+		key := ""
+		if f.Tag != nil {
+			tag := reflect.StructTag(strings.Trim(f.Tag.Value, "`"))
+			key, _, _ = strings.Cut(tag.Get("conf"), ",")
+		}
+		if key == "-" {
+			continue
+		}
+		for _, n := range f.Names {
+			if !n.IsExported() {
+				continue
+			}
+			k := key
+			if k == "" {
+				k = conf.SnakeCaseKeys(n.Name)
+			}
+			fmt.Fprintf(&g.buf, "if x, ok := m[%q]; ok {\n", k)
+			if err := g.value("v."+n.Name, f.Type, "x", fmt.Sprintf("conf.JoinPath(path, %q)", k)); err != nil {
+				return fmt.Errorf("%s.%s: %w", name, n.Name, err)
+			}
+			g.buf.WriteString("}\n")
+		}
+	}
+	g.buf.WriteString("return nil\n}\n")
+	return nil
+}
+
+// value writes the statements decoding the value src at the key path
+// path into dst, an addressable expression of type t.
+func (g *generator) value(dst string, t ast.Expr, src, path string) error {
+	switch tt := t.(type) {
+	case *ast.Ident:
+		return g.named(dst, tt.Name, tt.Name, src, path)
+	case *ast.SelectorExpr:
+		if pkg, ok := tt.X.(*ast.Ident); ok && pkg.Name == "time" {
+			switch tt.Sel.Name {
+			case "Duration":
+				g.decodeCall(dst, "", "conf.DecodeDuration(%s, %s)", src, path)
+				return nil
+			case "Time":
+				g.decodeCall(dst, "", "conf.DecodeTime(%s, %s)", src, path)
+				return nil
+			}
+		}
+	case *ast.InterfaceType:
+		if len(tt.Methods.List) == 0 {
+			fmt.Fprintf(&g.buf, "%s = conf.DecodeAny(%s)\n", dst, src)
+			return nil
+		}
+	case *ast.StarExpr:
+		ptr := g.newVar()
+		fmt.Fprintf(&g.buf, "%s := new(%s)\n", ptr, g.typeString(tt.X))
+		if err := g.value("*"+ptr, tt.X, src, path); err != nil {
+			return err
+		}
+		fmt.Fprintf(&g.buf, "%s = %s\n", dst, ptr)
+		return nil
+	case *ast.ArrayType:
+		if tt.Len != nil {
+			break
+		}
+		path = g.bind(path)
+		arr, s, i := g.newVar(), g.newVar(), g.newVar()
+		g.fmt = true
+		fmt.Fprintf(&g.buf, "%s, err := conf.DecodeArray(%s, %s)\nif err != nil {\nreturn err\n}\n", arr, src, path)
+		fmt.Fprintf(&g.buf, "%s := make(%s, len(%s))\n", s, g.typeString(tt), arr)
+		fmt.Fprintf(&g.buf, "for %s, e := range %s {\n", i, arr)
+		if err := g.value(fmt.Sprintf("%s[%s]", s, i), tt.Elt, "e", fmt.Sprintf("fmt.Sprintf(\"%%s[%%d]\", %s, %s)", path, i)); err != nil {
+			return err
+		}
+		fmt.Fprintf(&g.buf, "}\n%s = %s\n", dst, s)
+		return nil
+	case *ast.MapType:
+		if k, ok := tt.Key.(*ast.Ident); !ok || k.Name != "string" {
+			break
+		}
+		path = g.bind(path)
+		src2, mm, k, e := g.newVar(), g.newVar(), g.newVar(), g.newVar()
+		fmt.Fprintf(&g.buf, "%s, err := conf.DecodeMap(%s, %s)\nif err != nil {\nreturn err\n}\n", src2, src, path)
+		fmt.Fprintf(&g.buf, "%s := make(%s, len(%s))\n", mm, g.typeString(tt), src2)
+		fmt.Fprintf(&g.buf, "for %s, x := range %s {\nvar %s %s\n", k, src2, e, g.typeString(tt.Value))
+		if err := g.value(e, tt.Value, "x", fmt.Sprintf("conf.JoinPath(%s, %s)", path, k)); err != nil {
+			return err
+		}
+		fmt.Fprintf(&g.buf, "%s[%s] = %s\n}\n%s = %s\n", mm, k, e, dst, mm)
+		return nil
+	}
+	return fmt.Errorf("unsupported type %s", exprString(t))
+}
+
+// named writes the statements decoding into dst of the named type typ,
+// which is name or a type of the package based on it.
+func (g *generator) named(dst, typ, name, src, path string) error {
+	conv := ""
+	if typ != name {
+		conv = typ
+	}
+	switch name {
+	case "string":
+		g.decodeCall(dst, conv, "conf.DecodeString(%s, %s)", src, path)
+	case "bool":
+		g.decodeCall(dst, conv, "conf.DecodeBool(%s, %s)", src, path)
+	case "int", "int8", "int16", "int32", "int64":
+		if conv == "" && name != "int64" {
+			conv = name
+		}
+		g.decodeCall(dst, conv, "conf.DecodeInt(%s, %s, "+intBits(name)+")", src, path)
+	case "uint", "uint8", "uint16", "uint32", "uint64":
+		if conv == "" && name != "uint64" {
+			conv = name
+		}
+		g.decodeCall(dst, conv, "conf.DecodeUint(%s, %s, "+intBits(name)+")", src, path)
+	case "float32", "float64":
+		if conv == "" && name != "float64" {
+			conv = name
+		}
+		g.decodeCall(dst, conv, "conf.DecodeFloat(%s, %s)", src, path)
+	case "any":
+		fmt.Fprintf(&g.buf, "%s = conf.DecodeAny(%s)\n", dst, src)
+	default:
+		switch t := g.types[name].(type) {
+		case *ast.StructType:
+			if typ != name {
+				return fmt.Errorf("unsupported type %s", typ)
+			}
+			g.queue = append(g.queue, name)
+			path = g.bind(path)
+			m := g.newVar()
+			fmt.Fprintf(&g.buf, "%s, err := conf.DecodeMap(%s, %s)\nif err != nil {\nreturn err\n}\n", m, src, path)
+			fmt.Fprintf(&g.buf, "if err := decodeConf%s(%s, %s, %s); err != nil {\nreturn err\n}\n", name, addr(dst), m, path)
+		case *ast.Ident:
+			return g.named(dst, typ, t.Name, src, path)
+		case nil:
+			return fmt.Errorf("unsupported type %s", name)
+		default:
+			// Named slices, maps and pointers decode as their underlying
+			// type, converted on assignment.
+			tmp := g.newVar()
+			fmt.Fprintf(&g.buf, "var %s %s\n", tmp, g.typeString(t))
+			if err := g.value(tmp, t, src, path); err != nil {
+				return fmt.Errorf("unsupported type %s", typ)
+			}
+			fmt.Fprintf(&g.buf, "%s = %s(%s)\n", dst, typ, tmp)
+		}
+	}
+	return nil
+}
+
+// decodeCall writes a call of a conf.Decode function, the format call
+// with src and path, and the assignment of its result to dst, converted to
+// conv if set.
+func (g *generator) decodeCall(dst, conv, call, src, path string) {
+	x := g.newVar()
+	fmt.Fprintf(&g.buf, "%s, err := "+call+"\nif err != nil {\nreturn err\n}\n", x, src, path)
+	if conv != "" {
+		x = conv + "(" + x + ")"
+	}
+	fmt.Fprintf(&g.buf, "%s = %s\n", dst, x)
+}
+
+// bind writes the declaration of a variable holding the key path path,
+// computed once, and returns its name. A path that is a variable already
+// is returned as is.
+func (g *generator) bind(path string) string {
+	if token.IsIdentifier(path) {
+		return path
+	}
+	p := g.newVar()
+	fmt.Fprintf(&g.buf, "%s := %s\n", p, path)
+	return p
+}
+
+// addr returns the address of the addressable expression dst.
+func addr(dst string) string {
+	if ptr, ok := strings.CutPrefix(dst, "*"); ok {
+		return ptr
+	}
+	return "&" + dst
+}
+
+// newVar returns a new variable name.
+func (g *generator) newVar() string {
+	g.vars++
+	return fmt.Sprintf("v%d", g.vars)
+}
+
+// typeString returns the source of t, noting the packages it uses.
+func (g *generator) typeString(t ast.Expr) string {
+	s := exprString(t)
+	if strings.Contains(s, "time.") {
+		g.time = true
+	}
+	return s
+}
+
+// intBits returns the size in bits of the integer type name, as an
+// expression.
+func intBits(name string) string {
+	if bits := strings.TrimPrefix(strings.TrimPrefix(name, "u"), "int"); bits != "" {
+		return bits
+	}
+	// The size of int and uint depends on the platform.
+	return "32 << (^uint(0) >> 63)"
+}
+
+func exprString(t ast.Expr) string {
+	var buf bytes.Buffer
+	if err := format.Node(&buf, token.NewFileSet(), t); err != nil {
+		return fmt.Sprintf("%T", t)
+	}
+	return buf.String()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestGenerateExample fails when the decoders of the example package are
+// out of date, so changes to the generator are tested by its tests.
+func TestGenerateExample(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "server_conf.go")
+	var stderr bytes.Buffer
+	if status := run([]string{"-type", "Server", "-output", fp, "internal/example"}, &stderr); status != 0 {
+		t.Fatalf("Unexpected status %d: %s", status, stderr.String())
+	}
+	got, err := os.ReadFile(fp)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected, err := os.ReadFile("internal/example/server_conf.go")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(got, expected) {
+		t.Fatal("internal/example/server_conf.go is out of date, run go generate ./...")
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	dir := t.TempDir()
+	src := `package bad
+
+type Good struct { Name string }
+
+type Chan struct { C chan int }
+
+type Keys struct { M map[int]string }
+
+type Foreign struct { B bytes.Buffer }
+
+type Iface interface{ Close() error }
+
+type Fn struct { I Iface }
+`
+	if err := os.WriteFile(filepath.Join(dir, "bad.go"), []byte(src), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, test := range []struct {
+		args     []string
+		status   int
+		expected string
+	}{
+		{[]string{}, 2, "usage: confgen"},
+		{[]string{"-type", "Missing", dir}, 1, "no struct type Missing"},
+		{[]string{"-type", "Iface", dir}, 1, "no struct type Iface"},
+		{[]string{"-type", "Chan", dir}, 1, "Chan.C: unsupported type chan int"},
+		{[]string{"-type", "Keys", dir}, 1, "Keys.M: unsupported type map[int]string"},
+		{[]string{"-type", "Foreign", dir}, 1, "Foreign.B: unsupported type bytes.Buffer"},
+		{[]string{"-type", "Fn", dir}, 1, "Fn.I: unsupported type Iface"},
+		{[]string{"-type", "Good", filepath.Join(dir, "missing")}, 1, "no Go files"},
+	} {
+		var stderr bytes.Buffer
+		status := run(test.args, &stderr)
+		if status != test.status || !strings.Contains(stderr.String(), test.expected) {
+			t.Fatalf("Mismatch with status %d:\nReceived: '%+v'\nExpected: '%+v'\n", status, stderr.String(), test.expected)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "good_conf.go")); !os.IsNotExist(err) {
+		t.Fatalf("Expected no output for failed runs, got %v", err)
+	}
+}
@@ -0,0 +1,18 @@
+// Command confwasm exposes the parser to JavaScript as a WebAssembly
+// module, so web UIs can validate and format configs with the same grammar
+// as the services reading them. Build it with:
+//
+//	GOOS=js GOARCH=wasm go build -o conf.wasm ./cmd/confwasm
+//
+// and load it with the wasm_exec.js of the Go release it was built with.
+// Once run, it defines a global conf object with functions taking the
+// source of a config:
+//
+//	conf.parse(src)     // {valid, config, errors}
+//	conf.validate(src)  // {valid, errors, warnings} with lint findings
+//	conf.format(src)    // {valid, output, errors}
+//
+// Errors and warnings have a message and, when known, the line and pos of
+// the source they refer to. Includes and file() can not be read in the
+// browser, and fail.
+package main
@@ -0,0 +1,36 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"encoding/json"
+	"syscall/js"
+
+	"github.com/ninepeach/go-conf/internal/bridge"
+)
+
+func main() {
+	js.Global().Set("conf", js.ValueOf(map[string]any{
+		"parse":    export(bridge.Parse),
+		"validate": export(bridge.Validate),
+		"format":   export(bridge.Format),
+	}))
+	// Keep the functions callable.
+	select {}
+}
+
+// export wraps fn as a JavaScript function taking the source as its
+// argument and returning the response as an object.
+func export(fn func(src string) bridge.Response) js.Func {
+	return js.FuncOf(func(_ js.Value, args []js.Value) any {
+		src := ""
+		if len(args) > 0 {
+			src = args[0].String()
+		}
+		data, err := json.Marshal(fn(src))
+		if err != nil {
+			data, _ = json.Marshal(bridge.Response{Errors: []bridge.Diagnostic{{Message: err.Error()}}})
+		}
+		return js.Global().Get("JSON").Call("parse", string(data))
+	})
+}
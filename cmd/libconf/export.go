@@ -0,0 +1,32 @@
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/ninepeach/go-conf/internal/bridge"
+)
+
+//export conf_parse
+func conf_parse(src *C.char) *C.char {
+	return C.CString(respond(bridge.Parse, C.GoString(src)))
+}
+
+//export conf_validate
+func conf_validate(src *C.char) *C.char {
+	return C.CString(respond(bridge.Validate, C.GoString(src)))
+}
+
+//export conf_format
+func conf_format(src *C.char) *C.char {
+	return C.CString(respond(bridge.Format, C.GoString(src)))
+}
+
+//export conf_free
+func conf_free(p *C.char) {
+	C.free(unsafe.Pointer(p))
+}
@@ -0,0 +1,44 @@
+// Command libconf builds the parser as a C shared library, so services
+// written in other languages, such as ops tooling in Python or agents in
+// C, can read configs with the same grammar without running a subprocess.
+// Build it with:
+//
+//	go build -buildmode=c-shared -o libconf.so ./cmd/libconf
+//
+// which writes libconf.h next to the library. The functions take the
+// source of a config and return a JSON object, which the caller must
+// release with conf_free:
+//
+//	char *conf_parse(char *src);     // {"valid", "config", "errors"}
+//	char *conf_validate(char *src);  // {"valid", "errors", "warnings"}
+//	char *conf_format(char *src);    // {"valid", "output", "errors"}
+//	void conf_free(char *json);
+//
+// Errors and warnings have a message and, when known, the line and pos of
+// the source they refer to. Includes and file() are read relative to the
+// working directory of the process. From Python:
+//
+//	lib = ctypes.CDLL("./libconf.so")
+//	lib.conf_parse.restype = ctypes.c_void_p
+//	ptr = lib.conf_parse(b"port = 4222")
+//	result = json.loads(ctypes.string_at(ptr))
+//	lib.conf_free(ctypes.c_void_p(ptr))
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/ninepeach/go-conf/internal/bridge"
+)
+
+// main is required by c-shared builds but not called.
+func main() {}
+
+// respond returns the response of fn for src as JSON.
+func respond(fn func(src string) bridge.Response, src string) string {
+	data, err := json.Marshal(fn(src))
+	if err != nil {
+		data, _ = json.Marshal(bridge.Response{Errors: []bridge.Diagnostic{{Message: err.Error()}}})
+	}
+	return string(data)
+}
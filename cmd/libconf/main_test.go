@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ninepeach/go-conf/internal/bridge"
+)
+
+func TestRespond(t *testing.T) {
+	for _, test := range []struct {
+		fn       func(string) bridge.Response
+		src      string
+		expected string
+	}{
+		{bridge.Parse, "port = 4222\nsize = 1k", `{"config":{"port":4222,"size":1000},"valid":true}`},
+		{bridge.Format, "b = 1\na = true", `{"output":"a: true\nb: 1\n","valid":true}`},
+		{bridge.Validate, "port = [", `{"valid":false,"errors":[{"message":"parse error: Expected an array value terminator \",\" or an array terminator \"]\", but got '\u0000' instead.","line":1,"pos":8}]}`},
+	} {
+		if got := respond(test.fn, test.src); got != test.expected {
+			t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", got, test.expected)
+		}
+	}
+}
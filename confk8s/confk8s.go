@@ -0,0 +1,194 @@
+// Package confk8s assembles a config from ConfigMap and Secret volumes
+// mounted into a Kubernetes pod, and reloads it when they are updated.
+//
+// Files ending in .conf are config fragments, merged in order as with
+// conf.ParseFiles. Every other file is a single key named after the file,
+// holding the file contents:
+//
+//	p := &confk8s.Projection{Dirs: []string{"/etc/app/config", "/etc/app/secrets"}}
+//	s, err := confk8s.NewStore(p)
+//	if err != nil {
+//		return err
+//	}
+//	go s.Watch(ctx, 10*time.Second, nil)
+//
+// Kubernetes updates a volume by writing the new files to a fresh
+// directory and switching the ..data symlink of the volume to it. A
+// Projection reads all files of a volume through the target of ..data it
+// resolved once, so a load never mixes files of two updates, and watches
+// the symlink to find updates.
+package confk8s
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	conf "github.com/ninepeach/go-conf"
+)
+
+// dataLink is the symlink Kubernetes switches to update a volume.
+const dataLink = "..data"
+
+// Projection is a config assembled from mounted volume directories.
+type Projection struct {
+	// Dirs are the mounted directories. Fragments are merged in the order
+	// of the directories, and keys of later directories replace those of
+	// earlier ones.
+	Dirs []string
+	// ParseValues parses the contents of key files as config values, so
+	// a file holding 4222 sets an integer. By default the contents are
+	// kept as strings, which suits secrets.
+	ParseValues bool
+	// Options are used to parse the fragments and values.
+	Options []conf.Option
+}
+
+// Load reads the directories and returns the config. A single trailing
+// newline is trimmed from the contents of key files.
+func (p *Projection) Load() (map[string]any, error) {
+	var fragments []string
+	keys := make(map[string]any)
+	for _, dir := range p.Dirs {
+		root, err := resolveDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := os.ReadDir(root)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			name := e.Name()
+			if strings.HasPrefix(name, "..") || e.IsDir() {
+				continue
+			}
+			fp := filepath.Join(root, name)
+			if strings.HasSuffix(name, ".conf") {
+				fragments = append(fragments, fp)
+				continue
+			}
+			data, err := os.ReadFile(fp)
+			if err != nil {
+				return nil, err
+			}
+			s := strings.TrimSuffix(string(data), "\n")
+			if !p.ParseValues {
+				keys[name] = s
+				continue
+			}
+			v, err := conf.ParseValue(s, p.Options...)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", filepath.Join(dir, name), err)
+			}
+			keys[name] = v
+		}
+	}
+
+	m := make(map[string]any)
+	if len(fragments) > 0 {
+		var err error
+		if m, err = conf.ParseFiles(fragments, p.Options...); err != nil {
+			return nil, err
+		}
+	}
+	for k, v := range keys {
+		m[k] = v
+	}
+	return m, nil
+}
+
+// resolveDir returns the directory the ..data symlink of dir points to,
+// or dir itself for directories not managed by Kubernetes.
+func resolveDir(dir string) (string, error) {
+	target, err := os.Readlink(filepath.Join(dir, dataLink))
+	if err != nil {
+		if _, serr := os.Stat(dir); serr != nil {
+			return "", serr
+		}
+		return dir, nil
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(dir, target)
+	}
+	return target, nil
+}
+
+// version returns a string that changes whenever one of the directories
+// was updated: the target of ..data, or the names, sizes and modification
+// times of the files of directories without it.
+func (p *Projection) version() string {
+	var sb strings.Builder
+	for _, dir := range p.Dirs {
+		if target, err := os.Readlink(filepath.Join(dir, dataLink)); err == nil {
+			fmt.Fprintf(&sb, "%s -> %s\n", dir, target)
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			fmt.Fprintf(&sb, "%s: %v\n", dir, err)
+			continue
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+		for _, e := range entries {
+			info, err := e.Info()
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(&sb, "%s/%s %d %d\n", dir, e.Name(), info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return sb.String()
+}
+
+// Store is a conf.Store holding the config of a Projection.
+type Store struct {
+	*conf.Store
+	p *Projection
+	// seen is the version of the directories last loaded by NewStore or
+	// Watch.
+	seen string
+}
+
+// NewStore loads the projection and returns a Store holding it. Reloading
+// the store loads the projection again.
+func NewStore(p *Projection) (*Store, error) {
+	seen := p.version()
+	s, err := conf.NewStoreFunc(p.Load)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{Store: s, p: p, seen: seen}, nil
+}
+
+// Watch checks the directories for updates every interval and reloads the
+// store when they were updated, until ctx is done. It returns the error of
+// ctx.
+//
+// fn, if not nil, is called after every reload Watch makes, with the
+// changes or with the error of the reload, in which case the current
+// config is kept.
+func (s *Store) Watch(ctx context.Context, interval time.Duration, fn func(changes []conf.Change, err error)) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+		v := s.p.version()
+		if v == s.seen {
+			continue
+		}
+		s.seen = v
+		changes, err := s.Reload()
+		if fn != nil {
+			fn(changes, err)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package confk8s
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	conf "github.com/ninepeach/go-conf"
+)
+
+// project writes files to a fresh directory of the volume at dir and
+// switches ..data to it, the way the kubelet updates a mounted volume.
+func project(t *testing.T, dir, version string, files map[string]string) {
+	t.Helper()
+	ts := filepath.Join(dir, "..2024_"+version)
+	if err := os.MkdirAll(ts, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(ts, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		link := filepath.Join(dir, name)
+		if _, err := os.Lstat(link); os.IsNotExist(err) {
+			if err := os.Symlink(filepath.Join(dataLink, name), link); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	tmp := filepath.Join(dir, "..data_tmp")
+	if err := os.Symlink(filepath.Base(ts), tmp); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, dataLink)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProjection(t *testing.T) {
+	cm := t.TempDir()
+	secrets := t.TempDir()
+	project(t, cm, "1", map[string]string{
+		"app.conf":    "port = 4222\ninclude 'limits.conf'",
+		"limits.conf": "max_conn = 10",
+		"log_level":   "debug\n",
+	})
+	project(t, secrets, "1", map[string]string{"password": "s3cr$t"})
+	// A plain directory works as well.
+	extra := t.TempDir()
+	if err := os.WriteFile(filepath.Join(extra, "replicas"), []byte("3"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Projection{Dirs: []string{cm, secrets}}
+	m, err := p.Load()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ex := map[string]any{
+		"port":      int64(4222),
+		"max_conn":  int64(10),
+		"log_level": "debug",
+		"password":  "s3cr$t",
+	}
+	if !reflect.DeepEqual(m, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, ex)
+	}
+
+	p = &Projection{Dirs: []string{extra}, ParseValues: true}
+	if m, err = p.Load(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m["replicas"] != int64(3) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m["replicas"], 3)
+	}
+}
+
+func TestStoreWatch(t *testing.T) {
+	cm := t.TempDir()
+	project(t, cm, "1", map[string]string{"app.conf": "port = 4222"})
+	s, err := NewStore(&Projection{Dirs: []string{cm}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	type result struct {
+		changes []conf.Change
+		err     error
+	}
+	results := make(chan result)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.Watch(ctx, 5*time.Millisecond, func(changes []conf.Change, err error) {
+			results <- result{changes, err}
+		})
+	}()
+	next := func() result {
+		t.Helper()
+		select {
+		case r := <-results:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for a reload")
+			return result{}
+		}
+	}
+
+	project(t, cm, "2", map[string]string{"app.conf": "port = 4333"})
+	if r := next(); r.err != nil || len(r.changes) != 1 || s.Load()["port"] != int64(4333) {
+		t.Fatalf("Unexpected reload: %+v", r)
+	}
+
+	// A broken update keeps the current config.
+	project(t, cm, "3", map[string]string{"app.conf": "port = ["})
+	if r := next(); r.err == nil {
+		t.Fatalf("Expected error, got %+v", r)
+	}
+	if s.Load()["port"] != int64(4333) {
+		t.Fatalf("Expected config to be kept, got %+v", s.Load())
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", err, context.Canceled)
+	}
+}
@@ -0,0 +1,189 @@
+// Package confremote loads config documents from a remote config service
+// into a conf.Store.
+//
+// Documents are fetched by a Source. Client fetches them over HTTP and
+// uses ETag and Last-Modified validators, so polling an unchanged document
+// costs a 304 response and no parse. Consul and Etcd read documents, or
+// trees of keys, from those KV stores. Other transports, such as a gRPC
+// config service, implement Source themselves:
+//
+//	c := &confremote.Client{URL: "https://config.example.com/app.conf"}
+//	s, err := confremote.NewStore(ctx, c)
+//	if err != nil {
+//		return err
+//	}
+//	go s.Poll(ctx, 30*time.Second, nil)
+package confremote
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	conf "github.com/ninepeach/go-conf"
+)
+
+// Source fetches a config document from a remote service.
+type Source interface {
+	// Fetch returns the current document and whether it changed since
+	// the previous fetch. Sources backed by a stream of updates may block
+	// until the next update arrives.
+	Fetch(ctx context.Context) (data []byte, changed bool, err error)
+}
+
+// Client is a Source fetching a document with HTTP GET requests.
+type Client struct {
+	URL string
+	// Header is added to every request, e.g. for authorization.
+	Header http.Header
+	// HTTPClient is used for the requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+
+	mu           sync.Mutex
+	data         []byte
+	etag         string
+	lastModified string
+}
+
+// Fetch requests the document, sending the validators of the previous
+// response. A 304 response returns the previous document as unchanged.
+func (c *Client) Fetch(ctx context.Context) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	header := c.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	if c.data != nil {
+		if c.etag != "" {
+			header.Set("If-None-Match", c.etag)
+		}
+		if c.lastModified != "" {
+			header.Set("If-Modified-Since", c.lastModified)
+		}
+	}
+	resp, err := doRequest(ctx, c.HTTPClient, http.MethodGet, c.URL, header, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && c.data != nil:
+		return c.data, false, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, false, fmt.Errorf("fetching '%s': unexpected status %s", c.URL, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, fmt.Errorf("fetching '%s': %v", c.URL, err)
+	}
+	c.data = data
+	c.etag = resp.Header.Get("ETag")
+	c.lastModified = resp.Header.Get("Last-Modified")
+	return data, true, nil
+}
+
+// doRequest sends a request with the given header and body, with
+// http.DefaultClient if hc is nil.
+func doRequest(ctx context.Context, hc *http.Client, method, url string, header http.Header, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range header {
+		req.Header[k] = append([]string(nil), vs...)
+	}
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	return hc.Do(req)
+}
+
+// loader parses the documents of a source, keeping the last config so
+// unchanged documents are not parsed again.
+type loader struct {
+	src  Source
+	opts []conf.Option
+
+	mu sync.Mutex
+	m  map[string]any
+}
+
+func (l *loader) load(ctx context.Context) (map[string]any, bool, error) {
+	data, changed, err := l.src.Fetch(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !changed && l.m != nil {
+		return l.m, false, nil
+	}
+	m, err := conf.Parse(string(data), l.opts...)
+	if err != nil {
+		return nil, false, err
+	}
+	l.m = m
+	return m, true, nil
+}
+
+// Store is a conf.Store holding the config of a remote document.
+type Store struct {
+	*conf.Store
+	l *loader
+}
+
+// NewStore fetches and parses the document of src and returns a Store
+// holding it. Reloading the store fetches the document again, with ctx.
+func NewStore(ctx context.Context, src Source, opts ...conf.Option) (*Store, error) {
+	l := &loader{src: src, opts: opts}
+	cs, err := conf.NewStoreFunc(func() (map[string]any, error) {
+		m, _, err := l.load(ctx)
+		return m, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Store{Store: cs, l: l}, nil
+}
+
+// Poll fetches the document every interval and swaps it in when it
+// changed, until ctx is done. It returns the error of ctx. Sources whose
+// Fetch blocks until an update arrives can be polled with a zero interval.
+//
+// fn, if not nil, is called with the changes of every changed document, or
+// with the error of a fetch or parse. A document that fails to parse is
+// never swapped in, the current config is kept.
+func (s *Store) Poll(ctx context.Context, interval time.Duration, fn func(changes []conf.Change, err error)) error {
+	for {
+		if interval > 0 {
+			t := time.NewTimer(interval)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return ctx.Err()
+			case <-t.C:
+			}
+		}
+		m, changed, err := s.l.load(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !changed && err == nil {
+			continue
+		}
+		var changes []conf.Change
+		if err == nil {
+			changes, err = s.Update(m)
+		}
+		if fn != nil {
+			fn(changes, err)
+		}
+	}
+}
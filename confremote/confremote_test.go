@@ -0,0 +1,171 @@
+package confremote
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	conf "github.com/ninepeach/go-conf"
+)
+
+// server serves a document with an ETag and counts the 304 responses.
+type server struct {
+	mu      sync.Mutex
+	doc     string
+	version int
+	notMod  int
+}
+
+func (s *server) set(doc string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.doc = doc
+	s.version++
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	etag := strconv.Quote(strconv.Itoa(s.version))
+	if r.Header.Get("If-None-Match") == etag {
+		s.notMod++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	w.Write([]byte(s.doc))
+}
+
+func TestClientFetch(t *testing.T) {
+	srv := &server{doc: "port = 4222"}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	c := &Client{URL: ts.URL}
+	ctx := context.Background()
+	data, changed, err := c.Fetch(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !changed || string(data) != "port = 4222" {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", string(data), "port = 4222")
+	}
+	data, changed, err = c.Fetch(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if changed || string(data) != "port = 4222" || srv.notMod != 1 {
+		t.Fatalf("Expected an unchanged document, got %q, changed %v, %d not modified", data, changed, srv.notMod)
+	}
+
+	ts404 := httptest.NewServer(http.NotFoundHandler())
+	defer ts404.Close()
+	c = &Client{URL: ts404.URL}
+	if _, _, err := c.Fetch(ctx); err == nil {
+		t.Fatal("Expected error for a missing document")
+	}
+}
+
+func TestStorePoll(t *testing.T) {
+	srv := &server{doc: "port = 4222"}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, err := NewStore(ctx, &Client{URL: ts.URL})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if s.Load()["port"] != int64(4222) {
+		t.Fatalf("Unexpected config: %+v", s.Load())
+	}
+
+	type result struct {
+		changes []conf.Change
+		err     error
+	}
+	results := make(chan result)
+	done := make(chan error)
+	go func() {
+		done <- s.Poll(ctx, 5*time.Millisecond, func(changes []conf.Change, err error) {
+			results <- result{changes, err}
+		})
+	}()
+	next := func() result {
+		t.Helper()
+		select {
+		case r := <-results:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for an update")
+			return result{}
+		}
+	}
+
+	srv.set("port = 4333")
+	if r := next(); r.err != nil || len(r.changes) != 1 || r.changes[0].Path != "port" {
+		t.Fatalf("Unexpected update: %+v", r)
+	}
+
+	// A broken document is reported once and keeps the current config.
+	srv.set("port = [")
+	if r := next(); r.err == nil {
+		t.Fatalf("Expected a parse error, got %+v", r)
+	}
+	srv.set("port = 4444")
+	if r := next(); r.err != nil || len(r.changes) != 1 {
+		t.Fatalf("Unexpected update: %+v", r)
+	}
+	if s.Load()["port"] != int64(4444) {
+		t.Fatalf("Unexpected config: %+v", s.Load())
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", err, context.Canceled)
+	}
+}
+
+// stream is a Source whose Fetch blocks until a document is pushed.
+type stream chan string
+
+func (s stream) Fetch(ctx context.Context) ([]byte, bool, error) {
+	select {
+	case doc := <-s:
+		return []byte(doc), true, nil
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	}
+}
+
+func TestStoreStream(t *testing.T) {
+	src := make(stream, 1)
+	src <- "port = 4222"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, err := NewStore(ctx, src)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	updated := make(chan []conf.Change)
+	done := make(chan error)
+	go func() {
+		done <- s.Poll(ctx, 0, func(changes []conf.Change, err error) {
+			updated <- changes
+		})
+	}()
+	src <- "port = 4333"
+	if changes := <-updated; len(changes) != 1 || s.Load()["port"] != int64(4333) {
+		t.Fatalf("Unexpected update: %+v", changes)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", err, context.Canceled)
+	}
+}
@@ -0,0 +1,100 @@
+package confremote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Consul is a Source reading a document from the Consul KV store through
+// its HTTP API.
+type Consul struct {
+	// Addr is the address of the Consul agent, such as
+	// http://127.0.0.1:8500.
+	Addr string
+	// Key holds the document. With Tree set, Key is a prefix instead and
+	// the keys below it make up the config, see Tree.
+	Key string
+	// Tree makes the keys below Key the config, split into nested maps on
+	// slashes. Values holding exactly one scalar, such as 4222 or true,
+	// are read as that value, and other values are kept as strings.
+	Tree bool
+	// Wait makes Fetch a blocking query that returns once the keys change
+	// or Wait elapsed, so the source can be polled with a zero interval.
+	Wait time.Duration
+	// Header is added to every request, e.g. X-Consul-Token.
+	Header http.Header
+	// HTTPClient is used for the requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+
+	mu    sync.Mutex
+	index string
+	data  []byte
+}
+
+// consulPair is an entry of a recursive Consul KV read.
+type consulPair struct {
+	Key   string
+	Value []byte
+}
+
+// Fetch reads the document, blocking until it changes when Wait is set.
+func (c *Consul) Fetch(ctx context.Context) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	q := url.Values{}
+	if c.Tree {
+		q.Set("recurse", "")
+	} else {
+		q.Set("raw", "")
+	}
+	if c.Wait > 0 && c.index != "" {
+		q.Set("index", c.index)
+		q.Set("wait", fmt.Sprintf("%dms", c.Wait.Milliseconds()))
+	}
+	u := strings.TrimSuffix(c.Addr, "/") + "/v1/kv/" + strings.TrimPrefix(c.Key, "/") + "?" + q.Encode()
+	resp, err := doRequest(ctx, c.HTTPClient, http.MethodGet, u, c.Header, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("reading consul key '%s': unexpected status %s", c.Key, resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, fmt.Errorf("reading consul key '%s': %v", c.Key, err)
+	}
+	if idx := resp.Header.Get("X-Consul-Index"); idx != "" {
+		if _, err := strconv.ParseUint(idx, 10, 64); err == nil {
+			c.index = idx
+		}
+	}
+
+	data := body
+	if c.Tree {
+		var pairs []consulPair
+		if err := json.Unmarshal(body, &pairs); err != nil {
+			return nil, false, fmt.Errorf("reading consul key '%s': %v", c.Key, err)
+		}
+		kvs := make(map[string][]byte, len(pairs))
+		for _, p := range pairs {
+			kvs[p.Key] = p.Value
+		}
+		if data, err = treeDocument(c.Key, kvs); err != nil {
+			return nil, false, err
+		}
+	}
+	changed := c.data == nil || !bytes.Equal(data, c.data)
+	c.data = data
+	return data, changed, nil
+}
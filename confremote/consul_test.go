@@ -0,0 +1,88 @@
+package confremote
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeConsul serves a KV store the way the Consul HTTP API does, recording
+// the blocking query index of the last request.
+type fakeConsul struct {
+	mu        sync.Mutex
+	kvs       map[string]string
+	index     int
+	lastIndex string
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lastIndex = r.URL.Query().Get("index")
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	w.Header().Set("X-Consul-Index", "7")
+	if _, ok := r.URL.Query()["recurse"]; ok {
+		var pairs []consulPair
+		for k, v := range f.kvs {
+			if strings.HasPrefix(k, key) {
+				pairs = append(pairs, consulPair{Key: k, Value: []byte(v)})
+			}
+		}
+		json.NewEncoder(w).Encode(pairs)
+		return
+	}
+	v, ok := f.kvs[key]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write([]byte(v))
+}
+
+func TestConsul(t *testing.T) {
+	f := &fakeConsul{kvs: map[string]string{
+		"app.conf":           "port = 4222",
+		"app/server/port":    "4222",
+		"app/server/":        "",
+		"app/debug":          "true",
+		"app/routes":         "[a, b]",
+		"application/config": "x",
+	}}
+	ts := httptest.NewServer(f)
+	defer ts.Close()
+	ctx := context.Background()
+
+	c := &Consul{Addr: ts.URL, Key: "app.conf", Wait: 1}
+	s, err := NewStore(ctx, c)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if s.Load()["port"] != int64(4222) || f.lastIndex != "" {
+		t.Fatalf("Unexpected config %+v, index %q", s.Load(), f.lastIndex)
+	}
+	if _, changed, err := c.Fetch(ctx); err != nil || changed || f.lastIndex != "7" {
+		t.Fatalf("Expected an unchanged blocking read, got changed %v, index %q: %v", changed, f.lastIndex, err)
+	}
+
+	s, err = NewStore(ctx, &Consul{Addr: ts.URL, Key: "app/", Tree: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ex := map[string]any{
+		"server": map[string]any{"port": int64(4222)},
+		"debug":  true,
+		"routes": "[a, b]",
+	}
+	if !reflect.DeepEqual(s.Load(), ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", s.Load(), ex)
+	}
+
+	if _, err := NewStore(ctx, &Consul{Addr: ts.URL, Key: "missing"}); err == nil {
+		t.Fatal("Expected error for a missing key")
+	}
+}
@@ -0,0 +1,184 @@
+package confremote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Etcd is a Source reading a document from etcd through the JSON gateway
+// of its v3 API.
+type Etcd struct {
+	// Endpoint is the address of an etcd member, such as
+	// http://127.0.0.1:2379.
+	Endpoint string
+	// Key holds the document. With Tree set, Key is a prefix instead and
+	// the keys below it make up the config, as for Consul.
+	Key  string
+	Tree bool
+	// Wait makes Fetch watch the keys and return once they change or Wait
+	// elapsed, so the source can be polled with a zero interval.
+	Wait time.Duration
+	// Header is added to every request, e.g. Authorization.
+	Header http.Header
+	// HTTPClient is used for the requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+
+	mu   sync.Mutex
+	rev  int64
+	data []byte
+}
+
+type etcdRangeRequest struct {
+	Key      []byte `json:"key"`
+	RangeEnd []byte `json:"range_end,omitempty"`
+}
+
+type etcdRangeResponse struct {
+	Header etcdHeader `json:"header"`
+	Kvs    []struct {
+		Key   []byte `json:"key"`
+		Value []byte `json:"value"`
+	} `json:"kvs"`
+}
+
+// The gateway encodes 64-bit integers as strings.
+type etcdHeader struct {
+	Revision int64 `json:"revision,string"`
+}
+
+type etcdWatchRequest struct {
+	CreateRequest etcdWatchCreateRequest `json:"create_request"`
+}
+
+type etcdWatchCreateRequest struct {
+	Key           []byte `json:"key"`
+	RangeEnd      []byte `json:"range_end,omitempty"`
+	StartRevision int64  `json:"start_revision,string"`
+}
+
+type etcdWatchResponse struct {
+	Result struct {
+		Canceled bool `json:"canceled"`
+		Events   []struct {
+			Type string `json:"type"`
+		} `json:"events"`
+	} `json:"result"`
+}
+
+// Fetch reads the document, watching the keys until they change first
+// when Wait is set.
+func (e *Etcd) Fetch(ctx context.Context) ([]byte, bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	req := etcdRangeRequest{Key: []byte(e.Key)}
+	if e.Tree {
+		req.RangeEnd = prefixEnd(req.Key)
+	}
+	if e.Wait > 0 && e.rev > 0 {
+		if err := e.watch(ctx, req); err != nil {
+			return nil, false, err
+		}
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, false, err
+	}
+	u := strings.TrimSuffix(e.Endpoint, "/") + "/v3/kv/range"
+	resp, err := doRequest(ctx, e.HTTPClient, http.MethodPost, u, e.Header, body)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("reading etcd key '%s': unexpected status %s", e.Key, resp.Status)
+	}
+	var rr etcdRangeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rr); err != nil {
+		return nil, false, fmt.Errorf("reading etcd key '%s': %v", e.Key, err)
+	}
+	e.rev = rr.Header.Revision
+
+	var data []byte
+	if e.Tree {
+		kvs := make(map[string][]byte, len(rr.Kvs))
+		for _, kv := range rr.Kvs {
+			kvs[string(kv.Key)] = kv.Value
+		}
+		if data, err = treeDocument(e.Key, kvs); err != nil {
+			return nil, false, err
+		}
+	} else {
+		if len(rr.Kvs) == 0 {
+			return nil, false, fmt.Errorf("reading etcd key '%s': key not found", e.Key)
+		}
+		data = rr.Kvs[0].Value
+	}
+	changed := e.data == nil || !bytes.Equal(data, e.data)
+	e.data = data
+	return data, changed, nil
+}
+
+// watch blocks until the keys of req change after the revision of the last
+// read, Wait elapsed or ctx is done. Watches canceled by etcd, such as for
+// a compacted revision, return so the keys are read again.
+func (e *Etcd) watch(ctx context.Context, req etcdRangeRequest) error {
+	wctx, cancel := context.WithTimeout(ctx, e.Wait)
+	defer cancel()
+
+	body, err := json.Marshal(etcdWatchRequest{CreateRequest: etcdWatchCreateRequest{
+		Key:           req.Key,
+		RangeEnd:      req.RangeEnd,
+		StartRevision: e.rev + 1,
+	}})
+	if err != nil {
+		return err
+	}
+	u := strings.TrimSuffix(e.Endpoint, "/") + "/v3/watch"
+	resp, err := doRequest(wctx, e.HTTPClient, http.MethodPost, u, e.Header, body)
+	if err != nil {
+		if ctx.Err() == nil && wctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("watching etcd key '%s': unexpected status %s", e.Key, resp.Status)
+	}
+	// The gateway streams a response for the created watch and one for
+	// every batch of events.
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var wr etcdWatchResponse
+		if err := dec.Decode(&wr); err != nil {
+			if ctx.Err() == nil && wctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("watching etcd key '%s': %v", e.Key, err)
+		}
+		if len(wr.Result.Events) > 0 || wr.Result.Canceled {
+			return nil
+		}
+	}
+}
+
+// prefixEnd returns the end of the etcd key range holding the keys that
+// start with prefix.
+func prefixEnd(prefix []byte) []byte {
+	end := bytes.Clone(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	// All keys.
+	return []byte{0}
+}
@@ -0,0 +1,165 @@
+package confremote
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeEtcd serves range requests the way the etcd v3 JSON gateway does.
+type fakeEtcd map[string]string
+
+func (f fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v3/kv/range" || r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+	var req etcdRangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var resp etcdRangeResponse
+	for k, v := range f {
+		key := []byte(k)
+		match := bytes.Equal(key, req.Key)
+		if req.RangeEnd != nil {
+			match = bytes.Compare(key, req.Key) >= 0 && bytes.Compare(key, req.RangeEnd) < 0
+		}
+		if match {
+			resp.Kvs = append(resp.Kvs, struct {
+				Key   []byte `json:"key"`
+				Value []byte `json:"value"`
+			}{key, []byte(v)})
+		}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func TestEtcd(t *testing.T) {
+	ts := httptest.NewServer(fakeEtcd{
+		"/app.conf":        "port = 4222\nhost = localhost",
+		"/app/server/port": "4222",
+		"/app/name":        "'my app'",
+		"/apps":            "x",
+	})
+	defer ts.Close()
+	ctx := context.Background()
+
+	e := &Etcd{Endpoint: ts.URL, Key: "/app.conf"}
+	s, err := NewStore(ctx, e)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ex := map[string]any{"port": int64(4222), "host": "localhost"}
+	if !reflect.DeepEqual(s.Load(), ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", s.Load(), ex)
+	}
+	if _, changed, err := e.Fetch(ctx); err != nil || changed {
+		t.Fatalf("Expected an unchanged document, got changed %v: %v", changed, err)
+	}
+
+	s, err = NewStore(ctx, &Etcd{Endpoint: ts.URL, Key: "/app/", Tree: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ex = map[string]any{"server": map[string]any{"port": int64(4222)}, "name": "my app"}
+	if !reflect.DeepEqual(s.Load(), ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", s.Load(), ex)
+	}
+
+	if _, err := NewStore(ctx, &Etcd{Endpoint: ts.URL, Key: "/missing"}); err == nil {
+		t.Fatal("Expected error for a missing key")
+	}
+}
+
+// fakeEtcdWatch serves a single key the way the etcd v3 JSON gateway does,
+// streaming watch responses until the key is set.
+type fakeEtcdWatch struct {
+	mu       sync.Mutex
+	value    string
+	rev      int64
+	start    int64
+	watching chan struct{}
+	set      chan struct{}
+}
+
+func (f *fakeEtcdWatch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/v3/kv/range":
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		fmt.Fprintf(w, `{"header":{"revision":"%d"},"kvs":[{"key":"YQ==","value":%q}]}`,
+			f.rev, base64.StdEncoding.EncodeToString([]byte(f.value)))
+	case "/v3/watch":
+		var req etcdWatchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.start = req.CreateRequest.StartRevision
+		f.mu.Unlock()
+		fmt.Fprintln(w, `{"result":{"created":true}}`)
+		w.(http.Flusher).Flush()
+		f.watching <- struct{}{}
+		select {
+		case <-f.set:
+			fmt.Fprintln(w, `{"result":{"events":[{"type":"PUT"}]}}`)
+		case <-r.Context().Done():
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestEtcdWatch(t *testing.T) {
+	f := &fakeEtcdWatch{value: "port = 1", rev: 1, watching: make(chan struct{}, 1), set: make(chan struct{})}
+	ts := httptest.NewServer(f)
+	defer ts.Close()
+	ctx := context.Background()
+
+	e := &Etcd{Endpoint: ts.URL, Key: "a", Wait: time.Minute}
+	if _, _, err := e.Fetch(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	go func() {
+		<-f.watching
+		f.mu.Lock()
+		f.value, f.rev = "port = 2", 5
+		f.mu.Unlock()
+		close(f.set)
+	}()
+	data, changed, err := e.Fetch(ctx)
+	if err != nil || !changed || string(data) != "port = 2" {
+		t.Fatalf("Expected the changed document, got %q, changed %v: %v", data, changed, err)
+	}
+	if f.start != 2 {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", f.start, 2)
+	}
+
+	e.Wait = 10 * time.Millisecond
+	f.set = make(chan struct{})
+	if _, changed, err := e.Fetch(ctx); err != nil || changed {
+		t.Fatalf("Expected an unchanged document after Wait, got changed %v: %v", changed, err)
+	}
+	if f.start != 6 {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", f.start, 6)
+	}
+}
+
+func TestPrefixEnd(t *testing.T) {
+	for prefix, ex := range map[string]string{"/app/": "/app0", "a\xff": "b", "\xff": "\x00"} {
+		if end := string(prefixEnd([]byte(prefix))); end != ex {
+			t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", end, ex)
+		}
+	}
+}
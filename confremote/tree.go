@@ -0,0 +1,64 @@
+package confremote
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	conf "github.com/ninepeach/go-conf"
+)
+
+// treeDocument renders the keys of a KV store below prefix as a config
+// document. Keys are split into nested maps on slashes and each value that
+// is exactly one scalar config value is read as that value, so
+// "app/server/port" holding 4222 under the prefix "app/" becomes
+// server { port: 4222 }. Other values, such as "a b", "x; y=1", "$HOME" or
+// "[a, b]", are kept as strings.
+//
+// The document is written with conf.Marshal, which quotes strings, so the
+// options of the store, applied when the document is parsed, do not expand
+// variables or call functions in values.
+func treeDocument(prefix string, kvs map[string][]byte) ([]byte, error) {
+	keys := make([]string, 0, len(kvs))
+	for k := range kvs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	m := make(map[string]any)
+	for _, k := range keys {
+		var path []string
+		for _, elem := range strings.Split(strings.TrimPrefix(k, prefix), "/") {
+			if elem != "" {
+				path = append(path, elem)
+			}
+		}
+		// Keys ending in a slash are folders.
+		if len(path) == 0 || strings.HasSuffix(k, "/") {
+			continue
+		}
+		var v any = string(kvs[k])
+		if sv, ok := conf.ParseExactValue(string(kvs[k])); ok {
+			switch sv.(type) {
+			case map[string]any, []any:
+			default:
+				v = sv
+			}
+		}
+		parent := m
+		for _, elem := range path[:len(path)-1] {
+			v, ok := parent[elem]
+			if !ok {
+				v = make(map[string]any)
+				parent[elem] = v
+			}
+			child, ok := v.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("key '%s' is below a key holding a value", k)
+			}
+			parent = child
+		}
+		parent[path[len(path)-1]] = v
+	}
+	return conf.Marshal(m)
+}
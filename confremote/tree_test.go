@@ -0,0 +1,51 @@
+package confremote
+
+import (
+	"reflect"
+	"testing"
+
+	conf "github.com/ninepeach/go-conf"
+)
+
+func TestTreeDocument(t *testing.T) {
+	t.Setenv("CONF_TEST_SECRET", "leaked")
+	data, err := treeDocument("app/", map[string][]byte{
+		"app/port":     []byte("4222"),
+		"app/debug":    []byte("true"),
+		"app/name":     []byte("'my app'"),
+		"app/words":    []byte("a b c"),
+		"app/password": []byte("x; y=1"),
+		"app/secret":   []byte("$CONF_TEST_SECRET"),
+		"app/call":     []byte(`env("CONF_TEST_SECRET")`),
+		"app/list":     []byte("[a, b]"),
+		"app/block":    []byte("{a = 1}"),
+		"app/db/":      nil,
+		"app/db/url":   []byte("postgres://x:5432/db"),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	m, err := conf.Parse(string(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ex := map[string]any{
+		"port":     int64(4222),
+		"debug":    true,
+		"name":     "my app",
+		"words":    "a b c",
+		"password": "x; y=1",
+		"secret":   "$CONF_TEST_SECRET",
+		"call":     `env("CONF_TEST_SECRET")`,
+		"list":     "[a, b]",
+		"block":    "{a = 1}",
+		"db":       map[string]any{"url": "postgres://x:5432/db"},
+	}
+	if !reflect.DeepEqual(m, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, ex)
+	}
+
+	if _, err := treeDocument("", map[string][]byte{"a": []byte("1"), "a/b": []byte("2")}); err == nil {
+		t.Fatal("Expected error for a key below a value")
+	}
+}
@@ -0,0 +1,275 @@
+// Package conftest runs the conformance corpus of the config format
+// against a parser, so regressions and alternate implementations can be
+// validated.
+//
+// A corpus is a directory with the cases below valid/ and invalid/. Each
+// case is a .conf file. Valid cases come with a .json file holding the
+// expected result in tagged form, see Tagged. Invalid cases must fail to
+// parse, and may come with a .err file holding text the error must
+// contain.
+//
+// The corpus for this module is returned by Corpus:
+//
+//	func TestConformance(t *testing.T) {
+//		conftest.Run(t, conftest.Corpus(), func(data string) (map[string]any, error) {
+//			return conf.Parse(data)
+//		})
+//	}
+package conftest
+
+import (
+	"embed"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+//go:embed corpus
+var corpus embed.FS
+
+// Corpus returns the conformance cases shipped with this package.
+func Corpus() fs.FS {
+	sub, err := fs.Sub(corpus, "corpus")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// Case is a single conformance case.
+type Case struct {
+	// Name is the path of the case without extension, e.g.
+	// "valid/integer".
+	Name  string
+	Input string
+	Valid bool
+
+	// Expected is the tagged JSON of the result of a valid case.
+	Expected json.RawMessage
+
+	// Error is text the error of an invalid case must contain, empty when
+	// any error will do.
+	Error string
+}
+
+// Load reads the cases in fsys, sorted by name.
+func Load(fsys fs.FS) ([]Case, error) {
+	var cases []Case
+	for _, dir := range []string{"valid", "invalid"} {
+		names, err := fs.Glob(fsys, dir+"/*.conf")
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			c, err := loadCase(fsys, strings.TrimSuffix(name, ".conf"), dir == "valid")
+			if err != nil {
+				return nil, err
+			}
+			cases = append(cases, c)
+		}
+	}
+	sort.Slice(cases, func(i, j int) bool { return cases[i].Name < cases[j].Name })
+	return cases, nil
+}
+
+func loadCase(fsys fs.FS, name string, valid bool) (Case, error) {
+	input, err := fs.ReadFile(fsys, name+".conf")
+	if err != nil {
+		return Case{}, err
+	}
+	c := Case{Name: name, Input: string(input), Valid: valid}
+	if valid {
+		if c.Expected, err = fs.ReadFile(fsys, name+".json"); err != nil {
+			return Case{}, err
+		}
+		if !json.Valid(c.Expected) {
+			return Case{}, fmt.Errorf("%s.json: invalid JSON", name)
+		}
+		return c, nil
+	}
+	msg, err := fs.ReadFile(fsys, name+".err")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return Case{}, err
+	}
+	c.Error = strings.TrimSpace(string(msg))
+	return c, nil
+}
+
+// ParseFunc parses a config document into plain values: maps, arrays,
+// strings, int64, float64, bool, time.Time and []byte.
+type ParseFunc func(data string) (map[string]any, error)
+
+// Run runs every case in fsys as a subtest of t.
+func Run(t *testing.T, fsys fs.FS, parse ParseFunc) {
+	t.Helper()
+	cases, err := Load(fsys)
+	if err != nil {
+		t.Fatalf("Unexpected error loading the corpus: %v", err)
+	}
+	if len(cases) == 0 {
+		t.Fatal("Empty corpus")
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			m, err := parse(c.Input)
+			if err := c.Check(m, err); err != nil {
+				t.Fatalf("%v\nInput:\n%s", err, c.Input)
+			}
+		})
+	}
+}
+
+// Check reports how the result of parsing the input of c differs from the
+// expected one, nil when it conforms.
+func (c Case) Check(m map[string]any, err error) error {
+	if !c.Valid {
+		if err == nil {
+			return fmt.Errorf("expected an error, got %v", m)
+		}
+		if !strings.Contains(err.Error(), c.Error) {
+			return fmt.Errorf("expected an error containing %q, got %q", c.Error, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unexpected error: %v", err)
+	}
+	tagged, err := Tagged(m)
+	if err != nil {
+		return err
+	}
+	// Round trip through JSON to compare like with like.
+	data, err := json.Marshal(tagged)
+	if err != nil {
+		return err
+	}
+	var got, expected any
+	if err := json.Unmarshal(data, &got); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(c.Expected, &expected); err != nil {
+		return fmt.Errorf("%s.json: %v", c.Name, err)
+	}
+	if !taggedEqual(got, expected) {
+		return fmt.Errorf("mismatch:\nreceived: %s\nexpected: %s", data, compact(c.Expected))
+	}
+	return nil
+}
+
+func compact(data []byte) string {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return string(data)
+	}
+	out, _ := json.Marshal(v)
+	return string(out)
+}
+
+// Tagged returns v in the tagged JSON form of the corpus. Maps become
+// objects and arrays become arrays. Other values become objects holding
+// their type and their value as a string:
+//
+//	{"type": "string", "value": "nats"}
+//	{"type": "integer", "value": "4222"}
+//	{"type": "float", "value": "2.5"}
+//	{"type": "bool", "value": "true"}
+//	{"type": "datetime", "value": "2016-05-04T18:53:41Z"}
+//	{"type": "bytes", "value": "aGk="}
+//
+// Bytes are base64 encoded. Floats are compared by value, so "2.50" and
+// "2.5" are equal.
+func Tagged(v any) (any, error) {
+	switch vv := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(vv))
+		for k, e := range vv {
+			te, err := Tagged(e)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", k, err)
+			}
+			m[k] = te
+		}
+		return m, nil
+	case []any:
+		a := make([]any, len(vv))
+		for i, e := range vv {
+			te, err := Tagged(e)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %v", i, err)
+			}
+			a[i] = te
+		}
+		return a, nil
+	case string:
+		return tag("string", vv), nil
+	case int64:
+		return tag("integer", strconv.FormatInt(vv, 10)), nil
+	case float64:
+		return tag("float", strconv.FormatFloat(vv, 'g', -1, 64)), nil
+	case bool:
+		return tag("bool", strconv.FormatBool(vv)), nil
+	case time.Time:
+		return tag("datetime", vv.UTC().Format(time.RFC3339)), nil
+	case []byte:
+		return tag("bytes", base64.StdEncoding.EncodeToString(vv)), nil
+	}
+	return nil, fmt.Errorf("unexpected value of type %T", v)
+}
+
+func tag(typ, value string) map[string]any {
+	return map[string]any{"type": typ, "value": value}
+}
+
+// taggedEqual compares decoded tagged JSON, floats by value.
+func taggedEqual(a, b any) bool {
+	if fa, ok := taggedFloat(a); ok {
+		fb, ok := taggedFloat(b)
+		return ok && fa == fb
+	}
+	switch av := a.(type) {
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, e := range av {
+			if be, ok := bv[k]; !ok || !taggedEqual(e, be) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		bv, ok := b.([]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !taggedEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func taggedFloat(v any) (float64, bool) {
+	m, ok := v.(map[string]any)
+	if !ok || len(m) != 2 || m["type"] != "float" {
+		return 0, false
+	}
+	s, ok := m["value"].(string)
+	if !ok {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil
+}
@@ -0,0 +1,73 @@
+package conftest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	conf "github.com/ninepeach/go-conf"
+)
+
+func TestConformance(t *testing.T) {
+	Run(t, Corpus(), func(data string) (map[string]any, error) {
+		return conf.Parse(data)
+	})
+}
+
+func TestCorpusCoversAllTypes(t *testing.T) {
+	cases, err := Load(Corpus())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var all strings.Builder
+	for _, c := range cases {
+		if c.Valid {
+			all.Write(c.Expected)
+		}
+	}
+	for _, typ := range []string{"string", "integer", "float", "bool", "datetime", "bytes"} {
+		if !strings.Contains(all.String(), `"type": "`+typ+`"`) {
+			t.Errorf("No valid case with a %s value", typ)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	fsys := fstest.MapFS{
+		"valid/a.conf":   {Data: []byte("a = 1.50")},
+		"valid/a.json":   {Data: []byte(`{"a": {"type": "float", "value": "1.5"}}`)},
+		"invalid/b.conf": {Data: []byte("b = ")},
+		"invalid/b.err":  {Data: []byte("expected value\n")},
+	}
+	cases, err := Load(fsys)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(cases) != 2 || cases[0].Name != "invalid/b" || cases[1].Name != "valid/a" {
+		t.Fatalf("Unexpected cases: %+v", cases)
+	}
+	invalid, valid := cases[0], cases[1]
+	if invalid.Error != "expected value" {
+		t.Fatalf("Unexpected error text %q", invalid.Error)
+	}
+
+	if err := valid.Check(map[string]any{"a": 1.5}, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := valid.Check(map[string]any{"a": int64(1)}, nil); err == nil {
+		t.Fatal("Expected a mismatch for an integer")
+	}
+	if err := valid.Check(nil, errors.New("boom")); err == nil {
+		t.Fatal("Expected an error for a failed parse")
+	}
+	if err := invalid.Check(map[string]any{}, nil); err == nil {
+		t.Fatal("Expected an error for a successful parse")
+	}
+	if err := invalid.Check(nil, errors.New("Expected value but found new line")); err == nil {
+		t.Fatal("Expected an error for a different message")
+	}
+	if err := invalid.Check(nil, errors.New("expected value")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,292 @@
+// Package confvault resolves variable references to secrets kept in
+// HashiCorp Vault, through its HTTP API.
+//
+// References name the path of a secret and, after a '#', one of its
+// fields:
+//
+//	r := &confvault.Resolver{Addr: "https://vault:8200", Token: token}
+//	s, err := conf.NewStore("app.conf", conf.WithVariableResolver("vault", r))
+//	if err != nil {
+//		return err
+//	}
+//	go r.Renew(ctx, time.Minute, func() { s.Reload() }, nil)
+//
+// with app.conf holding
+//
+//	db {
+//	  user: $vault:database/creds/app#username
+//	  password: $vault:database/creds/app#password
+//	}
+//
+// Secrets are read once and cached, so all references to the same secret
+// see the same version, such as a matching user name and password of
+// dynamic database credentials. Renew keeps their leases alive and reads
+// them again before they expire.
+package confvault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resolver is a conf.VariableResolver reading secrets from Vault.
+type Resolver struct {
+	// Addr is the address of the Vault server, such as
+	// https://127.0.0.1:8200.
+	Addr  string
+	Token string
+	// HTTPClient is used for the requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+	// Refresh is how often Renew reads secrets without a lease again, such
+	// as those of the KV engine, to pick up new versions. Such secrets are
+	// never read again when zero.
+	Refresh time.Duration
+
+	mu      sync.Mutex
+	secrets map[string]*secret
+}
+
+// secret is a cached secret and its lease.
+type secret struct {
+	data      map[string]any
+	read      time.Time
+	leaseID   string
+	renewable bool
+	lease     time.Duration
+	expires   time.Time
+}
+
+// response is the part of Vault responses used for secrets and renewals.
+type response struct {
+	LeaseID       string          `json:"lease_id"`
+	Renewable     bool            `json:"renewable"`
+	LeaseDuration int             `json:"lease_duration"`
+	Data          json.RawMessage `json:"data"`
+	Errors        []string        `json:"errors"`
+}
+
+// Resolve returns the field of the secret ref names, as path#field, or all
+// fields as a map when ref has no field.
+func (r *Resolver) Resolve(ref string) (any, error) {
+	path, field, hasField := strings.Cut(ref, "#")
+	s, err := r.secret(path)
+	if err != nil {
+		return nil, err
+	}
+	if !hasField {
+		return jsonValue(s.data), nil
+	}
+	v, ok := s.data[field]
+	if !ok {
+		return nil, fmt.Errorf("secret '%s' has no field '%s'", path, field)
+	}
+	return jsonValue(v), nil
+}
+
+// secret returns the cached secret at path, reading it when it is not
+// cached or its lease expired.
+func (r *Resolver) secret(path string) (*secret, error) {
+	r.mu.Lock()
+	s, ok := r.secrets[path]
+	fresh := ok && (s.leaseID == "" || time.Now().Before(s.expires))
+	r.mu.Unlock()
+	if fresh {
+		return s, nil
+	}
+	s, err := r.read(context.Background(), path)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	if r.secrets == nil {
+		r.secrets = make(map[string]*secret)
+	}
+	r.secrets[path] = s
+	r.mu.Unlock()
+	return s, nil
+}
+
+// read reads the secret at path from Vault.
+func (r *Resolver) read(ctx context.Context, path string) (*secret, error) {
+	var resp response
+	if err := r.do(ctx, http.MethodGet, "/v1/"+strings.TrimPrefix(path, "/"), nil, &resp); err != nil {
+		return nil, fmt.Errorf("reading secret '%s': %v", path, err)
+	}
+	var data map[string]any
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		return nil, fmt.Errorf("reading secret '%s': %v", path, err)
+	}
+	// Version 2 of the KV engine nests the fields next to metadata.
+	if inner, ok := data["data"].(map[string]any); ok {
+		if _, ok := data["metadata"]; ok {
+			data = inner
+		}
+	}
+	now := time.Now()
+	s := &secret{data: data, read: now, leaseID: resp.LeaseID, renewable: resp.Renewable}
+	if resp.LeaseID != "" {
+		s.lease = time.Duration(resp.LeaseDuration) * time.Second
+		s.expires = now.Add(s.lease)
+	}
+	return s, nil
+}
+
+// renew extends the lease of s.
+func (r *Resolver) renew(ctx context.Context, s *secret) error {
+	body := map[string]any{"lease_id": s.leaseID, "increment": int(s.lease.Seconds())}
+	var resp response
+	if err := r.do(ctx, http.MethodPut, "/v1/sys/leases/renew", body, &resp); err != nil {
+		return fmt.Errorf("renewing lease '%s': %v", s.leaseID, err)
+	}
+	lease := time.Duration(resp.LeaseDuration) * time.Second
+	r.mu.Lock()
+	s.renewable = resp.Renewable
+	s.expires = time.Now().Add(lease)
+	r.mu.Unlock()
+	return nil
+}
+
+// do sends a request to Vault and decodes the response into out.
+func (r *Resolver) do(ctx context.Context, method, path string, body any, out *response) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(r.Addr, "/")+path, &buf)
+	if err != nil {
+		return err
+	}
+	if r.Token != "" {
+		req.Header.Set("X-Vault-Token", r.Token)
+	}
+	hc := r.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil && resp.StatusCode == http.StatusOK {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		if len(out.Errors) > 0 {
+			return fmt.Errorf("%s: %s", resp.Status, strings.Join(out.Errors, ", "))
+		}
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// Renew keeps the leases of the cached secrets alive and reads secrets
+// again once their leases can not be renewed any longer, or every Refresh
+// for secrets without a lease. It checks the secrets every interval until
+// ctx is done, and returns the error of ctx.
+//
+// When a secret read again holds other values, reload is called, which
+// typically reloads the Store of the config so the references resolve to
+// the new values. Errors are passed to onError, if not nil.
+func (r *Resolver) Renew(ctx context.Context, interval time.Duration, reload func(), onError func(error)) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+		changed, errs := r.refresh(ctx, interval)
+		if onError != nil {
+			for _, err := range errs {
+				onError(err)
+			}
+		}
+		if changed && reload != nil {
+			reload()
+		}
+	}
+}
+
+// refresh renews or reads again the cached secrets that are due and
+// reports whether any of the secrets read again changed.
+func (r *Resolver) refresh(ctx context.Context, interval time.Duration) (bool, []error) {
+	r.mu.Lock()
+	due := make(map[string]*secret)
+	now := time.Now()
+	for path, s := range r.secrets {
+		switch {
+		case s.leaseID != "":
+			// Act once less than a third of the lease is left, or
+			// before the next check would come too late.
+			if left := s.expires.Sub(now); left < s.lease/3 || left < 2*interval {
+				due[path] = s
+			}
+		case r.Refresh > 0 && now.Sub(s.read) >= r.Refresh:
+			due[path] = s
+		}
+	}
+	r.mu.Unlock()
+
+	var changed bool
+	var errs []error
+	for path, s := range due {
+		if s.leaseID != "" && s.renewable {
+			err := r.renew(ctx, s)
+			if err == nil && s.expires.Sub(time.Now()) >= 2*interval {
+				continue
+			}
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+		ns, err := r.read(ctx, path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		r.mu.Lock()
+		r.secrets[path] = ns
+		r.mu.Unlock()
+		if !reflect.DeepEqual(ns.data, s.data) {
+			changed = true
+		}
+	}
+	return changed, errs
+}
+
+// jsonValue converts a decoded JSON value to the types of parsed configs,
+// with whole numbers as int64.
+func jsonValue(v any) any {
+	switch v := v.(type) {
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<63 {
+			return int64(v)
+		}
+		return v
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[k] = jsonValue(e)
+		}
+		return m
+	case []any:
+		arr := make([]any, len(v))
+		for i, e := range v {
+			arr[i] = jsonValue(e)
+		}
+		return arr
+	}
+	return v
+}
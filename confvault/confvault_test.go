@@ -0,0 +1,161 @@
+package confvault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	conf "github.com/ninepeach/go-conf"
+)
+
+// fakeVault serves a KV version 2 secret and dynamic database credentials
+// with a one second lease, whose renewals hit the maximum lease time.
+type fakeVault struct {
+	mu      sync.Mutex
+	reads   map[string]int
+	renewed int
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Header.Get("X-Vault-Token") != "t0ken" {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]any{"errors": []string{"permission denied"}})
+		return
+	}
+	if f.reads == nil {
+		f.reads = make(map[string]int)
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	f.reads[path]++
+	var resp map[string]any
+	switch path {
+	case "secret/data/app":
+		resp = map[string]any{"data": map[string]any{
+			"data":     map[string]any{"api_key": "k3y", "port": 4222},
+			"metadata": map[string]any{"version": 3},
+		}}
+	case "database/creds/app":
+		n := f.reads[path]
+		resp = map[string]any{
+			"lease_id":       fmt.Sprintf("database/creds/app/%d", n),
+			"lease_duration": 1,
+			"renewable":      true,
+			"data":           map[string]any{"username": fmt.Sprintf("user%d", n), "password": fmt.Sprintf("pass%d", n)},
+		}
+	case "sys/leases/renew":
+		f.renewed++
+		resp = map[string]any{"lease_duration": 0}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]any{"errors": []string{}})
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func TestResolve(t *testing.T) {
+	f := &fakeVault{}
+	ts := httptest.NewServer(f)
+	defer ts.Close()
+
+	r := &Resolver{Addr: ts.URL, Token: "t0ken"}
+	data := `
+		api_key = $vault:secret/data/app#api_key
+		port = $vault:secret/data/app#port
+		db {
+			user = $vault:database/creds/app#username
+			password = $vault:database/creds/app#password
+		}
+	`
+	m, err := conf.Parse(data, conf.WithVariableResolver("vault", r))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ex := map[string]any{
+		"api_key": "k3y",
+		"port":    int64(4222),
+		"db":      map[string]any{"user": "user1", "password": "pass1"},
+	}
+	if !reflect.DeepEqual(m, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, ex)
+	}
+	// Each secret is read once.
+	if f.reads["secret/data/app"] != 1 || f.reads["database/creds/app"] != 1 {
+		t.Fatalf("Unexpected reads: %+v", f.reads)
+	}
+
+	for ref, msg := range map[string]string{
+		"secret/data/app#missing": "secret 'secret/data/app' has no field 'missing'",
+		"secret/data/other#key":   "reading secret 'secret/data/other': unexpected status 404 Not Found",
+	} {
+		if _, err := r.Resolve(ref); err == nil || err.Error() != msg {
+			t.Fatalf("Expected error %q, got %v", msg, err)
+		}
+	}
+	r = &Resolver{Addr: ts.URL, Token: "wrong"}
+	if _, err := r.Resolve("secret/data/app"); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Fatalf("Expected a permission error, got %v", err)
+	}
+}
+
+func TestRenew(t *testing.T) {
+	f := &fakeVault{}
+	ts := httptest.NewServer(f)
+	defer ts.Close()
+
+	fp := filepath.Join(t.TempDir(), "app.conf")
+	if err := os.WriteFile(fp, []byte("db { user = $vault:database/creds/app#username }"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r := &Resolver{Addr: ts.URL, Token: "t0ken"}
+	s, err := conf.NewStore(fp, conf.WithVariableResolver("vault", r))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if v, _ := conf.Lookup(s.Load(), "db.user"); v != "user1" {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", v, "user1")
+	}
+
+	reloaded := make(chan []conf.Change, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- r.Renew(ctx, 10*time.Millisecond, func() {
+			changes, err := s.Reload()
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			reloaded <- changes
+		}, func(err error) { t.Errorf("Unexpected error: %v", err) })
+	}()
+
+	// The lease can not be extended, so the credentials are read again.
+	select {
+	case changes := <-reloaded:
+		if len(changes) != 1 || changes[0].Path != "db.user" || changes[0].New != "user2" {
+			t.Fatalf("Unexpected changes: %+v", changes)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for a reload")
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", err, context.Canceled)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.renewed == 0 {
+		t.Fatal("Expected the lease to be renewed")
+	}
+}
@@ -0,0 +1,123 @@
+package conf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Context describes where in the config a value occurs, for the hook of
+// WithContextHook.
+type Context struct {
+	// Path is the full key path of the value as with Lookup, such as
+	// "accounts.A.users[0].password".
+	Path string
+
+	// Depth is the number of maps and arrays the value is nested in, 1 for
+	// the values of top level keys.
+	Depth int
+
+	// File, Line and Pos are where the value was defined.
+	File string
+	Line int
+	Pos  int
+
+	// Variable is the name of the variable reference the value was
+	// resolved from, if any.
+	Variable string
+
+	// Func is the name of the function call that returned the value, if
+	// any.
+	Func string
+
+	// Env is set when the value was looked up in the environment, by a
+	// variable reference or env().
+	Env bool
+}
+
+// Within reports whether the value is at or below the key path prefix,
+// such as "accounts".
+func (c Context) Within(prefix string) bool {
+	if prefix == "" || c.Path == prefix {
+		return true
+	}
+	rest, ok := strings.CutPrefix(c.Path, prefix)
+	return ok && (rest[0] == '.' || rest[0] == '[')
+}
+
+// WithContextHook calls fn for every value set while parsing, including
+// maps and arrays once they are closed, with where it occurs. An error
+// returned by fn fails the parse at the value, which lets applications
+// add their own rules, such as rejecting environment variables inside
+// accounts {}:
+//
+//	conf.WithContextHook(func(c conf.Context, v any) error {
+//		if c.Env && c.Within("accounts") {
+//			return errors.New("environment variables are not allowed in accounts")
+//		}
+//		return nil
+//	})
+//
+// Values merged in from include files are reported while the include is
+// parsed, with paths including the key the include is mounted at.
+func WithContextHook(fn func(c Context, value any) error) Option {
+	return func(o *options) {
+		o.contextHook = fn
+	}
+}
+
+// callContextHook passes the value v of it to the context hook.
+func (p *parser) callContextHook(it item, v any) error {
+	c := p.context(it)
+	c.Env = p.fromEnv
+	switch it.Type {
+	case itemVariable:
+		c.Variable = it.Val
+	case itemCall:
+		c.Func, _, _ = strings.Cut(it.Val, "(")
+	}
+	if err := p.opts.contextHook(c, plainValue(v)); err != nil {
+		return p.errorf(it, "%w", err)
+	}
+	return nil
+}
+
+// context returns the context of the value being set by it.
+func (p *parser) context(it item) Context {
+	path, depth := p.valuePath()
+	return Context{
+		Path:  path,
+		Depth: depth,
+		File:  p.file,
+		Line:  it.Line,
+		Pos:   it.Pos,
+	}
+}
+
+// valuePath returns the key path of the value being set and the number
+// of maps and arrays it is nested in.
+func (p *parser) valuePath() (string, int) {
+	path := p.prefix
+	elems, _ := parsePath(path)
+	depth := len(elems)
+	keys := p.keys
+	// The first context is the fallback for variable lookups, and the
+	// array of a value document holds the document rather than a value.
+	start := 1
+	if p.valueDoc {
+		start = 3
+	}
+	for _, ctx := range p.ctxs[min(start, len(p.ctxs)):] {
+		switch c := ctx.(type) {
+		case map[string]any:
+			if len(keys) == 0 {
+				continue
+			}
+			path = joinPath(path, keys[0])
+			keys = keys[1:]
+		case []any:
+			path = fmt.Sprintf("%s[%d]", path, len(c))
+		}
+		depth++
+	}
+	return path, depth
+}
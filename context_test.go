@@ -0,0 +1,103 @@
+package conf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestContextHook(t *testing.T) {
+	type seen struct {
+		path  string
+		depth int
+	}
+	var got []seen
+	m, err := Parse(`
+		a = 1
+		b { c = [1, {d: $a}] }
+	`, WithContextHook(func(c Context, v any) error {
+		got = append(got, seen{c.Path, c.Depth})
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []seen{
+		{"a", 1},
+		{"b.c[0]", 3},
+		{"b.c[1].d", 4},
+		{"b.c[1]", 3},
+		{"b.c", 2},
+		{"b", 1},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", got, expected)
+	}
+	if v, _ := Lookup(m, "b.c[1].d"); v != int64(1) {
+		t.Fatalf("Unexpected config: %+v", m)
+	}
+}
+
+func TestContextHookReject(t *testing.T) {
+	t.Setenv("CONF_TEST_CONTEXT_PASS", "secret")
+	noEnv := WithContextHook(func(c Context, v any) error {
+		if c.Env && c.Within("accounts") {
+			return errors.New("environment variables are not allowed in accounts")
+		}
+		return nil
+	})
+
+	for _, tc := range []struct {
+		name, data, err string
+	}{
+		{"outside", "pass = $CONF_TEST_CONTEXT_PASS\naccounts { A { users = [{pass: s3cr3t}] } }", ""},
+		{"reference", "accounts {\n  A { users = [{pass: $CONF_TEST_CONTEXT_PASS}] }\n}",
+			"environment variables are not allowed in accounts (:2:24)"},
+		{"env", "accounts {\n  pass = env(\"CONF_TEST_CONTEXT_PASS\")\n}",
+			"environment variables are not allowed in accounts (:2:10)"},
+		{"prefix", "accounts_extra { pass = $CONF_TEST_CONTEXT_PASS }", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(tc.data, noEnv)
+			if tc.err == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tc.err {
+				t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestContextHookInclude(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "users.conf"), []byte("users = [{user: a}]"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fp := filepath.Join(dir, "app.conf")
+	if err := os.WriteFile(fp, []byte("accounts { A: { include users.conf } }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	_, err := ParseFile(fp,
+		WithIncludeCache(NewIncludeCache()),
+		WithContextHook(func(c Context, v any) error {
+			if strings.HasSuffix(c.File, "users.conf") {
+				paths = append(paths, c.Path)
+			}
+			return nil
+		}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{"accounts.A.users[0].user", "accounts.A.users[0]", "accounts.A.users"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", paths, expected)
+	}
+}
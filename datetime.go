@@ -0,0 +1,23 @@
+package conf
+
+import "time"
+
+// WithLocation interprets datetimes written without 'Z' or an offset, such
+// as 2024-05-01T10:00:00, in loc. By default they are in UTC.
+func WithLocation(loc *time.Location) Option {
+	return func(o *options) {
+		o.location = loc
+	}
+}
+
+// parseDatetime parses a datetime literal, which ends in 'Z', in an offset
+// such as +08:00, or in neither for a time in loc.
+func parseDatetime(val string, loc *time.Location) (time.Time, error) {
+	if len(val) == len("2006-01-02T15:04:05") {
+		if loc == nil {
+			loc = time.UTC
+		}
+		return time.ParseInLocation("2006-01-02T15:04:05", val, loc)
+	}
+	return time.Parse(time.RFC3339, val)
+}
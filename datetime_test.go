@@ -0,0 +1,43 @@
+package conf
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDatetimeOffsets(t *testing.T) {
+	m, err := Parse("utc = 2024-05-01T10:00:00Z\nshanghai = 2024-05-01T10:00:00+08:00\nlocal = 2024-05-01T10:00:00")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	utc := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	if got := m["utc"].(time.Time); !got.Equal(utc) || got.Location() != time.UTC {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", got, utc)
+	}
+	if got := m["shanghai"].(time.Time); !got.Equal(utc.Add(-8 * time.Hour)) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", got, utc.Add(-8*time.Hour))
+	}
+	if _, offset := m["shanghai"].(time.Time).Zone(); offset != 8*60*60 {
+		t.Fatalf("Expected the +08:00 offset to be kept, got %d", offset)
+	}
+	// Without a location, local datetimes are in UTC.
+	if got := m["local"].(time.Time); !got.Equal(utc) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", got, utc)
+	}
+}
+
+func TestWithLocation(t *testing.T) {
+	loc := time.FixedZone("EST", -5*60*60)
+	m, err := Parse("local = 2024-05-01T10:00:00; utc = 2024-05-01T10:00:00Z", WithLocation(loc))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ex := time.Date(2024, 5, 1, 10, 0, 0, 0, loc)
+	if got := m["local"].(time.Time); !got.Equal(ex) || got.Location() != loc {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", got, ex)
+	}
+	// Explicit zones are kept.
+	if got := m["utc"].(time.Time); got.Location() != time.UTC {
+		t.Fatalf("Expected UTC, got %v", got.Location())
+	}
+}
@@ -0,0 +1,123 @@
+package conf
+
+import (
+	"fmt"
+	"time"
+)
+
+// The Decode functions convert the values of a parsed config to Go types
+// without reflection, for the decoders generated by cmd/confgen. Values of
+// a parse with checks are unwrapped from their tokens. path is the key
+// path of the value, reported in errors.
+
+// DecodeError is returned for a value that does not fit the Go type of
+// the field it is decoded into.
+type DecodeError struct {
+	Path  string
+	Value any
+	Type  string
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%s: cannot decode %s '%v' into %s", e.Path, kindOf(e.Value), e.Value, e.Type)
+}
+
+// JoinPath returns the key path of key in the map at the key path path,
+// quoting key as needed.
+func JoinPath(path, key string) string {
+	return joinPath(path, key)
+}
+
+// DecodeString decodes a string.
+func DecodeString(v any, path string) (string, error) {
+	if s, ok := plainValue(v).(string); ok {
+		return s, nil
+	}
+	return "", &DecodeError{Path: path, Value: plainValue(v), Type: "string"}
+}
+
+// DecodeBool decodes a bool.
+func DecodeBool(v any, path string) (bool, error) {
+	if b, ok := plainValue(v).(bool); ok {
+		return b, nil
+	}
+	return false, &DecodeError{Path: path, Value: plainValue(v), Type: "bool"}
+}
+
+// DecodeInt decodes an integer, including sizes such as 4kb, that fits a
+// signed integer of the given number of bits.
+func DecodeInt(v any, path string, bits int) (int64, error) {
+	v = plainValue(v)
+	n, ok := v.(int64)
+	if !ok {
+		n, ok = unitValue(v)
+	}
+	if !ok || bits < 64 && (n < -1<<(bits-1) || n > 1<<(bits-1)-1) {
+		return 0, &DecodeError{Path: path, Value: v, Type: fmt.Sprintf("int%d", bits)}
+	}
+	return n, nil
+}
+
+// DecodeUint decodes a non-negative integer that fits an unsigned integer
+// of the given number of bits.
+func DecodeUint(v any, path string, bits int) (uint64, error) {
+	n, err := DecodeInt(v, path, 64)
+	if err != nil || n < 0 || bits < 64 && uint64(n) > 1<<bits-1 {
+		return 0, &DecodeError{Path: path, Value: plainValue(v), Type: fmt.Sprintf("uint%d", bits)}
+	}
+	return uint64(n), nil
+}
+
+// DecodeFloat decodes a float or an integer.
+func DecodeFloat(v any, path string) (float64, error) {
+	switch vv := plainValue(v).(type) {
+	case float64:
+		return vv, nil
+	case int64:
+		return float64(vv), nil
+	}
+	if n, ok := unitValue(plainValue(v)); ok {
+		return float64(n), nil
+	}
+	return 0, &DecodeError{Path: path, Value: plainValue(v), Type: "float64"}
+}
+
+// DecodeDuration decodes a string such as "1m30s" as a duration.
+func DecodeDuration(v any, path string) (time.Duration, error) {
+	if s, ok := plainValue(v).(string); ok {
+		if d, err := time.ParseDuration(s); err == nil {
+			return d, nil
+		}
+	}
+	return 0, &DecodeError{Path: path, Value: plainValue(v), Type: "time.Duration"}
+}
+
+// DecodeTime decodes a datetime.
+func DecodeTime(v any, path string) (time.Time, error) {
+	if t, ok := plainValue(v).(time.Time); ok {
+		return t, nil
+	}
+	return time.Time{}, &DecodeError{Path: path, Value: plainValue(v), Type: "time.Time"}
+}
+
+// DecodeMap decodes a map, whose values are decoded in turn.
+func DecodeMap(v any, path string) (map[string]any, error) {
+	if m, ok := plainValue(v).(map[string]any); ok {
+		return m, nil
+	}
+	return nil, &DecodeError{Path: path, Value: plainValue(v), Type: "map"}
+}
+
+// DecodeArray decodes an array, whose elements are decoded in turn.
+func DecodeArray(v any, path string) ([]any, error) {
+	if a, ok := plainValue(v).([]any); ok {
+		return a, nil
+	}
+	return nil, &DecodeError{Path: path, Value: plainValue(v), Type: "array"}
+}
+
+// DecodeAny returns the value with the tokens of a parse with checks
+// removed, for fields of type any.
+func DecodeAny(v any) any {
+	return stripValue(v)
+}
@@ -0,0 +1,63 @@
+package conf
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDecodeInt(t *testing.T) {
+	for _, test := range []struct {
+		v    any
+		bits int
+		ok   bool
+	}{
+		{int64(127), 8, true},
+		{int64(128), 8, false},
+		{int64(-128), 8, true},
+		{int64(-129), 8, false},
+		{int64(1) << 40, 64, true},
+		{ByteSize{Bytes: 4096, Unit: "kb"}, 16, true},
+		{NewToken(int64(1), "", 1, 0), 8, true},
+		{"1", 64, false},
+		{1.5, 64, false},
+	} {
+		_, err := DecodeInt(test.v, "n", test.bits)
+		if (err == nil) != test.ok {
+			t.Fatalf("Mismatch for %v in %d bits:\nReceived: '%+v'\nExpected: '%+v'\n", test.v, test.bits, err, test.ok)
+		}
+	}
+	for _, test := range []struct {
+		v    any
+		bits int
+		ok   bool
+	}{
+		{int64(255), 8, true},
+		{int64(256), 8, false},
+		{int64(-1), 64, false},
+		{int64(1) << 62, 64, true},
+	} {
+		_, err := DecodeUint(test.v, "n", test.bits)
+		if (err == nil) != test.ok {
+			t.Fatalf("Mismatch for %v in %d bits:\nReceived: '%+v'\nExpected: '%+v'\n", test.v, test.bits, err, test.ok)
+		}
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	_, err := DecodeDuration("soon", JoinPath("http", "read.timeout"))
+	var de *DecodeError
+	if !errors.As(err, &de) {
+		t.Fatalf("Expected a *DecodeError, got %v", err)
+	}
+	expected := `http."read.timeout": cannot decode string 'soon' into time.Duration`
+	if err.Error() != expected {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", err.Error(), expected)
+	}
+	if d, err := DecodeDuration("1m30s", ""); err != nil || d != 90*time.Second {
+		t.Fatalf("Unexpected duration %v: %v", d, err)
+	}
+	if f, err := DecodeFloat(int64(2), ""); err != nil || f != 2 {
+		t.Fatalf("Unexpected float %v: %v", f, err)
+	}
+}
@@ -0,0 +1,105 @@
+package conf
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// encPrefix starts encrypted values, e.g. enc:AES256:<base64>.
+const encPrefix = "enc:"
+
+// Decryptor decrypts values written as enc:<scheme>:<base64 ciphertext>,
+// so secrets can be kept encrypted in config files.
+type Decryptor interface {
+	Decrypt(scheme string, ciphertext []byte) ([]byte, error)
+}
+
+// DecryptorFunc adapts a function to a Decryptor.
+type DecryptorFunc func(scheme string, ciphertext []byte) ([]byte, error)
+
+func (f DecryptorFunc) Decrypt(scheme string, ciphertext []byte) ([]byte, error) {
+	return f(scheme, ciphertext)
+}
+
+// WithDecryptor decrypts encrypted string values with d while parsing.
+// Without a Decryptor such values are kept as they are.
+func WithDecryptor(d Decryptor) Option {
+	return func(o *options) {
+		o.decryptor = d
+	}
+}
+
+// decrypt returns the plaintext of s if it is an encrypted value.
+func (p *parser) decrypt(it item, s string) (string, error) {
+	d := p.opts.decryptor
+	if d == nil || !strings.HasPrefix(s, encPrefix) {
+		return s, nil
+	}
+	scheme, payload, ok := strings.Cut(s[len(encPrefix):], ":")
+	if !ok || scheme == "" {
+		return "", p.errorf(it, "invalid encrypted value, expected enc:<scheme>:<base64>")
+	}
+	ciphertext, err := parseBytes(`base64"` + payload)
+	if err != nil {
+		return "", p.errorf(it, "invalid encrypted value: %w", err)
+	}
+	plaintext, err := d.Decrypt(scheme, ciphertext)
+	if err != nil {
+		return "", p.errorf(it, "can not decrypt value: %w", err)
+	}
+	p.state.secrets = append(p.state.secrets, string(plaintext))
+	return string(plaintext), nil
+}
+
+// SchemeAES256 is the scheme of values encrypted with EncryptAES.
+const SchemeAES256 = "AES256"
+
+// NewAESDecryptor returns a Decryptor for values encrypted with EncryptAES
+// using the 32 byte key.
+func NewAESDecryptor(key []byte) (Decryptor, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return DecryptorFunc(func(scheme string, ciphertext []byte) ([]byte, error) {
+		if scheme != SchemeAES256 {
+			return nil, fmt.Errorf("unsupported encryption scheme '%s'", scheme)
+		}
+		n := aead.NonceSize()
+		if len(ciphertext) < n {
+			return nil, errors.New("ciphertext too short")
+		}
+		return aead.Open(nil, ciphertext[:n], ciphertext[n:], nil)
+	}), nil
+}
+
+// EncryptAES encrypts plaintext with AES-256-GCM using the 32 byte key and
+// returns it as a value for config files, enc:AES256:<base64>.
+func EncryptAES(key, plaintext []byte) (string, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, nil)
+	return encPrefix + SchemeAES256 + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("AES256 key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
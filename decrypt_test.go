@@ -0,0 +1,72 @@
+package conf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDecryptAES(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	enc, err := EncryptAES(key, []byte("s3cret"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	d, err := NewAESDecryptor(key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	data := fmt.Sprintf("password = %s\nquoted = \"%s\"\nplain = x", enc, enc)
+	for _, parse := range []func(string, ...Option) (map[string]any, error){Parse, ParseWithChecks} {
+		m, err := parse(data, WithDecryptor(d))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		m = StripTokens(m)
+		if m["password"] != "s3cret" || m["quoted"] != "s3cret" || m["plain"] != "x" {
+			t.Fatalf("Unexpected result: %+v", m)
+		}
+	}
+
+	// Without a decryptor the value is kept.
+	m, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m["password"] != enc {
+		t.Fatalf("Unexpected result: %+v", m)
+	}
+
+	other, _ := NewAESDecryptor(bytes.Repeat([]byte{8}, 32))
+	_, err = Parse("a = 1\npassword = "+enc, WithDecryptor(other))
+	var pe *ParseError
+	if !errors.As(err, &pe) || pe.Line != 2 {
+		t.Fatalf("Expected positioned decryption error, got %v", err)
+	}
+	if _, err := NewAESDecryptor([]byte("short")); err == nil {
+		t.Fatal("Expected error for short key")
+	}
+}
+
+func TestDecryptorFunc(t *testing.T) {
+	rot := DecryptorFunc(func(scheme string, ciphertext []byte) ([]byte, error) {
+		if scheme != "REV" {
+			return nil, fmt.Errorf("unsupported scheme '%s'", scheme)
+		}
+		for i, j := 0, len(ciphertext)-1; i < j; i, j = i+1, j-1 {
+			ciphertext[i], ciphertext[j] = ciphertext[j], ciphertext[i]
+		}
+		return ciphertext, nil
+	})
+	m, err := Parse(`a = "enc:REV:Y2Jh"`, WithDecryptor(rot))
+	if err != nil || m["a"] != "abc" {
+		t.Fatalf("Unexpected result: %+v %v", m, err)
+	}
+	for _, data := range []string{`a = "enc:XOR:Y2Jh"`, `a = "enc:REV"`, `a = "enc:REV:!!"`} {
+		if _, err := Parse(data, WithDecryptor(rot)); err == nil || !strings.Contains(err.Error(), "(:1:") {
+			t.Fatalf("Expected positioned error for %s, got %v", data, err)
+		}
+	}
+}
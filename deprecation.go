@@ -0,0 +1,217 @@
+package conf
+
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Deprecation describes a config key that has been renamed or retired.
+type Deprecation struct {
+	// NewKey is the full key path replacing the deprecated key, e.g.
+	// "cluster.listen". When empty the key is kept and only a warning is
+	// reported.
+	NewKey string
+
+	// Sunset is the version from which on the deprecated key is rejected
+	// instead of remapped. It is compared against the version set with
+	// WithVersion. Empty means the key is never rejected.
+	Sunset string
+
+	// Message is added to the warning or error, e.g. to point to docs.
+	Message string
+}
+
+// WithDeprecations remaps deprecated keys, given by their full key path, as
+// they are parsed. Each use is reported through the warning handler.
+func WithDeprecations(deps map[string]Deprecation) Option {
+	return func(o *options) {
+		o.deprecations = make(map[string]Deprecation, len(deps))
+		for path, d := range deps {
+			d.NewKey = canonicalPath(d.NewKey)
+			o.deprecations[canonicalPath(path)] = d
+		}
+	}
+}
+
+// WithVersion sets the application version that deprecation sunsets are
+// compared against. Versions are compared as in semantic versioning, so a
+// pre-release such as "2.0.0-rc1" is still before a sunset of "2.0".
+func WithVersion(version string) Option {
+	return func(o *options) {
+		o.version = version
+	}
+}
+
+type pendingMove struct {
+	path  string
+	value any
+	file  string
+	item  item
+}
+
+// deprecatedKey checks the key being set in ctx against the configured
+// deprecations. It returns the key to set the value under, or an empty key
+// when the value was handled otherwise.
+func (p *parser) deprecatedKey(ctx map[string]any, key string, it item, val any) (string, error) {
+	parent := p.keyPrefix()
+	path := joinPath(parent, key)
+	d, ok := p.opts.deprecations[path]
+	if !ok {
+		return key, nil
+	}
+
+	if d.Sunset != "" && p.opts.version != "" && compareVersions(p.opts.version, d.Sunset) >= 0 {
+		msg := fmt.Sprintf("key '%s' was removed in version %s", path, d.Sunset)
+		if d.NewKey != "" {
+			msg += fmt.Sprintf(", use '%s' instead", d.NewKey)
+		}
+		return "", p.errorf(it, "%s%s", msg, d.suffix())
+	}
+	if d.NewKey == "" {
+		p.warnf(it, "key '%s' is deprecated%s", path, d.suffix())
+		return key, nil
+	}
+
+	newParent, newKey := splitPath(d.NewKey)
+	if newParent == parent {
+		if _, ok := ctx[newKey]; ok {
+			p.warnf(it, "ignoring deprecated key '%s' since '%s' is set%s", path, d.NewKey, d.suffix())
+			return "", nil
+		}
+		p.warnf(it, "key '%s' is deprecated, use '%s' instead%s", path, d.NewKey, d.suffix())
+		return newKey, nil
+	}
+
+	p.warnf(it, "key '%s' is deprecated, use '%s' instead%s", path, d.NewKey, d.suffix())
+	if tk, ok := val.(*Token); ok {
+		tk.item.Pos = it.Pos
+		tk.item.Line = it.Line
+	}
+	p.state.moves = append(p.state.moves, pendingMove{d.NewKey, val, p.file, it})
+	return "", nil
+}
+
+func (d Deprecation) suffix() string {
+	if d.Message == "" {
+		return ""
+	}
+	return ": " + d.Message
+}
+
+// applyMoves sets the values of deprecated keys that were renamed into a
+// different block, creating the enclosing maps as needed. Values already
+// set under the new key take precedence.
+func (p *parser) applyMoves() error {
+	for _, mv := range p.state.moves {
+		ctx := p.mapping
+		parts, err := pathKeys(mv.path)
+		if err != nil {
+			return &ParseError{File: mv.file, Line: mv.item.Line, Pos: mv.item.Pos,
+				Err: fmt.Errorf("can not move deprecated key: %v", err)}
+		}
+		for _, part := range parts[:len(parts)-1] {
+			next, ok := plainValue(ctx[part]).(map[string]any)
+			if !ok {
+				if _, exists := ctx[part]; exists {
+					return &ParseError{File: mv.file, Line: mv.item.Line, Pos: mv.item.Pos,
+						Err: fmt.Errorf("can not move deprecated key to '%s', '%s' is not a map", mv.path, part)}
+				}
+				next = make(map[string]any)
+				ctx[part] = next
+			}
+			ctx = next
+		}
+		key := parts[len(parts)-1]
+		if _, ok := ctx[key]; ok {
+			if p.opts.warn != nil {
+				p.opts.warn(Warning{mv.file, mv.item.Line, mv.item.Pos,
+					fmt.Sprintf("ignoring deprecated key since '%s' is set", mv.path)})
+			}
+			continue
+		}
+		ctx[key] = mv.value
+	}
+	return nil
+}
+
+// splitPath splits a dotted key path into its parent path and last key.
+func splitPath(path string) (string, string) {
+	keys, err := pathKeys(path)
+	if err != nil {
+		return "", path
+	}
+	var parent string
+	for _, k := range keys[:len(keys)-1] {
+		parent = joinPath(parent, k)
+	}
+	return parent, keys[len(keys)-1]
+}
+
+// compareVersions compares version strings such as "v2.10.1" or
+// "2.0.0-rc.1". Missing components count as zero, so "2.1" equals
+// "2.1.0", and pre-releases come before their release, as in semantic
+// versioning. Build metadata after a '+' is ignored.
+func compareVersions(a, b string) int {
+	a, apre := splitVersion(a)
+	b, bpre := splitVersion(b)
+	if c := compareVersionFields(strings.Split(a, "."), strings.Split(b, "."), "0"); c != 0 {
+		return c
+	}
+	switch {
+	case apre == bpre:
+		return 0
+	case apre == "":
+		return 1
+	case bpre == "":
+		return -1
+	}
+	return compareVersionFields(strings.Split(apre, "."), strings.Split(bpre, "."), "")
+}
+
+// splitVersion splits a version string into its dotted release and its
+// pre-release.
+func splitVersion(v string) (release, pre string) {
+	v, _, _ = strings.Cut(strings.TrimPrefix(v, "v"), "+")
+	release, pre, _ = strings.Cut(v, "-")
+	return release, pre
+}
+
+// compareVersionFields compares the fields of versions in order, taking
+// missing fields as pad. Fields that are both numbers are compared
+// numerically, and numbers come before other fields. An empty pad makes
+// the version with fewer fields come first.
+func compareVersionFields(as, bs []string, pad string) int {
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		x, y := pad, pad
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		if x == y {
+			continue
+		}
+		xn, xerr := strconv.Atoi(x)
+		yn, yerr := strconv.Atoi(y)
+		switch {
+		case x == "":
+			return -1
+		case y == "":
+			return 1
+		case xerr == nil && yerr == nil:
+			if c := cmp.Compare(xn, yn); c != 0 {
+				return c
+			}
+		case xerr == nil:
+			return -1
+		case yerr == nil:
+			return 1
+		default:
+			return strings.Compare(x, y)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,158 @@
+package conf
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDeprecations(t *testing.T) {
+	deps := map[string]Deprecation{
+		"max_conn":          {NewKey: "max_connections"},
+		"cluster_port":      {NewKey: "cluster.port"},
+		"cluster.route_url": {NewKey: "cluster.routes", Message: "see docs"},
+		"legacy":            {},
+	}
+	var warnings []Warning
+	opts := []Option{
+		WithDeprecations(deps),
+		WithWarningHandler(func(w Warning) { warnings = append(warnings, w) }),
+	}
+
+	data := `
+		max_conn = 10
+		cluster_port = 6222
+		legacy = true
+		cluster {
+			route_url = "nats://a:6222"
+		}
+	`
+	ex := map[string]any{
+		"max_connections": int64(10),
+		"legacy":          true,
+		"cluster": map[string]any{
+			"port":   int64(6222),
+			"routes": "nats://a:6222",
+		},
+	}
+	m, err := Parse(data, opts...)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(m, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, ex)
+	}
+	if len(warnings) != 4 {
+		t.Fatalf("Expected 4 warnings, got %+v", warnings)
+	}
+	if w := warnings[0]; w.Line != 2 || !strings.Contains(w.Message, "use 'max_connections'") {
+		t.Fatalf("Unexpected warning: %v", w)
+	}
+	if w := warnings[3]; w.Line != 6 || !strings.HasSuffix(w.Message, ": see docs") {
+		t.Fatalf("Unexpected warning: %v", w)
+	}
+
+	n, err := ParseWithChecks(data, opts...)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(marshaled(m), marshaled(n)) {
+		t.Fatalf("Mismatch after checks:\nReceived: '%s'\nExpected: '%s'\n", marshaled(n), marshaled(m))
+	}
+}
+
+func TestDeprecationNewKeyWins(t *testing.T) {
+	deps := map[string]Deprecation{
+		"max_conn":     {NewKey: "max_connections"},
+		"cluster_port": {NewKey: "cluster.port"},
+	}
+	m, err := Parse(`
+		max_connections = 1
+		max_conn = 2
+		cluster_port = 3
+		cluster { port = 4 }
+	`, WithDeprecations(deps))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ex := map[string]any{
+		"max_connections": int64(1),
+		"cluster":         map[string]any{"port": int64(4)},
+	}
+	if !reflect.DeepEqual(m, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, ex)
+	}
+}
+
+func TestDeprecationSunset(t *testing.T) {
+	deps := map[string]Deprecation{
+		"max_conn": {NewKey: "max_connections", Sunset: "2.10"},
+	}
+	if _, err := Parse("max_conn = 1", WithDeprecations(deps), WithVersion("v2.9.3")); err != nil {
+		t.Fatalf("Unexpected error before sunset: %v", err)
+	}
+	_, err := Parse("\nmax_conn = 1", WithDeprecations(deps), WithVersion("v2.10.0"))
+	if err == nil || !strings.Contains(err.Error(), "removed in version 2.10") ||
+		!strings.Contains(err.Error(), ":2:") {
+		t.Fatalf("Expected sunset error, got %v", err)
+	}
+}
+
+func TestDeprecationInInclude(t *testing.T) {
+	dir := t.TempDir()
+	main := filepath.Join(dir, "main.conf")
+	if err := os.WriteFile(main, []byte("cluster { include 'cluster.conf' }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cluster.conf"), []byte("route_url = x\nlegacy = 1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var warnings []Warning
+	m, err := ParseFile(main,
+		WithDeprecations(map[string]Deprecation{
+			"cluster.route_url": {NewKey: "cluster.routes"},
+			"cluster.legacy":    {},
+		}),
+		WithWarningHandler(func(w Warning) { warnings = append(warnings, w) }))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ex := map[string]any{"cluster": map[string]any{"routes": "x", "legacy": int64(1)}}
+	if !reflect.DeepEqual(m, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, ex)
+	}
+	if len(warnings) != 2 || !strings.HasSuffix(warnings[0].File, "cluster.conf") {
+		t.Fatalf("Expected warning from include file, got %+v", warnings)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		ex   int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"v1.10", "1.9", 1},
+		{"1.2", "1.2.1", -1},
+		{"2.0.0-rc1", "2.0.0-rc2", -1},
+		{"2.1", "2.1.0", 0},
+		{"v2", "2.0.0", 0},
+		{"2.1.0", "2.1", 0},
+		{"2.1.01", "2.1.1", 0},
+		{"2.0.0-rc1", "2.0.0", -1},
+		{"2.0.0", "2.0.0-rc1", 1},
+		{"2.0-beta", "2.0.0", -1},
+		{"2.0.0-rc.2", "2.0.0-rc.10", -1},
+		{"2.0.0-alpha", "2.0.0-alpha.1", -1},
+		{"2.0.0-1", "2.0.0-alpha", -1},
+		{"2.0.0-beta", "2.0.0-alpha.1", 1},
+		{"1.9.9", "2.0.0-rc1", -1},
+		{"2.0.0+build.5", "2.0.0", 0},
+	} {
+		if got := compareVersions(tt.a, tt.b); got != tt.ex {
+			t.Errorf("compareVersions(%q, %q) = %d, expected %d", tt.a, tt.b, got, tt.ex)
+		}
+	}
+}
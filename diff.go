@@ -0,0 +1,148 @@
+package conf
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// ChangeKind describes how a value differs between two configs.
+type ChangeKind int
+
+const (
+	Added ChangeKind = iota
+	Removed
+	Modified
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Modified:
+		return "modified"
+	}
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// Change is a single difference between two configs.
+type Change struct {
+	Kind ChangeKind
+	// Path is the dotted key path of the value, with array elements
+	// addressed as key[i].
+	Path string
+	Old  any
+	New  any
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case Added:
+		return fmt.Sprintf("+ %s = %v", c.Path, c.New)
+	case Removed:
+		return fmt.Sprintf("- %s = %v", c.Path, c.Old)
+	}
+	return fmt.Sprintf("~ %s: %v -> %v", c.Path, c.Old, c.New)
+}
+
+// Diff returns the changes needed to turn old into new, sorted by path.
+// Tokens from a pedantic parse are compared by value, and references kept
+// by WithLateBinding by what they refer to.
+func Diff(old, new map[string]any) []Change {
+	var changes []Change
+	diffMaps("", old, new, &changes)
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+func diffMaps(prefix string, old, new map[string]any, changes *[]Change) {
+	for k, ov := range old {
+		path := joinPath(prefix, k)
+		nv, ok := new[k]
+		if !ok {
+			*changes = append(*changes, Change{Kind: Removed, Path: path, Old: plainValue(ov)})
+			continue
+		}
+		diffValues(path, ov, nv, changes)
+	}
+	for k, nv := range new {
+		if _, ok := old[k]; !ok {
+			*changes = append(*changes, Change{Kind: Added, Path: joinPath(prefix, k), New: plainValue(nv)})
+		}
+	}
+}
+
+func diffValues(path string, ov, nv any, changes *[]Change) {
+	ov, nv = plainValue(ov), plainValue(nv)
+	switch o := ov.(type) {
+	case map[string]any:
+		if n, ok := nv.(map[string]any); ok {
+			diffMaps(path, o, n, changes)
+			return
+		}
+	case []any:
+		if n, ok := nv.([]any); ok {
+			for i := 0; i < len(o) || i < len(n); i++ {
+				ipath := fmt.Sprintf("%s[%d]", path, i)
+				switch {
+				case i >= len(n):
+					*changes = append(*changes, Change{Kind: Removed, Path: ipath, Old: plainValue(o[i])})
+				case i >= len(o):
+					*changes = append(*changes, Change{Kind: Added, Path: ipath, New: plainValue(n[i])})
+				default:
+					diffValues(ipath, o[i], n[i], changes)
+				}
+			}
+			return
+		}
+	case *LateRef:
+		// References are the same as long as they refer to the same
+		// value, which is only resolved when read.
+		if n, ok := nv.(*LateRef); ok && o.Name == n.Name {
+			return
+		}
+	}
+	if !reflect.DeepEqual(stripValue(ov), stripValue(nv)) {
+		*changes = append(*changes, Change{Kind: Modified, Path: path, Old: ov, New: nv})
+	}
+}
+
+// joinPath appends key to the key path prefix, quoting it if needed.
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return quoteKey(key)
+	}
+	return prefix + "." + quoteKey(key)
+}
+
+// plainValue unwraps a token from a pedantic parse.
+func plainValue(v any) any {
+	if tk, ok := v.(*Token); ok {
+		return tk.Value()
+	}
+	return v
+}
+
+// stripValue returns v with any nested tokens replaced by their values.
+func stripValue(v any) any {
+	switch vv := plainValue(v).(type) {
+	case map[string]any:
+		m := make(map[string]any, len(vv))
+		for k, e := range vv {
+			m[k] = stripValue(e)
+		}
+		return m
+	case []any:
+		a := make([]any, len(vv))
+		for i, e := range vv {
+			a[i] = stripValue(e)
+		}
+		return a
+	default:
+		return vv
+	}
+}
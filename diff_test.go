@@ -0,0 +1,41 @@
+package conf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	old, err := Parse(`
+		port = 4222
+		debug = true
+		tls { cert = a.pem; key = a.key }
+		servers = [a, b, c]
+	`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	new, err := ParseWithChecks(`
+		port = 4223
+		tls { cert = b.pem; key = a.key }
+		servers = [a, x]
+		name = n1
+	`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []Change{
+		{Kind: Removed, Path: "debug", Old: true},
+		{Kind: Added, Path: "name", New: "n1"},
+		{Kind: Modified, Path: "port", Old: int64(4222), New: int64(4223)},
+		{Kind: Modified, Path: "servers[1]", Old: "b", New: "x"},
+		{Kind: Removed, Path: "servers[2]", Old: "c"},
+		{Kind: Modified, Path: "tls.cert", Old: "a.pem", New: "b.pem"},
+	}
+	if changes := Diff(old, new); !reflect.DeepEqual(changes, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", changes, expected)
+	}
+	if changes := Diff(old, old); len(changes) != 0 {
+		t.Fatalf("Expected no changes, got %+v", changes)
+	}
+}
@@ -0,0 +1,220 @@
+package conf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+)
+
+// DirectiveFunc handles a directive of a config, with the argument it was
+// given and where it occurs. It returns a value of the types a parse
+// returns. For a directive in place of a key, the Path of c is the key
+// path of the map it appears in and its Depth that of the keys it sets,
+// and the value must be a map.
+type DirectiveFunc func(c Context, arg string) (any, error)
+
+// WithDirective registers fn as the handler of the directive name, which
+// a config can then use in place of a key or a value, followed by its
+// argument:
+//
+//	authorization {
+//		import_users 'users.csv'
+//		admins = import_users 'admins.csv'
+//	}
+//
+// The argument is written as the file of an include, quoted or not. As
+// with include, the keys of a map fn returns for a directive in place of a
+// key are set in the map it appears in, and the value fn returns for a
+// directive in place of a value becomes that value. Errors of fn are
+// reported at the position of the directive. Relative file names in
+// arguments are best resolved against the directory of c.File.
+//
+// A name followed by a key separator or a map is still a key, and include
+// can not be replaced. The built-in directives, which fn replaces when it
+// has the same name, are:
+//
+//	load_csv file    the rows of a CSV file as maps, keyed by its header
+//	load_jsonl file  the JSON objects of a JSON lines file, one per line
+//
+// Both return an array and are used in place of values:
+//
+//	users = load_csv 'users.csv'
+func WithDirective(name string, fn DirectiveFunc) Option {
+	return func(o *options) {
+		if o.directives == nil {
+			o.directives = make(map[string]DirectiveFunc)
+		}
+		o.directives[name] = fn
+	}
+}
+
+// builtinDirective is a built-in directive, which unlike DirectiveFunc has
+// access to the parser to resolve paths.
+type builtinDirective func(p *parser, it item, arg string) (any, error)
+
+// builtinDirectiveFor returns the built-in directive called name, or nil.
+func builtinDirectiveFor(name string) builtinDirective {
+	switch name {
+	case "load_csv":
+		return loadCSV
+	case "load_jsonl":
+		return loadJSONL
+	}
+	return nil
+}
+
+// isDirective reports whether name is a directive.
+func (p *parser) isDirective(name string) bool {
+	if p.noCalls {
+		return false
+	}
+	if _, ok := p.opts.directives[name]; ok {
+		return true
+	}
+	return !p.opts.noFileFunc && builtinDirectiveFor(name) != nil
+}
+
+// directive calls the handler of the directive it, returning the value
+// it produced.
+func (p *parser) directive(it item, mount bool) (any, error) {
+	name, arg, _ := strings.Cut(it.Val, " ")
+	fn, ok := p.opts.directives[name]
+	if !ok {
+		return builtinDirectiveFor(name)(p, it, arg)
+	}
+	c := p.context(it)
+	if !mount {
+		c.Depth++
+	}
+	v, err := fn(c, arg)
+	if err != nil {
+		return nil, p.errorf(it, "%s: %w", name, err)
+	}
+	p.debug(it, "directive handled", "directive", name, "arg", arg)
+	return v, nil
+}
+
+// mergeDirective sets the keys of m, returned by the directive it in place
+// of a key, in the current map.
+func (p *parser) mergeDirective(it item, m map[string]any) error {
+	for _, k := range sortedKeys(m) {
+		var v any = m[k]
+		if p.pedantic {
+			v = &Token{item: it, value: v, sourceFile: p.file}
+		}
+		p.pushKey(k)
+		p.pushItemKey(it)
+		if err := p.setValue(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readDirectiveFile reads the file argument of a built-in directive,
+// relative to the config file.
+func (p *parser) readDirectiveFile(it item, name, path string) ([]byte, error) {
+	path = includePath(p.fp, path)
+	if err := checkRoot(p.opts.includeRoot, path); err != nil {
+		return nil, p.errorf(it, "%s: %w", name, err)
+	}
+	data, err := p.readCounted(path)
+	if err != nil {
+		return nil, p.errorf(it, "%s: %w", name, err)
+	}
+	p.addDep(path, data)
+	p.debug(it, "values read from file", "directive", name, "path", path)
+	return data, nil
+}
+
+// loadCSV returns the rows of a CSV file as maps, keyed by the names in
+// its first row. Values are typed as those of a properties file, and empty
+// cells are left out.
+func loadCSV(p *parser, it item, arg string) (any, error) {
+	data, err := p.readDirectiveFile(it, "load_csv", arg)
+	if err != nil {
+		return nil, err
+	}
+	r := csv.NewReader(bytes.NewReader(data))
+	header, err := r.Read()
+	if err != nil {
+		return nil, p.errorf(it, "load_csv: %s: missing header: %w", arg, err)
+	}
+	rows := []any{}
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, p.errorf(it, "load_csv: %s: %w", arg, err)
+		}
+		row := make(map[string]any, len(header))
+		for i, cell := range rec {
+			if cell != "" {
+				row[header[i]] = legacyValue(cell)
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+// loadJSONL returns the objects of a JSON lines file as maps. Blank lines
+// are skipped.
+func loadJSONL(p *parser, it item, arg string) (any, error) {
+	data, err := p.readDirectiveFile(it, "load_jsonl", arg)
+	if err != nil {
+		return nil, err
+	}
+	rows := []any{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, len(data)+1)
+	for n := 1; sc.Scan(); n++ {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		d := json.NewDecoder(bytes.NewReader(line))
+		d.UseNumber()
+		var v any
+		if err := d.Decode(&v); err != nil {
+			return nil, p.errorf(it, "load_jsonl: %s:%d: %w", arg, n, err)
+		}
+		row, ok := v.(map[string]any)
+		if !ok {
+			return nil, p.errorf(it, "load_jsonl: %s:%d: expected an object", arg, n)
+		}
+		rows = append(rows, jsonValue(row))
+	}
+	return rows, nil
+}
+
+// jsonValue converts the numbers of a decoded JSON value to integers and
+// floats, and leaves out null values of maps.
+func jsonValue(v any) any {
+	switch vv := v.(type) {
+	case map[string]any:
+		for k, e := range vv {
+			if e == nil {
+				delete(vv, k)
+				continue
+			}
+			vv[k] = jsonValue(e)
+		}
+	case []any:
+		for i, e := range vv {
+			vv[i] = jsonValue(e)
+		}
+	case json.Number:
+		if n, err := vv.Int64(); err == nil {
+			return n
+		}
+		f, _ := vv.Float64()
+		return f
+	}
+	return v
+}
@@ -0,0 +1,136 @@
+package conf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDirective(t *testing.T) {
+	var got []Context
+	importUsers := WithDirective("import_users", func(c Context, arg string) (any, error) {
+		got = append(got, c)
+		if arg == "missing.csv" {
+			return nil, errors.New("no such file")
+		}
+		return map[string]any{
+			"users": []any{map[string]any{"user": "a", "source": arg}},
+		}, nil
+	})
+
+	m, err := Parse(`
+		authorization {
+			timeout = 2
+			import_users 'users.csv'
+		}
+		import_users = 1
+	`, importUsers)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]any{
+		"authorization": map[string]any{
+			"timeout": int64(2),
+			"users":   []any{map[string]any{"user": "a", "source": "users.csv"}},
+		},
+		"import_users": int64(1),
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, expected)
+	}
+	c := Context{Path: "authorization", Depth: 2, Line: 4, Pos: 18}
+	if len(got) != 1 || got[0] != c {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", got, c)
+	}
+
+	m, err = ParseWithChecks("import_users users.csv", importUsers)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if tk, ok := m["users"].(*Token); !ok || tk.Line() != 1 {
+		t.Fatalf("Expected a token, got %+v", m["users"])
+	}
+
+	m, err = Parse("a { b = import_users users.csv }", importUsers)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if v, _ := Lookup(m, "a.b.users[0].user"); v != "a" {
+		t.Fatalf("Unexpected config: %+v", m)
+	}
+	c = Context{Path: "a.b", Depth: 2, Line: 1, Pos: 21}
+	if got[len(got)-1] != c {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", got[len(got)-1], c)
+	}
+
+	for _, tc := range []struct {
+		data, err string
+	}{
+		{"a = 1\nimport_users missing.csv", "import_users: no such file (:2:14)"},
+		{"load_csv users.csv", "directive load_csv returned array '[]' and must be set as the value of a key (:1:9)"},
+	} {
+		_, err = Parse(tc.data, importUsers,
+			WithDirective("load_csv", func(Context, string) (any, error) { return []any{}, nil }))
+		if err == nil || err.Error() != tc.err {
+			t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", err, tc.err)
+		}
+	}
+}
+
+func TestLoadDirectives(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"users.csv":    "user,password,admin\nalice,s3cr3t,true\n\"bob, jr\",,false\n",
+		"routes.jsonl": "{\"url\": \"nats://a:4222\", \"weight\": 1.5}\n\n{\"url\": \"nats://b:4222\", \"port\": 4222, \"tags\": [\"x\", 1], \"x\": null}\n",
+		"bad.jsonl":    "{\"url\": 1}\n[1]\n",
+		"app.conf":     "users = load_csv users.csv\ncluster { routes = load_jsonl 'routes.jsonl' }",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fp := filepath.Join(dir, "app.conf")
+	m, err := ParseFile(fp)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]any{
+		"users": []any{
+			map[string]any{"user": "alice", "password": "s3cr3t", "admin": true},
+			map[string]any{"user": "bob, jr", "admin": false},
+		},
+		"cluster": map[string]any{
+			"routes": []any{
+				map[string]any{"url": "nats://a:4222", "weight": 1.5},
+				map[string]any{"url": "nats://b:4222", "port": int64(4222), "tags": []any{"x", int64(1)}},
+			},
+		},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, expected)
+	}
+
+	r, err := Load(fp)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(r.Files) != 3 {
+		t.Fatalf("Unexpected files: %+v", r.Files)
+	}
+
+	if _, err := ParseFile(fp, WithoutFileFunc()); err == nil {
+		t.Fatal("Expected load_csv to be disabled")
+	}
+
+	if err := os.WriteFile(fp, []byte("routes = load_jsonl bad.jsonl"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = ParseFile(fp)
+	if expected := "load_jsonl: bad.jsonl:2: expected an object"; err == nil || !strings.Contains(err.Error(), expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", err, expected)
+	}
+}
@@ -0,0 +1,780 @@
+package conf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// EditSet stages edits to a config file and the files it includes, and
+// writes them all at once. Edits change the text of the files in place, so
+// comments, formatting and the order of keys are kept:
+//
+//	es, err := conf.NewEditSet("server.conf")
+//	if err != nil {
+//		return err
+//	}
+//	if err := es.Set("tls.cert", "/etc/tls/new.pem"); err != nil {
+//		return err
+//	}
+//	if err := es.Delete("debug"); err != nil {
+//		return err
+//	}
+//	written, err := es.Commit()
+//
+// Keys are edited in the file that defines them, which may be an include
+// of the root file. Every edit is checked by parsing the edited files with
+// the options of the set and undone if they no longer parse. Files that are
+// encrypted or need converting before they are parsed, such as UTF-16
+// files, can not be edited.
+type EditSet struct {
+	root     string
+	opts     []Option
+	o        *options
+	resolver IncludeResolver
+
+	// files are the files read so far, by the path tokens report for
+	// them, in the order they were read.
+	files map[string]*editFile
+	order []string
+}
+
+// editFile is a file of an EditSet with its staged content.
+type editFile struct {
+	path string
+	orig []byte
+	src  []byte
+	mode fs.FileMode
+	// encoded is set when the parser reads src converted, as it does
+	// UTF-16 and encrypted files. Byte order marks and CRLF line endings,
+	// which it drops, are kept and written back.
+	encoded bool
+	// crlf is set for files with CRLF line endings, which edits use too.
+	crlf bool
+}
+
+// keyDef is where a key is defined in the source of a file, by byte
+// offsets, with the value ending at valEnd. line and pos are where tokens
+// of the definition are, as the lexer reports them. For maps and arrays
+// that are array elements keyStart is -1 and the token is past their
+// closing bracket.
+type keyDef struct {
+	keyStart, keyEnd int
+	valStart, valEnd int
+	line, pos        int
+}
+
+// NewEditSet reads the config file root and the files it includes to edit
+// them. The options are used to parse the files, so includes are found the
+// way the application finds them.
+func NewEditSet(root string, opts ...Option) (*EditSet, error) {
+	e := &EditSet{
+		root:  root,
+		opts:  opts,
+		o:     newOptions(opts),
+		files: make(map[string]*editFile),
+	}
+	e.resolver = e.o.includeResolver()
+	data, err := os.ReadFile(root)
+	if err != nil {
+		return nil, &OpenError{Path: root, Err: err}
+	}
+	e.addFile(root, data)
+	if _, err := e.parse(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// addFile adds the file fp with its content data.
+func (e *EditSet) addFile(fp string, data []byte) *editFile {
+	f := &editFile{path: fp, orig: data, src: data, mode: 0o644}
+	if fi, err := os.Stat(fp); err == nil {
+		f.mode = fi.Mode().Perm()
+	}
+	plain, err := normalizeInput(string(data), false)
+	if input, ierr := e.o.prepareInput(fp, string(data)); err != nil || ierr != nil || input != plain {
+		f.encoded = true
+	}
+	f.crlf = bytes.Contains(data, []byte("\r\n"))
+	e.files[fp] = f
+	e.order = append(e.order, fp)
+	return f
+}
+
+// resolve loads includes for the parses of the set, from the staged files
+// once they have been read.
+func (e *EditSet) resolve(parent, name string) ([]byte, string, error) {
+	data, fp, err := e.resolver.Resolve(parent, name)
+	if err != nil {
+		return data, fp, err
+	}
+	if f, ok := e.files[fp]; ok {
+		return f.src, fp, nil
+	}
+	return e.addFile(fp, data).src, fp, nil
+}
+
+// parse parses the staged files with checks.
+func (e *EditSet) parse() (map[string]any, error) {
+	o := newOptions(append(e.opts[:len(e.opts):len(e.opts)], WithIncludeResolver(IncludeResolverFunc(e.resolve))))
+	p, err := parseDataWithOptions(string(e.files[e.root].src), e.root, true, false, o)
+	if err != nil {
+		return nil, err
+	}
+	return p.mapping, nil
+}
+
+// edit runs fn and checks the staged files still parse, undoing the
+// changes of fn otherwise.
+func (e *EditSet) edit(fn func(m map[string]any) error) error {
+	srcs := make(map[string][]byte, len(e.files))
+	for fp, f := range e.files {
+		srcs[fp] = f.src
+	}
+	m, err := e.parse()
+	if err == nil {
+		if err = fn(m); err == nil {
+			_, err = e.parse()
+		}
+	}
+	if err != nil {
+		for fp, f := range e.files {
+			if src, ok := srcs[fp]; ok {
+				f.src = src
+			}
+		}
+	}
+	return err
+}
+
+// Set sets the value at the key path, in the notation of Lookup, replacing
+// the value of the definition in effect. Keys that are not set are added to
+// the innermost map of the path that is, with the maps leading to them.
+// The value is written as Marshal writes it, so it should be of the types
+// of parsed configs.
+func (e *EditSet) Set(path string, value any) error {
+	return e.edit(func(m map[string]any) error {
+		if v, ok := Lookup(m, path); ok {
+			f, d, err := e.locate(path, v)
+			if err != nil {
+				return err
+			}
+			if d.keyStart < 0 {
+				return fmt.Errorf("can not set array element '%s', set the array instead", path)
+			}
+			text, err := encodeEdit(value, lineIndent(f.src, d.keyStart))
+			if err != nil {
+				return fmt.Errorf("key '%s': %v", path, err)
+			}
+			f.replace(d.valStart, d.valEnd, text)
+			return nil
+		}
+		text, err := encodeEdit(value, "")
+		if err != nil {
+			return fmt.Errorf("key '%s': %v", path, err)
+		}
+		ed, err := e.addition(m, path, text)
+		if err != nil {
+			return err
+		}
+		applyEdits([]textEdit{ed})
+		return nil
+	})
+}
+
+// addition returns the edit adding the key path, which is not set in m,
+// with the value written as text, to the innermost map of the path that is
+// set.
+func (e *EditSet) addition(m map[string]any, path, text string) (textEdit, error) {
+	elems, err := parsePath(path)
+	if err != nil {
+		return textEdit{}, err
+	}
+	if len(elems) == 0 {
+		return textEdit{}, fmt.Errorf("empty key path")
+	}
+	i := len(elems) - 1
+	var parent any
+	for ; i > 0; i-- {
+		if v, ok := Lookup(m, formatPath(elems[:i])); ok {
+			parent = v
+			break
+		}
+	}
+	keys := make([]string, 0, len(elems)-i)
+	for _, el := range elems[i:] {
+		if el.isIdx || el.wildcard {
+			return textEdit{}, fmt.Errorf("can not add '%s', only keys of maps can be added", path)
+		}
+		keys = append(keys, el.key)
+	}
+	text, err = definitionText(keys, text)
+	if err != nil {
+		return textEdit{}, err
+	}
+
+	if i == 0 {
+		f := e.files[e.root]
+		if f.encoded {
+			return textEdit{}, fmt.Errorf("can not edit %s, it is encoded", f.path)
+		}
+		end := len(f.src)
+		if end > 0 && f.src[end-1] != '\n' {
+			text = "\n" + text
+		}
+		return textEdit{f: f, start: end, end: end, text: text + "\n"}, nil
+	}
+	ppath := formatPath(elems[:i])
+	if _, ok := plainValue(parent).(map[string]any); !ok {
+		return textEdit{}, fmt.Errorf("can not add '%s', '%s' is not a map", path, ppath)
+	}
+	f, d, err := e.locate(ppath, parent)
+	if err != nil {
+		return textEdit{}, err
+	}
+	if f.src[d.valStart] != '{' {
+		return textEdit{}, fmt.Errorf("can not add '%s', '%s' is not set as a map", path, ppath)
+	}
+	return f.insertion(d, text), nil
+}
+
+// definitionText returns the definition of the key path keys with the
+// value written as text, in blocks for the maps leading to it.
+func definitionText(keys []string, text string) (string, error) {
+	ek, err := encodeKey(keys[0])
+	if err != nil {
+		return "", err
+	}
+	if len(keys) == 1 {
+		return ek + ": " + text, nil
+	}
+	inner, err := definitionText(keys[1:], text)
+	if err != nil {
+		return "", err
+	}
+	return ek + " {\n" + indentText(inner, encodeIndent) + "\n}", nil
+}
+
+// Delete removes the key at the key path, along with the earlier
+// definitions of it that would take effect once it is gone.
+func (e *EditSet) Delete(path string) error {
+	return e.edit(func(m map[string]any) error {
+		return e.eachDefinition(m, path, func(f *editFile, d keyDef) error {
+			applyEdits([]textEdit{f.removal(d)})
+			return nil
+		})
+	})
+}
+
+// Rename renames the key at the key path to key, keeping its value and its
+// place in the file, as RenameKey does.
+func (e *EditSet) Rename(path, key string) error {
+	elems, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	if len(elems) == 0 || elems[len(elems)-1].isIdx {
+		return fmt.Errorf("can not rename '%s', it is not a key", path)
+	}
+	elems[len(elems)-1].key = key
+	return e.RenameKey(path, formatPath(elems))
+}
+
+// eachDefinition calls fn with the definition of the key path in effect
+// until the path is no longer set, parsing the staged files again after
+// every call.
+func (e *EditSet) eachDefinition(m map[string]any, path string, fn func(f *editFile, d keyDef) error) error {
+	v, ok := Lookup(m, path)
+	if !ok {
+		return fmt.Errorf("key '%s' is not set", path)
+	}
+	for ok {
+		f, d, err := e.locate(path, v)
+		if err != nil {
+			return err
+		}
+		if d.keyStart < 0 {
+			return fmt.Errorf("can not edit array element '%s', set the array instead", path)
+		}
+		if err := fn(f, d); err != nil {
+			return err
+		}
+		if m, err = e.parse(); err != nil {
+			return err
+		}
+		v, ok = Lookup(m, path)
+	}
+	return nil
+}
+
+// locate returns the file and the definition of the value v found at the
+// key path.
+func (e *EditSet) locate(path string, v any) (*editFile, keyDef, error) {
+	tk, ok := v.(*Token)
+	if !ok {
+		return nil, keyDef{}, fmt.Errorf("key '%s' has no position", path)
+	}
+	f, ok := e.files[tk.SourceFile()]
+	if !ok {
+		return nil, keyDef{}, fmt.Errorf("key '%s' is not set in a file", path)
+	}
+	if f.encoded {
+		return nil, keyDef{}, fmt.Errorf("can not edit key '%s', %s is encoded", path, f.path)
+	}
+	defs, err := e.definitions(f)
+	if err != nil {
+		return nil, keyDef{}, err
+	}
+	for _, d := range defs {
+		if d.line == tk.Line() && d.pos == tk.Position() {
+			return f, d, nil
+		}
+	}
+	return nil, keyDef{}, fmt.Errorf("can not edit key '%s', it is not set by a definition in %s", path, f.path)
+}
+
+// definitions returns the definitions of keys in f, and of maps, arrays
+// and variable references in arrays.
+func (e *EditSet) definitions(f *editFile) ([]keyDef, error) {
+	// The lexer reads the file without its byte order mark and with CRLF
+	// line endings as plain new lines, which leaves the lines and the
+	// positions on them as they are but the start of the first line.
+	text, err := normalizeInput(string(f.src), false)
+	if err != nil {
+		return nil, err
+	}
+	lines := []int{len(f.src) - len(bytes.TrimPrefix(f.src, []byte(utf8BOM)))}
+	for i, c := range f.src {
+		if c == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
+	offset := func(it item) int {
+		return f.offset(lines, it.Line, it.Pos, e.o.tabWidth)
+	}
+
+	var defs []keyDef
+	// open holds the index in defs of the maps and arrays being read.
+	var open []int
+	var key *keyDef
+	lx := newParser(text, f.path, true, e.o).lx
+	for it := lx.Next(); it.Type != itemEOF; it = lx.Next() {
+		switch it.Type {
+		case itemError:
+			return nil, fmt.Errorf("%s:%d:%d: %s", f.path, it.Line, it.Pos, it.Val)
+		case itemCommentStart, itemText:
+			continue
+		case itemKey:
+			ks := offset(it)
+			ke := ks + len(it.Val)
+			if q := f.src[max(ks-1, 0)]; ks > 0 && (q == '"' || q == '\'') && ke < len(f.src) && f.src[ke] == q {
+				ks, ke = ks-1, ke+1
+			}
+			key = &keyDef{keyStart: ks, keyEnd: ke, line: it.Line, pos: it.Pos}
+			continue
+		case itemMapStart, itemArrayStart:
+			d := keyDef{keyStart: -1, valStart: offset(it) - 1}
+			if key != nil {
+				d.keyStart, d.keyEnd, d.line, d.pos = key.keyStart, key.keyEnd, key.line, key.pos
+			}
+			defs = append(defs, d)
+			open = append(open, len(defs)-1)
+		case itemMapEnd, itemArrayEnd:
+			if len(open) > 0 {
+				d := &defs[open[len(open)-1]]
+				open = open[:len(open)-1]
+				d.valEnd = offset(it)
+				if d.keyStart < 0 {
+					d.line, d.pos = it.Line, it.Pos
+				}
+			}
+		case itemInclude, itemOptionalInclude, itemDirective:
+		case itemVariable:
+			if key == nil {
+				// A reference in an array, whose token is at its name.
+				vs := offset(it) - 1
+				defs = append(defs, keyDef{keyStart: -1, valStart: vs, valEnd: vs + 1 + len(it.Val), line: it.Line, pos: it.Pos})
+				break
+			}
+			fallthrough
+		default:
+			if key != nil {
+				key.valStart = f.valueStart(key.keyEnd)
+				key.valEnd = f.scalarEnd(key.valStart)
+				defs = append(defs, *key)
+			}
+		}
+		key = nil
+	}
+	return defs, nil
+}
+
+// offset returns the byte offset of the position pos on the line, counted
+// the way the lexer does, with lines holding the offsets lines start at.
+func (f *editFile) offset(lines []int, line, pos, tabWidth int) int {
+	if line < 1 || line > len(lines) {
+		return len(f.src)
+	}
+	off, col, base := lines[line-1], 0, 0
+	if line > 1 {
+		// The new line character ending the previous line is position 0.
+		col, base = 1, 1
+	}
+	for col < pos && off < len(f.src) {
+		r, w := utf8.DecodeRune(f.src[off:])
+		if r == '\t' && tabWidth > 1 {
+			col += tabWidth - (col-base)%tabWidth
+		} else {
+			col++
+		}
+		off += w
+	}
+	return off
+}
+
+// valueStart returns the offset of the value of the key ending at off.
+func (f *editFile) valueStart(off int) int {
+	skip := func() {
+		for off < len(f.src) && (f.src[off] == ' ' || f.src[off] == '\t') {
+			off++
+		}
+	}
+	skip()
+	if off < len(f.src) && (f.src[off] == '=' || f.src[off] == ':') {
+		off++
+		skip()
+	}
+	return off
+}
+
+// scalarEnd returns the offset just past the value starting at off, which
+// is not a map or an array.
+func (f *editFile) scalarEnd(off int) int {
+	src := f.src
+	if off >= len(src) {
+		return off
+	}
+	switch src[off] {
+	case '"':
+		for i := off + 1; i < len(src); i++ {
+			switch src[i] {
+			case '\\':
+				i++
+			case '"':
+				return i + 1
+			}
+		}
+		return len(src)
+	case '\'':
+		if i := bytes.IndexByte(src[off+1:], '\''); i >= 0 {
+			return off + i + 2
+		}
+		return len(src)
+	case '(':
+		// Blocks end with a ')' on a line of its own.
+		for i := off; ; {
+			j := bytes.Index(src[i:], []byte("\n)"))
+			if j < 0 {
+				return len(src)
+			}
+			i += j + 2
+			if i == len(src) || src[i] == '\n' || src[i] == '\r' {
+				return i
+			}
+		}
+	}
+	// Calls may hold quoted arguments, and bytes literals such as
+	// base64"aGk=" a quoted part. Quotes anywhere else are part of an
+	// unquoted value, as in ab"c.
+	var quote byte
+	depth := 0
+	for i := off; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && depth > 0,
+			c == '"' && (string(src[off:i]) == "base64" || string(src[off:i]) == "hex"):
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		case depth == 0 && strings.IndexByte(" \t\r\n;,]}", c) >= 0:
+			return i
+		}
+	}
+	return len(src)
+}
+
+// replace replaces the source between start and end with text, with the
+// line endings of the file.
+func (f *editFile) replace(start, end int, text string) {
+	if f.crlf {
+		text = strings.ReplaceAll(text, "\n", "\r\n")
+	}
+	src := make([]byte, 0, len(f.src)-(end-start)+len(text))
+	src = append(src, f.src[:start]...)
+	src = append(src, text...)
+	f.src = append(src, f.src[end:]...)
+}
+
+// textEdit replaces the source of a file between start and end with text.
+type textEdit struct {
+	f          *editFile
+	start, end int
+	text       string
+}
+
+// applyEdits applies edits made against the same sources, last to first
+// in every file so the offsets of the edits before them stay valid.
+func applyEdits(edits []textEdit) {
+	sort.SliceStable(edits, func(i, j int) bool {
+		return edits[i].start > edits[j].start
+	})
+	for _, ed := range edits {
+		ed.f.replace(ed.start, ed.end, ed.text)
+	}
+}
+
+// removal returns the edit removing the definition d, with its line when
+// nothing else is on it but a comment.
+func (f *editFile) removal(d keyDef) textEdit {
+	src := f.src
+	end := d.valEnd
+	for end < len(src) && (src[end] == ' ' || src[end] == '\t') {
+		end++
+	}
+	sep := end < len(src) && (src[end] == ',' || src[end] == ';')
+	if sep {
+		end++
+	}
+	ls := bytes.LastIndexByte(src[:d.keyStart], '\n') + 1
+	le := bytes.IndexByte(src[end:], '\n')
+	if le < 0 {
+		le = len(src)
+	} else {
+		le += end + 1
+	}
+	rest := strings.TrimSpace(string(src[end:le]))
+	if strings.TrimSpace(string(src[ls:d.keyStart])) == "" &&
+		(rest == "" || strings.HasPrefix(rest, "#") || strings.HasPrefix(rest, "//")) {
+		return textEdit{f: f, start: ls, end: le}
+	}
+	for end < len(src) && (src[end] == ' ' || src[end] == '\t') {
+		end++
+	}
+	start := d.keyStart
+	if !sep {
+		// Take the separator before the last key of a map on one line.
+		i := start
+		for i > 0 && (src[i-1] == ' ' || src[i-1] == '\t') {
+			i--
+		}
+		if i > 0 && (src[i-1] == ',' || src[i-1] == ';') {
+			start = i - 1
+			end = d.valEnd
+		}
+	}
+	return textEdit{f: f, start: start, end: end}
+}
+
+// insertion returns the edit inserting the definition text at the end of
+// the map defined by d, on a line of its own unless the map is written on
+// one line.
+func (f *editFile) insertion(d keyDef, text string) textEdit {
+	src := f.src
+	closing := d.valEnd - 1
+	ls := bytes.LastIndexByte(src[:closing], '\n') + 1
+	indent := lineIndent(src, closing)
+	if strings.TrimSpace(string(src[ls:closing])) == "" {
+		return textEdit{f: f, start: ls, end: ls, text: indentText(text, indent+encodeIndent) + "\n"}
+	}
+	i := closing
+	for i > d.valStart+1 && (src[i-1] == ' ' || src[i-1] == '\t') {
+		i--
+	}
+	sep := ","
+	if c := src[i-1]; c == '{' || c == ',' || c == ';' || c == '\n' {
+		sep = ""
+	}
+	if !strings.Contains(text, "\n") {
+		return textEdit{f: f, start: i, end: closing, text: sep + " " + text + " "}
+	}
+	return textEdit{f: f, start: i, end: closing, text: sep + "\n" + indentText(text, indent+encodeIndent) + "\n" + indent}
+}
+
+// lineIndent returns the blanks the line holding the offset off starts with.
+func lineIndent(src []byte, off int) string {
+	ls := bytes.LastIndexByte(src[:off], '\n') + 1
+	end := ls
+	for end < len(src) && (src[end] == ' ' || src[end] == '\t') {
+		end++
+	}
+	return string(src[ls:end])
+}
+
+// indentText indents every line of text by indent.
+func indentText(text, indent string) string {
+	return indent + strings.ReplaceAll(text, "\n", "\n"+indent)
+}
+
+// encodeEdit encodes v as the value of a key on a line indented by indent.
+func encodeEdit(v any, indent string) (string, error) {
+	var buf bytes.Buffer
+	if err := encodeValue(&buf, v, 0); err != nil {
+		return "", err
+	}
+	return strings.ReplaceAll(buf.String(), "\n", "\n"+indent), nil
+}
+
+// Changed returns the files with staged changes, in the order they were
+// read.
+func (e *EditSet) Changed() []string {
+	var changed []string
+	for _, fp := range e.order {
+		if f := e.files[fp]; !bytes.Equal(f.src, f.orig) {
+			changed = append(changed, fp)
+		}
+	}
+	return changed
+}
+
+// Source returns the staged content of the file fp, which is the root file
+// or one of its includes, as it will be written.
+func (e *EditSet) Source(fp string) ([]byte, bool) {
+	f, ok := e.files[fp]
+	if !ok {
+		return nil, false
+	}
+	return f.src, true
+}
+
+// Reset discards the staged changes.
+func (e *EditSet) Reset() {
+	for _, f := range e.files {
+		f.src = f.orig
+	}
+}
+
+// Commit writes the files with staged changes and returns the paths of
+// those it rewrote, in the order they were read. Only files whose content
+// changes are written, so the others keep their modification times and
+// watchers of them see no change, and edits that were undone, or that leave
+// a file as it is on disk, write nothing.
+//
+// Every file is written to a temporary file next to it first, and the
+// temporary files replace the files once all of them are written, so an
+// error while writing leaves every file as it was. If replacing a file
+// fails, the files replaced before it are restored. Commit fails without
+// writing anything if one of the files changed since it was read.
+func (e *EditSet) Commit() ([]string, error) {
+	var files, current []*editFile
+	for _, fp := range e.Changed() {
+		f := e.files[fp]
+		data, err := os.ReadFile(f.path)
+		if err != nil {
+			return nil, &OpenError{Path: f.path, Err: err}
+		}
+		switch {
+		case bytes.Equal(data, f.src):
+			current = append(current, f)
+		case !bytes.Equal(data, f.orig):
+			return nil, fmt.Errorf("%s changed since it was read", f.path)
+		default:
+			files = append(files, f)
+		}
+	}
+
+	// Symbolic links are kept, and the files they point to replaced.
+	targets := make([]string, len(files))
+	for i, f := range files {
+		targets[i] = resolvedPath(f.path)
+	}
+	tmps := make([]string, 0, len(files))
+	removeTemps := func() {
+		for _, tmp := range tmps {
+			os.Remove(tmp)
+		}
+	}
+	for i, f := range files {
+		tmp, err := writeTemp(targets[i], f.src, f.mode)
+		if err != nil {
+			removeTemps()
+			return nil, err
+		}
+		tmps = append(tmps, tmp)
+	}
+	for i, f := range files {
+		if err := os.Rename(tmps[i], targets[i]); err != nil {
+			err = fmt.Errorf("can not replace %s: %w", f.path, err)
+			for _, rf := range files[:i] {
+				if rerr := writeFile(rf.path, rf.orig, rf.mode); rerr != nil {
+					err = errors.Join(err, fmt.Errorf("can not restore %s: %w", rf.path, rerr))
+				}
+			}
+			tmps = tmps[i:]
+			removeTemps()
+			return nil, err
+		}
+	}
+	var written []string
+	for _, f := range files {
+		f.orig = f.src
+		written = append(written, f.path)
+	}
+	for _, f := range current {
+		f.orig = f.src
+	}
+	return written, nil
+}
+
+// writeTemp writes data to a new temporary file in the directory of fp and
+// returns its path.
+func writeTemp(fp string, data []byte, mode fs.FileMode) (string, error) {
+	tf, err := os.CreateTemp(filepath.Dir(fp), "."+filepath.Base(fp)+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	_, err = tf.Write(data)
+	if err == nil {
+		err = tf.Chmod(mode)
+	}
+	if err == nil {
+		err = tf.Sync()
+	}
+	if cerr := tf.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tf.Name())
+		return "", fmt.Errorf("can not write %s: %w", fp, err)
+	}
+	return tf.Name(), nil
+}
+
+// writeFile replaces the file fp with data through a temporary file. A
+// symbolic link at fp is kept and the file it points to replaced.
+func writeFile(fp string, data []byte, mode fs.FileMode) error {
+	fp = resolvedPath(fp)
+	tmp, err := writeTemp(fp, data, mode)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, fp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,332 @@
+package conf
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEditSet(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "server.conf")
+	tls := filepath.Join(dir, "tls.conf")
+	writeTestFile(t, root, `# Server settings
+port = 4222 # client port
+debug: true
+tls {
+  include tls.conf
+}
+cluster { name: c1, port = 6222 }
+`)
+	writeTestFile(t, tls, "cert = \"a.pem\"\nkey = 'a.key'\n")
+
+	es, err := NewEditSet(root)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, edit := range []func() error{
+		func() error { return es.Set("port", int64(4333)) },
+		func() error { return es.Set("tls.cert", "b.pem") },
+		func() error { return es.Set("tls.verify", true) },
+		func() error { return es.Set("cluster.pool", int64(3)) },
+		func() error { return es.Set("log.file", "x.log") },
+		func() error { return es.Delete("debug") },
+		func() error { return es.Rename("cluster.port", "listen_port") },
+	} {
+		if err := edit(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if changed := es.Changed(); !reflect.DeepEqual(changed, []string{root, tls}) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", changed, []string{root, tls})
+	}
+	expected := `# Server settings
+port = 4333 # client port
+tls {
+  include tls.conf
+  verify: true
+}
+cluster { name: c1, listen_port = 6222, pool: 3 }
+log {
+  file: "x.log"
+}
+`
+	if src, _ := es.Source(root); string(src) != expected {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", string(src), expected)
+	}
+	if data, _ := os.ReadFile(root); strings.Contains(string(data), "4333") {
+		t.Fatalf("Expected no changes before commit, got %s", data)
+	}
+
+	written, err := es.Commit()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(written, []string{root, tls}) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", written, []string{root, tls})
+	}
+	if data, _ := os.ReadFile(tls); string(data) != "cert = \"b.pem\"\nkey = 'a.key'\n" {
+		t.Fatalf("Unexpected content of %s: %s", tls, data)
+	}
+	m, err := ParseFile(root)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	em := map[string]any{
+		"port":    int64(4333),
+		"tls":     map[string]any{"cert": "b.pem", "key": "a.key", "verify": true},
+		"cluster": map[string]any{"name": "c1", "listen_port": int64(6222), "pool": int64(3)},
+		"log":     map[string]any{"file": "x.log"},
+	}
+	if !reflect.DeepEqual(m, em) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, em)
+	}
+	if changed := es.Changed(); len(changed) != 0 {
+		t.Fatalf("Expected no changes after commit, got %v", changed)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Fatalf("Expected the temporary files to be gone, got %v", entries)
+	}
+}
+
+func TestEditSetValues(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "app.conf")
+	writeTestFile(t, root, `a = 1
+a = 2
+list = [1, 2]
+  nested {
+    "quoted key": "x\ty"
+    m { x: 1 }
+  }
+s = 'single', t = env("HOME")
+`)
+	es, err := NewEditSet(root)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, edit := range []func() error{
+		func() error { return es.Set("nested.\"quoted key\"", "z") },
+		func() error { return es.Set("nested.m", map[string]any{"y": []any{int64(1)}}) },
+		func() error { return es.Set("list", []any{}) },
+		func() error { return es.Delete("a") },
+		func() error { return es.Delete("t") },
+		func() error { return es.Rename("s", "str") },
+	} {
+		if err := edit(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	expected := `list = []
+  nested {
+    "quoted key": "z"
+    m {
+      y: [
+        1
+      ]
+    }
+  }
+str = 'single'
+`
+	if src, _ := es.Source(root); string(src) != expected {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", string(src), expected)
+	}
+}
+
+func TestEditSetUnquoted(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "app.conf")
+	writeTestFile(t, root, "x = ab\"c\ny = 2\nb = base64\"aGk=\", z = 3\n")
+	es, err := NewEditSet(root)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := es.Set("x", int64(7)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := es.Set("b", "hi"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "x = 7\ny = 2\nb = \"hi\", z = 3\n"
+	if src, _ := es.Source(root); string(src) != expected {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", string(src), expected)
+	}
+}
+
+func TestEditSetLineEndings(t *testing.T) {
+	tests := []struct {
+		name, src, expected string
+	}{
+		{"crlf", "a = 1\r\nb = 2\r\nm {\r\n  x = 1\r\n}\r\n", "a = 7\r\nm {\r\n  x = 1\r\n  y: 3\r\n}\r\nc: \"s\"\r\n"},
+		{"bom", "\xef\xbb\xbfa = 1\nb = 2\nm {\n  x = 1\n}\n", "\xef\xbb\xbfa = 7\nm {\n  x = 1\n  y: 3\n}\nc: \"s\"\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := filepath.Join(t.TempDir(), "app.conf")
+			writeTestFile(t, root, test.src)
+			es, err := NewEditSet(root)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := es.Set("a", int64(7)); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := es.Delete("b"); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := es.Set("m.y", int64(3)); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := es.Set("c", "s"); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if src, _ := es.Source(root); string(src) != test.expected {
+				t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", string(src), test.expected)
+			}
+		})
+	}
+}
+
+func TestEditSetSymlink(t *testing.T) {
+	dir := t.TempDir()
+	real := filepath.Join(dir, "data", "app.conf")
+	link := filepath.Join(dir, "app.conf")
+	if err := os.Mkdir(filepath.Dir(real), 0o755); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	writeTestFile(t, real, "port = 4222\n")
+	if err := os.Symlink(real, link); err != nil {
+		t.Skipf("Symbolic links not supported: %v", err)
+	}
+	es, err := NewEditSet(link)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := es.Set("port", int64(4333)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := es.Commit(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fi, err := os.Lstat(link); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("Expected %s to be kept as a link, got %v, %v", link, fi, err)
+	}
+	if data, _ := os.ReadFile(real); string(data) != "port = 4333\n" {
+		t.Fatalf("Unexpected content of %s: %s", real, data)
+	}
+}
+
+func TestEditSetErrors(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "app.conf")
+	src := "p = 1\nport = $p\nlist = [{ a: 1 }]\nn = 1\n"
+	writeTestFile(t, root, src)
+	es, err := NewEditSet(root)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, test := range []struct {
+		edit func() error
+		err  string
+	}{
+		{func() error { return es.Delete("p") }, "variable reference for 'p'"},
+		{func() error { return es.Delete("missing") }, "key 'missing' is not set"},
+		{func() error { return es.Set("list[0].a", int64(2)) }, ""},
+		{func() error { return es.Set("list[0]", int64(2)) }, "can not set array element 'list[0]'"},
+		{func() error { return es.Set("list[1].a", int64(2)) }, "only keys of maps can be added"},
+		{func() error { return es.Set("n.x", int64(2)) }, "'n' is not a map"},
+		{func() error { return es.Rename("n", "p") }, "key 'p' is already set"},
+	} {
+		err := test.edit()
+		if test.err == "" {
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("Expected error containing %q, got %v", test.err, err)
+		}
+	}
+	expected := "p = 1\nport = $p\nlist = [{ a: 2 }]\nn = 1\n"
+	if got, _ := es.Source(root); string(got) != expected {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", string(got), expected)
+	}
+
+	// Nothing is written when a file changed since it was read.
+	writeTestFile(t, root, src+"x = 1\n")
+	if _, err := es.Commit(); err == nil || !strings.Contains(err.Error(), "changed since it was read") {
+		t.Fatalf("Expected error for a changed file, got %v", err)
+	}
+	if data, _ := os.ReadFile(root); string(data) != src+"x = 1\n" {
+		t.Fatalf("Unexpected content of %s: %s", root, data)
+	}
+	es.Reset()
+	if changed := es.Changed(); len(changed) != 0 {
+		t.Fatalf("Expected no changes after reset, got %v", changed)
+	}
+}
+
+func TestEditSetCommit(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "server.conf")
+	tls := filepath.Join(dir, "tls.conf")
+	auth := filepath.Join(dir, "auth.conf")
+	writeTestFile(t, root, "port = 4222\ninclude tls.conf\ninclude auth.conf\n")
+	writeTestFile(t, tls, "cert = a.pem\n")
+	writeTestFile(t, auth, "user = a\n")
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, fp := range []string{root, tls, auth} {
+		if err := os.Chtimes(fp, old, old); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	es, err := NewEditSet(root)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, edit := range []func() error{
+		func() error { return es.Set("cert", "b.pem") },
+		// Undone edits leave the file alone.
+		func() error { return es.Set("port", int64(4333)) },
+		func() error { return es.Set("port", int64(4222)) },
+		func() error { return es.Set("user", "b") },
+	} {
+		if err := edit(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	// A file that already holds its staged content is not written either.
+	src, _ := es.Source(auth)
+	writeTestFile(t, auth, string(src))
+	if err := os.Chtimes(auth, old, old); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	written, err := es.Commit()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(written, []string{tls}) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", written, []string{tls})
+	}
+	for _, fp := range []string{root, auth} {
+		if fi, _ := os.Stat(fp); !fi.ModTime().Equal(old) {
+			t.Fatalf("Expected %s to be left alone, modified at %v", fp, fi.ModTime())
+		}
+	}
+	if written, err := es.Commit(); err != nil || len(written) != 0 {
+		t.Fatalf("Expected nothing to be written, got %v, %v", written, err)
+	}
+}
+
+func writeTestFile(t *testing.T, fp, data string) {
+	t.Helper()
+	if err := os.WriteFile(fp, []byte(data), 0644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
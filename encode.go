@@ -0,0 +1,189 @@
+package conf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Marshal encodes m in the conf format. Keys are sorted so the output is
+// stable, and parsing the output yields m again. Tokens from a pedantic
+// parse are encoded as their values.
+func Marshal(m map[string]any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeMap(&buf, m, 0); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// marshalValue encodes any value, maps as a config document and everything
+// else as a single value.
+func marshalValue(v any) ([]byte, error) {
+	if m, ok := plainValue(v).(map[string]any); ok {
+		return Marshal(m)
+	}
+	var buf bytes.Buffer
+	if err := encodeValue(&buf, v, 0); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+const encodeIndent = "  "
+
+func encodeMap(buf *bytes.Buffer, m map[string]any, depth int) error {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	indent := strings.Repeat(encodeIndent, depth)
+	for _, k := range keys {
+		ek, err := encodeKey(k)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(indent)
+		buf.WriteString(ek)
+		if nested, ok := plainValue(m[k]).(map[string]any); ok {
+			buf.WriteString(" {\n")
+			if err := encodeMap(buf, nested, depth+1); err != nil {
+				return err
+			}
+			buf.WriteString(indent)
+			buf.WriteString("}\n")
+			continue
+		}
+		buf.WriteString(": ")
+		if err := encodeValue(buf, m[k], depth); err != nil {
+			return fmt.Errorf("key '%s': %v", k, err)
+		}
+		buf.WriteByte('\n')
+	}
+	return nil
+}
+
+func encodeValue(buf *bytes.Buffer, v any, depth int) error {
+	switch vv := plainValue(v).(type) {
+	case map[string]any:
+		if len(vv) == 0 {
+			buf.WriteString("{}")
+			return nil
+		}
+		buf.WriteString("{\n")
+		if err := encodeMap(buf, vv, depth+1); err != nil {
+			return err
+		}
+		buf.WriteString(strings.Repeat(encodeIndent, depth))
+		buf.WriteByte('}')
+	case []any:
+		if len(vv) == 0 {
+			buf.WriteString("[]")
+			return nil
+		}
+		indent := strings.Repeat(encodeIndent, depth+1)
+		buf.WriteString("[\n")
+		for _, e := range vv {
+			buf.WriteString(indent)
+			if err := encodeValue(buf, e, depth+1); err != nil {
+				return err
+			}
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(strings.Repeat(encodeIndent, depth))
+		buf.WriteByte(']')
+	case string:
+		buf.WriteString(quoteString(vv))
+	case []byte:
+		buf.WriteString(`base64"`)
+		buf.WriteString(base64.StdEncoding.EncodeToString(vv))
+		buf.WriteByte('"')
+	case bool:
+		buf.WriteString(strconv.FormatBool(vv))
+	case int:
+		buf.WriteString(strconv.Itoa(vv))
+	case int64:
+		buf.WriteString(strconv.FormatInt(vv, 10))
+	case ByteSize:
+		buf.WriteString(vv.String())
+	case SIQuantity:
+		buf.WriteString(vv.String())
+	case float64:
+		if math.IsNaN(vv) || math.IsInf(vv, 0) {
+			return fmt.Errorf("can not encode float %v", vv)
+		}
+		s := strconv.FormatFloat(vv, 'f', -1, 64)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		buf.WriteString(s)
+	case time.Time:
+		buf.WriteString(vv.UTC().Format("2006-01-02T15:04:05Z"))
+	case *LateRef:
+		buf.WriteString(vv.String())
+	default:
+		return fmt.Errorf("can not encode value of type %T", vv)
+	}
+	return nil
+}
+
+// encodeKey returns the key as written in a config file, quoted unless it
+// only contains letters, digits, '_' and '-'.
+func encodeKey(k string) (string, error) {
+	if isBareKey(k) {
+		return k, nil
+	}
+	if strings.ContainsAny(k, "\"\n") {
+		return "", fmt.Errorf("can not encode key %q", k)
+	}
+	return `"` + k + `"`, nil
+}
+
+func isBareKey(k string) bool {
+	if k == "" || strings.EqualFold(k, "include") {
+		return false
+	}
+	for _, r := range k {
+		if !(r == '_' || r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// quoteString returns s as a double quoted string using the escapes the
+// lexer understands.
+func quoteString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			if c < 0x20 || c == 0x7f {
+				fmt.Fprintf(&sb, `\x%02x`, c)
+			} else {
+				sb.WriteByte(c)
+			}
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
@@ -0,0 +1,62 @@
+package conf
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarshalRoundTrip(t *testing.T) {
+	dt, _ := time.Parse(time.RFC3339, "2016-05-04T18:53:41Z")
+	m := map[string]any{
+		"port":    int64(4222),
+		"ratio":   2.0,
+		"debug":   true,
+		"name":    "say \"hi\"\n\tthere\\",
+		"now":     dt,
+		"empty":   map[string]any{},
+		"none":    []any{},
+		"include": "keyword",
+		"a key":   "spaced",
+		"nonce":   []byte{0xde, 0xad, 0xbe, 0xef},
+		"cluster": map[string]any{
+			"routes": []any{
+				map[string]any{"url": "nats://a:6222"},
+				[]any{int64(1), int64(2)},
+			},
+		},
+	}
+	data, err := Marshal(m)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	n, err := Parse(string(data))
+	if err != nil {
+		t.Fatalf("Unexpected error parsing:\n%s\n%v", data, err)
+	}
+	if !reflect.DeepEqual(m, n) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n%s", n, m, data)
+	}
+
+	// Encoding is stable.
+	again, _ := Marshal(n)
+	if string(again) != string(data) {
+		t.Fatalf("Expected stable output:\n%s\n%s", data, again)
+	}
+}
+
+func TestMarshalErrors(t *testing.T) {
+	for _, m := range []map[string]any{
+		{"ch": make(chan int)},
+		{`bad"key`: 1},
+	} {
+		if _, err := Marshal(m); err == nil {
+			t.Errorf("Expected error encoding %+v", m)
+		}
+	}
+	_, err := Marshal(map[string]any{"a": map[string]any{"b": struct{}{}}})
+	if err == nil || !strings.Contains(err.Error(), "key 'b'") {
+		t.Errorf("Expected error naming the key, got %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package conf
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+	"unicode/utf16"
+)
+
+// ErrUTF16 is returned for UTF-16 encoded input unless WithUTF16 is used.
+var ErrUTF16 = errors.New("config appears to be UTF-16 encoded, save it as UTF-8 or parse it with WithUTF16")
+
+const utf8BOM = "\xef\xbb\xbf"
+
+// WithUTF16 converts UTF-16 encoded files, detected by their byte order
+// mark or leading zero bytes, to UTF-8 before parsing them.
+func WithUTF16() Option {
+	return func(o *options) {
+		o.utf16 = true
+	}
+}
+
+// normalizeInput prepares raw config data for the lexer. It converts UTF-16
+// input when allowed, drops a leading UTF-8 byte order mark and turns CRLF
+// line endings into plain new lines.
+func normalizeInput(data string, allowUTF16 bool) (string, error) {
+	if order, skip, ok := detectUTF16(data); ok {
+		if !allowUTF16 {
+			return "", ErrUTF16
+		}
+		data = decodeUTF16(data[skip:], order)
+	}
+	data = strings.TrimPrefix(data, utf8BOM)
+	if strings.Contains(data, "\r\n") {
+		data = strings.ReplaceAll(data, "\r\n", "\n")
+	}
+	return data, nil
+}
+
+// detectUTF16 reports whether data looks UTF-16 encoded, returning the byte
+// order and the length of the byte order mark.
+func detectUTF16(data string) (binary.ByteOrder, int, bool) {
+	if len(data) < 2 {
+		return nil, 0, false
+	}
+	switch {
+	case data[0] == 0xfe && data[1] == 0xff:
+		return binary.BigEndian, 2, true
+	case data[0] == 0xff && data[1] == 0xfe:
+		return binary.LittleEndian, 2, true
+	case data[0] == 0 && data[1] != 0:
+		return binary.BigEndian, 0, true
+	case data[0] != 0 && data[1] == 0:
+		return binary.LittleEndian, 0, true
+	}
+	return nil, 0, false
+}
+
+func decodeUTF16(data string, order binary.ByteOrder) string {
+	u := make([]uint16, len(data)/2)
+	for i := range u {
+		u[i] = order.Uint16([]byte(data[2*i : 2*i+2]))
+	}
+	return string(utf16.Decode(u))
+}
@@ -0,0 +1,73 @@
+package conf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+func utf16Bytes(s string, bom, bigEndian bool) []byte {
+	var b []byte
+	u := utf16.Encode([]rune(s))
+	if bom {
+		u = append([]uint16{0xfeff}, u...)
+	}
+	for _, c := range u {
+		if bigEndian {
+			b = append(b, byte(c>>8), byte(c))
+		} else {
+			b = append(b, byte(c), byte(c>>8))
+		}
+	}
+	return b
+}
+
+func TestBOMAndCRLF(t *testing.T) {
+	ex := map[string]any{
+		"name":  "node0",
+		"block": "\nline1\nline2\n",
+		"auth":  map[string]any{"user": "a"},
+	}
+	data := "\xef\xbb\xbfname = node0\r\nblock (\r\nline1\r\nline2\r\n)\r\nauth {\r\n  user = a\r\n}\r\n"
+	testParse(t, data, ex)
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.conf"), []byte("\xef\xbb\xbfinclude 'inc.conf'\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "inc.conf"), []byte("\xef\xbb\xbfport = 4222\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := ParseFileWithChecks(filepath.Join(dir, "main.conf"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if v := m["port"].(*Token); v.Value() != int64(4222) || v.Line() != 1 || v.Position() != 0 {
+		t.Fatalf("Unexpected value: %+v", v)
+	}
+}
+
+func TestUTF16(t *testing.T) {
+	conf := "name = \"nödé\"\r\nport = 4222\r\n"
+	ex := map[string]any{"name": "nödé", "port": int64(4222)}
+	for _, tt := range []struct {
+		bom, bigEndian bool
+	}{
+		{true, false}, {true, true}, {false, false}, {false, true},
+	} {
+		data := string(utf16Bytes(conf, tt.bom, tt.bigEndian))
+		if _, err := Parse(data); !errors.Is(err, ErrUTF16) {
+			t.Fatalf("Expected UTF-16 error, got %v", err)
+		}
+		m, err := Parse(data, WithUTF16())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(m, ex) {
+			t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, ex)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package conf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// WithEnums restricts values to a set of allowed values by their full key
+// path:
+//
+//	conf.WithEnums(map[string][]string{
+//		"log_level": {"debug", "info", "warn", "error"},
+//	})
+//
+// Values are compared as written, so integers and booleans are allowed
+// by their literal, e.g. "1" or "true". A value outside the set is
+// reported at its position with the closest allowed value, if one is
+// close enough to be a typo, such as 'debug' for debgu, or with all
+// allowed values otherwise.
+//
+// Keys that are not declared but are close to a declared key of the same
+// map are reported as typos too, such as log_levl for log_level, at the
+// position of the key.
+func WithEnums(enums map[string][]string) Option {
+	return func(o *options) {
+		if o.enums == nil {
+			o.enums = make(map[string][]string, len(enums))
+			o.enumKeys = make(map[string][]string)
+		}
+		for path, values := range enums {
+			path = canonicalPath(path)
+			if _, ok := o.enums[path]; !ok {
+				keys, err := pathKeys(path)
+				if err != nil {
+					o.err = fmt.Errorf("invalid enum key '%s': %v", path, err)
+					return
+				}
+				parent := ""
+				for _, k := range keys[:len(keys)-1] {
+					parent = joinPath(parent, k)
+				}
+				o.enumKeys[parent] = append(o.enumKeys[parent], keys[len(keys)-1])
+			}
+			o.enums[path] = values
+		}
+	}
+}
+
+// checkEnum reports an error when val, set from it under the current key,
+// is not one of the values allowed for the key.
+func (p *parser) checkEnum(it item, val any) error {
+	if _, ok := p.ctx.(map[string]any); !ok || len(p.keys) == 0 {
+		return nil
+	}
+	path := p.keyPrefix()
+	allowed, ok := p.opts.enums[path]
+	if !ok {
+		return nil
+	}
+	lit := fmt.Sprint(stripValue(plainValue(val)))
+	switch it.Type {
+	case itemInteger, itemFloat:
+		lit = it.Val
+	}
+	for _, a := range allowed {
+		if lit == a {
+			return nil
+		}
+	}
+	if s, ok := suggest(lit, allowed); ok {
+		return p.errorf(it, "invalid value '%s' for key '%s', did you mean '%s'?", lit, path, s)
+	}
+	return p.errorf(it, "invalid value '%s' for key '%s', expected one of %s",
+		lit, path, strings.Join(allowed, ", "))
+}
+
+// checkEnumKey reports an error when key, set from it in the map at the
+// current key path, is not declared but close to a declared key.
+func (p *parser) checkEnumKey(it item, key string) error {
+	prefix := p.keyPrefix()
+	declared := p.opts.enumKeys[prefix]
+	for _, k := range declared {
+		if k == key {
+			return nil
+		}
+	}
+	if s, ok := suggest(key, declared); ok {
+		return p.errorf(it, "unknown key '%s', did you mean '%s'?", joinPath(prefix, key), s)
+	}
+	return nil
+}
+
+// suggest returns the candidate closest to s, if it is close enough for s
+// to be a typo of it. Ties go to the candidate sorting first.
+func suggest(s string, candidates []string) (string, bool) {
+	sorted := append([]string(nil), candidates...)
+	sort.Strings(sorted)
+	best, bestDist := "", -1
+	for _, c := range sorted {
+		d := levenshtein(s, c)
+		if d >= len([]rune(c)) || d > max(2, len([]rune(s))/3) {
+			continue
+		}
+		if bestDist < 0 || d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best, bestDist >= 0
+}
+
+// levenshtein returns the number of single rune insertions, deletions and
+// substitutions needed to turn a into b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,81 @@
+package conf
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testEnums = map[string][]string{
+	"log_level":      {"debug", "info", "warn", "error"},
+	"cluster.mode":   {"static", "dynamic"},
+	"retries":        {"1", "3", "5"},
+	"tls.verify":     {"true", "false"},
+	"storage.engine": {"file", "memory"},
+}
+
+func TestWithEnums(t *testing.T) {
+	data := `
+log_level = warn
+cluster { mode = dynamic, name = west }
+retries = 3
+tls { verify = true }
+log_file = "/var/log/app.log"
+`
+	m, err := Parse(data, WithEnums(testEnums))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ex := map[string]any{
+		"log_level": "warn",
+		"cluster":   map[string]any{"mode": "dynamic", "name": "west"},
+		"retries":   int64(3),
+		"tls":       map[string]any{"verify": true},
+		"log_file":  "/var/log/app.log",
+	}
+	if !reflect.DeepEqual(m, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, ex)
+	}
+}
+
+func TestWithEnumsViolations(t *testing.T) {
+	for data, expected := range map[string]string{
+		"log_level = debgu":             "invalid value 'debgu' for key 'log_level', did you mean 'debug'? (:1:12)",
+		"log_level = verbose":           "invalid value 'verbose' for key 'log_level', expected one of debug, info, warn, error (:1:12)",
+		"cluster {\n  mode = statik\n}": "invalid value 'statik' for key 'cluster.mode', did you mean 'static'? (:2:10)",
+		"retries = 4":                   "invalid value '4' for key 'retries', expected one of 1, 3, 5 (:1:10)",
+		"log_levl = info":               "unknown key 'log_levl', did you mean 'log_level'? (:1:0)",
+		"storage {\n  engnie = file\n}": "unknown key 'storage.engnie', did you mean 'engine'? (:2:3)",
+	} {
+		_, err := Parse(data, WithEnums(testEnums))
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("Expected error containing %q for %q, got %v", expected, data, err)
+		}
+	}
+
+	// Parses with checks report the same violations.
+	if _, err := ParseWithChecks("log_level = inf", WithEnums(testEnums)); err == nil || !strings.Contains(err.Error(), "did you mean 'info'?") {
+		t.Fatalf("Expected a suggestion, got %v", err)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"log_level", "log_file", "listen", "port"}
+	for s, expected := range map[string]string{
+		"log_levl": "log_level",
+		"lgo_file": "log_file",
+		"lsiten":   "listen",
+		"prot":     "port",
+		"hostname": "",
+		"log_lvl":  "log_level",
+		"cluster":  "",
+	} {
+		got, _ := suggest(s, candidates)
+		if got != expected {
+			t.Fatalf("Mismatch for %q:\nReceived: '%+v'\nExpected: '%+v'\n", s, got, expected)
+		}
+	}
+	if d := levenshtein("kitten", "sitting"); d != 3 {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", d, 3)
+	}
+}
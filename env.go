@@ -0,0 +1,177 @@
+package conf
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WithoutEnv disables resolving variables from environment variables, so
+// only keys defined in the config can be referenced.
+func WithoutEnv() Option {
+	return func(o *options) {
+		o.env.disabled = true
+	}
+}
+
+// WithEnvPrefix restricts environment variable lookups to names starting
+// with one of the prefixes, e.g. "MYAPP_".
+func WithEnvPrefix(prefixes ...string) Option {
+	return func(o *options) {
+		o.env.prefixes = append(o.env.prefixes, prefixes...)
+	}
+}
+
+// WithEnvAllowlist restricts environment variable lookups to the given
+// names. Combined with WithEnvPrefix a name is allowed if it matches
+// either.
+func WithEnvAllowlist(names ...string) Option {
+	return func(o *options) {
+		if o.env.allow == nil {
+			o.env.allow = make(map[string]bool)
+		}
+		for _, name := range names {
+			o.env.allow[name] = true
+		}
+	}
+}
+
+// WithEnvDenylist prevents the given environment variables from being
+// resolved, even if allowed otherwise.
+func WithEnvDenylist(names ...string) Option {
+	return func(o *options) {
+		if o.env.deny == nil {
+			o.env.deny = make(map[string]bool)
+		}
+		for _, name := range names {
+			o.env.deny[name] = true
+		}
+	}
+}
+
+// envPolicy decides which environment variables can be referenced.
+type envPolicy struct {
+	disabled bool
+	prefixes []string
+	allow    map[string]bool
+	deny     map[string]bool
+}
+
+// allowed reports whether the environment variable name may be resolved.
+func (e *envPolicy) allowed(name string) bool {
+	if e.disabled || e.deny[name] {
+		return false
+	}
+	if len(e.prefixes) == 0 && e.allow == nil {
+		return true
+	}
+	if e.allow[name] {
+		return true
+	}
+	for _, prefix := range e.prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ToEnv returns the values of m as environment variables, NAME=value, for
+// processes configured only through their environment. Names are the
+// prefix followed by the key path, with levels separated by a double
+// underscore, so with prefix APP
+//
+//	cluster { name = west, routes = ["nats://a", "nats://b"] }
+//
+// becomes APP_CLUSTER__NAME=west, APP_CLUSTER__ROUTES__0=nats://a and
+// APP_CLUSTER__ROUTES__1=nats://b. Without a prefix names start with the
+// first key.
+//
+// Keys are upper cased, and every rune other than an ASCII letter, digit
+// or underscore becomes an underscore, so log-file and log.file are both
+// LOG_FILE. When keys end up with the same name, the value of the last
+// one in key order is kept. Values are written as is: strings unquoted,
+// sizes in bytes, datetimes in RFC 3339 and bytes unencoded. Empty maps
+// and arrays have no variables. The result is sorted by name.
+func ToEnv(m map[string]any, prefix string) []string {
+	vars := make(map[string]string)
+	for _, k := range sortedKeys(m) {
+		name := envName(k)
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+		addEnv(vars, name, m[k])
+	}
+	env := make([]string, 0, len(vars))
+	for name, v := range vars {
+		env = append(env, name+"="+v)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// addEnv adds the variables of v, named name, to vars.
+func addEnv(vars map[string]string, name string, v any) {
+	switch vv := plainValue(v).(type) {
+	case map[string]any:
+		for _, k := range sortedKeys(vv) {
+			addEnv(vars, name+"__"+envName(k), vv[k])
+		}
+	case []any:
+		for i, e := range vv {
+			addEnv(vars, name+"__"+strconv.Itoa(i), e)
+		}
+	default:
+		vars[name] = envValue(vv)
+	}
+}
+
+// envName returns key with the runes not allowed in environment variable
+// names replaced by underscores, upper cased.
+func envName(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+// envValue returns a scalar config value as written to the environment.
+func envValue(v any) string {
+	if n, ok := unitValue(v); ok {
+		v = n
+	}
+	switch vv := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return vv
+	case int64:
+		return strconv.FormatInt(vv, 10)
+	case float64:
+		return strconv.FormatFloat(vv, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(vv)
+	case time.Time:
+		return vv.Format(time.RFC3339Nano)
+	case []byte:
+		return string(vv)
+	}
+	return fmt.Sprint(v)
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
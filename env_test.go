@@ -0,0 +1,123 @@
+package conf
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEnvPolicy(t *testing.T) {
+	t.Setenv("MYAPP_PORT", "4222")
+	t.Setenv("SECRET_TOKEN", "abc")
+
+	for _, tt := range []struct {
+		name   string
+		opts   []Option
+		port   bool
+		secret bool
+	}{
+		{"default", nil, true, true},
+		{"disabled", []Option{WithoutEnv()}, false, false},
+		{"prefix", []Option{WithEnvPrefix("MYAPP_")}, true, false},
+		{"allowlist", []Option{WithEnvAllowlist("SECRET_TOKEN")}, false, true},
+		{"prefix and allowlist", []Option{WithEnvPrefix("MYAPP_"), WithEnvAllowlist("SECRET_TOKEN")}, true, true},
+		{"denylist", []Option{WithEnvDenylist("SECRET_TOKEN")}, true, false},
+		{"denylist wins", []Option{WithEnvAllowlist("SECRET_TOKEN"), WithEnvDenylist("SECRET_TOKEN")}, false, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, v := range []struct {
+				data    string
+				allowed bool
+			}{{"port = $MYAPP_PORT", tt.port}, {"token = $SECRET_TOKEN", tt.secret}} {
+				_, err := Parse(v.data, tt.opts...)
+				if v.allowed && err != nil {
+					t.Fatalf("Unexpected error for %q: %v", v.data, err)
+				}
+				if !v.allowed && (err == nil || !strings.Contains(err.Error(), "can not be found")) {
+					t.Fatalf("Expected %q to be rejected, got %v", v.data, err)
+				}
+			}
+		})
+	}
+
+	// Keys defined in the config are not affected.
+	m, err := Parse("MYAPP_PORT = 1\nport = $MYAPP_PORT", WithoutEnv())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m["port"] != int64(1) {
+		t.Fatalf("Unexpected result: %+v", m)
+	}
+}
+
+func TestEnvValuesNotCalled(t *testing.T) {
+	t.Setenv("CONF_TEST_UUID", "uuid()")
+	t.Setenv("CONF_TEST_FILE", `file("/etc/hostname")`)
+	t.Setenv("CONF_TEST_LIST", `[1, uuid()]`)
+	data := "a = $CONF_TEST_UUID\nb = $CONF_TEST_FILE\nc = env(\"CONF_TEST_UUID\")\nd = $CONF_TEST_LIST\ne = uuid()"
+	for _, opts := range [][]Option{nil, {WithLateBinding()}} {
+		m, err := Parse(data, opts...)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for _, key := range []string{"a", "b", "c", "d"} {
+			m[key], err = Get(m, key)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		if e, ok := m["e"].(string); !ok || len(e) != 36 {
+			t.Fatalf("Expected a call in the config to be evaluated, got %+v", m["e"])
+		}
+		delete(m, "e")
+		ex := map[string]any{"a": "uuid()", "b": `file("/etc/hostname")`, "c": "uuid()", "d": []any{int64(1), "uuid()"}}
+		if !reflect.DeepEqual(m, ex) {
+			t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, ex)
+		}
+	}
+}
+
+func TestToEnv(t *testing.T) {
+	m, err := ParseWithChecks(`
+		port = 4222
+		log-file = "/var/log/app.log"
+		max_payload = 1mb
+		ratio = 0.5
+		debug = true
+		started = 2024-05-01T10:00:00Z
+		cluster {
+			name = west
+			routes = ["nats://a", "nats://b"]
+			tls { "cert.file" = "c.pem" }
+		}
+		accounts = [ { name = a, users = [] } ]
+	`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	env := ToEnv(m, "APP")
+	ex := []string{
+		"APP_ACCOUNTS__0__NAME=a",
+		"APP_CLUSTER__NAME=west",
+		"APP_CLUSTER__ROUTES__0=nats://a",
+		"APP_CLUSTER__ROUTES__1=nats://b",
+		"APP_CLUSTER__TLS__CERT_FILE=c.pem",
+		"APP_DEBUG=true",
+		"APP_LOG_FILE=/var/log/app.log",
+		"APP_MAX_PAYLOAD=1048576",
+		"APP_PORT=4222",
+		"APP_RATIO=0.5",
+		"APP_STARTED=2024-05-01T10:00:00Z",
+	}
+	if !reflect.DeepEqual(env, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", env, ex)
+	}
+
+	// Without a prefix names start with the key, and the last of the keys
+	// sharing a name wins.
+	env = ToEnv(map[string]any{"log-file": "a", "log.file": "b"}, "")
+	ex = []string{"LOG_FILE=b"}
+	if !reflect.DeepEqual(env, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", env, ex)
+	}
+}
@@ -0,0 +1,88 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ParseError is an error in the contents of a config file. Line and Pos are
+// zero when the error is not tied to a position, such as an undecodable
+// file.
+type ParseError struct {
+	File string
+	Line int
+	Pos  int
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	if e.Line == 0 {
+		if e.File == "" {
+			return e.Err.Error()
+		}
+		return fmt.Sprintf("%v (%s)", e.Err, e.File)
+	}
+	return fmt.Sprintf("%v (%s:%d:%d)", e.Err, e.File, e.Line, e.Pos)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// OpenError is returned when a config or include file can not be read.
+// The underlying error is usually an *fs.PathError, so
+// errors.Is(err, fs.ErrNotExist) reports missing files.
+type OpenError struct {
+	Path string
+	Err  error
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("error opening config file: %v", e.Err)
+}
+
+func (e *OpenError) Unwrap() error {
+	return e.Err
+}
+
+// IncludeError is returned when an include file fails to parse. Stack is
+// the chain of files from the top level file down to the file the error
+// occurred in.
+type IncludeError struct {
+	File    string
+	Line    int
+	Pos     int
+	Include string
+	Stack   []string
+	Err     error
+}
+
+func (e *IncludeError) Error() string {
+	return fmt.Sprintf("error parsing include file '%s', %v", e.Include, e.Err)
+}
+
+func (e *IncludeError) Unwrap() error {
+	return e.Err
+}
+
+// errorf returns a *ParseError at the position of it.
+func (p *parser) errorf(it item, format string, args ...any) error {
+	return &ParseError{File: p.file, Line: it.Line, Pos: it.Pos, Err: fmt.Errorf(format, args...)}
+}
+
+// includeError wraps err from parsing the include file at the chain stack.
+// Errors from nested includes keep the stack of the innermost one.
+func (p *parser) includeError(it item, stack []string, err error) error {
+	var ie *IncludeError
+	if errors.As(err, &ie) {
+		stack = ie.Stack
+	}
+	return &IncludeError{
+		File:    p.file,
+		Line:    it.Line,
+		Pos:     it.Pos,
+		Include: it.Val,
+		Stack:   stack,
+		Err:     err,
+	}
+}
@@ -0,0 +1,95 @@
+package conf
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOpenErrorParity(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.conf")
+	for _, parse := range []func(string, ...Option) (map[string]any, error){ParseFile, ParseFileWithChecks} {
+		_, err := parse(missing)
+		var oe *OpenError
+		if !errors.As(err, &oe) || oe.Path != missing {
+			t.Fatalf("Expected *OpenError for %q, got %v", missing, err)
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("Expected error to wrap fs.ErrNotExist, got %v", err)
+		}
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	for _, parse := range []func(string, ...Option) (map[string]any, error){Parse, ParseWithChecks} {
+		_, err := parse("a = 1\nb = $missing")
+		var pe *ParseError
+		if !errors.As(err, &pe) {
+			t.Fatalf("Expected *ParseError, got %v", err)
+		}
+		if pe.Line != 2 || pe.Pos != 6 {
+			t.Fatalf("Unexpected position %d:%d in %v", pe.Line, pe.Pos, err)
+		}
+		if err.Error() != "variable reference for 'missing' can not be found (:2:6)" {
+			t.Fatalf("Unexpected error message: %v", err)
+		}
+	}
+
+	_, err := Parse("\xff\xfea\x00=\x001\x00", WithUTF16())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = Parse("\xff\xfea\x00")
+	var pe *ParseError
+	if !errors.As(err, &pe) || !errors.Is(err, ErrUTF16) {
+		t.Fatalf("Expected *ParseError wrapping ErrUTF16, got %v", err)
+	}
+}
+
+func TestIncludeErrorStack(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.conf": "a = 1\ninclude 'b.conf'",
+		"b.conf": "b = 1\ninclude 'c.conf'",
+		"c.conf": "c = [1, 2",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stack := []string{
+		filepath.Join(dir, "a.conf"),
+		filepath.Join(dir, "b.conf"),
+		filepath.Join(dir, "c.conf"),
+	}
+	for _, parse := range []func(string, ...Option) (map[string]any, error){ParseFile, ParseFileWithChecks} {
+		_, err := parse(stack[0])
+		var ie *IncludeError
+		if !errors.As(err, &ie) {
+			t.Fatalf("Expected *IncludeError, got %v", err)
+		}
+		if ie.File != stack[0] || ie.Include != "b.conf" || ie.Line != 2 {
+			t.Fatalf("Unexpected include error: %+v", ie)
+		}
+		if !reflect.DeepEqual(ie.Stack, stack) {
+			t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", ie.Stack, stack)
+		}
+		var pe *ParseError
+		if !errors.As(err, &pe) || pe.File != stack[2] {
+			t.Fatalf("Expected *ParseError in c.conf, got %v", err)
+		}
+	}
+
+	// A missing include keeps the underlying file system error.
+	if err := os.WriteFile(filepath.Join(dir, "c.conf"), []byte("include 'd.conf'"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := ParseFileWithChecks(stack[0])
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Expected error to wrap fs.ErrNotExist, got %v", err)
+	}
+}
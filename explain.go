@@ -0,0 +1,72 @@
+package conf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Explanation describes where the value at a key path was set and how it
+// came to be.
+type Explanation struct {
+	Path string
+	// Token is the value together with the position it was set at.
+	Token *Token
+	// Variables are the variable references resolved to get the value,
+	// starting with the one the value was set from.
+	Variables []VariableStep
+	// Overridden are the earlier definitions of the key the value
+	// replaced, most recent first.
+	Overridden []*Token
+}
+
+// VariableStep is a variable reference resolved on the way to a value.
+type VariableStep struct {
+	Name string
+	// Definition is where the variable was defined, nil for environment
+	// variables and references resolved by a VariableResolver.
+	Definition *Token
+}
+
+// Explain returns how the value at the key path in m, from a parse with
+// checks, was set.
+func Explain(m map[string]any, path string) (*Explanation, error) {
+	v, ok := Lookup(m, path)
+	if !ok {
+		return nil, fmt.Errorf("key '%s' is not set", path)
+	}
+	tk, ok := v.(*Token)
+	if !ok {
+		return nil, fmt.Errorf("key '%s' has no position, explain needs a parse with checks", path)
+	}
+	e := &Explanation{Path: path, Token: tk}
+	for t := tk; t != nil && t.Variable() != ""; t = t.VariableDefinition() {
+		e.Variables = append(e.Variables, VariableStep{Name: t.Variable(), Definition: t.VariableDefinition()})
+	}
+	for t := tk.Replaced(); t != nil; t = t.Replaced() {
+		e.Overridden = append(e.Overridden, t)
+	}
+	return e, nil
+}
+
+func (e *Explanation) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s = %v\n", e.Path, stripValue(e.Token))
+	fmt.Fprintf(&sb, "  set at %s\n", tokenPosition(e.Token))
+	for _, s := range e.Variables {
+		if scheme, _, ok := strings.Cut(s.Name, ":"); ok && s.Definition == nil {
+			fmt.Fprintf(&sb, "  from $%s by the %s resolver\n", s.Name, scheme)
+		} else if s.Definition == nil {
+			fmt.Fprintf(&sb, "  from $%s in the environment\n", s.Name)
+		} else {
+			fmt.Fprintf(&sb, "  from $%s defined at %s\n", s.Name, tokenPosition(s.Definition))
+		}
+	}
+	for _, t := range e.Overridden {
+		fmt.Fprintf(&sb, "  overrides %v set at %s\n", stripValue(t), tokenPosition(t))
+	}
+	return sb.String()
+}
+
+func tokenPosition(t *Token) string {
+	return fmt.Sprintf("%s:%d:%d", t.SourceFile(), t.Line(), t.Position())
+}
@@ -0,0 +1,50 @@
+package conf
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	evar := "__EXPLAIN_PORT__"
+	os.Setenv(evar, "4333")
+	defer os.Unsetenv(evar)
+
+	data := strings.Join([]string{
+		"PORT = $" + evar,
+		"LISTEN_PORT = $PORT",
+		"server {",
+		"  port = 4222",
+		"  port = $LISTEN_PORT",
+		"}",
+	}, "\n")
+	m, err := ParseWithChecks(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	e, err := Explain(m, "server.port")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "server.port = 4333\n" +
+		"  set at :5:3\n" +
+		"  from $LISTEN_PORT defined at :2:1\n" +
+		"  from $PORT defined at :1:0\n" +
+		"  from $" + evar + " in the environment\n" +
+		"  overrides 4222 set at :4:3\n"
+	if s := e.String(); s != expected {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", s, expected)
+	}
+	if len(e.Variables) != 3 || e.Variables[2].Definition != nil || len(e.Overridden) != 1 {
+		t.Fatalf("Unexpected explanation: %+v", e)
+	}
+
+	if _, err := Explain(m, "server.host"); err == nil {
+		t.Fatal("Expected an error for a missing key")
+	}
+	plain, _ := Parse(data)
+	if _, err := Explain(plain, "server.port"); err == nil || !strings.Contains(err.Error(), "parse with checks") {
+		t.Fatalf("Expected an error for a parse without checks, got: %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package conf
+
+import "strings"
+
+// Extract returns the value at the key path in data, as Lookup would on
+// the result of Parse, but without building more of the config than the
+// value: the rest of data is only scanned. When the value depends on
+// variables or includes, or the key or a map holding it is set again
+// further down, which replaces or merges the value, Extract falls back to
+// parsing all of data.
+func Extract(data, path string) (any, bool, error) {
+	if _, err := parsePath(path); err != nil {
+		return nil, false, err
+	}
+	ex := &extractor{path: canonicalPath(path)}
+	if err := Scan(strings.NewReader(data), ex); err != nil {
+		return nil, false, err
+	}
+	if ex.fallback {
+		m, err := Parse(data)
+		if err != nil {
+			return nil, false, err
+		}
+		v, ok := Lookup(m, path)
+		return v, ok, nil
+	}
+	return ex.result, ex.done, nil
+}
+
+// extractor builds the value at path from scan events.
+type extractor struct {
+	path     string
+	result   any
+	done     bool
+	fallback bool
+
+	// stack holds the maps and arrays of the value being built, with the
+	// key of the next value of each map.
+	stack []any
+	keys  []string
+}
+
+func (ex *extractor) HandleEvent(ev Event) error {
+	if ex.done {
+		return ex.check(ev)
+	}
+	if ex.stack == nil {
+		return ex.find(ev)
+	}
+	switch ev.Kind {
+	case EventKey:
+		ex.keys[len(ex.keys)-1] = ev.Value.(string)
+	case EventValue:
+		ex.add(ev.Value)
+	case EventMapStart:
+		m := make(map[string]any)
+		ex.add(m)
+		ex.push(m)
+	case EventArrayStart:
+		ex.add([]any{})
+		ex.push([]any{})
+	case EventMapEnd, EventArrayEnd:
+		v := ex.stack[len(ex.stack)-1]
+		ex.stack = ex.stack[:len(ex.stack)-1]
+		ex.keys = ex.keys[:len(ex.keys)-1]
+		if len(ex.stack) == 0 {
+			ex.result, ex.done = v, true
+			return nil
+		}
+		// Arrays grow as values are added, so store the final one.
+		ex.set(v)
+	case EventVariable, EventInclude:
+		ex.fallback = true
+		return ErrStopScan
+	}
+	return nil
+}
+
+// find looks for the start of the value at path.
+func (ex *extractor) find(ev Event) error {
+	if ev.Kind == EventInclude && isPathPrefix(ev.Path, ex.path) {
+		// The include may define the key.
+		ex.fallback = true
+		return ErrStopScan
+	}
+	if ev.Path != ex.path {
+		return nil
+	}
+	switch ev.Kind {
+	case EventValue:
+		ex.result, ex.done = ev.Value, true
+	case EventMapStart:
+		ex.push(make(map[string]any))
+	case EventArrayStart:
+		ex.push([]any{})
+	case EventVariable:
+		ex.fallback = true
+		return ErrStopScan
+	}
+	return nil
+}
+
+// check looks for definitions after the value that change it: the key set
+// again, a map holding it or a key below it, or an include that may do so.
+func (ex *extractor) check(ev Event) error {
+	switch ev.Kind {
+	case EventKey:
+		if !isPathPrefix(ev.Path, ex.path) && !isPathPrefix(ex.path, ev.Path) {
+			return nil
+		}
+	case EventInclude:
+		if !isPathPrefix(ev.Path, ex.path) {
+			return nil
+		}
+	default:
+		return nil
+	}
+	ex.fallback = true
+	return ErrStopScan
+}
+
+// isPathPrefix reports whether path is prefix or a path within it.
+func isPathPrefix(prefix, path string) bool {
+	if prefix == "" || prefix == path {
+		return true
+	}
+	return strings.HasPrefix(path, prefix) && (path[len(prefix)] == '.' || path[len(prefix)] == '[')
+}
+
+func (ex *extractor) push(v any) {
+	ex.stack = append(ex.stack, v)
+	ex.keys = append(ex.keys, "")
+}
+
+// add adds v to the innermost map or array.
+func (ex *extractor) add(v any) {
+	switch c := ex.stack[len(ex.stack)-1].(type) {
+	case map[string]any:
+		c[ex.keys[len(ex.keys)-1]] = v
+	case []any:
+		ex.stack[len(ex.stack)-1] = append(c, v)
+	}
+}
+
+// set replaces the last value added to the innermost map or array.
+func (ex *extractor) set(v any) {
+	switch c := ex.stack[len(ex.stack)-1].(type) {
+	case map[string]any:
+		c[ex.keys[len(ex.keys)-1]] = v
+	case []any:
+		c[len(c)-1] = v
+	}
+}
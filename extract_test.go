@@ -0,0 +1,87 @@
+package conf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	data := `
+		port = 4222
+		cluster {
+			name = c1
+			routes = [nats://a, {url = b, opts = [1, 2
+			]}]
+			tls { verify = true }
+		}
+	`
+	for _, tt := range []struct {
+		path string
+		ex   any
+		ok   bool
+	}{
+		{"port", int64(4222), true},
+		{"cluster.name", "c1", true},
+		{"cluster.routes", []any{"nats://a", map[string]any{"url": "b", "opts": []any{int64(1), int64(2)}}}, true},
+		{"cluster.routes[1].opts", []any{int64(1), int64(2)}, true},
+		{"cluster.tls", map[string]any{"verify": true}, true},
+		{"cluster.missing", nil, false},
+	} {
+		v, ok, err := Extract(data, tt.path)
+		if tt.ok && err != nil {
+			t.Fatalf("Unexpected error for %s: %v", tt.path, err)
+		}
+		if ok != tt.ok || !reflect.DeepEqual(v, tt.ex) {
+			t.Fatalf("Mismatch for %s:\nReceived: '%+v' %v\nExpected: '%+v'\n", tt.path, v, ok, tt.ex)
+		}
+	}
+}
+
+func TestExtractFallback(t *testing.T) {
+	t.Setenv("CONF_TEST_HOST", "example.com")
+	data := "defaults { port = 4222 }\nserver { host = $CONF_TEST_HOST, opts = $defaults }"
+	v, ok, err := Extract(data, "server")
+	if err != nil || !ok {
+		t.Fatalf("Unexpected result: %v %v", ok, err)
+	}
+	ex := map[string]any{"host": "example.com", "opts": map[string]any{"port": int64(4222)}}
+	if !reflect.DeepEqual(v, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", v, ex)
+	}
+
+	if _, _, err := Extract("a = 1\nbroken = [", "a"); err == nil {
+		t.Fatal("Expected error for invalid data after the value")
+	}
+	if _, _, err := Extract("a = 1", "a..b"); err == nil {
+		t.Fatal("Expected error for invalid path")
+	}
+}
+
+func TestExtractRedefined(t *testing.T) {
+	for _, tt := range []struct {
+		data, path string
+		ex         any
+	}{
+		{"port = 1\nport = 2\n", "port", int64(2)},
+		{"a { x = 1 }\nb = 2\na { y = 2 }\n", "a", map[string]any{"y": int64(2)}},
+		{"a { x = 1 }\na = 3\n", "a.x", nil},
+		{"a = 1\nb = 2\n", "a", int64(1)},
+	} {
+		v, ok, err := Extract(tt.data, tt.path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		m, _ := Parse(tt.data)
+		lv, lok := Lookup(m, tt.path)
+		if ok != lok || !reflect.DeepEqual(v, tt.ex) || !reflect.DeepEqual(v, lv) {
+			t.Fatalf("Mismatch for %q:\nReceived: '%+v'\nExpected: '%+v'\n", tt.data, v, tt.ex)
+		}
+	}
+}
+
+func TestExtractQuotedKey(t *testing.T) {
+	v, ok, err := Extract(`routes { "nats.>" { url = "nats://a" } }`, `"routes"."nats.>".url`)
+	if err != nil || !ok || v != "nats://a" {
+		t.Fatalf("Unexpected result: %v, %v, %v", v, ok, err)
+	}
+}
@@ -0,0 +1,119 @@
+package conf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// FileDecryptor decrypts whole config files, such as files encrypted with
+// age or SOPS, before they are parsed.
+type FileDecryptor interface {
+	// Encrypted reports whether data is encrypted in a format the
+	// FileDecryptor handles.
+	Encrypted(data []byte) bool
+	// DecryptFile returns the plaintext of the encrypted file at path,
+	// which is empty for data passed to Parse.
+	DecryptFile(path string, data []byte) ([]byte, error)
+}
+
+// WithFileDecryptor decrypts config and include files that one of ds
+// recognizes as encrypted. Other files are parsed as they are.
+func WithFileDecryptor(ds ...FileDecryptor) Option {
+	return func(o *options) {
+		o.fileDecryptors = append(o.fileDecryptors, ds...)
+	}
+}
+
+// ageHeaders start age encrypted files, binary and armored.
+var ageHeaders = [][]byte{
+	[]byte("age-encryption.org/v1\n"),
+	[]byte("-----BEGIN AGE ENCRYPTED FILE-----"),
+}
+
+// AgeFiles returns a FileDecryptor for files encrypted with age. decrypt
+// is called with the whole file, e.g. backed by filippo.io/age using the
+// identities from a key source:
+//
+//	conf.AgeFiles(func(data []byte) ([]byte, error) {
+//		r, err := age.Decrypt(armor.NewReader(bytes.NewReader(data)), identities...)
+//		if err != nil {
+//			return nil, err
+//		}
+//		return io.ReadAll(r)
+//	})
+func AgeFiles(decrypt func(data []byte) ([]byte, error)) FileDecryptor {
+	return &funcDecryptor{
+		name:    "age",
+		detect:  isAgeEncrypted,
+		decrypt: func(_ string, data []byte) ([]byte, error) { return decrypt(data) },
+	}
+}
+
+// SOPSFiles returns a FileDecryptor for files encrypted with SOPS, which
+// stores files of unknown formats as a JSON document holding the encrypted
+// contents and a "sops" metadata section. decrypt is called with the path
+// and whole file, e.g. backed by the SOPS decrypt package:
+//
+//	conf.SOPSFiles(func(path string, data []byte) ([]byte, error) {
+//		return decrypt.DataWithFormat(data, formats.Binary)
+//	})
+func SOPSFiles(decrypt func(path string, data []byte) ([]byte, error)) FileDecryptor {
+	return &funcDecryptor{name: "sops", detect: isSOPSEncrypted, decrypt: decrypt}
+}
+
+type funcDecryptor struct {
+	name    string
+	detect  func([]byte) bool
+	decrypt func(string, []byte) ([]byte, error)
+}
+
+func (d *funcDecryptor) Encrypted(data []byte) bool {
+	return d.detect(data)
+}
+
+func (d *funcDecryptor) DecryptFile(path string, data []byte) ([]byte, error) {
+	plaintext, err := d.decrypt(path, data)
+	if err != nil {
+		return nil, fmt.Errorf("can not decrypt %s file: %w", d.name, err)
+	}
+	return plaintext, nil
+}
+
+func isAgeEncrypted(data []byte) bool {
+	data = bytes.TrimLeft(data, " \t\r\n")
+	for _, h := range ageHeaders {
+		if bytes.HasPrefix(data, h) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSOPSEncrypted(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '{' {
+		return false
+	}
+	var doc struct {
+		SOPS *struct {
+			MAC string `json:"mac"`
+		} `json:"sops"`
+	}
+	return json.Unmarshal(data, &doc) == nil && doc.SOPS != nil && doc.SOPS.MAC != ""
+}
+
+// prepareInput decrypts and normalizes the contents of the config file fp.
+func (o *options) prepareInput(fp, data string) (string, error) {
+	for _, d := range o.fileDecryptors {
+		if d.Encrypted([]byte(data)) {
+			plaintext, err := d.DecryptFile(fp, []byte(data))
+			if err != nil {
+				return "", err
+			}
+			data = string(plaintext)
+			break
+		}
+	}
+	return normalizeInput(data, o.utf16)
+}
@@ -0,0 +1,76 @@
+package conf
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fakeAge "encrypts" by prefixing the age header.
+func fakeAge(plaintext string) string {
+	return "age-encryption.org/v1\n" + plaintext
+}
+
+// fakeSOPS stores the plaintext in a SOPS style JSON document.
+func fakeSOPS(plaintext string) string {
+	data, _ := json.Marshal(map[string]any{
+		"data": plaintext,
+		"sops": map[string]any{"mac": "ENC[AES256_GCM,data:x]", "version": "3.8.1"},
+	})
+	return string(data)
+}
+
+func TestFileDecryptors(t *testing.T) {
+	age := AgeFiles(func(data []byte) ([]byte, error) {
+		return bytes.TrimPrefix(data, []byte("age-encryption.org/v1\n")), nil
+	})
+	sops := SOPSFiles(func(path string, data []byte) ([]byte, error) {
+		var doc struct{ Data string }
+		err := json.Unmarshal(data, &doc)
+		return []byte(doc.Data), err
+	})
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.conf":    fakeAge("name = main\ninclude 'secrets.conf'\ninclude 'plain.conf'"),
+		"secrets.conf": fakeSOPS("password = s3cret"),
+		"plain.conf":   "port = 4222",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ex := map[string]any{"name": "main", "password": "s3cret", "port": int64(4222)}
+	m, err := ParseFile(filepath.Join(dir, "main.conf"), WithFileDecryptor(age, sops))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(m, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, ex)
+	}
+
+	m, err = Parse(fakeSOPS("a = 1"), WithFileDecryptor(age, sops))
+	if err != nil || m["a"] != int64(1) {
+		t.Fatalf("Unexpected result: %+v %v", m, err)
+	}
+}
+
+func TestFileDecryptorError(t *testing.T) {
+	errKey := errors.New("no identity matched")
+	age := AgeFiles(func([]byte) ([]byte, error) { return nil, errKey })
+	_, err := Parse(fakeAge("a = 1"), WithFileDecryptor(age))
+	if !errors.Is(err, errKey) {
+		t.Fatalf("Expected decryption error, got %v", err)
+	}
+	if !isAgeEncrypted([]byte("-----BEGIN AGE ENCRYPTED FILE-----\nYWdl\n")) {
+		t.Fatal("Expected armored age file to be detected")
+	}
+	if isSOPSEncrypted([]byte(`{"sops": {}}`)) || isSOPSEncrypted([]byte("a = 1")) {
+		t.Fatal("Expected files without SOPS metadata to be parsed as they are")
+	}
+}
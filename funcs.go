@@ -0,0 +1,194 @@
+package conf
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Func is a function that can be called in values, e.g.
+//
+//	port = env("PORT", 4222)
+//
+// Arguments are parsed like values in a config file. A returned error is
+// reported at the position of the call.
+type Func func(args ...any) (any, error)
+
+// WithFunc makes fn callable in values as name, replacing any built-in
+// function of the same name. The built-in functions are:
+//
+//	env(name[, default])  the environment variable name, or default if unset
+//	file(path)            the trimmed contents of path, relative to the config file
+//	hostname()            the host name reported by the kernel
+//	uuid()                a random version 4 UUID
+func WithFunc(name string, fn Func) Option {
+	return func(o *options) {
+		if o.funcs == nil {
+			o.funcs = make(map[string]Func)
+		}
+		o.funcs[name] = fn
+	}
+}
+
+// WithoutFileFunc disables the file() function, which otherwise reads a
+// value from a file such as a mounted secret, and the load_csv and
+// load_jsonl directives, which read values from files as well:
+//
+//	password = file("./secrets/password")
+func WithoutFileFunc() Option {
+	return func(o *options) {
+		o.noFileFunc = true
+	}
+}
+
+// builtinFunc is a built-in function, which unlike Func has access to the
+// parser to resolve paths and apply the environment policy.
+type builtinFunc func(p *parser, it item, args []any) (any, error)
+
+// builtin returns the built-in function called name, or nil.
+func builtin(name string) builtinFunc {
+	switch name {
+	case "env":
+		return envFunc
+	case "file":
+		return fileFunc
+	case "hostname":
+		return hostnameFunc
+	case "uuid":
+		return uuidFunc
+	}
+	return nil
+}
+
+// isFunc reports whether name is a function callable in values.
+func (p *parser) isFunc(name string) bool {
+	if p.noCalls {
+		return false
+	}
+	if _, ok := p.opts.funcs[name]; ok {
+		return true
+	}
+	if name == "file" && p.opts.noFileFunc {
+		return false
+	}
+	return builtin(name) != nil
+}
+
+// call evaluates a function call item such as `file("./secret")`.
+func (p *parser) call(it item) (any, error) {
+	name, args, _ := strings.Cut(it.Val, "(")
+	args = strings.TrimSuffix(args, ")")
+	v, err := p.parseNested(fmt.Sprintf("[%s\n]", args), true)
+	if err != nil {
+		return nil, p.errorf(it, "invalid arguments to %s(): %w", name, err)
+	}
+	argv := v.([]any)
+	if _, ok := p.opts.funcs[name]; ok || name != "file" {
+		p.state.calls++
+	}
+
+	if fn, ok := p.opts.funcs[name]; ok {
+		v, err := fn(argv...)
+		if err != nil {
+			return nil, p.errorf(it, "%s(): %w", name, err)
+		}
+		return v, nil
+	}
+	if fn := builtin(name); fn != nil {
+		return fn(p, it, argv)
+	}
+	return nil, p.errorf(it, "unknown function %s()", name)
+}
+
+// stringArgs checks that a built-in function got n arguments, all strings.
+func (p *parser) stringArgs(it item, name string, args []any, n int) ([]string, error) {
+	if len(args) != n {
+		return nil, p.errorf(it, "%s() expects %d argument(s), got %d", name, n, len(args))
+	}
+	strs := make([]string, len(args))
+	for i, a := range args {
+		s, ok := a.(string)
+		if !ok {
+			return nil, p.errorf(it, "%s() expects a string argument, got '%v'", name, a)
+		}
+		strs[i] = s
+	}
+	return strs, nil
+}
+
+// envFunc returns the environment variable named by the first argument,
+// parsed as a value, or the optional second argument when it is unset.
+func envFunc(p *parser, it item, args []any) (any, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, p.errorf(it, "env() expects 1 to 2 arguments, got %d", len(args))
+	}
+	name, ok := args[0].(string)
+	if !ok {
+		return nil, p.errorf(it, "env() expects a string argument, got '%v'", args[0])
+	}
+	if p.opts.env.allowed(name) {
+		p.state.envLookups++
+		p.track(&p.state.envVars, name)
+		p.fromEnv = true
+		if val, ok := os.LookupEnv(name); ok {
+			v, err := p.parseNested(val, false)
+			if err != nil {
+				return nil, p.errorf(it, "env(): %w", err)
+			}
+			return v, nil
+		}
+	} else {
+		p.debug(it, "environment variable not allowed", "name", name)
+	}
+	if len(args) == 2 {
+		return args[1], nil
+	}
+	return nil, p.errorf(it, "env(): environment variable '%s' is not set", name)
+}
+
+// fileFunc returns the trimmed contents of the file named by the single
+// argument, relative to the directory of the config file.
+func fileFunc(p *parser, it item, args []any) (any, error) {
+	strs, err := p.stringArgs(it, "file", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	path := includePath(p.fp, strs[0])
+	if err := checkRoot(p.opts.includeRoot, path); err != nil {
+		return nil, p.errorf(it, "file(): %w", err)
+	}
+	data, err := p.readCounted(path)
+	if err != nil {
+		return nil, p.errorf(it, "file(): %w", err)
+	}
+	p.addDep(path, data)
+	p.debug(it, "value read from file", "path", path)
+	v := strings.TrimSpace(string(data))
+	p.state.secrets = append(p.state.secrets, v)
+	return v, nil
+}
+
+func hostnameFunc(p *parser, it item, args []any) (any, error) {
+	if _, err := p.stringArgs(it, "hostname", args, 0); err != nil {
+		return nil, err
+	}
+	name, err := os.Hostname()
+	if err != nil {
+		return nil, p.errorf(it, "hostname(): %w", err)
+	}
+	return name, nil
+}
+
+func uuidFunc(p *parser, it item, args []any) (any, error) {
+	if _, err := p.stringArgs(it, "uuid", args, 0); err != nil {
+		return nil, err
+	}
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, p.errorf(it, "uuid(): %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,168 @@
+package conf
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFileFunc(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.conf":        "include 'sub/db.conf'\nname = file(\"name.txt\")",
+		"name.txt":         "node0\n",
+		"sub/db.conf":      "db { password: file('secrets/pass'), opts = [file(\"secrets/pass\")] }",
+		"sub/secrets/pass": "  hunter2\n",
+	}
+	for name, data := range files {
+		fp := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fp, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ex := map[string]any{
+		"name": "node0",
+		"db": map[string]any{
+			"password": "hunter2",
+			"opts":     []any{"hunter2"},
+		},
+	}
+	for _, parse := range []func(string, ...Option) (map[string]any, error){ParseFile, ParseFileWithChecks} {
+		m, err := parse(filepath.Join(dir, "main.conf"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if s := stripValue(m); !reflect.DeepEqual(s, ex) {
+			t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", s, ex)
+		}
+	}
+
+	// Disabled, calls are plain strings.
+	m, err := Parse(`name = file("name.txt")`, WithoutFileFunc())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m["name"] != `file("name.txt")` {
+		t.Fatalf("Unexpected result: %+v", m)
+	}
+}
+
+func TestFileFuncErrors(t *testing.T) {
+	_, err := Parse("a = 1\nb = file(\"does-not-exist\")")
+	var pe *ParseError
+	if !errors.As(err, &pe) || pe.Line != 2 || !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Expected positioned not found error, got %v", err)
+	}
+	for _, data := range []string{`a = file()`, `a = file(1)`, `a = file("x", "y")`, `a = file("x"`} {
+		if _, err := Parse(data); err == nil {
+			t.Fatalf("Expected error for %q", data)
+		}
+	}
+}
+
+func TestFuncArgsOptions(t *testing.T) {
+	t.Setenv("CONF_TEST_SECRET", "hunter2")
+	dir := t.TempDir()
+	outside := filepath.Join(t.TempDir(), "outside.conf")
+	writeTestFile(t, outside, "leak = true")
+	writeTestFile(t, filepath.Join(dir, "secret.txt"), "hunter2")
+	for _, test := range []struct {
+		data string
+		opts []Option
+	}{
+		{`a = env("CONF_TEST_NOPE", $CONF_TEST_SECRET)`, []Option{WithoutEnv()}},
+		{`a = env("CONF_TEST_NOPE", $CONF_TEST_SECRET)`, []Option{WithEnvDenylist("CONF_TEST_SECRET")}},
+		{`a = env("CONF_TEST_NOPE", include "` + outside + `")`, []Option{WithIncludeRoot(dir)}},
+		{`a = env("CONF_TEST_NOPE", include "` + outside + `")`, nil},
+	} {
+		// The include is read past the limit set to the size of the data.
+		if test.opts == nil {
+			test.opts = []Option{WithMaxBytes(int64(len(test.data) + 5))}
+		}
+		if m, err := Parse(test.data, test.opts...); err == nil {
+			t.Fatalf("Expected error for %s, got %+v", test.data, m)
+		}
+	}
+	fp := filepath.Join(dir, "app.conf")
+	writeTestFile(t, fp, `a = env("CONF_TEST_NOPE", file("secret.txt"))`)
+	m, err := ParseFile(fp, WithoutFileFunc())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m["a"] != `file("secret.txt")` {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m["a"], `file("secret.txt")`)
+	}
+}
+
+func TestBuiltinFuncs(t *testing.T) {
+	t.Setenv("CONF_TEST_PORT", "4222")
+	host, _ := os.Hostname()
+	m, err := Parse(`
+		port = env("CONF_TEST_PORT")
+		debug = env("CONF_TEST_UNSET", false)
+		host = hostname()
+		id = uuid()
+	`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m["port"] != int64(4222) || m["debug"] != false || m["host"] != host {
+		t.Fatalf("Unexpected result: %+v", m)
+	}
+	if id, _ := m["id"].(string); len(id) != 36 || id[14] != '4' {
+		t.Fatalf("Unexpected uuid: %v", m["id"])
+	}
+
+	// env() follows the environment variable policy.
+	m, err = Parse(`port = env("CONF_TEST_PORT", 1)`, WithoutEnv())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m["port"] != int64(1) {
+		t.Fatalf("Unexpected result: %+v", m)
+	}
+	if _, err := Parse(`port = env("CONF_TEST_UNSET")`); err == nil {
+		t.Fatal("Expected error for unset environment variable")
+	}
+}
+
+func TestWithFunc(t *testing.T) {
+	double := func(args ...any) (any, error) {
+		if len(args) != 1 {
+			return nil, errors.New("expects 1 argument")
+		}
+		n, ok := args[0].(int64)
+		if !ok {
+			return nil, errors.New("expects an integer")
+		}
+		return n * 2, nil
+	}
+	m, err := ParseWithChecks("a = double(21)\nb = [double(1), double(2)]", WithFunc("double", double))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ex := map[string]any{"a": int64(42), "b": []any{int64(2), int64(4)}}
+	if s := stripValue(m); !reflect.DeepEqual(s, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", s, ex)
+	}
+
+	_, err = Parse("a = 1\nb = double(\"x\")", WithFunc("double", double))
+	if err == nil || err.Error() != "double(): expects an integer (:2:5)" {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Unregistered names are plain strings.
+	m, err = Parse("a = double(21)")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m["a"] != "double(21)" {
+		t.Fatalf("Unexpected result: %+v", m)
+	}
+}
@@ -0,0 +1,98 @@
+package conf
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Include is an include directive of a config file.
+type Include struct {
+	// From is the file holding the directive and To the file it includes,
+	// as in Result.Files.
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	// Line is the line of the directive in From.
+	Line int `json:"line"`
+
+	// Optional is set for optional includes, and Missing for those whose
+	// file did not exist, so nothing was included.
+	Optional bool `json:"optional,omitempty"`
+	Missing  bool `json:"missing,omitempty"`
+}
+
+// IncludeGraph is the graph of a config file and the files it includes,
+// directly or through other include files, such as for build systems to
+// declare the inputs of a config or to visualize large config trees. It
+// encodes to JSON with encoding/json and to Graphviz with DOT.
+type IncludeGraph struct {
+	// Files are the config file and the include files read for it, in the
+	// order they were read, once each.
+	Files []string `json:"files"`
+
+	// Includes are the edges of the graph, in the order they were parsed.
+	// A file included more than once has an edge for every include.
+	Includes []Include `json:"includes"`
+}
+
+// IncludeGraph returns the include graph of the config file r was loaded
+// from.
+func (r *Result) IncludeGraph() *IncludeGraph {
+	g := &IncludeGraph{Includes: slices.Clone(r.Includes)}
+	if len(r.Files) > 0 {
+		g.Files = []string{r.Files[0]}
+	}
+	for _, inc := range r.Includes {
+		if !inc.Missing && !slices.Contains(g.Files, inc.To) {
+			g.Files = append(g.Files, inc.To)
+		}
+	}
+	if g.Includes == nil {
+		g.Includes = []Include{}
+	}
+	return g
+}
+
+// DOT returns the graph in the DOT language of Graphviz, with the edges
+// labeled by the lines of their include directives. Optional includes are
+// dashed, and missing ones dotted to a gray node.
+func (g *IncludeGraph) DOT() string {
+	var sb strings.Builder
+	sb.WriteString("digraph includes {\n")
+	for _, fp := range g.Files {
+		fmt.Fprintf(&sb, "  %s;\n", quoteString(fp))
+	}
+	for _, inc := range g.Includes {
+		if inc.Missing && !slices.Contains(g.Files, inc.To) {
+			fmt.Fprintf(&sb, "  %s [color=gray, fontcolor=gray];\n", quoteString(inc.To))
+		}
+	}
+	for _, inc := range g.Includes {
+		attrs := fmt.Sprintf("label=\"%d\"", inc.Line)
+		switch {
+		case inc.Missing:
+			attrs += ", style=dotted"
+		case inc.Optional:
+			attrs += ", style=dashed"
+		}
+		fmt.Fprintf(&sb, "  %s -> %s [%s];\n", quoteString(inc.From), quoteString(inc.To), attrs)
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// trackInclude records the include directive of it for the file fp for
+// Load.
+func (p *parser) trackInclude(it item, fp string, missing bool) {
+	if !p.opts.track {
+		return
+	}
+	p.state.inclusions = append(p.state.inclusions, Include{
+		From:     p.file,
+		To:       fp,
+		Line:     it.Line,
+		Optional: it.Type == itemOptionalInclude,
+		Missing:  missing,
+	})
+}
@@ -0,0 +1,72 @@
+package conf
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIncludeGraph(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "server.conf")
+	tls := filepath.Join(dir, "tls.conf")
+	users := filepath.Join(dir, "users.conf")
+	missing := filepath.Join(dir, "local.conf")
+	writeTestFile(t, root, "port = 4222\ninclude tls.conf\nauth {\n  include users.conf\n}\ninclude? local.conf\n")
+	writeTestFile(t, tls, "cert = a.pem\ninclude users.conf\n")
+	writeTestFile(t, users, "user = a\n")
+
+	r, err := Load(root)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	g := r.IncludeGraph()
+	expected := &IncludeGraph{
+		Files: []string{root, tls, users},
+		Includes: []Include{
+			{From: root, To: tls, Line: 2},
+			{From: tls, To: users, Line: 2},
+			{From: root, To: users, Line: 4},
+			{From: root, To: missing, Line: 6, Optional: true, Missing: true},
+		},
+	}
+	if !reflect.DeepEqual(g, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", g, expected)
+	}
+
+	dot := "digraph includes {\n" +
+		"  \"" + root + "\";\n" +
+		"  \"" + tls + "\";\n" +
+		"  \"" + users + "\";\n" +
+		"  \"" + missing + "\" [color=gray, fontcolor=gray];\n" +
+		"  \"" + root + "\" -> \"" + tls + "\" [label=\"2\"];\n" +
+		"  \"" + tls + "\" -> \"" + users + "\" [label=\"2\"];\n" +
+		"  \"" + root + "\" -> \"" + users + "\" [label=\"4\"];\n" +
+		"  \"" + root + "\" -> \"" + missing + "\" [label=\"6\", style=dotted];\n" +
+		"}\n"
+	if got := g.DOT(); got != dot {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", got, dot)
+	}
+
+	data, err := json.Marshal(g)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var decoded IncludeGraph
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(&decoded, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", decoded, expected)
+	}
+
+	// A config without includes is a single node.
+	writeTestFile(t, root, "port = 4222\n")
+	if r, err = Load(root); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if data, _ := json.Marshal(r.IncludeGraph()); string(data) != `{"files":["`+root+`"],"includes":[]}` {
+		t.Fatalf("Unexpected graph: %s", data)
+	}
+}
@@ -0,0 +1,116 @@
+package conf
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"strings"
+)
+
+// RedactedValue replaces secret values in redacted configs.
+const RedactedValue = "[REDACTED]"
+
+var secretKeyParts = []string{"pass", "secret", "token", "credential", "private", "apikey", "api_key"}
+
+// IsSecretKey reports whether a key name suggests its value is a secret,
+// such as "password", "auth_token" or "client_secret".
+func IsSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, part := range secretKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact returns a copy of m with the values of secret keys replaced by
+// RedactedValue. When isSecret is nil IsSecretKey is used.
+func Redact(m map[string]any, isSecret func(key string) bool) map[string]any {
+	if isSecret == nil {
+		isSecret = IsSecretKey
+	}
+	return redactValue(m, isSecret, nil).(map[string]any)
+}
+
+// redactValue redacts v as Redact does, and the strings in secrets as
+// well.
+func redactValue(v any, isSecret func(string) bool, secrets map[string]bool) any {
+	switch vv := plainValue(v).(type) {
+	case map[string]any:
+		m := make(map[string]any, len(vv))
+		for k, e := range vv {
+			if isSecret(k) {
+				m[k] = RedactedValue
+			} else {
+				m[k] = redactValue(e, isSecret, secrets)
+			}
+		}
+		return m
+	case []any:
+		a := make([]any, len(vv))
+		for i, e := range vv {
+			a[i] = redactValue(e, isSecret, secrets)
+		}
+		return a
+	case string:
+		// Hashed passwords are secrets no matter the key they are under.
+		if secrets[vv] || hasLiteralPrefix(vv, DefaultLiteralPrefixes) {
+			return RedactedValue
+		}
+		return vv
+	default:
+		return vv
+	}
+}
+
+// Handler returns an http.Handler serving the current config of store with
+// secrets redacted as by Store.Redacted, for debugging running services. The query parameter
+// "path" selects a subtree, e.g. ?path=cluster.routes, and "format" selects
+// "json" (the default) or "conf" output.
+func Handler(store *Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		q := r.URL.Query()
+		v, ok := Lookup(store.Redacted(), q.Get("path"))
+		if !ok {
+			http.Error(w, "key path not found", http.StatusNotFound)
+			return
+		}
+
+		var (
+			data []byte
+			err  error
+		)
+		switch format := q.Get("format"); format {
+		case "", "json":
+			w.Header().Set("Content-Type", "application/json")
+			data, err = json.MarshalIndent(v, "", "  ")
+		case "conf":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			data, err = marshalValue(v)
+		default:
+			http.Error(w, "unknown format '"+format+"'", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(data)
+	})
+}
+
+// PublishExpvar publishes the current config of store with secrets redacted
+// as by Store.Redacted as the expvar variable name. Like expvar.Publish it panics if the name is
+// already registered.
+func PublishExpvar(name string, store *Store) {
+	expvar.Publish(name, expvar.Func(func() any {
+		return store.Redacted()
+	}))
+}
@@ -0,0 +1,130 @@
+package conf
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "app.conf")
+	data := `
+		port = 4222
+		authorization { user = admin; password = s3cret; token = abc }
+		users = [ { user = a, password = $2a$11$W2zko751KUvVy59mUTWmpOdWXFmbuhH8xCBXE9vfEKh7Jj4ZjsjNW } ]
+	`
+	if err := os.WriteFile(fp, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewStore(fp)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	h := Handler(s)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != 200 {
+		t.Fatalf("Unexpected status %d: %s", rec.Code, rec.Body)
+	}
+	var m map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &m); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Contains(rec.Body.String(), "s3cret") || strings.Contains(rec.Body.String(), "abc") ||
+		strings.Contains(rec.Body.String(), "$2a$") {
+		t.Fatalf("Expected secrets to be redacted: %s", rec.Body)
+	}
+	if m["port"] != float64(4222) {
+		t.Fatalf("Unexpected config: %s", rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/?path=authorization&format=conf", nil))
+	if rec.Code != 200 || !strings.Contains(rec.Body.String(), `user: "admin"`) ||
+		!strings.Contains(rec.Body.String(), `password: "[REDACTED]"`) {
+		t.Fatalf("Unexpected response %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/?path=authorization.password", nil))
+	if rec.Body.String() != `"[REDACTED]"` {
+		t.Fatalf("Unexpected response %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/?path=nope", nil))
+	if rec.Code != 404 {
+		t.Fatalf("Expected 404, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/?format=xml", nil))
+	if rec.Code != 400 {
+		t.Fatalf("Expected 400, got %d", rec.Code)
+	}
+}
+
+func TestPublishExpvar(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "app.conf")
+	if err := os.WriteFile(fp, []byte("port = 4222; pass = x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewStore(fp)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	PublishExpvar("conf_test", s)
+	if v := expvar.Get("conf_test").String(); v != `{"pass":"[REDACTED]","port":4222}` {
+		t.Fatalf("Unexpected expvar value: %s", v)
+	}
+}
+
+func TestHandlerRedactsSources(t *testing.T) {
+	dir := t.TempDir()
+	key := make([]byte, 32)
+	dec, err := NewAESDecryptor(key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	enc, err := EncryptAES(key, []byte("hunter2"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	files := map[string]string{
+		"app.conf": "port = 4222\ninclude 'db.conf'\ndsn = '" + enc + "'",
+		"db.conf":  "db { login = file('db.key') }",
+		"db.key":   "k3y",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The store takes db.conf from the include cache.
+	opts := []Option{WithDecryptor(dec), WithIncludeCache(NewIncludeCache())}
+	if _, err := ParseFile(filepath.Join(dir, "app.conf"), opts...); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	s, err := NewStore(filepath.Join(dir, "app.conf"), opts...)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	Handler(s).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if strings.Contains(rec.Body.String(), "hunter2") || strings.Contains(rec.Body.String(), "k3y") {
+		t.Fatalf("Expected decrypted and file values to be redacted: %s", rec.Body)
+	}
+	expected := map[string]any{"port": int64(4222), "dsn": RedactedValue, "db": map[string]any{"login": RedactedValue}}
+	if m := s.Redacted(); !reflect.DeepEqual(m, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, expected)
+	}
+	if m := s.Load(); m["dsn"] != "hunter2" {
+		t.Fatalf("Expected the config to keep the decrypted value, got %v", m["dsn"])
+	}
+}
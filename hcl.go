@@ -0,0 +1,527 @@
+package conf
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// FromHCL converts a document in the native syntax of HCL, as written by
+// Terraform, Nomad or Packer, to a config. Attributes become keys, and a
+// block becomes a map nested below its type and labels, so
+//
+//	service "web" {
+//	  port = 8080
+//	  check { interval = "10s" }
+//	}
+//
+// becomes service { web { port: 8080, check { interval: "10s" } } }. A
+// block repeated with the same type and labels becomes an array of maps,
+// in order.
+//
+// Only literal values are supported: strings, heredocs, numbers, bools,
+// tuples and objects. Attributes set to null are left out. Template
+// sequences such as ${var.name} in strings are kept as written, while
+// references, function calls and operators outside strings fail to
+// convert, since evaluating them needs the context of the tool reading
+// the document.
+func FromHCL(data []byte) (map[string]any, error) {
+	p := &hclParser{data: data, line: 1, col: 1}
+	return p.body(false)
+}
+
+// hclParser parses HCL native syntax. line and col are the position of the
+// next byte, both starting at 1.
+type hclParser struct {
+	data      []byte
+	off       int
+	line, col int
+}
+
+// hclNull is the value of a null literal.
+type hclNull struct{}
+
+func (p *hclParser) eof() bool {
+	return p.off >= len(p.data)
+}
+
+func (p *hclParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.data[p.off]
+}
+
+func (p *hclParser) hasPrefix(s string) bool {
+	return bytes.HasPrefix(p.data[p.off:], []byte(s))
+}
+
+func (p *hclParser) next() byte {
+	c := p.data[p.off]
+	p.off++
+	if c == '\n' {
+		p.line++
+		p.col = 1
+	} else {
+		p.col++
+	}
+	return c
+}
+
+// errorf returns an error at the current position.
+func (p *hclParser) errorf(format string, args ...any) error {
+	return &ParseError{Line: p.line, Pos: p.col, Err: fmt.Errorf(format, args...)}
+}
+
+// skip skips white space and comments, and newlines too if newlines is
+// set.
+func (p *hclParser) skip(newlines bool) error {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.next()
+		case c == '\n' && newlines:
+			p.next()
+		case c == '#' || p.hasPrefix("//"):
+			for !p.eof() && p.peek() != '\n' {
+				p.next()
+			}
+		case p.hasPrefix("/*"):
+			p.next()
+			p.next()
+			for !p.hasPrefix("*/") {
+				if p.eof() {
+					return p.errorf("unterminated comment")
+				}
+				p.next()
+			}
+			p.next()
+			p.next()
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func isHCLIdent(c byte, first bool) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80 ||
+		!first && (c == '-' || c >= '0' && c <= '9')
+}
+
+func (p *hclParser) ident() string {
+	start := p.off
+	for !p.eof() && isHCLIdent(p.peek(), p.off == start) {
+		p.next()
+	}
+	return string(p.data[start:p.off])
+}
+
+// body parses attributes and blocks up to the end of the document, or up
+// to the closing brace of a block if inBlock is set.
+func (p *hclParser) body(inBlock bool) (map[string]any, error) {
+	m := make(map[string]any)
+	attrs := make(map[string]bool)
+	for {
+		if err := p.skip(true); err != nil {
+			return nil, err
+		}
+		if p.eof() {
+			if inBlock {
+				return nil, p.errorf("missing '}' at the end of a block")
+			}
+			return m, nil
+		}
+		if inBlock && p.peek() == '}' {
+			p.next()
+			return m, nil
+		}
+		line, col := p.line, p.col
+		name := p.ident()
+		if name == "" {
+			return nil, p.errorf("expected an attribute or block, got '%c'", p.peek())
+		}
+		if err := p.skip(false); err != nil {
+			return nil, err
+		}
+
+		if p.peek() == '=' {
+			p.next()
+			v, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if attrs[name] {
+				return nil, &ParseError{Line: line, Pos: col, Err: fmt.Errorf("attribute '%s' is already set", name)}
+			}
+			attrs[name] = true
+			if _, ok := v.(hclNull); !ok {
+				if _, ok := m[name]; ok {
+					return nil, &ParseError{Line: line, Pos: col, Err: fmt.Errorf("attribute '%s' conflicts with a block", name)}
+				}
+				m[name] = v
+			}
+			if err := p.skip(false); err != nil {
+				return nil, err
+			}
+			switch {
+			case p.eof(), p.peek() == '\n', inBlock && p.peek() == '}':
+			default:
+				return nil, p.errorf("expected a newline after the value of '%s', got '%c'", name, p.peek())
+			}
+			continue
+		}
+
+		path := []string{name}
+		for p.peek() != '{' {
+			var label string
+			switch c := p.peek(); {
+			case c == '"':
+				s, err := p.quoted()
+				if err != nil {
+					return nil, err
+				}
+				label = s
+			case isHCLIdent(c, true):
+				label = p.ident()
+			default:
+				return nil, p.errorf("expected '=' or a block after '%s'", name)
+			}
+			path = append(path, label)
+			if err := p.skip(false); err != nil {
+				return nil, err
+			}
+		}
+		p.next()
+		block, err := p.body(true)
+		if err != nil {
+			return nil, err
+		}
+		if attrs[name] {
+			return nil, &ParseError{Line: line, Pos: col, Err: fmt.Errorf("block '%s' conflicts with an attribute", name)}
+		}
+		if err := addHCLBlock(m, path, block); err != nil {
+			return nil, &ParseError{Line: line, Pos: col, Err: err}
+		}
+	}
+}
+
+// addHCLBlock adds a block below its type and labels in m. A block added
+// again turns into an array of the blocks.
+func addHCLBlock(m map[string]any, path []string, block map[string]any) error {
+	parent := m
+	for _, k := range path[:len(path)-1] {
+		v, ok := parent[k]
+		if !ok {
+			v = make(map[string]any)
+			parent[k] = v
+		}
+		child, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("block '%s' mixes labeled and repeated blocks", strings.Join(path, " "))
+		}
+		parent = child
+	}
+	k := path[len(path)-1]
+	switch v := parent[k].(type) {
+	case nil:
+		parent[k] = block
+	case map[string]any:
+		parent[k] = []any{v, block}
+	case []any:
+		parent[k] = append(v, block)
+	}
+	return nil
+}
+
+// expr parses a literal value.
+func (p *hclParser) expr() (any, error) {
+	if err := p.skip(false); err != nil {
+		return nil, err
+	}
+	switch c := p.peek(); {
+	case c == '"':
+		return p.quoted()
+	case p.hasPrefix("<<"):
+		return p.heredoc()
+	case c == '[':
+		return p.tuple()
+	case c == '{':
+		return p.object()
+	case c == '-' || c >= '0' && c <= '9':
+		return p.number()
+	case isHCLIdent(c, true):
+		line, col, start := p.line, p.col, p.off
+		name := p.ident()
+		switch name {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return hclNull{}, nil
+		}
+		for !p.eof() && (p.peek() == '.' || isHCLIdent(p.peek(), false)) {
+			p.next()
+		}
+		return nil, &ParseError{Line: line, Pos: col,
+			Err: fmt.Errorf("unsupported expression '%s', only literal values can be converted", p.data[start:p.off])}
+	case p.eof():
+		return nil, p.errorf("missing value")
+	}
+	return nil, p.errorf("unexpected '%c' in value", p.peek())
+}
+
+// quoted parses a quoted string, keeping template sequences as written.
+func (p *hclParser) quoted() (string, error) {
+	p.next()
+	var sb strings.Builder
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		switch {
+		case p.peek() == '"':
+			p.next()
+			return sb.String(), nil
+		case p.hasPrefix("$${"), p.hasPrefix("%%{"):
+			sb.WriteByte(p.next())
+			p.next()
+			sb.WriteByte(p.next())
+		case p.hasPrefix("${"), p.hasPrefix("%{"):
+			// Copy the template sequence up to its closing brace.
+			for depth := 0; ; {
+				if p.eof() || p.peek() == '\n' {
+					return "", p.errorf("unterminated template sequence")
+				}
+				c := p.next()
+				sb.WriteByte(c)
+				if c == '{' {
+					depth++
+				} else if c == '}' {
+					if depth--; depth == 0 {
+						break
+					}
+				}
+			}
+		case p.peek() == '\\':
+			r, err := p.escape()
+			if err != nil {
+				return "", err
+			}
+			sb.WriteRune(r)
+		default:
+			sb.WriteByte(p.next())
+		}
+	}
+}
+
+// escape parses a backslash escape in a quoted string.
+func (p *hclParser) escape() (rune, error) {
+	p.next()
+	if p.eof() {
+		return 0, p.errorf("unterminated string")
+	}
+	switch c := p.next(); c {
+	case 'n':
+		return '\n', nil
+	case 'r':
+		return '\r', nil
+	case 't':
+		return '\t', nil
+	case '"':
+		return '"', nil
+	case '\\':
+		return '\\', nil
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		if p.off+n > len(p.data) {
+			return 0, p.errorf("invalid escape")
+		}
+		r, err := strconv.ParseUint(string(p.data[p.off:p.off+n]), 16, 32)
+		if err != nil || !utf8.ValidRune(rune(r)) {
+			return 0, p.errorf("invalid escape '\\%c%s'", c, p.data[p.off:p.off+n])
+		}
+		for i := 0; i < n; i++ {
+			p.next()
+		}
+		return rune(r), nil
+	default:
+		return 0, p.errorf("invalid escape '\\%c'", c)
+	}
+}
+
+// heredoc parses a heredoc, <<EOF or the indented <<-EOF, whose value
+// holds the newline of its last line.
+func (p *hclParser) heredoc() (string, error) {
+	p.next()
+	p.next()
+	indented := p.peek() == '-'
+	if indented {
+		p.next()
+	}
+	marker := p.ident()
+	if marker == "" {
+		return "", p.errorf("expected a heredoc marker")
+	}
+	if err := p.skip(false); err != nil {
+		return "", err
+	}
+	if p.peek() != '\n' {
+		return "", p.errorf("expected a newline after heredoc marker '%s'", marker)
+	}
+	p.next()
+	var lines []string
+	for {
+		if p.eof() {
+			return "", p.errorf("missing heredoc marker '%s'", marker)
+		}
+		start := p.off
+		for !p.eof() && p.peek() != '\n' {
+			p.next()
+		}
+		line := string(p.data[start:p.off])
+		if strings.TrimSpace(line) == marker {
+			break
+		}
+		if !p.eof() {
+			p.next()
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\r"))
+	}
+	if indented {
+		indent := -1
+		for _, l := range lines {
+			if strings.TrimSpace(l) == "" {
+				continue
+			}
+			n := len(l) - len(strings.TrimLeft(l, " \t"))
+			if indent < 0 || n < indent {
+				indent = n
+			}
+		}
+		for i, l := range lines {
+			if len(l) >= indent && indent > 0 {
+				lines[i] = l[indent:]
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return "", nil
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// number parses an integer or a float.
+func (p *hclParser) number() (any, error) {
+	start := p.off
+	if p.peek() == '-' {
+		p.next()
+	}
+	for !p.eof() && strings.IndexByte("0123456789.eE+-", p.peek()) >= 0 {
+		c := p.peek()
+		if prev := p.data[p.off-1]; (c == '+' || c == '-') && prev != 'e' && prev != 'E' {
+			break
+		}
+		p.next()
+	}
+	lit := string(p.data[start:p.off])
+	if n, err := strconv.ParseInt(lit, 10, 64); err == nil {
+		return n, nil
+	}
+	f, err := strconv.ParseFloat(lit, 64)
+	if err != nil {
+		return nil, p.errorf("invalid number '%s'", lit)
+	}
+	return f, nil
+}
+
+// tuple parses a tuple, [a, b], as an array.
+func (p *hclParser) tuple() ([]any, error) {
+	p.next()
+	arr := []any{}
+	for {
+		if err := p.skip(true); err != nil {
+			return nil, err
+		}
+		if p.peek() == ']' {
+			p.next()
+			return arr, nil
+		}
+		v, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := v.(hclNull); ok {
+			return nil, p.errorf("null in a tuple")
+		}
+		arr = append(arr, v)
+		if err := p.skip(true); err != nil {
+			return nil, err
+		}
+		switch p.peek() {
+		case ',':
+			p.next()
+		case ']':
+		default:
+			return nil, p.errorf("expected ',' or ']' in a tuple")
+		}
+	}
+}
+
+// object parses an object, { a = 1, b = 2 }, as a map.
+func (p *hclParser) object() (map[string]any, error) {
+	p.next()
+	m := make(map[string]any)
+	for {
+		if err := p.skip(true); err != nil {
+			return nil, err
+		}
+		if p.peek() == '}' {
+			p.next()
+			return m, nil
+		}
+		var key string
+		switch c := p.peek(); {
+		case c == '"':
+			s, err := p.quoted()
+			if err != nil {
+				return nil, err
+			}
+			key = s
+		case isHCLIdent(c, true):
+			key = p.ident()
+		default:
+			return nil, p.errorf("expected a key in an object")
+		}
+		if err := p.skip(false); err != nil {
+			return nil, err
+		}
+		if c := p.peek(); c != '=' && c != ':' {
+			return nil, p.errorf("expected '=' or ':' after key '%s'", key)
+		}
+		p.next()
+		v, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := v.(hclNull); !ok {
+			m[key] = v
+		}
+		if err := p.skip(false); err != nil {
+			return nil, err
+		}
+		switch p.peek() {
+		case ',', '\n':
+			p.next()
+		case '}':
+		default:
+			return nil, p.errorf("expected ',' or a newline after the value of '%s'", key)
+		}
+	}
+}
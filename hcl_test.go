@@ -0,0 +1,93 @@
+package conf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFromHCL(t *testing.T) {
+	m, err := FromHCL([]byte(`
+# Nomad style job
+region = "west" // trailing comment
+count  = 3
+ratio  = 0.5
+debug  = true
+unset  = null
+tags   = ["web", "api",
+  "v2",]
+meta   = { owner = "ops", "team.name": "core" }
+image  = "nginx:${var.version}"
+price  = "$${literal}"
+
+/* a block comment
+   spanning lines */
+service "web" {
+  port = 8080
+  check {
+    interval = "10s"
+  }
+  check { path = "/health" }
+}
+service "api" { port = 9090 }
+
+template {
+  data = <<-EOT
+    listen {{ .Port }}
+      indented
+  EOT
+}
+
+resource "aws_instance" "web" {
+  ami = "ami-123"
+}
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ex := map[string]any{
+		"region": "west",
+		"count":  int64(3),
+		"ratio":  0.5,
+		"debug":  true,
+		"tags":   []any{"web", "api", "v2"},
+		"meta":   map[string]any{"owner": "ops", "team.name": "core"},
+		"image":  "nginx:${var.version}",
+		"price":  "${literal}",
+		"service": map[string]any{
+			"web": map[string]any{
+				"port": int64(8080),
+				"check": []any{
+					map[string]any{"interval": "10s"},
+					map[string]any{"path": "/health"},
+				},
+			},
+			"api": map[string]any{"port": int64(9090)},
+		},
+		"template": map[string]any{"data": "listen {{ .Port }}\n  indented\n"},
+		"resource": map[string]any{
+			"aws_instance": map[string]any{"web": map[string]any{"ami": "ami-123"}},
+		},
+	}
+	if !reflect.DeepEqual(m, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, ex)
+	}
+}
+
+func TestFromHCLErrors(t *testing.T) {
+	for data, expected := range map[string]string{
+		"port = var.port":      "unsupported expression 'var.port', only literal values can be converted (:1:8)",
+		"port = 1 + 2":         "expected a newline after the value of 'port', got '+' (:1:10)",
+		"a = 1\na = 2":         "attribute 'a' is already set (:2:1)",
+		"svc {\n  port = 1\n":  "missing '}' at the end of a block (:3:1)",
+		"name = \"west":        "unterminated string (:1:13)",
+		"tags = [1 2]":         "expected ',' or ']' in a tuple (:1:11)",
+		"a = 1\na { b = 2 }":   "block 'a' conflicts with an attribute (:2:1)",
+		"data = <<EOT\nline\n": "missing heredoc marker 'EOT' (:3:1)",
+		"s = \"\\q\"":          "invalid escape '\\q' (:1:8)",
+		"/* open":              "unterminated comment (:1:8)",
+	} {
+		if _, err := FromHCL([]byte(data)); err == nil || err.Error() != expected {
+			t.Fatalf("Expected error %q for %q, got %v", expected, data, err)
+		}
+	}
+}
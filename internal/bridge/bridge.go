@@ -0,0 +1,92 @@
+// Package bridge is the JSON API of the parser for bindings to other
+// languages, shared by the WebAssembly module and the C library.
+package bridge
+
+import (
+	"errors"
+
+	conf "github.com/ninepeach/go-conf"
+)
+
+// Response is what the functions of the API return, encoded as JSON by
+// the bindings.
+type Response struct {
+	// Config is the parsed config, for parse.
+	Config map[string]any `json:"config,omitempty"`
+
+	// Output is the formatted config, for format.
+	Output string `json:"output,omitempty"`
+
+	// Valid is set when the config parsed without errors.
+	Valid bool `json:"valid"`
+
+	Errors   []Diagnostic `json:"errors,omitempty"`
+	Warnings []Diagnostic `json:"warnings,omitempty"`
+}
+
+// Diagnostic is an error or lint finding, at the line and column of the
+// source it refers to when known.
+type Diagnostic struct {
+	Message string `json:"message"`
+	Line    int    `json:"line,omitempty"`
+	Pos     int    `json:"pos,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Rule    string `json:"rule,omitempty"`
+}
+
+// Parse parses src as conf.Parse does.
+func Parse(src string) Response {
+	m, err := conf.Parse(src)
+	if err != nil {
+		return failed(err)
+	}
+	return Response{Config: m, Valid: true}
+}
+
+// Validate parses src with checks and lints it with the default rules,
+// whose findings are returned as warnings.
+func Validate(src string) Response {
+	m, err := conf.ParseWithChecks(src)
+	if err != nil {
+		return failed(err)
+	}
+	r := Response{Valid: true}
+	for _, f := range conf.Lint(m, conf.DefaultRules...) {
+		r.Warnings = append(r.Warnings, Diagnostic{
+			Message: f.Message,
+			Line:    f.Line,
+			Pos:     f.Pos,
+			Path:    f.Path,
+			Rule:    f.Rule,
+		})
+	}
+	return r
+}
+
+// Format returns src encoded as conf.Marshal does, with keys sorted and
+// variables and includes resolved. Comments are not kept.
+func Format(src string) Response {
+	m, err := conf.Parse(src)
+	if err != nil {
+		return failed(err)
+	}
+	out, err := conf.Marshal(m)
+	if err != nil {
+		return failed(err)
+	}
+	return Response{Output: string(out), Valid: true}
+}
+
+// failed returns the response for err, at its position when it has one.
+func failed(err error) Response {
+	d := Diagnostic{Message: err.Error()}
+	var pe *conf.ParseError
+	var ie *conf.IncludeError
+	switch {
+	case errors.As(err, &ie):
+		d.Line, d.Pos = ie.Line, ie.Pos
+	case errors.As(err, &pe) && pe.Line > 0:
+		d.Message, d.Line, d.Pos = pe.Err.Error(), pe.Line, pe.Pos
+	}
+	return Response{Errors: []Diagnostic{d}}
+}
@@ -0,0 +1,56 @@
+package bridge
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	r := Parse("port = 4222\nhosts = [a, b]")
+	expected := Response{Config: map[string]any{"port": int64(4222), "hosts": []any{"a", "b"}}, Valid: true}
+	if !reflect.DeepEqual(r, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", r, expected)
+	}
+
+	r = Parse("port = 4222\nhost = $HOST_NOT_SET_ANYWHERE")
+	if r.Valid || len(r.Errors) != 1 || r.Errors[0].Line != 2 {
+		t.Fatalf("Unexpected response: %+v", r)
+	}
+	if _, err := json.Marshal(r); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	r := Validate("port = 4222\nport = 4333\n")
+	expected := Response{
+		Valid: true,
+		Warnings: []Diagnostic{{
+			Message: "key was already set at :1:0",
+			Line:    2,
+			Pos:     1,
+			Path:    "port",
+			Rule:    "duplicate-keys",
+		}},
+	}
+	if !reflect.DeepEqual(r, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", r, expected)
+	}
+
+	r = Validate("a { b = 1 }\n}")
+	if r.Valid || len(r.Errors) != 1 || r.Errors[0].Line == 0 {
+		t.Fatalf("Unexpected response: %+v", r)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	r := Format("b = 1\na = [x, y]")
+	expected := Response{Output: "a: [\n  \"x\"\n  \"y\"\n]\nb: 1\n", Valid: true}
+	if !reflect.DeepEqual(r, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", r, expected)
+	}
+	if r := Format("include missing.conf"); r.Valid || len(r.Errors) != 1 {
+		t.Fatalf("Unexpected response: %+v", r)
+	}
+}
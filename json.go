@@ -0,0 +1,174 @@
+package conf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// JSONInts is how ToJSON writes integers.
+type JSONInts int
+
+const (
+	// JSONIntNumbers writes integers as numbers.
+	JSONIntNumbers JSONInts = iota
+
+	// JSONIntSafe writes integers as numbers when JavaScript represents
+	// them exactly, within ±2^53-1, and as strings otherwise.
+	JSONIntSafe
+
+	// JSONIntStrings writes integers as strings.
+	JSONIntStrings
+)
+
+// maxSafeInt is the largest integer a float64, the number of JavaScript,
+// represents exactly along with all smaller ones.
+const maxSafeInt = 1<<53 - 1
+
+// JSONOptions are the options of ToJSON. The zero value writes compact JSON
+// with integers as numbers, times in RFC 3339 and keys sorted.
+type JSONOptions struct {
+	// Ints is how integers, including sizes such as 4kb, are written.
+	Ints JSONInts
+
+	// TimeFormat is the layout of times, written as strings in UTC,
+	// time.RFC3339Nano when empty.
+	TimeFormat string
+
+	// SizesAsWritten writes the ByteSize and SIQuantity values of a parse
+	// WithUnits as written, such as "4kb", rather than as integers.
+	SizesAsWritten bool
+
+	// KeepOrder writes the keys of maps from a parse with checks in the
+	// order they are defined in, rather than sorted. Keys whose values are
+	// not tokens come after them, sorted.
+	KeepOrder bool
+
+	// Indent, when set, writes every element of a map or array on a line
+	// of its own, indented by Indent for each level of nesting.
+	Indent string
+}
+
+// ToJSON encodes m as JSON. The output only depends on the values of m and
+// opts, so exported configs can be diffed and cached by their bytes.
+// Tokens from a parse with checks are written as their values.
+func ToJSON(m map[string]any, opts JSONOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, m, &opts); err != nil {
+		return nil, err
+	}
+	if opts.Indent == "" {
+		return buf.Bytes(), nil
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, buf.Bytes(), "", opts.Indent); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func writeJSON(buf *bytes.Buffer, v any, opts *JSONOptions) error {
+	if !opts.SizesAsWritten {
+		if n, ok := unitValue(plainValue(v)); ok {
+			v = n
+		}
+	}
+	switch vv := plainValue(v).(type) {
+	case map[string]any:
+		buf.WriteByte('{')
+		for i, k := range jsonKeys(vv, opts.KeepOrder) {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, k)
+			buf.WriteByte(':')
+			if err := writeJSON(buf, vv[k], opts); err != nil {
+				return fmt.Errorf("key '%s': %v", k, err)
+			}
+		}
+		buf.WriteByte('}')
+	case []any:
+		buf.WriteByte('[')
+		for i, e := range vv {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSON(buf, e, opts); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case string:
+		writeJSONString(buf, vv)
+	case bool:
+		buf.WriteString(strconv.FormatBool(vv))
+	case int64:
+		s := strconv.FormatInt(vv, 10)
+		if opts.Ints == JSONIntStrings || opts.Ints == JSONIntSafe && (vv > maxSafeInt || vv < -maxSafeInt) {
+			s = `"` + s + `"`
+		}
+		buf.WriteString(s)
+	case float64:
+		if math.IsNaN(vv) || math.IsInf(vv, 0) {
+			return fmt.Errorf("can not encode float %v", vv)
+		}
+		data, _ := json.Marshal(vv)
+		buf.Write(data)
+	case time.Time:
+		layout := opts.TimeFormat
+		if layout == "" {
+			layout = time.RFC3339Nano
+		}
+		writeJSONString(buf, vv.UTC().Format(layout))
+	case []byte:
+		writeJSONString(buf, base64.StdEncoding.EncodeToString(vv))
+	case ByteSize, SIQuantity:
+		writeJSONString(buf, fmt.Sprint(vv))
+	case nil:
+		buf.WriteString("null")
+	default:
+		return fmt.Errorf("can not encode value of type %T", vv)
+	}
+	return nil
+}
+
+// writeJSONString writes s quoted, leaving <, > and & as they are.
+func writeJSONString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	// Drop the newline Encode ends with.
+	buf.Truncate(buf.Len() - 1)
+}
+
+// jsonKeys returns the keys of m sorted, or in the order they were defined
+// when order is set.
+func jsonKeys(m map[string]any, order bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if !order {
+		return keys
+	}
+	// Maps and arrays are tokens at their closing bracket, which still
+	// orders them among the keys of the same map as their start would.
+	sort.SliceStable(keys, func(i, j int) bool {
+		ti, iok := m[keys[i]].(*Token)
+		tj, jok := m[keys[j]].(*Token)
+		switch {
+		case !iok || !jok:
+			return iok && !jok
+		case ti.Line() != tj.Line():
+			return ti.Line() < tj.Line()
+		}
+		return ti.Position() < tj.Position()
+	})
+	return keys
+}
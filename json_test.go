@@ -0,0 +1,95 @@
+package conf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestToJSON(t *testing.T) {
+	data := `
+		zone = "<eu>"
+		port = 4222
+		big = 9007199254740993
+		neg = -9007199254740993
+		ratio = 0.5
+		max_payload = 4kb
+		started = 2024-01-02T03:04:05Z
+		cluster { routes = [a, b], name = c }
+		debug = true
+	`
+	m, err := ParseWithChecks(data, WithUnits())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, test := range []struct {
+		name     string
+		opts     JSONOptions
+		expected string
+	}{
+		{
+			"defaults",
+			JSONOptions{},
+			`{"big":9007199254740993,"cluster":{"name":"c","routes":["a","b"]},"debug":true,"max_payload":4096,"neg":-9007199254740993,"port":4222,"ratio":0.5,"started":"2024-01-02T03:04:05Z","zone":"<eu>"}`,
+		},
+		{
+			"safe ints",
+			JSONOptions{Ints: JSONIntSafe},
+			`"big":"9007199254740993",`,
+		},
+		{
+			"safe negative ints",
+			JSONOptions{Ints: JSONIntSafe},
+			`"neg":"-9007199254740993","port":4222,`,
+		},
+		{
+			"string ints",
+			JSONOptions{Ints: JSONIntStrings},
+			`"max_payload":"4096","neg":"-9007199254740993","port":"4222",`,
+		},
+		{
+			"sizes as written",
+			JSONOptions{SizesAsWritten: true},
+			`"max_payload":"4kb",`,
+		},
+		{
+			"time format",
+			JSONOptions{TimeFormat: "2006-01-02"},
+			`"started":"2024-01-02",`,
+		},
+		{
+			"keep order",
+			JSONOptions{KeepOrder: true},
+			`{"zone":"<eu>","port":4222,"big":9007199254740993,"neg":-9007199254740993,"ratio":0.5,"max_payload":4096,"started":"2024-01-02T03:04:05Z","cluster":{"routes":["a","b"],"name":"c"},"debug":true}`,
+		},
+		{
+			"indent",
+			JSONOptions{Indent: "  "},
+			"{\n  \"big\": 9007199254740993,\n  \"cluster\": {\n    \"name\": \"c\",\n",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := ToJSON(m, test.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !strings.Contains(string(out), test.expected) {
+				t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", string(out), test.expected)
+			}
+		})
+	}
+
+	// The same values written differently export the same.
+	other, err := Parse("debug = true\ncluster { name = c, routes = [a, b] }\nratio = 0.5\nport = 4222\nneg = -9007199254740993\nbig = 9007199254740993\nmax_payload = 4096\nstarted = 2024-01-02T03:04:05Z\nzone = \"<eu>\"")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	a, _ := ToJSON(m, JSONOptions{})
+	b, _ := ToJSON(other, JSONOptions{})
+	if string(a) != string(b) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", string(b), string(a))
+	}
+
+	if _, err := ToJSON(map[string]any{"f": struct{}{}}, JSONOptions{}); err == nil {
+		t.Fatal("Expected an error for an unsupported type")
+	}
+}
@@ -0,0 +1,224 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+)
+
+// WithLateBinding keeps references to environment variables and to
+// VariableResolver schemes unresolved in the parsed config, as *LateRef
+// values that Get resolves every time they are read. Values that change
+// while the application runs, such as rotating tokens, are then read
+// fresh without parsing the config again:
+//
+//	m, _ := conf.ParseFile("app.conf", conf.WithLateBinding(),
+//		conf.WithVariableResolver("vault", vault))
+//	token, err := conf.Get(m, "upstream.token")
+//
+// References to keys of the config are still resolved while parsing, as
+// are references spread into arrays and maps, since their values are
+// needed then. Environment variables that are not set are not reported
+// while parsing but by Get. Checks of values while parsing, such as
+// schemas, WithTypes and WithRanges, see the references rather than their
+// values, so keys bound late should not be checked by them. Marshal writes
+// the references as they were written.
+func WithLateBinding() Option {
+	return func(o *options) {
+		o.lateBinding = true
+	}
+}
+
+// LateRef is a variable reference kept unresolved by WithLateBinding.
+type LateRef struct {
+	// Name is the reference without the '$', such as "TOKEN" or
+	// "vault:secret/api#token".
+	Name string
+
+	resolve func() (any, error)
+}
+
+// Resolve returns the current value of the reference.
+func (r *LateRef) Resolve() (any, error) {
+	return r.resolve()
+}
+
+func (r *LateRef) String() string {
+	return "$" + r.Name
+}
+
+// Get returns the value at the key path in m, in the notation of Lookup,
+// with the references WithLateBinding kept in it resolved. Maps and
+// arrays are returned as copies holding the resolved values, and tokens
+// of a parse with checks are replaced by their values. Get fails when the
+// key is not set or a reference can not be resolved.
+func Get(m map[string]any, path string) (any, error) {
+	v, ok := Lookup(m, path)
+	if !ok {
+		return nil, fmt.Errorf("key '%s' is not set", path)
+	}
+	v, err := resolveLate(v)
+	if err != nil {
+		return nil, fmt.Errorf("key '%s': %w", path, err)
+	}
+	return v, nil
+}
+
+// resolveLate returns v with tokens replaced by their values and late
+// references by what they resolve to.
+func resolveLate(v any) (any, error) {
+	switch vv := v.(type) {
+	case *Token:
+		return resolveLate(vv.Value())
+	case *LateRef:
+		return vv.Resolve()
+	case map[string]any:
+		m := make(map[string]any, len(vv))
+		for k, e := range vv {
+			r, err := resolveLate(e)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = r
+		}
+		return m, nil
+	case []any:
+		a := make([]any, len(vv))
+		for i, e := range vv {
+			r, err := resolveLate(e)
+			if err != nil {
+				return nil, err
+			}
+			a[i] = r
+		}
+		return a, nil
+	}
+	return v, nil
+}
+
+// lateRef returns the reference of it kept unresolved, when late binding
+// is set and it refers to a VariableResolver or an environment variable
+// rather than a key.
+func (p *parser) lateRef(it item) (*LateRef, bool) {
+	name := it.Val
+	if !p.opts.lateBinding || p.isLiteral(name) {
+		return nil, false
+	}
+	if r, ref, ok := p.variableResolver(name); ok {
+		p.track(&p.state.variables, name)
+		return &LateRef{Name: name, resolve: func() (any, error) {
+			v, err := r.Resolve(ref)
+			if err != nil {
+				return nil, fmt.Errorf("variable reference for '%s' could not be resolved: %w", name, err)
+			}
+			return v, nil
+		}}, true
+	}
+	key := p.normalizeKey(name)
+	for _, ctx := range p.ctxs {
+		if m, ok := ctx.(map[string]any); ok {
+			if _, ok := m[key]; ok {
+				return nil, false
+			}
+		}
+	}
+	for _, scope := range p.scopes {
+		if _, ok := scope[key]; ok {
+			return nil, false
+		}
+	}
+	if !p.opts.env.allowed(name) {
+		return nil, false
+	}
+	p.track(&p.state.envVars, name)
+	o, file := p.opts, p.file
+	return &LateRef{Name: name, resolve: func() (any, error) {
+		s, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("variable reference for '%s' can not be found", name)
+		}
+		lp := newParser("", file, false, o)
+		lp.state = &parseState{}
+		v, err := lp.parseNested(s, false)
+		if err != nil {
+			return nil, fmt.Errorf("variable reference for '%s' could not be parsed: %w", name, err)
+		}
+		return v, nil
+	}}, true
+}
+
+// lateValues resolves the references WithLateBinding kept in m, returning
+// their values by the key paths holding them, or nil if m holds none.
+// References failing to resolve are left out and their errors returned
+// together. A reference used by several keys is resolved once.
+func lateValues(m map[string]any) (map[string]any, error) {
+	refs := Search(m, func(_ string, v any) bool {
+		_, ok := v.(*LateRef)
+		return ok
+	})
+	if len(refs) == 0 {
+		return nil, nil
+	}
+	type result struct {
+		v   any
+		err error
+	}
+	resolved := make(map[string]result)
+	values := make(map[string]any, len(refs))
+	var errs []error
+	for _, ref := range refs {
+		r := ref.Value.(*LateRef)
+		res, ok := resolved[r.Name]
+		if !ok {
+			res.v, res.err = r.Resolve()
+			resolved[r.Name] = res
+		}
+		if res.err != nil {
+			errs = append(errs, fmt.Errorf("key '%s': %w", ref.Path, res.err))
+			continue
+		}
+		values[ref.Path] = res.v
+	}
+	return values, errors.Join(errs...)
+}
+
+// Refresh resolves the references WithLateBinding kept in the current
+// config again, and notifies subscribers and reload handlers of the values
+// that changed since they were last resolved, as Modified changes of the
+// keys holding the references. Only the keys depending on a reference
+// whose value changed are notified, such as the keys set to a rotated
+// token. The config itself holds the references rather than their values,
+// so no version is recorded. References that fail to resolve keep their
+// last value and their errors are returned with the changes.
+//
+// Watch refreshes the store every interval.
+func (s *Store) Refresh() ([]Change, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.late == nil {
+		return nil, nil
+	}
+	values, err := lateValues(s.Load())
+	var changes []Change
+	for path, v := range values {
+		if old, ok := s.late[path]; !ok || !reflect.DeepEqual(old, v) {
+			changes = append(changes, Change{Kind: Modified, Path: path, Old: old, New: v})
+			s.late[path] = v
+		}
+	}
+	if len(changes) == 0 {
+		return nil, err
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	s.notify(changes)
+	return changes, errors.Join(err, s.runHandlers(s.Load(), changes, false))
+}
+
+// resolveLateValues records the values of the references WithLateBinding
+// kept in m, the new current config, for Refresh. The caller must hold
+// s.mu.
+func (s *Store) resolveLateValues(m map[string]any) {
+	s.late, _ = lateValues(m)
+}
@@ -0,0 +1,136 @@
+package conf
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLateBinding(t *testing.T) {
+	t.Setenv("API_TOKEN", "t1")
+	t.Setenv("API_RETRIES", "3")
+	secrets := map[string]any{"db": "s1"}
+	opts := []Option{
+		WithLateBinding(),
+		WithVariableResolver("secret", VariableResolverFunc(func(ref string) (any, error) {
+			return secrets[ref], nil
+		})),
+	}
+	data := `
+		host = example.com
+		api { token = $API_TOKEN, retries = $API_RETRIES, host = $host }
+		db { password = $secret:db }
+		list = [$API_TOKEN, 1]
+	`
+	for _, parse := range []func(string, ...Option) (map[string]any, error){Parse, ParseWithChecks} {
+		m, err := parse(data, opts...)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := map[string]any{"token": "t1", "retries": int64(3), "host": "example.com"}
+		if v, err := Get(m, "api"); err != nil || !reflect.DeepEqual(v, expected) {
+			t.Fatalf("Mismatch:\nReceived: '%+v', %v\nExpected: '%+v'\n", v, err, expected)
+		}
+
+		// Values are read again on every Get.
+		t.Setenv("API_TOKEN", "t2")
+		secrets["db"] = "s2"
+		for path, expected := range map[string]any{
+			"api.token":   "t2",
+			"db.password": "s2",
+			"list":        []any{"t2", int64(1)},
+			"host":        "example.com",
+		} {
+			if v, err := Get(m, path); err != nil || !reflect.DeepEqual(v, expected) {
+				t.Fatalf("Mismatch for %s:\nReceived: '%+v', %v\nExpected: '%+v'\n", path, v, err, expected)
+			}
+		}
+		t.Setenv("API_TOKEN", "t1")
+		secrets["db"] = "s1"
+
+		if v, _ := Lookup(m, "api.token"); plainValue(v).(*LateRef).Name != "API_TOKEN" {
+			t.Fatalf("Expected a late reference, got %v", v)
+		}
+	}
+
+	m, err := Parse("token = $API_TOKEN, missing = $LATE_UNSET_VAR", opts...)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := Get(m, "missing"); err == nil || err.Error() != "key 'missing': variable reference for 'LATE_UNSET_VAR' can not be found" {
+		t.Fatalf("Expected error for a missing variable, got %v", err)
+	}
+	if _, err := Get(m, "other"); err == nil || err.Error() != "key 'other' is not set" {
+		t.Fatalf("Expected error for a missing key, got %v", err)
+	}
+	out, err := Marshal(m)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(string(out), "token: $API_TOKEN") {
+		t.Fatalf("Expected the reference to be written, got %s", out)
+	}
+}
+
+func TestStoreRefresh(t *testing.T) {
+	t.Setenv("API_TOKEN", "t1")
+	t.Setenv("DB_HOST", "db1")
+	fp := filepath.Join(t.TempDir(), "app.conf")
+	writeTestFile(t, fp, "port = 4222\napi { token = $API_TOKEN }\nworker { token = $API_TOKEN }\ndb { host = $DB_HOST }\n")
+	s, err := NewStore(fp, WithLateBinding())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var notified [][]Change
+	s.Subscribe(func(changes []Change) { notified = append(notified, changes) })
+	var handled []string
+	if err := s.Handle("db", "db", func(r *Reload) error {
+		handled = append(handled, r.Changes[0].Path)
+		return nil
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if changes, err := s.Refresh(); err != nil || len(changes) != 0 {
+		t.Fatalf("Expected no changes, got %v, %v", changes, err)
+	}
+	t.Setenv("API_TOKEN", "t2")
+	changes, err := s.Refresh()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []Change{
+		{Kind: Modified, Path: "api.token", Old: "t1", New: "t2"},
+		{Kind: Modified, Path: "worker.token", Old: "t1", New: "t2"},
+	}
+	if !reflect.DeepEqual(changes, expected) || !reflect.DeepEqual(notified, [][]Change{expected}) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", notified, expected)
+	}
+	if len(handled) != 0 {
+		t.Fatalf("Expected no handler to run, got %v", handled)
+	}
+
+	// Values failing to resolve keep their last value.
+	os.Unsetenv("DB_HOST")
+	if _, err := s.Refresh(); err == nil || err.Error() != "key 'db.host': variable reference for 'DB_HOST' can not be found" {
+		t.Fatalf("Expected error for a missing variable, got %v", err)
+	}
+	t.Setenv("DB_HOST", "db2")
+	if changes, err := s.Refresh(); err != nil || len(changes) != 1 || changes[0].Old != "db1" {
+		t.Fatalf("Unexpected changes %v, %v", changes, err)
+	}
+	if !reflect.DeepEqual(handled, []string{"db.host"}) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", handled, []string{"db.host"})
+	}
+
+	// Reloads only report the references that changed.
+	writeTestFile(t, fp, "port = 4223\napi { token = $API_TOKEN }\nworker { token = $API_TOKEN }\ndb { host = $DB_HOST }\n")
+	if changes, err := s.Reload(); err != nil || len(changes) != 1 || changes[0].Path != "port" {
+		t.Fatalf("Unexpected changes %v, %v", changes, err)
+	}
+	if len(s.History()) != 2 {
+		t.Fatalf("Expected refreshes not to be recorded, got %+v", s.History())
+	}
+}
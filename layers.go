@@ -0,0 +1,165 @@
+package conf
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// ParseAll parses several documents and merges them in order, so values in
+// later documents take precedence over earlier ones. Maps are merged key
+// by key, all other values are replaced, and arrays are merged as set with
+// WithArrayStrategy. Variables can refer to top level keys of earlier
+// documents.
+func ParseAll(docs []string, opts ...Option) (map[string]any, error) {
+	return parseLayers(docs, make([]string, len(docs)), newOptions(opts))
+}
+
+// ParseFiles is like ParseAll for the config files at paths. Include
+// paths are relative to the file they appear in.
+func ParseFiles(paths []string, opts ...Option) (map[string]any, error) {
+	o := newOptions(opts)
+	docs := make([]string, len(paths))
+	for i, fp := range paths {
+		data, err := readFile(fp, o.readLimit())
+		if err != nil {
+			return nil, &OpenError{Path: fp, Err: err}
+		}
+		docs[i] = string(data)
+	}
+	return parseLayers(docs, paths, o)
+}
+
+// parseLayers parses docs read from files fps. Variables are stripped once
+// all documents were parsed, so later documents can still refer to them.
+// Limits apply to all documents together.
+func parseLayers(docs, fps []string, o *options) (_ map[string]any, err error) {
+	if o.err != nil {
+		return nil, o.err
+	}
+	state := &parseState{}
+	if len(o.policies) > 0 {
+		state.positions = make(map[string]schemaPos)
+	}
+	if o.stats != nil {
+		defer o.reportStats(firstFile(fps), state, time.Now(), &err)
+	}
+	parsers := make([]*parser, 0, len(docs))
+	var scopes []map[string]any
+	for i, data := range docs {
+		data, err := o.prepareInput(fps[i], data)
+		if err != nil {
+			return nil, &ParseError{File: fps[i], Err: err}
+		}
+		p := newParser(data, fps[i], false, o)
+		p.state = state
+		p.scopes = scopes
+		if err := p.parseDocument(data); err != nil {
+			return nil, err
+		}
+		state.moves = nil
+		parsers = append(parsers, p)
+		scopes = append(scopes[:len(scopes):len(scopes)], p.mapping)
+	}
+
+	m := make(map[string]any)
+	for _, p := range parsers {
+		p.stripVariables()
+	}
+	for _, p := range parsers {
+		mergeMaps(m, p.mapping, o.arrayStrategy)
+	}
+	if err := state.validateSchemas(m, false); err != nil {
+		return nil, err
+	}
+	if err := state.checkPolicies(o, firstFile(fps), m, false); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// firstFile returns the first of the files of a layered parse, empty when
+// parsing data.
+func firstFile(fps []string) string {
+	if len(fps) == 0 {
+		return ""
+	}
+	return fps[0]
+}
+
+// ArrayStrategy is how ParseAll and ParseFiles merge arrays set in more
+// than one document.
+type ArrayStrategy int
+
+const (
+	// ArrayReplace keeps the array of the later document.
+	ArrayReplace ArrayStrategy = iota
+	// ArrayAppend appends the elements of the later array.
+	ArrayAppend
+	// ArrayUnique appends the elements of the later array that the
+	// earlier one does not hold yet.
+	ArrayUnique
+)
+
+func (s ArrayStrategy) String() string {
+	switch s {
+	case ArrayReplace:
+		return "replace"
+	case ArrayAppend:
+		return "append"
+	case ArrayUnique:
+		return "unique"
+	}
+	return fmt.Sprintf("ArrayStrategy(%d)", int(s))
+}
+
+// WithArrayStrategy sets how ParseAll and ParseFiles merge arrays, which
+// by default are replaced.
+func WithArrayStrategy(s ArrayStrategy) Option {
+	return func(o *options) {
+		o.arrayStrategy = s
+	}
+}
+
+// mergeMaps sets the values of src in dst, merging maps present in both
+// and arrays as set by strategy.
+func mergeMaps(dst, src map[string]any, strategy ArrayStrategy) {
+	for k, v := range src {
+		switch sv := plainValue(v).(type) {
+		case map[string]any:
+			if dm, ok := plainValue(dst[k]).(map[string]any); ok {
+				mergeMaps(dm, sv, strategy)
+				continue
+			}
+		case []any:
+			if da, ok := plainValue(dst[k]).([]any); ok && strategy != ArrayReplace {
+				dst[k] = mergeArrays(da, sv, strategy)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
+
+// mergeArrays returns the elements of dst followed by those of src, or
+// only those of src not in dst for ArrayUnique.
+func mergeArrays(dst, src []any, strategy ArrayStrategy) []any {
+	merged := append(make([]any, 0, len(dst)+len(src)), dst...)
+	for _, e := range src {
+		if strategy == ArrayUnique && containsValue(merged, e) {
+			continue
+		}
+		merged = append(merged, e)
+	}
+	return merged
+}
+
+func containsValue(arr []any, v any) bool {
+	v = stripValue(v)
+	for _, e := range arr {
+		if reflect.DeepEqual(stripValue(e), v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package conf
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseAll(t *testing.T) {
+	base := `
+		port = 4222
+		host = localhost
+		tls { cert = base.pem; key = base.key }
+		routes = [a, b]
+	`
+	prod := `
+		host = example.com
+		tls { cert = prod.pem }
+		routes = [c]
+		url = "nats://$host:$port"
+	`
+	m, err := ParseAll([]string{base, prod})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]any{
+		"port":   int64(4222),
+		"host":   "example.com",
+		"tls":    map[string]any{"cert": "prod.pem", "key": "base.key"},
+		"routes": []any{"c"},
+		"url":    "nats://$host:$port",
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, expected)
+	}
+}
+
+func TestParseAllArrayStrategy(t *testing.T) {
+	docs := []string{
+		"routes = [a, b]; tls { ciphers = [x] }",
+		"routes = [b, c]; tls { ciphers = [x, y] }; new = [z]",
+	}
+	for _, tt := range []struct {
+		strategy ArrayStrategy
+		routes   []any
+		ciphers  []any
+	}{
+		{ArrayReplace, []any{"b", "c"}, []any{"x", "y"}},
+		{ArrayAppend, []any{"a", "b", "b", "c"}, []any{"x", "x", "y"}},
+		{ArrayUnique, []any{"a", "b", "c"}, []any{"x", "y"}},
+	} {
+		m, err := ParseAll(docs, WithArrayStrategy(tt.strategy))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := map[string]any{
+			"routes": tt.routes,
+			"tls":    map[string]any{"ciphers": tt.ciphers},
+			"new":    []any{"z"},
+		}
+		if !reflect.DeepEqual(m, expected) {
+			t.Fatalf("Mismatch for %s:\nReceived: '%+v'\nExpected: '%+v'\n", tt.strategy, m, expected)
+		}
+	}
+}
+
+func TestParseAllVariables(t *testing.T) {
+	secrets := `_PASS = s3cr3t; user = admin`
+	app := `
+		auth { user = $user; password = $_PASS }
+		user = nobody
+	`
+	m, err := ParseAll([]string{secrets, app}, WithPrivatePrefix("_"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]any{
+		"user": "nobody",
+		"auth": map[string]any{"user": "admin", "password": "s3cr3t"},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, expected)
+	}
+
+	m, err = ParseAll([]string{secrets, `password = $_PASS`}, WithStripVariables())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected = map[string]any{"user": "admin", "password": "s3cr3t"}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, expected)
+	}
+
+	// Variables only see earlier documents.
+	if _, err := ParseAll([]string{`a = $b`, `b = 1`}); err == nil {
+		t.Fatal("Expected an error for a variable of a later document")
+	}
+}
+
+func TestParseFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"base.conf":   "include 'limits.conf'\nport = 4222",
+		"limits.conf": "limits { conn = 10, subs = 100 }",
+		"local.conf":  "limits { conn = 20 }",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := ParseFiles([]string{filepath.Join(dir, "base.conf"), filepath.Join(dir, "local.conf")})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]any{
+		"port":   int64(4222),
+		"limits": map[string]any{"conn": int64(20), "subs": int64(100)},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, expected)
+	}
+
+	_, err = ParseFiles([]string{filepath.Join(dir, "base.conf"), filepath.Join(dir, "missing.conf")})
+	if err == nil || !strings.Contains(err.Error(), "error opening config file") {
+		t.Fatalf("Expected an open error, got %v", err)
+	}
+	_, err = ParseFiles([]string{filepath.Join(dir, "base.conf"), filepath.Join(dir, "local.conf")}, WithMaxBytes(60))
+	if err == nil {
+		t.Fatal("Expected the byte limit to apply to all files")
+	}
+}
@@ -0,0 +1,245 @@
+package conf
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FromINI converts an INI file to a config. Keys before the first section
+// are top level keys, and sections are nested on dots, so
+//
+//	[cluster.tls]
+//	cert_file = c.pem
+//
+// becomes cluster { tls { cert_file: c.pem } }. A quoted part of a section
+// name is a single key, so [remote "origin"] becomes remote { origin {} }
+// as in Git configs. Keys and values are separated by '=' or ':', and
+// lines starting with ';' or '#' are comments.
+//
+// Values are typed as described for FromProperties, except that values
+// in double or single quotes are strings without the quotes. Sections may
+// repeat; keys set again replace the earlier value.
+func FromINI(data string) (map[string]any, error) {
+	m := make(map[string]any)
+	var section []string
+	sc := bufio.NewScanner(strings.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' {
+			name, ok := strings.CutSuffix(line[1:], "]")
+			var err error
+			if section, err = sectionKeys(name); !ok || err != nil {
+				return nil, &ParseError{Line: n, Err: fmt.Errorf("invalid section '%s'", line)}
+			}
+			if err := insertLegacy(m, section, nil); err != nil {
+				return nil, &ParseError{Line: n, Err: err}
+			}
+			continue
+		}
+		i := strings.IndexAny(line, "=:")
+		if i <= 0 {
+			return nil, &ParseError{Line: n, Err: fmt.Errorf("expected key = value, got '%s'", line)}
+		}
+		key, raw := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		var v any = legacyValue(raw)
+		if len(raw) >= 2 && (raw[0] == '"' || raw[0] == '\'') && raw[len(raw)-1] == raw[0] {
+			v = raw[1 : len(raw)-1]
+			if s, err := strconv.Unquote(raw); err == nil && raw[0] == '"' {
+				v = s
+			}
+		}
+		path := append(append([]string(nil), section...), key)
+		if err := insertLegacy(m, path, v); err != nil {
+			return nil, &ParseError{Line: n, Err: err}
+		}
+	}
+	return m, sc.Err()
+}
+
+// sectionKeys splits an INI section name into its keys.
+func sectionKeys(name string) ([]string, error) {
+	var keys []string
+	for rest := strings.TrimSpace(name); rest != ""; rest = strings.TrimLeft(rest, ". \t") {
+		if rest[0] == '"' {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote")
+			}
+			keys = append(keys, rest[1:end+1])
+			rest = rest[end+2:]
+			continue
+		}
+		i := strings.IndexAny(rest, `."`)
+		if i < 0 {
+			i = len(rest)
+		}
+		key := strings.TrimSpace(rest[:i])
+		if key == "" {
+			return nil, fmt.Errorf("empty key")
+		}
+		keys = append(keys, key)
+		rest = rest[i:]
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("empty section")
+	}
+	return keys, nil
+}
+
+// FromProperties converts a Java properties file to a config. Keys are
+// split into nested maps on dots, so server.tls.port=4443 becomes
+// server { tls { port: 4443 } }. Keys and values are separated by '=',
+// ':' or white space, lines starting with '#' or '!' are comments, and
+// lines ending in a backslash continue on the next line. The escapes of
+// properties files, such as \n or \u00e9, are decoded.
+//
+// Values that read as integers, floats or the bools true and false are
+// typed as such, others are strings. A key can not hold both a value and
+// keys below it, as log4j's appender.A1 and appender.A1.layout would, so
+// such files fail to convert.
+func FromProperties(data string) (map[string]any, error) {
+	m := make(map[string]any)
+	lines := strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		n := i + 1
+		line := strings.TrimLeft(lines[i], " \t\f")
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+		// Join continued lines, ending in an odd number of backslashes.
+		for continued(line) && i+1 < len(lines) {
+			i++
+			line = line[:len(line)-1] + strings.TrimLeft(lines[i], " \t\f")
+		}
+		line = strings.TrimSuffix(line, `\`)
+
+		end := len(line)
+		for j := 0; j < len(line); j++ {
+			if line[j] == '\\' {
+				j++
+				continue
+			}
+			if strings.IndexByte("=: \t\f", line[j]) >= 0 {
+				end = j
+				break
+			}
+		}
+		key, rest := line[:end], strings.TrimLeft(line[end:], " \t\f")
+		if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+			rest = strings.TrimLeft(rest[1:], " \t\f")
+		}
+		key, err := unescapeProperty(key)
+		if err == nil {
+			rest, err = unescapeProperty(rest)
+		}
+		if err != nil {
+			return nil, &ParseError{Line: n, Err: err}
+		}
+		path := strings.Split(key, ".")
+		for _, k := range path {
+			if k == "" {
+				return nil, &ParseError{Line: n, Err: fmt.Errorf("invalid key '%s'", key)}
+			}
+		}
+		if err := insertLegacy(m, path, legacyValue(rest)); err != nil {
+			return nil, &ParseError{Line: n, Err: err}
+		}
+	}
+	return m, nil
+}
+
+// continued reports whether a properties line ends in an odd number of
+// backslashes.
+func continued(line string) bool {
+	n := len(line) - len(strings.TrimRight(line, `\`))
+	return n%2 == 1
+}
+
+// unescapeProperty decodes the escapes of a properties file key or value.
+func unescapeProperty(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			sb.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			sb.WriteByte('\t')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'u':
+			if i+5 > len(s) {
+				return "", fmt.Errorf("invalid escape '\\%s'", s[i:])
+			}
+			r, err := strconv.ParseUint(s[i+1:i+5], 16, 16)
+			if err != nil {
+				return "", fmt.Errorf("invalid escape '\\%s'", s[i:i+5])
+			}
+			sb.WriteRune(rune(r))
+			i += 4
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String(), nil
+}
+
+// legacyValue types a value of an INI or properties file.
+func legacyValue(s string) any {
+	switch s {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n
+	}
+	if strings.Trim(s, "0123456789.+-eE") == "" && strings.ContainsAny(s, "0123456789") {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return s
+}
+
+// insertLegacy sets v at path in m, creating the maps leading to it. A nil
+// v only creates the maps, for INI sections.
+func insertLegacy(m map[string]any, path []string, v any) error {
+	parent := m
+	for i, k := range path {
+		full := strings.Join(path[:i+1], ".")
+		if i == len(path)-1 && v != nil {
+			if _, ok := parent[k].(map[string]any); ok {
+				return fmt.Errorf("key '%s' holds a value and keys below it", full)
+			}
+			parent[k] = v
+			return nil
+		}
+		cur, ok := parent[k]
+		if !ok {
+			cur = make(map[string]any)
+			parent[k] = cur
+		}
+		child, ok := cur.(map[string]any)
+		if !ok {
+			return fmt.Errorf("key '%s' holds a value and keys below it", full)
+		}
+		parent = child
+	}
+	return nil
+}
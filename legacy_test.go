@@ -0,0 +1,103 @@
+package conf
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFromINI(t *testing.T) {
+	m, err := FromINI(`
+; global settings
+port = 4222
+debug: true
+
+[cluster.tls]
+cert_file = c.pem
+# comment
+timeout = 2.5
+
+[remote "origin.west"]
+url = "nats://a\tb"
+name = 'west'
+
+[my section]
+key =
+`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ex := map[string]any{
+		"port":  int64(4222),
+		"debug": true,
+		"cluster": map[string]any{
+			"tls": map[string]any{"cert_file": "c.pem", "timeout": 2.5},
+		},
+		"remote": map[string]any{
+			"origin.west": map[string]any{"url": "nats://a\tb", "name": "west"},
+		},
+		"my section": map[string]any{"key": ""},
+	}
+	if !reflect.DeepEqual(m, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, ex)
+	}
+
+	for data, expected := range map[string]string{
+		"[cluster":          "invalid section '[cluster' (:1:0)",
+		"[]":                "invalid section '[]' (:1:0)",
+		"port = 1\nport":    "expected key = value, got 'port' (:2:0)",
+		"port = 1\n[port]":  "key 'port' holds a value and keys below it (:2:0)",
+		"[a]\nb = 1\n[]\n":  "invalid section '[]' (:3:0)",
+		"[a.b]\n[a]\nb = 1": "key 'a.b' holds a value and keys below it (:3:0)",
+	} {
+		if _, err := FromINI(data); err == nil || err.Error() != expected {
+			t.Fatalf("Expected error %q for %q, got %v", expected, data, err)
+		}
+	}
+}
+
+func TestFromProperties(t *testing.T) {
+	m, err := FromProperties(strings.Join([]string{
+		"# comment",
+		"! another comment",
+		"server.port=4222",
+		"server.host : localhost",
+		"server.tls.enabled true",
+		"message = Hello, \\",
+		"    world\\u00e9",
+		"path=C:\\\\temp\\\\",
+		"ratio=0.75",
+		"version=1.2.3",
+		`key\ with\ spaces=a\tb`,
+		"empty",
+	}, "\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ex := map[string]any{
+		"server": map[string]any{
+			"port": int64(4222),
+			"host": "localhost",
+			"tls":  map[string]any{"enabled": true},
+		},
+		"message":         "Hello, world\u00e9",
+		"path":            `C:\temp\`,
+		"ratio":           0.75,
+		"version":         "1.2.3",
+		"key with spaces": "a\tb",
+		"empty":           "",
+	}
+	if !reflect.DeepEqual(m, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, ex)
+	}
+
+	for data, expected := range map[string]string{
+		"log.appender=a\nlog.appender.layout=b": "key 'log.appender' holds a value and keys below it (:2:0)",
+		"a..b=1":                                "invalid key 'a..b' (:1:0)",
+		"a=\\u12":                               `invalid escape '\u12' (:1:0)`,
+	} {
+		if _, err := FromProperties(data); err == nil || err.Error() != expected {
+			t.Fatalf("Expected error %q for %q, got %v", expected, data, err)
+		}
+	}
+}
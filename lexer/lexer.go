@@ -0,0 +1,2052 @@
+// Package lexer tokenizes the config format parsed by the conf package,
+// for tools such as syntax highlighters, formatters and linters.
+//
+//	lx := lexer.New(input)
+//	for it := lx.Next(); it.Type != lexer.EOF; it = lx.Next() {
+//		if it.Type == lexer.Error {
+//			return fmt.Errorf("%s (%d:%d)", it.Val, it.Line, it.Pos)
+//		}
+//		...
+//	}
+package lexer
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// ItemType is the kind of an Item.
+type ItemType int
+
+const (
+	Error ItemType = iota
+	NIL            // used in the parser to indicate no type
+	EOF
+	Key
+	Text
+	String
+	Bool
+	Integer
+	Float
+	Datetime
+	ArrayStart
+	ArrayEnd
+	MapStart
+	MapEnd
+	CommentStart
+	Variable
+	Include
+	Bytes
+	OptionalInclude
+	Call
+	Spread
+	Schema
+	Directive
+)
+
+const (
+	eof               = 0
+	mapStart          = '{'
+	mapEnd            = '}'
+	keySepEqual       = '='
+	keySepColon       = ':'
+	arrayStart        = '['
+	arrayEnd          = ']'
+	arrayValTerm      = ','
+	mapValTerm        = ','
+	commentHashStart  = '#'
+	commentSlashStart = '/'
+	dqStringStart     = '"'
+	dqStringEnd       = '"'
+	sqStringStart     = '\''
+	sqStringEnd       = '\''
+	optValTerm        = ';'
+	topOptStart       = '{'
+	topOptValTerm     = ','
+	topOptTerm        = '}'
+	blockStart        = '('
+	blockEnd          = ')'
+	spreadStart       = '$'
+	spreadEnd         = "..."
+	schemaKeyword     = "@schema"
+	mapEndString      = string(mapEnd)
+)
+
+type stateFn func(lx *Lexer) stateFn
+
+type Lexer struct {
+	input string
+	start int
+	pos   int
+	width int
+	line  int
+	state stateFn
+	items chan Item
+
+	// A stack of state functions used to maintain context.
+	// The idea is to reuse parts of the state machine in various places.
+	// For example, values can appear at the top level or within arbitrarily
+	// nested arrays. The last state on the stack is used after a value has
+	// been lexed. Similarly for comments.
+	stack []stateFn
+
+	// Used for processing escapable substrings in double-quoted and raw strings
+	stringParts   []string
+	stringStateFn stateFn
+
+	// lstart is the start position of the current line.
+	lstart int
+
+	// ilstart is the start position of the line from the current item.
+	ilstart int
+
+	// tabWidth is the number of columns a tab advances to the next tab
+	// stop when computing item positions.
+	tabWidth int
+
+	// colLine, colOff and col track the column of the offset colOff in the
+	// line starting at colLine, so the positions of the items of a line
+	// are counted on from the previous one rather than from the start of
+	// the line, which is quadratic in the length of long lines.
+	colLine, colOff, col int
+
+	// strict rejects input that is otherwise tolerated, such as a stray
+	// '}' after a top-level value.
+	strict bool
+
+	// includeType is the item emitted for the include being lexed, either
+	// Include or OptionalInclude.
+	includeType ItemType
+
+	// isFunc reports whether a name followed by '(' in a value is a
+	// function call. Without it such values are plain strings.
+	isFunc func(name string) bool
+
+	// isDirective reports whether a key followed by an argument is a
+	// directive, and directive is the name of the one being lexed.
+	isDirective func(name string) bool
+	directive   string
+}
+
+// Item is a token of the input. Val holds the text of the item, without
+// quotes for strings and keys, and the error message for Error items.
+type Item struct {
+	Type ItemType
+	Val  string
+
+	// Line is the 1-based line of the item. Pos is its column, counted
+	// from 0 on the first line and from 1 on the lines after it.
+	Line int
+	Pos  int
+}
+
+// Next returns the next item of the input. After an Error or EOF item it
+// keeps returning EOF.
+func (lx *Lexer) Next() Item {
+	for {
+		select {
+		case item := <-lx.items:
+			return item
+		default:
+			// The lexer stopped after an error or EOF, keep reporting EOF
+			// instead of calling a nil state.
+			if lx.state == nil {
+				return Item{EOF, "", lx.line, 0}
+			}
+			lx.state = lx.state(lx)
+		}
+	}
+}
+
+// New returns a Lexer for a document of keys and values.
+func New(input string) *Lexer {
+	lx := &Lexer{
+		input:       input,
+		state:       lexTop,
+		line:        1,
+		items:       make(chan Item, 10),
+		stack:       make([]stateFn, 0, 10),
+		stringParts: []string{},
+		tabWidth:    1,
+		colLine:     -1,
+	}
+	return lx
+}
+
+// NewValue returns a Lexer for a document holding a single value rather
+// than keys, such as a bare array.
+func NewValue(input string) *Lexer {
+	lx := New(input)
+	lx.state = lexDocValue
+	return lx
+}
+
+// IsValue reports whether input holds a single value rather than keys.
+// Arrays are told apart by their '[', other values by not lexing as keys
+// with values but lexing as a value.
+func IsValue(input string) bool {
+	if firstRune(input) == arrayStart {
+		return true
+	}
+	if last, ok := lexAll(New(input)); ok && last != Key {
+		return false
+	}
+	_, ok := lexAll(NewValue(input))
+	return ok
+}
+
+// lexAll consumes all items of lx. It returns the type of the last item
+// before EOF, and whether there was no error.
+func lexAll(lx *Lexer) (ItemType, bool) {
+	var last ItemType
+	for {
+		it := lx.Next()
+		switch it.Type {
+		case Error:
+			return last, false
+		case EOF:
+			return last, true
+		case CommentStart, Text:
+		default:
+			last = it.Type
+		}
+	}
+}
+
+// SetTabWidth sets the number of columns a tab advances positions to the
+// next tab stop by. The default of 1 counts a tab as one column.
+func (lx *Lexer) SetTabWidth(n int) {
+	lx.tabWidth = n
+}
+
+// SetStrict rejects input that is otherwise tolerated, such as a stray
+// '}' after a top-level value.
+func (lx *Lexer) SetStrict(strict bool) {
+	lx.strict = strict
+}
+
+// SetFuncs sets the functions values can call, as in env("HOME"). Calls
+// of names isFunc reports true for are lexed as Call items, other values
+// followed by '(' as strings.
+func (lx *Lexer) SetFuncs(isFunc func(name string) bool) {
+	lx.isFunc = isFunc
+}
+
+// SetDirectives sets the directives a config can use in place of keys or
+// values, as in import_users 'users.csv'. A name isDirective reports true
+// for, followed by an argument rather than a value, is lexed as a Directive
+// item whose Val is the name of the directive and its argument, separated
+// by a space. The argument is lexed as the file of an include.
+func (lx *Lexer) SetDirectives(isDirective func(name string) bool) {
+	lx.isDirective = isDirective
+}
+
+func (lx *Lexer) push(state stateFn) {
+	lx.stack = append(lx.stack, state)
+}
+
+func (lx *Lexer) pop() stateFn {
+	if len(lx.stack) == 0 {
+		return lx.errorf("BUG in lexer: no states to pop.")
+	}
+	li := len(lx.stack) - 1
+	last := lx.stack[li]
+	lx.stack = lx.stack[0:li]
+	return last
+}
+
+func (lx *Lexer) emit(typ ItemType) {
+	val := strings.Join(lx.stringParts, "") + lx.input[lx.start:lx.pos]
+	// Position of item in line where it started.
+	pos := lx.column(lx.ilstart, lx.pos-len(val))
+	lx.items <- Item{typ, val, lx.line, pos}
+	lx.start = lx.pos
+	lx.ilstart = lx.lstart
+}
+
+func (lx *Lexer) emitString() {
+	var finalString string
+	if len(lx.stringParts) > 0 {
+		finalString = strings.Join(lx.stringParts, "") + lx.input[lx.start:lx.pos]
+		lx.stringParts = []string{}
+	} else {
+		finalString = lx.input[lx.start:lx.pos]
+	}
+	// Position of string in line where it started.
+	pos := lx.column(lx.ilstart, lx.pos-len(finalString))
+	lx.items <- Item{String, finalString, lx.line, pos}
+	lx.start = lx.pos
+	lx.ilstart = lx.lstart
+}
+
+func (lx *Lexer) addCurrentStringPart(offset int) {
+	lx.stringParts = append(lx.stringParts, lx.input[lx.start:lx.pos-offset])
+	lx.start = lx.pos
+}
+
+func (lx *Lexer) addStringPart(s string) stateFn {
+	lx.stringParts = append(lx.stringParts, s)
+	lx.start = lx.pos
+	return lx.stringStateFn
+}
+
+func (lx *Lexer) hasEscapedParts() bool {
+	return len(lx.stringParts) > 0
+}
+
+func (lx *Lexer) next() (r rune) {
+	if lx.pos >= len(lx.input) {
+		lx.width = 0
+		return eof
+	}
+
+	if lx.input[lx.pos] == '\n' {
+		lx.line++
+
+		// Mark start position of current line.
+		lx.lstart = lx.pos
+	}
+	r, lx.width = utf8.DecodeRuneInString(lx.input[lx.pos:])
+	lx.pos += lx.width
+
+	return r
+}
+
+// column returns the position of the byte offset off in the line starting
+// at lstart. Positions count runes rather than bytes, and tabs advance to
+// the next multiple of the tab width, so they match what editors show.
+// Except for the first line lstart is the offset of the new line character
+// ending the previous line, which counts as one position.
+func (lx *Lexer) column(lstart, off int) int {
+	if off <= lstart || lstart >= len(lx.input) {
+		return max(off-lstart, 0)
+	}
+	off = min(off, len(lx.input))
+	base := 0
+	if lx.input[lstart] == '\n' {
+		base = 1
+	}
+	if lstart != lx.colLine || off < lx.colOff {
+		lx.colLine, lx.colOff, lx.col = lstart, lstart+base, base
+	}
+	col := lx.col
+	for _, r := range lx.input[lx.colOff:off] {
+		if r == '\t' && lx.tabWidth > 1 {
+			col += lx.tabWidth - (col-base)%lx.tabWidth
+		} else {
+			col++
+		}
+	}
+	// Offsets within a rune count its bytes, so only rune boundaries can
+	// be counted on from.
+	if off == len(lx.input) || utf8.RuneStart(lx.input[off]) {
+		lx.colOff, lx.col = off, col
+	}
+	return col
+}
+
+// ignore skips over the pending input before this point.
+func (lx *Lexer) ignore() {
+	lx.start = lx.pos
+	lx.ilstart = lx.lstart
+}
+
+// backup steps back one rune. Can be called only once per call of next.
+func (lx *Lexer) backup() {
+	lx.pos -= lx.width
+	if lx.pos < len(lx.input) && lx.input[lx.pos] == '\n' {
+		lx.line--
+	}
+}
+
+// peek returns but does not consume the next rune in the input.
+func (lx *Lexer) peek() rune {
+	r := lx.next()
+	lx.backup()
+	return r
+}
+
+// errorf stops all lexing by emitting an error and returning `nil`.
+// Note that any value that is a character is escaped if it's a special
+// character (new lines, tabs, etc.).
+func (lx *Lexer) errorf(format string, values ...any) stateFn {
+	for i, value := range values {
+		if v, ok := value.(rune); ok {
+			values[i] = escapeSpecial(v)
+		}
+	}
+
+	// Position of error in current line.
+	pos := lx.column(lx.lstart, lx.pos)
+	lx.items <- Item{
+		Error,
+		fmt.Sprintf(format, values...),
+		lx.line,
+		pos,
+	}
+	return nil
+}
+
+// lexTop consumes elements at the top level of data structure.
+func lexTop(lx *Lexer) stateFn {
+	r := lx.next()
+	if unicode.IsSpace(r) {
+		return lexSkip(lx, lexTop)
+	}
+
+	switch r {
+	case topOptStart:
+		lx.push(lexTop)
+		return lexSkip(lx, lexBlockStart)
+	case commentHashStart:
+		lx.push(lexTop)
+		return lexCommentStart
+	case commentSlashStart:
+		rn := lx.next()
+		if rn == commentSlashStart {
+			lx.push(lexTop)
+			return lexCommentStart
+		}
+		lx.backup()
+		fallthrough
+	case eof:
+		if lx.pos > lx.start {
+			return lx.errorf("Unexpected EOF.")
+		}
+		lx.emit(EOF)
+		return nil
+	}
+
+	// At this point, the only valid item can be a key, so we back up
+	// and let the key lexer do the rest.
+	lx.backup()
+	lx.push(lexTopValueEnd)
+	if lx.isSchema() {
+		return lexSchemaStart
+	}
+	return lexKeyStart
+}
+
+// isSchema reports whether the input at the current position starts a
+// schema block, @schema followed by '{'.
+func (lx *Lexer) isSchema() bool {
+	rest, ok := strings.CutPrefix(lx.input[lx.pos:], schemaKeyword)
+	if !ok {
+		return false
+	}
+	rest = strings.TrimLeft(rest, " \t")
+	return strings.HasPrefix(rest, string(mapStart))
+}
+
+// lexSchemaStart consumes the @schema keyword up to the '{' opening the
+// block.
+func lexSchemaStart(lx *Lexer) stateFn {
+	for lx.next() != mapStart {
+	}
+	lx.ignore()
+	return lexSchema
+}
+
+// lexSchema consumes the body of a schema block up to its matching '}' and
+// emits it as a Schema item, left for the parser to interpret. Braces in
+// strings and comments are skipped.
+func lexSchema(lx *Lexer) stateFn {
+	depth := 0
+	for {
+		switch r := lx.next(); r {
+		case eof:
+			return lx.errorf("Unexpected EOF processing schema block.")
+		case dqStringStart:
+			for r = lx.next(); r != dqStringEnd; r = lx.next() {
+				switch r {
+				case '\\':
+					lx.next()
+				case eof, '\n':
+					return lx.errorf("Unterminated string in schema block.")
+				}
+			}
+		case commentHashStart:
+			for r != '\n' && r != eof {
+				r = lx.next()
+			}
+			lx.backup()
+		case mapStart:
+			depth++
+		case mapEnd:
+			if depth > 0 {
+				depth--
+				continue
+			}
+			lx.backup()
+			lx.emit(Schema)
+			lx.next()
+			lx.ignore()
+			return lx.pop()
+		}
+	}
+}
+
+// lexTopValueEnd is entered whenever a top-level value has been consumed.
+// It must see only whitespace, and will turn back to lexTop upon a new line.
+// If it sees EOF, it will quit the lexer successfully.
+func lexTopValueEnd(lx *Lexer) stateFn {
+	r := lx.next()
+	switch {
+	case r == commentHashStart:
+		// a comment will read to a new line for us.
+		lx.push(lexTop)
+		return lexCommentStart
+	case r == commentSlashStart:
+		rn := lx.next()
+		if rn == commentSlashStart {
+			lx.push(lexTop)
+			return lexCommentStart
+		}
+		lx.backup()
+		fallthrough
+	case isWhitespace(r):
+		return lexTopValueEnd
+	case r == topOptTerm && lx.strict:
+		return lx.errorf("Unexpected '%v' with no matching '%v'.", r, topOptStart)
+	case isNL(r) || r == eof || r == optValTerm || r == topOptValTerm || r == topOptTerm:
+		lx.ignore()
+		return lexTop
+	}
+	return lx.errorf("Expected a top-level value to end with a new line, "+
+		"comment or EOF, but got '%v' instead.", r)
+}
+
+// lexDocValue starts a document holding a single value instead of keys,
+// such as a bare array.
+func lexDocValue(lx *Lexer) stateFn {
+	r := lx.next()
+	if unicode.IsSpace(r) {
+		return lexSkip(lx, lexDocValue)
+	}
+
+	switch r {
+	case commentHashStart:
+		lx.push(lexDocValue)
+		return lexCommentStart
+	case commentSlashStart:
+		rn := lx.next()
+		if rn == commentSlashStart {
+			lx.push(lexDocValue)
+			return lexCommentStart
+		}
+		lx.backup()
+	case eof:
+		lx.emit(EOF)
+		return nil
+	}
+	lx.backup()
+	lx.push(lexDocValueEnd)
+	return lexValue
+}
+
+// lexDocValueEnd is entered after the value of a value document. Only
+// whitespace and comments may follow it.
+func lexDocValueEnd(lx *Lexer) stateFn {
+	r := lx.next()
+	if unicode.IsSpace(r) {
+		return lexSkip(lx, lexDocValueEnd)
+	}
+
+	switch r {
+	case commentHashStart:
+		lx.push(lexDocValueEnd)
+		return lexCommentStart
+	case commentSlashStart:
+		if lx.next() == commentSlashStart {
+			lx.push(lexDocValueEnd)
+			return lexCommentStart
+		}
+		lx.backup()
+	case eof:
+		lx.emit(EOF)
+		return nil
+	}
+	return lx.errorf("Expected the document to end after its value, but got '%v' instead.", r)
+}
+
+// firstRune returns the first character of input that is not whitespace
+// or part of a comment, or eof.
+func firstRune(input string) rune {
+	for input != "" {
+		r, n := utf8.DecodeRuneInString(input)
+		switch {
+		case unicode.IsSpace(r):
+			input = input[n:]
+		case r == commentHashStart || strings.HasPrefix(input, "//"):
+			i := strings.IndexByte(input, '\n')
+			if i < 0 {
+				return eof
+			}
+			input = input[i+1:]
+		default:
+			return r
+		}
+	}
+	return eof
+}
+
+func lexBlockStart(lx *Lexer) stateFn {
+	r := lx.next()
+	if unicode.IsSpace(r) {
+		return lexSkip(lx, lexBlockStart)
+	}
+
+	switch r {
+	case topOptStart:
+		lx.push(lexBlockEnd)
+		return lexSkip(lx, lexBlockStart)
+	case topOptTerm:
+		lx.ignore()
+		return lx.pop()
+	case commentHashStart:
+		lx.push(lexBlockStart)
+		return lexCommentStart
+	case commentSlashStart:
+		rn := lx.next()
+		if rn == commentSlashStart {
+			lx.push(lexBlockStart)
+			return lexCommentStart
+		}
+		lx.backup()
+		fallthrough
+	case eof:
+		if lx.pos > lx.start {
+			return lx.errorf("Unexpected EOF.")
+		}
+		lx.emit(EOF)
+		return nil
+	}
+
+	// At this point, the only valid item can be a key, so we back up
+	// and let the key lexer do the rest.
+	lx.backup()
+	lx.push(lexBlockValueEnd)
+	return lexKeyStart
+}
+
+// lexBlockValueEnd is entered whenever a block-level value has been consumed.
+// It must see only whitespace, and will turn back to lexBlockStart upon a new line.
+// If it sees EOF, it will quit the lexer successfully.
+func lexBlockValueEnd(lx *Lexer) stateFn {
+	r := lx.next()
+	switch {
+	case r == commentHashStart:
+		// a comment will read to a new line for us.
+		lx.push(lexBlockValueEnd)
+		return lexCommentStart
+	case r == commentSlashStart:
+		rn := lx.next()
+		if rn == commentSlashStart {
+			lx.push(lexBlockValueEnd)
+			return lexCommentStart
+		}
+		lx.backup()
+		fallthrough
+	case isWhitespace(r):
+		return lexBlockValueEnd
+	case isNL(r) || r == optValTerm || r == topOptValTerm:
+		lx.ignore()
+		return lexBlockStart
+	case r == topOptTerm:
+		lx.backup()
+		return lexBlockEnd
+	}
+	return lx.errorf("Expected a block-level value to end with a new line, "+
+		"comment or EOF, but got '%v' instead.", r)
+}
+
+// lexBlockEnd is entered whenever a block-level value has been consumed.
+// It must see only whitespace, and will turn back to lexTop upon a "}".
+func lexBlockEnd(lx *Lexer) stateFn {
+	r := lx.next()
+	switch {
+	case r == commentHashStart:
+		// a comment will read to a new line for us.
+		lx.push(lexBlockStart)
+		return lexCommentStart
+	case r == commentSlashStart:
+		rn := lx.next()
+		if rn == commentSlashStart {
+			lx.push(lexBlockStart)
+			return lexCommentStart
+		}
+		lx.backup()
+		fallthrough
+	case isNL(r) || isWhitespace(r):
+		return lexBlockEnd
+	case r == optValTerm || r == topOptValTerm:
+		lx.ignore()
+		return lexBlockStart
+	case r == topOptTerm:
+		lx.ignore()
+		return lx.pop()
+	}
+	return lx.errorf("Expected a block-level to end with a '}', but got '%v' instead.", r)
+}
+
+// lexKeyStart consumes a key name up until the first non-whitespace character.
+// lexKeyStart will ignore whitespace. It will also eat enclosing quotes.
+func lexKeyStart(lx *Lexer) stateFn {
+	r := lx.peek()
+	switch {
+	case isKeySeparator(r):
+		return lx.errorf("Unexpected key separator '%v'", r)
+	case unicode.IsSpace(r):
+		lx.next()
+		return lexSkip(lx, lexKeyStart)
+	case r == dqStringStart:
+		lx.next()
+		return lexSkip(lx, lexDubQuotedKey)
+	case r == sqStringStart:
+		lx.next()
+		return lexSkip(lx, lexQuotedKey)
+	case r == spreadStart && lx.isSpread():
+		return lexSpread
+	}
+	lx.ignore()
+	lx.next()
+	return lexKey
+}
+
+// lexDubQuotedKey consumes the text of a key between quotes.
+func lexDubQuotedKey(lx *Lexer) stateFn {
+	r := lx.peek()
+	if r == dqStringEnd {
+		lx.emit(Key)
+		lx.next()
+		return lexSkip(lx, lexKeyEnd)
+	} else if r == eof {
+		if lx.pos > lx.start {
+			return lx.errorf("Unexpected EOF.")
+		}
+		lx.emit(EOF)
+		return nil
+	}
+	lx.next()
+	return lexDubQuotedKey
+}
+
+// lexQuotedKey consumes the text of a key between quotes.
+func lexQuotedKey(lx *Lexer) stateFn {
+	r := lx.peek()
+	if r == sqStringEnd {
+		lx.emit(Key)
+		lx.next()
+		return lexSkip(lx, lexKeyEnd)
+	} else if r == eof {
+		if lx.pos > lx.start {
+			return lx.errorf("Unexpected EOF.")
+		}
+		lx.emit(EOF)
+		return nil
+	}
+	lx.next()
+	return lexQuotedKey
+}
+
+// keyCheckKeyword will check for reserved keywords as the key value when the key is
+// separated with a space.
+func (lx *Lexer) keyCheckKeyword(fallThrough, push stateFn) stateFn {
+	key := strings.ToLower(lx.input[lx.start:lx.pos])
+	switch key {
+	case "include", "include?":
+		lx.includeType = Include
+		if key == "include?" {
+			lx.includeType = OptionalInclude
+		}
+		lx.ignore()
+		if push != nil {
+			lx.push(push)
+		}
+		return lexIncludeStart
+	}
+	if lx.isDirectiveKey() {
+		lx.directive = lx.input[lx.start:lx.pos]
+		lx.includeType = Directive
+		lx.ignore()
+		if push != nil {
+			lx.push(push)
+		}
+		return lexIncludeStart
+	}
+	lx.emit(Key)
+	return fallThrough
+}
+
+// isDirectiveKey reports whether the key being lexed is a directive, that
+// is a name isDirective reports true for that is not followed by a key
+// separator or the start of a map.
+func (lx *Lexer) isDirectiveKey() bool {
+	if lx.isDirective == nil || !lx.isDirective(lx.input[lx.start:lx.pos]) {
+		return false
+	}
+	rest := strings.TrimLeft(lx.input[lx.pos:], " \t")
+	return rest != "" && !isKeySeparator(rune(rest[0])) && rest[0] != mapStart && !isNL(rune(rest[0]))
+}
+
+// directiveKeyword returns the length of the name of the directive at the
+// current position of a value, followed by whitespace and its argument,
+// or 0 if there is none.
+func (lx *Lexer) directiveKeyword() int {
+	if lx.isDirective == nil {
+		return 0
+	}
+	rest := lx.input[lx.pos:]
+	n := strings.IndexFunc(rest, func(r rune) bool {
+		return !(r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r))
+	})
+	if n <= 0 || !isWhitespace(rune(rest[n])) || !lx.isDirective(rest[:n]) {
+		return 0
+	}
+	arg := strings.TrimLeft(rest[n:], " \t")
+	if arg == "" || isNL(rune(arg[0])) || arg[0] == commentHashStart {
+		return 0
+	}
+	return n
+}
+
+// emitInclude emits the file of an include, or the name and argument of a
+// directive.
+func (lx *Lexer) emitInclude() {
+	if lx.includeType != Directive {
+		lx.emit(lx.includeType)
+		return
+	}
+	pos := lx.column(lx.ilstart, lx.start)
+	lx.items <- Item{Directive, lx.directive + " " + lx.input[lx.start:lx.pos], lx.line, pos}
+	lx.start = lx.pos
+	lx.ilstart = lx.lstart
+}
+
+// isSpread reports whether the input at the current position is a map
+// spread such as $defaults..., which stands in place of a key and copies
+// the keys of the map it references.
+func (lx *Lexer) isSpread() bool {
+	return lx.spreadLen() > 0
+}
+
+// spreadLen returns the length of the map spread at the current position,
+// or 0 if there is none.
+func (lx *Lexer) spreadLen() int {
+	rest := lx.input[lx.pos:]
+	end := strings.IndexFunc(rest, func(r rune) bool {
+		return unicode.IsSpace(r) || r == optValTerm || r == mapValTerm || r == mapEnd ||
+			r == commentHashStart || isKeySeparator(r)
+	})
+	if end < 0 {
+		end = len(rest)
+	}
+	if end <= len(spreadEnd)+1 || !strings.HasSuffix(rest[:end], spreadEnd) {
+		return 0
+	}
+	return end
+}
+
+// lexSpread consumes a map spread and emits the name of the referenced
+// variable, without the leading '$' and trailing "...".
+func lexSpread(lx *Lexer) stateFn {
+	end := lx.pos + lx.spreadLen()
+	lx.next()
+	lx.ignore()
+	lx.pos = end - len(spreadEnd)
+	lx.emit(Spread)
+	lx.pos = end
+	lx.ignore()
+	return lx.pop()
+}
+
+// lexIncludeStart will consume the whitespace til the start of the value.
+func lexIncludeStart(lx *Lexer) stateFn {
+	r := lx.next()
+	if isWhitespace(r) {
+		return lexSkip(lx, lexIncludeStart)
+	}
+	lx.backup()
+	return lexInclude
+}
+
+// lexIncludeQuotedString consumes the inner contents of a string. It assumes that the
+// beginning '"' has already been consumed and ignored. It will not interpret any
+// internal contents.
+func lexIncludeQuotedString(lx *Lexer) stateFn {
+	r := lx.next()
+	switch {
+	case r == sqStringEnd:
+		lx.backup()
+		lx.emitInclude()
+		lx.next()
+		lx.ignore()
+		return lx.pop()
+	case r == eof:
+		return lx.errorf("Unexpected EOF in quoted include")
+	}
+	return lexIncludeQuotedString
+}
+
+// lexIncludeDubQuotedString consumes the inner contents of a string. It assumes that the
+// beginning '"' has already been consumed and ignored. It will not interpret any
+// internal contents.
+func lexIncludeDubQuotedString(lx *Lexer) stateFn {
+	r := lx.next()
+	switch {
+	case r == dqStringEnd:
+		lx.backup()
+		lx.emitInclude()
+		lx.next()
+		lx.ignore()
+		return lx.pop()
+	case r == eof:
+		return lx.errorf("Unexpected EOF in double quoted include")
+	}
+	return lexIncludeDubQuotedString
+}
+
+// lexIncludeString consumes the inner contents of a raw string. Raw
+// directive arguments also end at the end of an array value.
+func lexIncludeString(lx *Lexer) stateFn {
+	r := lx.next()
+	switch {
+	case isNL(r) || r == eof || r == optValTerm || r == mapEnd || isWhitespace(r),
+		lx.includeType == Directive && (r == arrayEnd || r == arrayValTerm):
+		lx.backup()
+		lx.emitInclude()
+		return lx.pop()
+	case r == sqStringEnd:
+		lx.backup()
+		lx.emitInclude()
+		lx.next()
+		lx.ignore()
+		return lx.pop()
+	}
+	return lexIncludeString
+}
+
+// lexInclude will consume the include value.
+func lexInclude(lx *Lexer) stateFn {
+	r := lx.next()
+	switch {
+	case r == sqStringStart:
+		lx.ignore() // ignore the " or '
+		return lexIncludeQuotedString
+	case r == dqStringStart:
+		lx.ignore() // ignore the " or '
+		return lexIncludeDubQuotedString
+	case r == arrayStart:
+		return lx.errorf("Expected include value but found start of an array")
+	case r == mapStart:
+		return lx.errorf("Expected include value but found start of a map")
+	case r == blockStart:
+		return lx.errorf("Expected include value but found start of a block")
+	case unicode.IsDigit(r), r == '-':
+		return lx.errorf("Expected include value but found start of a number")
+	case r == '\\':
+		return lx.errorf("Expected include value but found escape sequence")
+	case isNL(r):
+		return lx.errorf("Expected include value but found new line")
+	}
+	lx.backup()
+	return lexIncludeString
+}
+
+// lexKey consumes the text of a key. Assumes that the first character (which
+// is not whitespace) has already been consumed.
+func lexKey(lx *Lexer) stateFn {
+	r := lx.peek()
+	if unicode.IsSpace(r) {
+		// Spaces signal we could be looking at a keyword, e.g. include.
+		// Keywords will eat the keyword and set the appropriate return stateFn.
+		return lx.keyCheckKeyword(lexKeyEnd, nil)
+	} else if isKeySeparator(r) || r == eof {
+		lx.emit(Key)
+		return lexKeyEnd
+	}
+	lx.next()
+	return lexKey
+}
+
+// lexKeyEnd consumes the end of a key (up to the key separator).
+// Assumes that the first whitespace character after a key (or the '=' or ':'
+// separator) has NOT been consumed.
+func lexKeyEnd(lx *Lexer) stateFn {
+	r := lx.next()
+	switch {
+	case unicode.IsSpace(r):
+		return lexSkip(lx, lexKeyEnd)
+	case isKeySeparator(r):
+		return lexSkip(lx, lexValue)
+	case r == eof:
+		lx.emit(EOF)
+		return nil
+	}
+	// We start the value here
+	lx.backup()
+	return lexValue
+}
+
+// lexValue starts the consumption of a value anywhere a value is expected.
+// lexValue will ignore whitespace.
+// After a value is lexed, the last state on the next is popped and returned.
+func lexValue(lx *Lexer) stateFn {
+	// We allow whitespace to precede a value, but NOT new lines.
+	// In array syntax, the array states are responsible for ignoring new lines.
+	r := lx.next()
+	if isWhitespace(r) {
+		return lexSkip(lx, lexValue)
+	}
+
+	switch {
+	case r == arrayStart:
+		lx.ignore()
+		lx.emit(ArrayStart)
+		return lexArrayValue
+	case r == mapStart:
+		lx.ignore()
+		lx.emit(MapStart)
+		return lexMapKeyStart
+	case r == sqStringStart:
+		lx.ignore() // ignore the " or '
+		return lexQuotedString
+	case r == dqStringStart:
+		lx.ignore() // ignore the " or '
+		lx.stringStateFn = lexDubQuotedString
+		return lexDubQuotedString
+	case lx.isTokenLiteral():
+		// Encoded tokens such as nkeys and JWTs are strings, even
+		// when they start like a number.
+		lx.stringStateFn = lexString
+		return lexString
+	case r == '-':
+		return lexNegNumberStart
+	case r == '+' && lx.isNumberStart():
+		return lexNegNumberStart
+	case r == blockStart:
+		lx.ignore()
+		return lexBlock
+	case unicode.IsDigit(r):
+		lx.backup() // avoid an extra state and use the same as above
+		return lexNumberOrDateOrStringOrIPStart
+	case r == '.' && lx.isDigitNext():
+		return lexFloatStart
+	case r == '.': // special error case, be kind to users
+		return lx.errorf("Floats must start with a digit")
+	case isNL(r):
+		return lx.errorf("Expected value but found new line")
+	}
+	lx.backup()
+	if typ, n := lx.includeKeyword(); n > 0 {
+		// An include as a value mounts the file under the key.
+		lx.includeType = typ
+		lx.pos += n
+		lx.ignore()
+		return lexIncludeStart
+	}
+	if n := lx.directiveKeyword(); n > 0 {
+		lx.directive = lx.input[lx.pos : lx.pos+n]
+		lx.includeType = Directive
+		lx.pos += n
+		lx.ignore()
+		return lexIncludeStart
+	}
+	if lx.isCall() {
+		return lexCall
+	}
+	lx.stringStateFn = lexString
+	return lexString
+}
+
+// isCall reports whether the input at the current position is the name of
+// a known function followed by '('.
+func (lx *Lexer) isCall() bool {
+	if lx.isFunc == nil {
+		return false
+	}
+	// Only the name is scanned, so values without a call do not cost a
+	// search through the rest of the input.
+	rest := lx.input[lx.pos:]
+	i := 0
+	for j, r := range rest {
+		if !(r == '_' || unicode.IsLetter(r) || j > 0 && unicode.IsDigit(r)) {
+			break
+		}
+		i = j + utf8.RuneLen(r)
+	}
+	if i == 0 || i == len(rest) || rest[i] != '(' {
+		return false
+	}
+	return lx.isFunc(rest[:i])
+}
+
+// lexCall consumes a function call up to its closing ')', skipping over
+// quoted arguments, and emits it whole as an Call.
+func lexCall(lx *Lexer) stateFn {
+	depth := 0
+	var quote rune
+	for {
+		r := lx.next()
+		switch {
+		case r == eof || isNL(r):
+			return lx.errorf("Unterminated function call")
+		case quote != 0:
+			if r == '\\' && quote == dqStringEnd {
+				lx.next()
+			} else if r == quote {
+				quote = 0
+			}
+		case r == sqStringStart || r == dqStringStart:
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+			if depth == 0 {
+				lx.emit(Call)
+				return lx.pop()
+			}
+		}
+	}
+}
+
+// includeKeyword reports whether the input at the current position is the
+// include keyword followed by whitespace, returning the include item type
+// and the length of the keyword.
+func (lx *Lexer) includeKeyword() (ItemType, int) {
+	rest := lx.input[lx.pos:]
+	for _, kw := range []struct {
+		word string
+		typ  ItemType
+	}{{"include?", OptionalInclude}, {"include", Include}} {
+		if len(rest) > len(kw.word) && strings.EqualFold(rest[:len(kw.word)], kw.word) &&
+			isWhitespace(rune(rest[len(kw.word)])) {
+			return kw.typ, len(kw.word)
+		}
+	}
+	return 0, 0
+}
+
+// lexArrayValue consumes one value in an array. It assumes that '[' or ','
+// have already been consumed. All whitespace and new lines are ignored.
+func lexArrayValue(lx *Lexer) stateFn {
+	r := lx.next()
+	switch {
+	case unicode.IsSpace(r):
+		return lexSkip(lx, lexArrayValue)
+	case r == commentHashStart:
+		lx.push(lexArrayValue)
+		return lexCommentStart
+	case r == commentSlashStart:
+		rn := lx.next()
+		if rn == commentSlashStart {
+			lx.push(lexArrayValue)
+			return lexCommentStart
+		}
+		lx.backup()
+		fallthrough
+	case r == arrayValTerm:
+		return lx.errorf("Unexpected array value terminator '%v'.", arrayValTerm)
+	case r == arrayEnd:
+		return lexArrayEnd
+	}
+
+	lx.backup()
+	lx.push(lexArrayValueEnd)
+	return lexValue
+}
+
+// lexArrayValueEnd consumes the cruft between values of an array. Namely,
+// it ignores whitespace and expects either a ',' or a ']'.
+func lexArrayValueEnd(lx *Lexer) stateFn {
+	r := lx.next()
+	switch {
+	case isWhitespace(r):
+		return lexSkip(lx, lexArrayValueEnd)
+	case r == commentHashStart:
+		lx.push(lexArrayValueEnd)
+		return lexCommentStart
+	case r == commentSlashStart:
+		rn := lx.next()
+		if rn == commentSlashStart {
+			lx.push(lexArrayValueEnd)
+			return lexCommentStart
+		}
+		lx.backup()
+		fallthrough
+	case r == arrayValTerm || isNL(r):
+		return lexSkip(lx, lexArrayValue) // Move onto next
+	case r == arrayEnd:
+		return lexArrayEnd
+	}
+	return lx.errorf("Expected an array value terminator %q or an array "+
+		"terminator %q, but got '%v' instead.", arrayValTerm, arrayEnd, r)
+}
+
+// lexArrayEnd finishes the lexing of an array. It assumes that a ']' has
+// just been consumed.
+func lexArrayEnd(lx *Lexer) stateFn {
+	lx.ignore()
+	lx.emit(ArrayEnd)
+	return lx.pop()
+}
+
+// lexMapKeyStart consumes a key name up until the first non-whitespace
+// character.
+// lexMapKeyStart will ignore whitespace.
+func lexMapKeyStart(lx *Lexer) stateFn {
+	r := lx.peek()
+	switch {
+	case isKeySeparator(r):
+		return lx.errorf("Unexpected key separator '%v'.", r)
+	case r == arrayEnd:
+		return lx.errorf("Unexpected array end '%v' processing map.", r)
+	case unicode.IsSpace(r):
+		lx.next()
+		return lexSkip(lx, lexMapKeyStart)
+	case r == mapEnd:
+		lx.next()
+		return lexSkip(lx, lexMapEnd)
+	case r == commentHashStart:
+		lx.next()
+		lx.push(lexMapKeyStart)
+		return lexCommentStart
+	case r == commentSlashStart:
+		lx.next()
+		rn := lx.next()
+		if rn == commentSlashStart {
+			lx.push(lexMapKeyStart)
+			return lexCommentStart
+		}
+		lx.backup()
+	case r == sqStringStart:
+		lx.next()
+		return lexSkip(lx, lexMapQuotedKey)
+	case r == dqStringStart:
+		lx.next()
+		return lexSkip(lx, lexMapDubQuotedKey)
+	case r == spreadStart && lx.isSpread():
+		lx.push(lexMapValueEnd)
+		return lexSpread
+	case r == eof:
+		return lx.errorf("Unexpected EOF processing map.")
+	}
+	lx.ignore()
+	lx.next()
+	return lexMapKey
+}
+
+// lexMapQuotedKey consumes the text of a key between quotes.
+func lexMapQuotedKey(lx *Lexer) stateFn {
+	if r := lx.peek(); r == eof {
+		return lx.errorf("Unexpected EOF processing quoted map key.")
+	} else if r == sqStringEnd {
+		lx.emit(Key)
+		lx.next()
+		return lexSkip(lx, lexMapKeyEnd)
+	}
+	lx.next()
+	return lexMapQuotedKey
+}
+
+// lexMapDubQuotedKey consumes the text of a key between quotes.
+func lexMapDubQuotedKey(lx *Lexer) stateFn {
+	if r := lx.peek(); r == eof {
+		return lx.errorf("Unexpected EOF processing double quoted map key.")
+	} else if r == dqStringEnd {
+		lx.emit(Key)
+		lx.next()
+		return lexSkip(lx, lexMapKeyEnd)
+	}
+	lx.next()
+	return lexMapDubQuotedKey
+}
+
+// lexMapKey consumes the text of a key. Assumes that the first character (which
+// is not whitespace) has already been consumed.
+func lexMapKey(lx *Lexer) stateFn {
+	if r := lx.peek(); r == eof {
+		return lx.errorf("Unexpected EOF processing map key.")
+	} else if unicode.IsSpace(r) {
+		// Spaces signal we could be looking at a keyword, e.g. include.
+		// Keywords will eat the keyword and set the appropriate return stateFn.
+		return lx.keyCheckKeyword(lexMapKeyEnd, lexMapValueEnd)
+	} else if isKeySeparator(r) {
+		lx.emit(Key)
+		return lexMapKeyEnd
+	}
+	lx.next()
+	return lexMapKey
+}
+
+// lexMapKeyEnd consumes the end of a key (up to the key separator).
+// Assumes that the first whitespace character after a key (or the '='
+// separator) has NOT been consumed.
+func lexMapKeyEnd(lx *Lexer) stateFn {
+	r := lx.next()
+	switch {
+	case unicode.IsSpace(r):
+		return lexSkip(lx, lexMapKeyEnd)
+	case isKeySeparator(r):
+		return lexSkip(lx, lexMapValue)
+	}
+	// We start the value here
+	lx.backup()
+	return lexMapValue
+}
+
+// lexMapValue consumes one value in a map. It assumes that '{' or ','
+// have already been consumed. All whitespace and new lines are ignored.
+// Map values can be separated by ',' or simple NLs.
+func lexMapValue(lx *Lexer) stateFn {
+	r := lx.next()
+	switch {
+	case unicode.IsSpace(r):
+		return lexSkip(lx, lexMapValue)
+	case r == mapValTerm:
+		return lx.errorf("Unexpected map value terminator %q.", mapValTerm)
+	case r == mapEnd:
+		return lexSkip(lx, lexMapEnd)
+	}
+	lx.backup()
+	lx.push(lexMapValueEnd)
+	return lexValue
+}
+
+// lexMapValueEnd consumes the cruft between values of a map. Namely,
+// it ignores whitespace and expects either a ',' or a '}'.
+func lexMapValueEnd(lx *Lexer) stateFn {
+	r := lx.next()
+	switch {
+	case isWhitespace(r):
+		return lexSkip(lx, lexMapValueEnd)
+	case r == commentHashStart:
+		lx.push(lexMapValueEnd)
+		return lexCommentStart
+	case r == commentSlashStart:
+		rn := lx.next()
+		if rn == commentSlashStart {
+			lx.push(lexMapValueEnd)
+			return lexCommentStart
+		}
+		lx.backup()
+		fallthrough
+	case r == optValTerm || r == mapValTerm || isNL(r):
+		return lexSkip(lx, lexMapKeyStart) // Move onto next
+	case r == mapEnd:
+		return lexSkip(lx, lexMapEnd)
+	}
+	return lx.errorf("Expected a map value terminator %q or a map "+
+		"terminator %q, but got '%v' instead.", mapValTerm, mapEnd, r)
+}
+
+// lexMapEnd finishes the lexing of a map. It assumes that a '}' has
+// just been consumed.
+func lexMapEnd(lx *Lexer) stateFn {
+	lx.ignore()
+	lx.emit(MapEnd)
+	return lx.pop()
+}
+
+// Checks if the unquoted string was actually a boolean
+func (lx *Lexer) isBool() bool {
+	str := strings.ToLower(lx.input[lx.start:lx.pos])
+	return str == "true" || str == "false" ||
+		str == "on" || str == "off" ||
+		str == "yes" || str == "no"
+}
+
+// Check if the unquoted string is a variable reference, starting with $.
+func (lx *Lexer) isVariable() bool {
+	if lx.start >= len(lx.input) {
+		return false
+	}
+	if lx.input[lx.start] == '$' {
+		lx.start += 1
+		return true
+	}
+	return false
+}
+
+// isEscapedVariable checks if the unquoted string starts with $$, which is
+// an escaped '$' rather than a variable reference. The first '$' is dropped.
+func (lx *Lexer) isEscapedVariable() bool {
+	if !strings.HasPrefix(lx.input[lx.start:lx.pos], "$$") {
+		return false
+	}
+	lx.start += 1
+	return true
+}
+
+// lexQuotedString consumes the inner contents of a string. It assumes that the
+// beginning '"' has already been consumed and ignored. It will not interpret any
+// internal contents.
+func lexQuotedString(lx *Lexer) stateFn {
+	r := lx.next()
+	switch {
+	case r == sqStringEnd:
+		lx.backup()
+		lx.emit(String)
+		lx.next()
+		lx.ignore()
+		return lx.pop()
+	case r == eof:
+		if lx.pos > lx.start {
+			return lx.errorf("Unexpected EOF.")
+		}
+		lx.emit(EOF)
+		return nil
+	}
+	return lexQuotedString
+}
+
+// lexDubQuotedString consumes the inner contents of a string. It assumes that the
+// beginning '"' has already been consumed and ignored. It will not interpret any
+// internal contents.
+func lexDubQuotedString(lx *Lexer) stateFn {
+	r := lx.next()
+	switch {
+	case r == '\\':
+		lx.addCurrentStringPart(1)
+		return lexStringEscape
+	case r == dqStringEnd:
+		lx.backup()
+		lx.emitString()
+		lx.next()
+		lx.ignore()
+		return lx.pop()
+	case r == eof:
+		if lx.pos > lx.start {
+			return lx.errorf("Unexpected EOF.")
+		}
+		lx.emit(EOF)
+		return nil
+	}
+	return lexDubQuotedString
+}
+
+// lexString consumes the inner contents of a raw string.
+func lexString(lx *Lexer) stateFn {
+	r := lx.next()
+	switch {
+	case r == '\\':
+		lx.addCurrentStringPart(1)
+		return lexStringEscape
+	// Termination of non-quoted strings
+	case isNL(r) || r == eof || r == optValTerm ||
+		r == arrayValTerm || r == arrayEnd || r == mapEnd ||
+		isWhitespace(r):
+
+		lx.backup()
+		if lx.hasEscapedParts() {
+			lx.emitString()
+		} else if lx.isBool() {
+			lx.emit(Bool)
+		} else if lx.isEscapedVariable() {
+			lx.emitString()
+		} else if lx.isVariable() {
+			lx.emit(Variable)
+		} else {
+			lx.emitString()
+		}
+		return lx.pop()
+	case r == sqStringEnd:
+		lx.backup()
+		lx.emitString()
+		lx.next()
+		lx.ignore()
+		return lx.pop()
+	case r == dqStringStart && !lx.hasEscapedParts() && isBytesPrefix(lx.input[lx.start:lx.pos-1]):
+		return lexBytes
+	}
+	return lexString
+}
+
+// lexBytes consumes the quoted part of a bytes literal such as base64"aGk="
+// or hex"6869". It assumes the prefix and opening '"' have been consumed,
+// and emits the literal without the closing quote for the parser to decode.
+func lexBytes(lx *Lexer) stateFn {
+	r := lx.next()
+	switch {
+	case r == dqStringEnd:
+		lx.backup()
+		lx.emit(Bytes)
+		lx.next()
+		lx.ignore()
+		return lx.pop()
+	case isNL(r) || r == eof:
+		return lx.errorf("Unexpected end of bytes literal")
+	}
+	return lexBytes
+}
+
+// lexBlock consumes the inner contents as a string. It assumes that the
+// beginning '(' has already been consumed and ignored. It will continue
+// processing until it finds a ')' on a new line by itself.
+func lexBlock(lx *Lexer) stateFn {
+	r := lx.next()
+	switch {
+	case r == blockEnd:
+		lx.backup()
+		lx.backup()
+
+		// Looking for a ')' character on a line by itself, if the previous
+		// character isn't a new line, then break so we keep processing the block.
+		if lx.next() != '\n' {
+			lx.next()
+			break
+		}
+		lx.next()
+
+		// Make sure the next character is a new line or an eof. We want a ')' on a
+		// bare line by itself.
+		switch lx.next() {
+		case '\n', eof:
+			lx.backup()
+			lx.backup()
+			lx.emit(String)
+			lx.next()
+			lx.ignore()
+			return lx.pop()
+		}
+		lx.backup()
+	case r == eof:
+		return lx.errorf("Unexpected EOF processing block.")
+	}
+	return lexBlock
+}
+
+// lexStringEscape consumes an escaped character. It assumes that the preceding
+// '\\' has already been consumed. Single quoted strings do not process
+// escapes, so they can be used for values with literal backslashes.
+func lexStringEscape(lx *Lexer) stateFn {
+	r := lx.next()
+	switch r {
+	case 'x':
+		return lexStringBinary
+	case 'u':
+		return lexStringUnicode(lx, 4)
+	case 'U':
+		return lexStringUnicode(lx, 8)
+	case 't':
+		return lx.addStringPart("\t")
+	case 'n':
+		return lx.addStringPart("\n")
+	case 'r':
+		return lx.addStringPart("\r")
+	case 'b':
+		return lx.addStringPart("\b")
+	case 'f':
+		return lx.addStringPart("\f")
+	case '/':
+		return lx.addStringPart("/")
+	case '"':
+		return lx.addStringPart("\"")
+	case '\\':
+		return lx.addStringPart("\\")
+	case '$':
+		return lx.addStringPart("$")
+	}
+	return lx.errorf("Invalid escape character '%v'. Only the following "+
+		"escape characters are allowed: \\xXX, \\uXXXX, \\UXXXXXXXX, "+
+		"\\t, \\n, \\r, \\b, \\f, \\/, \\\", \\\\, \\$.", r)
+}
+
+// lexStringUnicode consumes the hexadecimal digits of a '\\u' or '\\U'
+// escape. A '\\u' escape of a high surrogate must be followed by one of a
+// low surrogate, as in JSON.
+func lexStringUnicode(lx *Lexer, digits int) stateFn {
+	r, ok := lx.hexRune(digits)
+	if !ok {
+		return lx.errorf("Expected %d hexadecimal digits in unicode escape", digits)
+	}
+	if utf16.IsSurrogate(r) {
+		if digits != 4 || r >= 0xdc00 || lx.next() != '\\' || lx.next() != 'u' {
+			return lx.errorf("Invalid unicode escape, unpaired surrogate '\\u%04X'", int64(r))
+		}
+		low, ok := lx.hexRune(4)
+		if r = utf16.DecodeRune(r, low); !ok || r == utf8.RuneError {
+			return lx.errorf("Invalid unicode escape, unpaired surrogate")
+		}
+	}
+	if r < 0 || r > unicode.MaxRune {
+		return lx.errorf("Invalid unicode escape, '%X' is not a valid code point", uint32(r))
+	}
+	lx.addStringPart(string(r))
+	return lx.stringStateFn
+}
+
+// hexRune consumes n hexadecimal digits and returns their value.
+func (lx *Lexer) hexRune(n int) (rune, bool) {
+	var r rune
+	for i := 0; i < n; i++ {
+		c := lx.next()
+		var d rune
+		switch {
+		case c >= '0' && c <= '9':
+			d = c - '0'
+		case c >= 'a' && c <= 'f':
+			d = c - 'a' + 10
+		case c >= 'A' && c <= 'F':
+			d = c - 'A' + 10
+		default:
+			return 0, false
+		}
+		r = r<<4 | d
+	}
+	return r, true
+}
+
+// lexStringBinary consumes two hexadecimal digits following '\x'. It assumes
+// that the '\x' has already been consumed.
+func lexStringBinary(lx *Lexer) stateFn {
+	r := lx.next()
+	if isNL(r) {
+		return lx.errorf("Expected two hexadecimal digits after '\\x', but hit end of line")
+	}
+	r = lx.next()
+	if isNL(r) {
+		return lx.errorf("Expected two hexadecimal digits after '\\x', but hit end of line")
+	}
+	offset := lx.pos - 2
+	byteString, err := hex.DecodeString(lx.input[offset:lx.pos])
+	if err != nil {
+		return lx.errorf("Expected two hexadecimal digits after '\\x', but got '%s'", lx.input[offset:lx.pos])
+	}
+	lx.addStringPart(string(byteString))
+	return lx.stringStateFn
+}
+
+// lexNumberOrDateOrStringOrIPStart consumes either a (positive)
+// integer, a float, a datetime, or IP, or String that started with a
+// number.  It assumes that NO negative sign has been consumed, that
+// is triggered above.
+func lexNumberOrDateOrStringOrIPStart(lx *Lexer) stateFn {
+	r := lx.next()
+	if !unicode.IsDigit(r) {
+		if r == '.' {
+			return lx.errorf("Floats must start with a digit, not '.'.")
+		}
+		return lx.errorf("Expected a digit but got '%v'.", r)
+	}
+	return lexNumberOrDateOrStringOrIP
+}
+
+// lexNumberOrDateOrStringOrIP consumes either a (positive) integer,
+// float, datetime, IP or string without quotes that starts with a
+// number.
+//
+// Numbers follow this grammar, with suffixes only allowed on integers:
+//
+//	number   = [ "-" | "+" ] ( digits [ "." digits ] | "." digits ) [ exponent ] [ suffix ]
+//	exponent = ( "e" | "E" ) [ "-" | "+" ] digits
+//	suffix   = ( "k" | "m" | "g" | "t" | "p" | "e" ) [ "i" ] [ "b" ]
+func lexNumberOrDateOrStringOrIP(lx *Lexer) stateFn {
+	r := lx.next()
+	switch {
+	case r == '-':
+		if lx.pos-lx.start != 5 {
+			return lx.errorf("All ISO8601 dates must be in full Zulu form.")
+		}
+		return lexDateAfterYear
+	case unicode.IsDigit(r):
+		return lexNumberOrDateOrStringOrIP
+	case r == '.':
+		// Assume float at first, but could be IP
+		return lexFloatStart
+	case (r == 'e' || r == 'E') && lx.isExponent():
+		return lexExponent
+	case isNumberSuffix(r):
+		return lexConvenientNumber
+	case !isNumberEnd(r):
+		// Treat it as a string value once we get a rune that
+		// is not a number.
+		lx.stringStateFn = lexString
+		return lexString
+	}
+	lx.backup()
+	lx.emit(Integer)
+	return lx.pop()
+}
+
+// lexConvenientNumber is when we have a suffix, e.g. 1k or 1Mb
+func lexConvenientNumber(lx *Lexer) stateFn {
+	r := lx.next()
+	if r == 'i' || r == 'I' {
+		r = lx.next()
+	}
+	if r == 'b' || r == 'B' {
+		r = lx.next()
+	}
+	lx.backup()
+	if isNumberEnd(r) {
+		lx.emit(Integer)
+		return lx.pop()
+	}
+	// This is not a number, so treat it as a string.
+	lx.stringStateFn = lexString
+	return lexString
+}
+
+// lexExponent consumes the exponent of a float. It assumes that the 'e'
+// has been consumed and is followed by an optional sign and a digit.
+func lexExponent(lx *Lexer) stateFn {
+	r := lx.next()
+	if r == '-' || r == '+' {
+		r = lx.next()
+	}
+	for unicode.IsDigit(r) {
+		r = lx.next()
+	}
+	lx.backup()
+	if !isNumberEnd(r) {
+		return lx.numberError(r)
+	}
+	lx.emit(Float)
+	return lx.pop()
+}
+
+// numberError reports r as the first character that does not belong to
+// the number being lexed. r must not have been consumed, so the error
+// points at it.
+func (lx *Lexer) numberError(r rune) stateFn {
+	if r == eof {
+		return lx.errorf("Unexpected EOF in number.")
+	}
+	num := lx.input[lx.start:lx.pos]
+	if tok := lx.tokenValue(); strings.ContainsFunc(tok, isTokenLetter) {
+		return lx.errorf("Invalid character '%v' in number '%s', quote '%s' if it is a string.", r, num, tok)
+	}
+	return lx.errorf("Invalid character '%v' in number '%s'.", r, num)
+}
+
+// isExponent reports whether an 'e' just consumed starts the exponent of
+// a float rather than being a suffix, as in 1e3 or 1e-3.
+func (lx *Lexer) isExponent() bool {
+	rest := lx.input[lx.pos:]
+	if rest != "" && (rest[0] == '-' || rest[0] == '+') {
+		rest = rest[1:]
+	}
+	return rest != "" && rest[0] >= '0' && rest[0] <= '9'
+}
+
+// isDigitNext reports whether the next character is a digit.
+func (lx *Lexer) isDigitNext() bool {
+	return lx.pos < len(lx.input) && lx.input[lx.pos] >= '0' && lx.input[lx.pos] <= '9'
+}
+
+// isNumberStart reports whether a sign just consumed starts a number,
+// followed by a digit or by '.' and a digit.
+func (lx *Lexer) isNumberStart() bool {
+	rest := lx.input[lx.pos:]
+	if rest != "" && rest[0] == '.' {
+		rest = rest[1:]
+	}
+	return rest != "" && rest[0] >= '0' && rest[0] <= '9'
+}
+
+// minTokenLiteral is the length from which an unquoted value made of the
+// characters of encoded tokens is taken for a token rather than a number.
+// nkeys are 56 characters long and JWTs longer still.
+const minTokenLiteral = 32
+
+// isTokenLiteral reports whether the unquoted value starting at the
+// current item is an encoded token, such as a base32 nkey or a JWT, rather
+// than a number: at least minTokenLiteral characters of base32, base64url
+// and '.', including a letter, and not a valid float.
+func (lx *Lexer) isTokenLiteral() bool {
+	tok := lx.tokenValue()
+	if len(tok) < minTokenLiteral {
+		return false
+	}
+	if _, err := strconv.ParseFloat(tok, 64); err == nil {
+		return false
+	}
+	return strings.ContainsFunc(tok, isTokenLetter)
+}
+
+// tokenValue returns the unquoted value starting at the current item if
+// it is made of token characters only, or "" otherwise.
+func (lx *Lexer) tokenValue() string {
+	rest := lx.input[lx.start:]
+	n := strings.IndexFunc(rest, func(r rune) bool { return !isTokenChar(r) })
+	if n < 0 {
+		n = len(rest)
+	}
+	if n < len(rest) && !isNumberEnd(rune(rest[n])) {
+		return ""
+	}
+	return rest[:n]
+}
+
+// isTokenChar reports whether r may appear in an encoded token.
+func isTokenChar(r rune) bool {
+	return isTokenLetter(r) || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.' || r == '='
+}
+
+func isTokenLetter(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+}
+
+// isNumberEnd reports whether r ends a number value.
+func isNumberEnd(r rune) bool {
+	return isNL(r) || r == eof || r == mapEnd || r == arrayEnd ||
+		r == optValTerm || r == mapValTerm || isWhitespace(r)
+}
+
+// lexDateAfterYear consumes a full Datetime in ISO8601 format, ending in
+// 'Z', in an offset such as +08:00, or in neither for a local time. It
+// assumes that "YYYY-" has already been consumed.
+func lexDateAfterYear(lx *Lexer) stateFn {
+	formats := []rune{
+		// digits are '0'.
+		// everything else is direct equality.
+		'0', '0', '-', '0', '0',
+		'T',
+		'0', '0', ':', '0', '0', ':', '0', '0',
+	}
+	if err := lx.acceptFormat(formats); err != nil {
+		return err
+	}
+	switch r := lx.next(); {
+	case r == 'Z':
+	case r == '+' || r == '-':
+		if err := lx.acceptFormat([]rune{'0', '0', ':', '0', '0'}); err != nil {
+			return err
+		}
+	case isNumberEnd(r):
+		lx.backup()
+	default:
+		return lx.errorf("Expected 'Z' or an offset in ISO8601 datetime, "+
+			"but found '%v' instead.", r)
+	}
+	lx.emit(Datetime)
+	return lx.pop()
+}
+
+// acceptFormat consumes the runes of a datetime matching formats, where
+// '0' stands for any digit. It returns an error state on a mismatch.
+func (lx *Lexer) acceptFormat(formats []rune) stateFn {
+	for _, f := range formats {
+		r := lx.next()
+		if f == '0' {
+			if !unicode.IsDigit(r) {
+				return lx.errorf("Expected digit in ISO8601 datetime, "+
+					"but found '%v' instead.", r)
+			}
+		} else if f != r {
+			return lx.errorf("Expected '%v' in ISO8601 datetime, "+
+				"but found '%v' instead.", f, r)
+		}
+	}
+	return nil
+}
+
+// lexNegNumberStart consumes either an integer or a float. It assumes that a
+// negative sign has already been read, but that *no* digits have been consumed.
+// lexNegNumberStart will move to the appropriate integer or float states.
+func lexNegNumberStart(lx *Lexer) stateFn {
+	// we MUST see a digit, or a '.' followed by one.
+	r := lx.next()
+	if !unicode.IsDigit(r) {
+		if r == '.' && lx.isDigitNext() {
+			return lexFloatStart
+		}
+		if r == '.' {
+			return lx.errorf("Floats must have a digit after the '.'.")
+		}
+		return lx.errorf("Expected a digit but got '%v'.", r)
+	}
+	return lexNegNumber
+}
+
+// lexNegNumber consumes a negative integer or a float after seeing the first digit.
+func lexNegNumber(lx *Lexer) stateFn {
+	r := lx.next()
+	switch {
+	case unicode.IsDigit(r):
+		return lexNegNumber
+	case r == '.':
+		return lexFloatStart
+	case (r == 'e' || r == 'E') && lx.isExponent():
+		return lexExponent
+	case isNumberSuffix(r):
+		return lexConvenientNumber
+	}
+	lx.backup()
+	if !isNumberEnd(r) {
+		return lx.numberError(r)
+	}
+	lx.emit(Integer)
+	return lx.pop()
+}
+
+// lexFloatStart starts the consumption of digits of a float after a '.'.
+// Namely, at least one digit is required.
+func lexFloatStart(lx *Lexer) stateFn {
+	r := lx.next()
+	if !unicode.IsDigit(r) {
+		return lx.errorf("Floats must have a digit after the '.', but got "+
+			"'%v' instead.", r)
+	}
+	return lexFloat
+}
+
+// lexFloat consumes the digits of a float after a '.'.
+// Assumes that one digit has been consumed after a '.' already.
+func lexFloat(lx *Lexer) stateFn {
+	r := lx.next()
+	if unicode.IsDigit(r) {
+		return lexFloat
+	}
+
+	// Not a digit, if its another '.', need to see if we falsely assumed a float.
+	if r == '.' {
+		return lexIPAddr
+	}
+	if (r == 'e' || r == 'E') && lx.isExponent() {
+		return lexExponent
+	}
+
+	lx.backup()
+	if !isNumberEnd(r) {
+		return lx.numberError(r)
+	}
+	lx.emit(Float)
+	return lx.pop()
+}
+
+// lexIPAddr consumes IP addrs, like 127.0.0.1:4222
+func lexIPAddr(lx *Lexer) stateFn {
+	r := lx.next()
+	if unicode.IsDigit(r) || r == '.' || r == ':' || r == '-' {
+		return lexIPAddr
+	}
+	lx.backup()
+	lx.emit(String)
+	return lx.pop()
+}
+
+// lexCommentStart begins the lexing of a comment. It will emit
+// CommentStart and consume no characters, passing control to lexComment.
+func lexCommentStart(lx *Lexer) stateFn {
+	lx.ignore()
+	lx.emit(CommentStart)
+	return lexComment
+}
+
+// lexComment lexes an entire comment. It assumes that '#' has been consumed.
+// It will consume *up to* the first new line character, and pass control
+// back to the last state on the stack.
+func lexComment(lx *Lexer) stateFn {
+	r := lx.peek()
+	if isNL(r) || r == eof {
+		lx.emit(Text)
+		return lx.pop()
+	}
+	lx.next()
+	return lexComment
+}
+
+// lexSkip ignores all slurped input and moves on to the next state.
+func lexSkip(lx *Lexer, nextState stateFn) stateFn {
+	return func(lx *Lexer) stateFn {
+		lx.ignore()
+		return nextState
+	}
+}
+
+// isBytesPrefix reports whether s introduces a bytes literal.
+func isBytesPrefix(s string) bool {
+	return s == "base64" || s == "hex"
+}
+
+// Tests to see if we have a number suffix
+func isNumberSuffix(r rune) bool {
+	return r == 'k' || r == 'K' || r == 'm' || r == 'M' || r == 'g' || r == 'G' || r == 't' || r == 'T' || r == 'p' || r == 'P' || r == 'e' || r == 'E'
+}
+
+// Tests for both key separators
+func isKeySeparator(r rune) bool {
+	return r == keySepEqual || r == keySepColon
+}
+
+// isWhitespace returns true if `r` is a whitespace character according
+// to the spec.
+func isWhitespace(r rune) bool {
+	return r == '\t' || r == ' '
+}
+
+func isNL(r rune) bool {
+	return r == '\n' || r == '\r'
+}
+
+func (itype ItemType) String() string {
+	switch itype {
+	case Error:
+		return "Error"
+	case NIL:
+		return "NIL"
+	case EOF:
+		return "EOF"
+	case Text:
+		return "Text"
+	case String:
+		return "String"
+	case Bool:
+		return "Bool"
+	case Integer:
+		return "Integer"
+	case Float:
+		return "Float"
+	case Datetime:
+		return "DateTime"
+	case Key:
+		return "Key"
+	case ArrayStart:
+		return "ArrayStart"
+	case ArrayEnd:
+		return "ArrayEnd"
+	case MapStart:
+		return "MapStart"
+	case MapEnd:
+		return "MapEnd"
+	case CommentStart:
+		return "CommentStart"
+	case Variable:
+		return "Variable"
+	case Include:
+		return "Include"
+	case OptionalInclude:
+		return "OptionalInclude"
+	case Call:
+		return "Call"
+	case Spread:
+		return "Spread"
+	case Schema:
+		return "Schema"
+	case Directive:
+		return "Directive"
+	case Bytes:
+		return "Bytes"
+	}
+	return fmt.Sprintf("ItemType(%d)", int(itype))
+}
+
+func (item Item) String() string {
+	return fmt.Sprintf("(%s, '%s', %d, %d)", item.Type.String(), item.Val, item.Line, item.Pos)
+}
+
+func escapeSpecial(c rune) string {
+	switch c {
+	case '\n':
+		return "\\n"
+	}
+	return string(c)
+}
@@ -0,0 +1,2043 @@
+package lexer
+
+import (
+	"strings"
+	"testing"
+)
+
+// Test to make sure we get what we expect.
+func expect(t *testing.T, lx *Lexer, items []Item) {
+	t.Helper()
+	for i := 0; i < len(items); i++ {
+		item := lx.Next()
+		_ = item.String()
+		if item.Type == EOF {
+			break
+		}
+		if item != items[i] {
+			t.Fatalf("Testing: '%s'\nExpected %q, received %q\n",
+				lx.input, items[i], item)
+		}
+		if item.Type == Error {
+			break
+		}
+	}
+}
+
+func TestPlainValue(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{EOF, "", 1, 0},
+	}
+	lx := New("foo")
+	expect(t, lx, expectedItems)
+}
+
+func TestSimpleKeyStringValues(t *testing.T) {
+	// Double quotes
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{String, "bar", 1, 7},
+		{EOF, "", 1, 0},
+	}
+	lx := New("foo = \"bar\"")
+	expect(t, lx, expectedItems)
+
+	// Single quotes
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{String, "bar", 1, 7},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo = 'bar'")
+	expect(t, lx, expectedItems)
+
+	// No spaces
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{String, "bar", 1, 5},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo='bar'")
+	expect(t, lx, expectedItems)
+
+	// NL
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{String, "bar", 1, 5},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo='bar'\r\n")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{String, "bar", 1, 6},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo=\t'bar'\t")
+	expect(t, lx, expectedItems)
+}
+
+func TestComplexStringValues(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{String, "bar\\r\\n  \\t", 1, 7},
+		{EOF, "", 2, 0},
+	}
+
+	lx := New("foo = 'bar\\r\\n  \\t'")
+	expect(t, lx, expectedItems)
+}
+
+func TestStringStartingWithNumber(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{String, "3xyz", 1, 6},
+		{EOF, "", 2, 0},
+	}
+
+	lx := New(`foo = 3xyz`)
+	expect(t, lx, expectedItems)
+
+	lx = New(`foo = 3xyz,`)
+	expect(t, lx, expectedItems)
+
+	lx = New(`foo = 3xyz;`)
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 2, 9},
+		{String, "3xyz", 2, 15},
+		{EOF, "", 2, 0},
+	}
+	content := `
+        foo = 3xyz
+        `
+	lx = New(content)
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "map", 2, 9},
+		{MapStart, "", 2, 14},
+		{Key, "foo", 3, 11},
+		{String, "3xyz", 3, 17},
+		{MapEnd, "", 3, 22},
+		{EOF, "", 2, 0},
+	}
+	content = `
+        map {
+          foo = 3xyz}
+        `
+	lx = New(content)
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "map", 2, 9},
+		{MapStart, "", 2, 14},
+		{Key, "foo", 3, 11},
+		{String, "3xyz", 3, 17},
+		{MapEnd, "", 4, 10},
+		{EOF, "", 2, 0},
+	}
+	content = `
+        map {
+          foo = 3xyz;
+        }
+        `
+	lx = New(content)
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "map", 2, 9},
+		{MapStart, "", 2, 14},
+		{Key, "foo", 3, 11},
+		{String, "3xyz", 3, 17},
+		{Key, "bar", 4, 11},
+		{String, "4wqs", 4, 17},
+		{MapEnd, "", 5, 10},
+		{EOF, "", 2, 0},
+	}
+	content = `
+        map {
+          foo = 3xyz,
+          bar = 4wqs
+        }
+        `
+	lx = New(content)
+	expect(t, lx, expectedItems)
+}
+
+func TestBinaryString(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{String, "e", 1, 9},
+		{EOF, "", 1, 0},
+	}
+	lx := New("foo = \\x65")
+	expect(t, lx, expectedItems)
+}
+
+func TestBinaryStringLatin1(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{String, "\xe9", 1, 9},
+		{EOF, "", 1, 0},
+	}
+	lx := New("foo = \\xe9")
+	expect(t, lx, expectedItems)
+}
+
+func TestSimpleKeyIntegerValues(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{Integer, "123", 1, 6},
+		{EOF, "", 1, 0},
+	}
+	lx := New("foo = 123")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{Integer, "123", 1, 4},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo=123")
+	expect(t, lx, expectedItems)
+	lx = New("foo=123\r\n")
+	expect(t, lx, expectedItems)
+}
+
+func TestSimpleKeyNegativeIntegerValues(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{Integer, "-123", 1, 6},
+		{EOF, "", 1, 0},
+	}
+	lx := New("foo = -123")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{Integer, "-123", 1, 4},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo=-123")
+	expect(t, lx, expectedItems)
+	lx = New("foo=-123\r\n")
+	expect(t, lx, expectedItems)
+}
+
+func TestConvenientIntegerValues(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{Integer, "1k", 1, 6},
+		{EOF, "", 1, 0},
+	}
+	lx := New("foo = 1k")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{Integer, "1K", 1, 6},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo = 1K")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{Integer, "1m", 1, 6},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo = 1m")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{Integer, "1M", 1, 6},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo = 1M")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{Integer, "1g", 1, 6},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo = 1g")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{Integer, "1G", 1, 6},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo = 1G")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{Integer, "1MB", 1, 6},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo = 1MB")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{Integer, "1Gb", 1, 6},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo = 1Gb")
+	expect(t, lx, expectedItems)
+
+	// Negative versions
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{Integer, "-1m", 1, 6},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo = -1m")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{Integer, "-1GB", 1, 6},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo = -1GB ")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{String, "1Ghz", 1, 6},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo = 1Ghz")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{String, "2Pie", 1, 6},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo = 2Pie")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{String, "3Mbs", 1, 6},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo = 3Mbs,")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{Integer, "4Gb", 1, 6},
+		{Key, "bar", 1, 11},
+		{String, "5Gø", 1, 17},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo = 4Gb, bar = 5Gø")
+	expect(t, lx, expectedItems)
+}
+
+func TestSimpleKeyFloatValues(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{Float, "22.2", 1, 6},
+		{EOF, "", 1, 0},
+	}
+	lx := New("foo = 22.2")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{Float, "22.2", 1, 4},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo=22.2")
+	expect(t, lx, expectedItems)
+	lx = New("foo=22.2\r\n")
+	expect(t, lx, expectedItems)
+}
+
+func TestBadBinaryStringEndingAfterZeroHexChars(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{Error, "Expected two hexadecimal digits after '\\x', but hit end of line", 2, 1},
+		{EOF, "", 1, 0},
+	}
+	lx := New("foo = xyz\\x\n")
+	expect(t, lx, expectedItems)
+}
+
+func TestBadBinaryStringEndingAfterOneHexChar(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{Error, "Expected two hexadecimal digits after '\\x', but hit end of line", 2, 1},
+		{EOF, "", 1, 0},
+	}
+	lx := New("foo = xyz\\xF\n")
+	expect(t, lx, expectedItems)
+}
+
+func TestBadBinaryStringWithZeroHexChars(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{Error, "Expected two hexadecimal digits after '\\x', but got ']\"'", 1, 12},
+		{EOF, "", 1, 0},
+	}
+	lx := New(`foo = "[\x]"`)
+	expect(t, lx, expectedItems)
+}
+
+func TestBadBinaryStringWithOneHexChar(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{Error, "Expected two hexadecimal digits after '\\x', but got 'e]'", 1, 12},
+		{EOF, "", 1, 0},
+	}
+	lx := New(`foo = "[\xe]"`)
+	expect(t, lx, expectedItems)
+}
+
+func TestBadFloatValues(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{Error, "Floats must start with a digit", 1, 7},
+		{EOF, "", 1, 0},
+	}
+	lx := New("foo = .x")
+	expect(t, lx, expectedItems)
+}
+
+func TestNumberGrammar(t *testing.T) {
+	for _, tt := range []struct {
+		input string
+		item  Item
+	}{
+		{"1.5e3", Item{Float, "1.5e3", 1, 6}},
+		{"-1.5e3", Item{Float, "-1.5e3", 1, 6}},
+		{"1E-3", Item{Float, "1E-3", 1, 6}},
+		{"2e+10", Item{Float, "2e+10", 1, 6}},
+		{"+.5", Item{Float, "+.5", 1, 6}},
+		{"-.5", Item{Float, "-.5", 1, 6}},
+		{".5", Item{Float, ".5", 1, 6}},
+		{"+5", Item{Integer, "+5", 1, 6}},
+		{"-4kb", Item{Integer, "-4kb", 1, 6}},
+		{"+4KiB", Item{Integer, "+4KiB", 1, 6}},
+		{"1e", Item{Integer, "1e", 1, 6}},
+		{"1eb", Item{Integer, "1eb", 1, 6}},
+		{"2kx", Item{String, "2kx", 1, 6}},
+		{"+x", Item{String, "+x", 1, 6}},
+		{"1.5x", Item{Error, "Invalid character 'x' in number '1.5', quote '1.5x' if it is a string.", 1, 9}},
+		{"-12abc", Item{Error, "Invalid character 'a' in number '-12', quote '-12abc' if it is a string.", 1, 9}},
+		{"1.5e3x", Item{Error, "Invalid character 'x' in number '1.5e3', quote '1.5e3x' if it is a string.", 1, 11}},
+		{"1.5k", Item{Error, "Invalid character 'k' in number '1.5', quote '1.5k' if it is a string.", 1, 9}},
+		{"1.5x:y", Item{Error, "Invalid character 'x' in number '1.5'.", 1, 9}},
+		{"1.5/2", Item{Error, "Invalid character '/' in number '1.5'.", 1, 9}},
+		{"-.x", Item{Error, "Floats must have a digit after the '.'.", 1, 8}},
+	} {
+		lx := New("foo = " + tt.input)
+		expect(t, lx, []Item{{Key, "foo", 1, 0}, tt.item})
+	}
+}
+
+func TestTokenLiterals(t *testing.T) {
+	for _, tok := range []string{
+		"UDXU4RCSJNZOIQHZNWXHXORDPRTGNJAHAHFRGZNEEJCPQTT2M7NLCNF4",
+		"2eyJ0eXAiOiJKV1QiLCJhbGciOiJlZDI1NTE5LW5rZXkifQ.eyJqdGkiOiJBQkMifQ.sig",
+		"-_8xJ0eXAiOiJKV1QiLCJhbGciOiJlZDI1NTE5LW5rZXkifQ==",
+		"1.5e3QiLCJhbGciOiJlZDI1NTE5LW5rZXkifQ",
+	} {
+		lx := New("foo = " + tok)
+		expect(t, lx, []Item{{Key, "foo", 1, 0}, {String, tok, 1, 6}})
+	}
+
+	// Numbers stay numbers however long they are.
+	lx := New("foo = 1.000000000000000000000000000000001e3")
+	expect(t, lx, []Item{{Key, "foo", 1, 0}, {Float, "1.000000000000000000000000000000001e3", 1, 6}})
+
+	lx = New("foo = [2eyJ0eXAiOiJKV1QiLCJhbGciOiJlZDI1NTE5LW5rZXkifQ, 1]")
+	expect(t, lx, []Item{
+		{Key, "foo", 1, 0},
+		{ArrayStart, "", 1, 7},
+		{String, "2eyJ0eXAiOiJKV1QiLCJhbGciOiJlZDI1NTE5LW5rZXkifQ", 1, 7},
+		{Integer, "1", 1, 56},
+		{ArrayEnd, "", 1, 58},
+	})
+}
+
+func TestNumbersInArrays(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "a", 1, 0},
+		{ArrayStart, "", 1, 5},
+		{Integer, "1", 1, 5},
+		{Float, "-2.5e1", 1, 8},
+		{Integer, "4k", 1, 16},
+		{ArrayEnd, "", 1, 19},
+		{EOF, "", 1, 0},
+	}
+	lx := New("a = [1, -2.5e1, 4k]")
+	expect(t, lx, expectedItems)
+}
+
+func TestBadKey(t *testing.T) {
+	expectedItems := []Item{
+		{Error, "Unexpected key separator ':'", 1, 1},
+		{EOF, "", 1, 0},
+	}
+	lx := New(" :foo = 22")
+	expect(t, lx, expectedItems)
+}
+
+func TestSimpleKeyBoolValues(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{Bool, "true", 1, 6},
+		{EOF, "", 1, 0},
+	}
+	lx := New("foo = true")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{Bool, "true", 1, 4},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo=true")
+	expect(t, lx, expectedItems)
+	lx = New("foo=true\r\n")
+	expect(t, lx, expectedItems)
+}
+
+func TestComments(t *testing.T) {
+	expectedItems := []Item{
+		{CommentStart, "", 1, 1},
+		{Text, " This is a comment", 1, 1},
+		{EOF, "", 1, 0},
+	}
+	lx := New("# This is a comment")
+	expect(t, lx, expectedItems)
+	lx = New("# This is a comment\r\n")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{CommentStart, "", 1, 2},
+		{Text, " This is a comment", 1, 2},
+		{EOF, "", 1, 0},
+	}
+	lx = New("// This is a comment\r\n")
+	expect(t, lx, expectedItems)
+}
+
+func TestTopValuesWithComments(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{Integer, "123", 1, 6},
+		{CommentStart, "", 1, 12},
+		{Text, " This is a comment", 1, 12},
+		{EOF, "", 1, 0},
+	}
+
+	lx := New("foo = 123 // This is a comment")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{Integer, "123", 1, 4},
+		{CommentStart, "", 1, 12},
+		{Text, " This is a comment", 1, 12},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo=123    # This is a comment")
+	expect(t, lx, expectedItems)
+}
+
+func TestRawString(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{String, "bar", 1, 6},
+		{EOF, "", 1, 0},
+	}
+	lx := New("foo = bar")
+	expect(t, lx, expectedItems)
+	lx = New(`foo = bar' `)
+	expect(t, lx, expectedItems)
+}
+
+func TestDateValues(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{Datetime, "2016-05-04T18:53:41Z", 1, 6},
+		{EOF, "", 1, 0},
+	}
+
+	lx := New("foo = 2016-05-04T18:53:41Z")
+	expect(t, lx, expectedItems)
+
+	for _, dt := range []string{"2024-05-01T10:00:00+08:00", "2024-05-01T10:00:00-05:30", "2024-05-01T10:00:00"} {
+		expectedItems = []Item{
+			{Key, "foo", 1, 0},
+			{Datetime, dt, 1, 6},
+			{Key, "bar", 2, 1},
+			{Integer, "1", 2, 7},
+			{EOF, "", 2, 1},
+		}
+		lx = New("foo = " + dt + "\nbar = 1")
+		expect(t, lx, expectedItems)
+	}
+
+	lx = New("foo = 2024-05-01T10:00:00+08")
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{Error, "Expected ':' in ISO8601 datetime, but found '\x00' instead.", 1, 28},
+	}
+	expect(t, lx, expectedItems)
+}
+
+func TestVariableValues(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{Variable, "bar", 1, 7},
+		{EOF, "", 1, 0},
+	}
+	lx := New("foo = $bar")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{Variable, "bar", 1, 6},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo =$bar")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{Variable, "bar", 1, 5},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo $bar")
+	expect(t, lx, expectedItems)
+}
+
+func TestEscapedVariableValues(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{String, "$bar", 1, 7},
+		{EOF, "", 1, 0},
+	}
+	lx := New("foo = \\$bar")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{String, "$bar", 1, 7},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo = $$bar")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{String, "pa$$word", 1, 6},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo = pa$$word")
+	expect(t, lx, expectedItems)
+}
+
+func TestArrays(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{ArrayStart, "", 1, 7},
+		{Integer, "1", 1, 7},
+		{Integer, "2", 1, 10},
+		{Integer, "3", 1, 13},
+		{String, "bar", 1, 17},
+		{ArrayEnd, "", 1, 22},
+		{EOF, "", 1, 0},
+	}
+	lx := New("foo = [1, 2, 3, 'bar']")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{ArrayStart, "", 1, 7},
+		{Integer, "1", 1, 7},
+		{Integer, "2", 1, 9},
+		{Integer, "3", 1, 11},
+		{String, "bar", 1, 14},
+		{ArrayEnd, "", 1, 19},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo = [1,2,3,'bar']")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{ArrayStart, "", 1, 7},
+		{Integer, "1", 1, 7},
+		{Integer, "2", 1, 10},
+		{Integer, "3", 1, 12},
+		{String, "bar", 1, 15},
+		{ArrayEnd, "", 1, 20},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo = [1, 2,3,'bar']")
+	expect(t, lx, expectedItems)
+}
+
+var mlArray = `
+# top level comment
+foo = [
+ 1, # One
+ 2, // Two
+ 3 # Three
+ 'bar'     ,
+ "bar"
+]
+`
+
+func TestMultilineArrays(t *testing.T) {
+	expectedItems := []Item{
+		{CommentStart, "", 2, 2},
+		{Text, " top level comment", 2, 2},
+		{Key, "foo", 3, 1},
+		{ArrayStart, "", 3, 8},
+		{Integer, "1", 4, 2},
+		{CommentStart, "", 4, 6},
+		{Text, " One", 4, 6},
+		{Integer, "2", 5, 2},
+		{CommentStart, "", 5, 7},
+		{Text, " Two", 5, 7},
+		{Integer, "3", 6, 2},
+		{CommentStart, "", 6, 5},
+		{Text, " Three", 6, 5},
+		{String, "bar", 7, 3},
+		{String, "bar", 8, 3},
+		{ArrayEnd, "", 9, 2},
+		{EOF, "", 9, 0},
+	}
+	lx := New(mlArray)
+	expect(t, lx, expectedItems)
+}
+
+var mlArrayNoSep = `
+# top level comment
+foo = [
+ 1 // foo
+ 2
+ 3
+ 'bar'
+ "bar"
+]
+`
+
+func TestMultilineArraysNoSep(t *testing.T) {
+	expectedItems := []Item{
+		{CommentStart, "", 2, 2},
+		{Text, " top level comment", 2, 2},
+		{Key, "foo", 3, 1},
+		{ArrayStart, "", 3, 8},
+		{Integer, "1", 4, 2},
+		{CommentStart, "", 4, 6},
+		{Text, " foo", 4, 6},
+		{Integer, "2", 5, 2},
+		{Integer, "3", 6, 2},
+		{String, "bar", 7, 3},
+		{String, "bar", 8, 3},
+		{ArrayEnd, "", 9, 2},
+		{EOF, "", 9, 0},
+	}
+	lx := New(mlArrayNoSep)
+	expect(t, lx, expectedItems)
+}
+
+func TestSimpleMap(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{MapStart, "", 1, 7},
+		{Key, "ip", 1, 7},
+		{String, "127.0.0.1", 1, 11},
+		{Key, "port", 1, 23},
+		{Integer, "8080", 1, 30},
+		{MapEnd, "", 1, 35},
+		{EOF, "", 1, 0},
+	}
+
+	lx := New("foo = {ip='127.0.0.1', port = 8080}")
+	expect(t, lx, expectedItems)
+}
+
+var mlMap = `
+foo = {
+  ip = '127.0.0.1' # the IP
+  port= 8080 // the port
+}
+`
+
+func TestMultilineMap(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 2, 1},
+		{MapStart, "", 2, 8},
+		{Key, "ip", 3, 3},
+		{String, "127.0.0.1", 3, 9},
+		{CommentStart, "", 3, 21},
+		{Text, " the IP", 3, 21},
+		{Key, "port", 4, 3},
+		{Integer, "8080", 4, 9},
+		{CommentStart, "", 4, 16},
+		{Text, " the port", 4, 16},
+		{MapEnd, "", 5, 2},
+		{EOF, "", 5, 0},
+	}
+
+	lx := New(mlMap)
+	expect(t, lx, expectedItems)
+}
+
+var nestedMap = `
+foo = {
+  host = {
+    ip = '127.0.0.1'
+    port= 8080
+  }
+}
+`
+
+func TestNestedMaps(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 2, 1},
+		{MapStart, "", 2, 8},
+		{Key, "host", 3, 3},
+		{MapStart, "", 3, 11},
+		{Key, "ip", 4, 5},
+		{String, "127.0.0.1", 4, 11},
+		{Key, "port", 5, 5},
+		{Integer, "8080", 5, 11},
+		{MapEnd, "", 6, 4},
+		{MapEnd, "", 7, 2},
+		{EOF, "", 7, 0},
+	}
+
+	lx := New(nestedMap)
+	expect(t, lx, expectedItems)
+}
+
+func TestQuotedKeys(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{Integer, "123", 1, 6},
+		{EOF, "", 1, 0},
+	}
+	lx := New("foo : 123")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 1},
+		{Integer, "123", 1, 8},
+		{EOF, "", 1, 0},
+	}
+	lx = New("'foo' : 123")
+	expect(t, lx, expectedItems)
+	lx = New("\"foo\" : 123")
+	expect(t, lx, expectedItems)
+}
+
+func TestQuotedKeysWithSpace(t *testing.T) {
+	expectedItems := []Item{
+		{Key, " foo", 1, 1},
+		{Integer, "123", 1, 9},
+		{EOF, "", 1, 0},
+	}
+	lx := New("' foo' : 123")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, " foo", 1, 1},
+		{Integer, "123", 1, 9},
+		{EOF, "", 1, 0},
+	}
+	lx = New("\" foo\" : 123")
+	expect(t, lx, expectedItems)
+}
+
+func TestColonKeySep(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{Integer, "123", 1, 6},
+		{EOF, "", 1, 0},
+	}
+	lx := New("foo : 123")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{Integer, "123", 1, 4},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo:123")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{Integer, "123", 1, 5},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo: 123")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{Integer, "123", 1, 6},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo:  123\r\n")
+	expect(t, lx, expectedItems)
+}
+
+func TestWhitespaceKeySep(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{Integer, "123", 1, 4},
+		{EOF, "", 1, 0},
+	}
+	lx := New("foo 123")
+	expect(t, lx, expectedItems)
+	lx = New("foo 123")
+	expect(t, lx, expectedItems)
+	lx = New("foo\t123")
+	expect(t, lx, expectedItems)
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{Integer, "123", 1, 5},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo\t\t123\r\n")
+	expect(t, lx, expectedItems)
+}
+
+var escString = `
+foo  = \t
+bar  = \r
+baz  = \n
+q    = \"
+bs   = \\
+`
+
+func TestEscapedString(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 2, 1},
+		{String, "\t", 2, 9},
+		{Key, "bar", 3, 1},
+		{String, "\r", 3, 9},
+		{Key, "baz", 4, 1},
+		{String, "\n", 4, 9},
+		{Key, "q", 5, 1},
+		{String, "\"", 5, 9},
+		{Key, "bs", 6, 1},
+		{String, "\\", 6, 9},
+		{EOF, "", 6, 0},
+	}
+	lx := New(escString)
+	expect(t, lx, expectedItems)
+}
+
+func TestCompoundStringES(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{String, "\\end", 1, 8},
+		{EOF, "", 2, 0},
+	}
+	lx := New(`foo = "\\end"`)
+	expect(t, lx, expectedItems)
+}
+
+func TestCompoundStringSE(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{String, "start\\", 1, 8},
+		{EOF, "", 2, 0},
+	}
+	lx := New(`foo = "start\\"`)
+	expect(t, lx, expectedItems)
+}
+
+func TestCompoundStringEE(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{String, "Eq", 1, 12},
+		{EOF, "", 2, 0},
+	}
+	lx := New(`foo = \x45\x71`)
+	expect(t, lx, expectedItems)
+}
+
+func TestCompoundStringSEE(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{String, "startEq", 1, 12},
+		{EOF, "", 2, 0},
+	}
+	lx := New(`foo = start\x45\x71`)
+	expect(t, lx, expectedItems)
+}
+
+func TestCompoundStringSES(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{String, "start|end", 1, 9},
+		{EOF, "", 2, 0},
+	}
+	lx := New(`foo = start\x7Cend`)
+	expect(t, lx, expectedItems)
+}
+
+func TestCompoundStringEES(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{String, "<>end", 1, 12},
+		{EOF, "", 2, 0},
+	}
+	lx := New(`foo = \x3c\x3eend`)
+	expect(t, lx, expectedItems)
+}
+
+func TestCompoundStringESE(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{String, "<middle>", 1, 12},
+		{EOF, "", 2, 0},
+	}
+	lx := New(`foo = \x3cmiddle\x3E`)
+	expect(t, lx, expectedItems)
+}
+
+func TestBadStringEscape(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{Error, "Invalid escape character 'y'. Only the following escape characters are allowed: " +
+			"\\xXX, \\uXXXX, \\UXXXXXXXX, \\t, \\n, \\r, \\b, \\f, \\/, \\\", \\\\, \\$.", 1, 8},
+		{EOF, "", 2, 0},
+	}
+	lx := New(`foo = \y`)
+	expect(t, lx, expectedItems)
+}
+
+func TestUnicodeEscapes(t *testing.T) {
+	for _, tt := range []struct {
+		input, ex string
+	}{
+		{`foo = "caf\u00e9"`, "café"},
+		{`foo = "\U0001F600!"`, "😀!"},
+		{`foo = "\uD83D\uDE00"`, "😀"},
+		{`foo = "a\b\f\/"`, "a\b\f/"},
+		{`foo = \u2603x`, "☃x"},
+	} {
+		lx := New(tt.input)
+		lx.Next()
+		if it := lx.Next(); it.Type != String || it.Val != tt.ex {
+			t.Errorf("Expected string %q for %s, got %v", tt.ex, tt.input, it)
+		}
+	}
+
+	// Single quoted strings are raw.
+	expect(t, New(`foo = 'C:\new\u00e9'`), []Item{
+		{Key, "foo", 1, 0},
+		{String, `C:\new\u00e9`, 1, 7},
+	})
+
+	for _, input := range []string{
+		`foo = "\u12"`,
+		`foo = "\u12g4"`,
+		`foo = "\uD83D"`,
+		`foo = "\uDE00"`,
+		`foo = "\uD83Dx"`,
+		`foo = "\uD83D\u0041"`,
+		`foo = "\UFFFFFFFF"`,
+		`foo = "\U00110000"`,
+	} {
+		lx := New(input)
+		if it := lx.Next(); it.Type != Key {
+			t.Fatalf("Expected key, got %v", it)
+		}
+		if it := lx.Next(); it.Type != Error {
+			t.Errorf("Expected error for %s, got %v", input, it)
+		}
+	}
+}
+
+func TestBytesLiteral(t *testing.T) {
+	expect(t, New(`key = base64"aGVsbG8="; nonce = hex"dead beef"`), []Item{
+		{Key, "key", 1, 0},
+		{Bytes, `base64"aGVsbG8=`, 1, 6},
+		{Key, "nonce", 1, 24},
+		{Bytes, `hex"dead beef`, 1, 32},
+		{EOF, "", 1, 0},
+	})
+	expect(t, New(`keys = [hex"00", plain"x"]`), []Item{
+		{Key, "keys", 1, 0},
+		{ArrayStart, "", 1, 8},
+		{Bytes, `hex"00`, 1, 8},
+		{String, `plain"x"`, 1, 17},
+		{ArrayEnd, "", 1, 26},
+	})
+	expect(t, New("key = hex\"00\n"), []Item{
+		{Key, "key", 1, 0},
+		{Error, "Unexpected end of bytes literal", 2, 1},
+	})
+}
+
+func TestNonBool(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{String, "\\true", 1, 7},
+		{EOF, "", 2, 0},
+	}
+	lx := New(`foo = \\true`)
+	expect(t, lx, expectedItems)
+}
+
+func TestNonVariable(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{String, "\\$var", 1, 7},
+		{EOF, "", 2, 0},
+	}
+	lx := New(`foo = \\$var`)
+	expect(t, lx, expectedItems)
+}
+
+func TestEmptyStringDQ(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{String, "", 1, 7},
+		{EOF, "", 2, 0},
+	}
+	lx := New(`foo = ""`)
+	expect(t, lx, expectedItems)
+}
+
+func TestEmptyStringSQ(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{String, "", 1, 7},
+		{EOF, "", 2, 0},
+	}
+	lx := New(`foo = ''`)
+	expect(t, lx, expectedItems)
+}
+
+var nestedWhitespaceMap = `
+foo  {
+  host  {
+    ip = '127.0.0.1'
+    port= 8080
+  }
+}
+`
+
+func TestNestedWhitespaceMaps(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 2, 1},
+		{MapStart, "", 2, 7},
+		{Key, "host", 3, 3},
+		{MapStart, "", 3, 10},
+		{Key, "ip", 4, 5},
+		{String, "127.0.0.1", 4, 11},
+		{Key, "port", 5, 5},
+		{Integer, "8080", 5, 11},
+		{MapEnd, "", 6, 4},
+		{MapEnd, "", 7, 2},
+		{EOF, "", 7, 0},
+	}
+
+	lx := New(nestedWhitespaceMap)
+	expect(t, lx, expectedItems)
+}
+
+var semicolons = `
+foo = 123;
+bar = 'baz';
+baz = 'boo'
+map {
+ id = 1;
+}
+`
+
+func TestOptionalSemicolons(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 2, 1},
+		{Integer, "123", 2, 7},
+		{Key, "bar", 3, 1},
+		{String, "baz", 3, 8},
+		{Key, "baz", 4, 1},
+		{String, "boo", 4, 8},
+		{Key, "map", 5, 1},
+		{MapStart, "", 5, 6},
+		{Key, "id", 6, 2},
+		{Integer, "1", 6, 7},
+		{MapEnd, "", 7, 2},
+		{EOF, "", 8, 0},
+	}
+
+	lx := New(semicolons)
+	expect(t, lx, expectedItems)
+}
+
+func TestSemicolonChaining(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{String, "1", 1, 5},
+		{Key, "bar", 1, 9},
+		{Float, "2.2", 1, 13},
+		{Key, "baz", 1, 18},
+		{Bool, "true", 1, 22},
+		{EOF, "", 1, 0},
+	}
+
+	lx := New("foo='1'; bar=2.2; baz=true;")
+	expect(t, lx, expectedItems)
+}
+
+var noquotes = `
+foo = 123
+bar = baz
+baz=boo
+map {
+ id:one
+ id2 : onetwo
+}
+t true
+f false
+tstr "true"
+tkey = two
+fkey = five # This should be a string
+`
+
+func TestNonQuotedStrings(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 2, 1},
+		{Integer, "123", 2, 7},
+		{Key, "bar", 3, 1},
+		{String, "baz", 3, 7},
+		{Key, "baz", 4, 1},
+		{String, "boo", 4, 5},
+		{Key, "map", 5, 1},
+		{MapStart, "", 5, 6},
+		{Key, "id", 6, 2},
+		{String, "one", 6, 5},
+		{Key, "id2", 7, 2},
+		{String, "onetwo", 7, 8},
+		{MapEnd, "", 8, 2},
+		{Key, "t", 9, 1},
+		{Bool, "true", 9, 3},
+		{Key, "f", 10, 1},
+		{Bool, "false", 10, 3},
+		{Key, "tstr", 11, 1},
+		{String, "true", 11, 7},
+		{Key, "tkey", 12, 1},
+		{String, "two", 12, 8},
+		{Key, "fkey", 13, 1},
+		{String, "five", 13, 8},
+		{CommentStart, "", 13, 14},
+		{Text, " This should be a string", 13, 14},
+		{EOF, "", 14, 0},
+	}
+	lx := New(noquotes)
+	expect(t, lx, expectedItems)
+}
+
+var danglingquote = `
+listen: "localhost:8080
+
+http: localhost:8222
+`
+
+func TestDanglingQuotedString(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "listen", 2, 1},
+		{Error, "Unexpected EOF.", 5, 1},
+	}
+	lx := New(danglingquote)
+	expect(t, lx, expectedItems)
+}
+
+var keydanglingquote = `
+foo = "
+listen: "
+
+http: localhost:8222
+
+"
+`
+
+func TestKeyDanglingQuotedString(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 2, 1},
+		{String, "\nlisten: ", 3, 8},
+		{Key, "http", 5, 1},
+		{String, "localhost:8222", 5, 7},
+		{Error, "Unexpected EOF.", 8, 1},
+	}
+	lx := New(keydanglingquote)
+	expect(t, lx, expectedItems)
+}
+
+var danglingsquote = `
+listen: 'localhost:8080
+
+http: localhost:8222
+`
+
+func TestDanglingSingleQuotedString(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "listen", 2, 1},
+		{Error, "Unexpected EOF.", 5, 1},
+	}
+	lx := New(danglingsquote)
+	expect(t, lx, expectedItems)
+}
+
+var keydanglingsquote = `
+foo = '
+listen: '
+
+http: localhost:8222
+
+'
+`
+
+func TestKeyDanglingSingleQuotedString(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 2, 1},
+		{String, "\nlisten: ", 3, 8},
+		{Key, "http", 5, 1},
+		{String, "localhost:8222", 5, 7},
+		{Error, "Unexpected EOF.", 8, 1},
+	}
+	lx := New(keydanglingsquote)
+	expect(t, lx, expectedItems)
+}
+
+var mapdanglingbracket = `
+listen = 4222
+
+cluster = {
+
+  foo = bar
+
+`
+
+func TestMapDanglingBracket(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "listen", 2, 1},
+		{Integer, "4222", 2, 10},
+		{Key, "cluster", 4, 1},
+		{MapStart, "", 4, 12},
+		{Key, "foo", 6, 3},
+		{String, "bar", 6, 9},
+		{Error, "Unexpected EOF processing map.", 8, 1},
+	}
+	lx := New(mapdanglingbracket)
+	expect(t, lx, expectedItems)
+}
+
+var blockdanglingparens = `
+listen = 4222
+
+quote = (
+
+  foo = bar
+
+`
+
+func TestBlockDanglingParens(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "listen", 2, 1},
+		{Integer, "4222", 2, 10},
+		{Key, "quote", 4, 1},
+		{Error, "Unexpected EOF processing block.", 8, 1},
+	}
+	lx := New(blockdanglingparens)
+	expect(t, lx, expectedItems)
+}
+
+func TestMapQuotedKeys(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{MapStart, "", 1, 7},
+		{Key, "bar", 1, 8},
+		{Integer, "8080", 1, 15},
+		{MapEnd, "", 1, 20},
+		{EOF, "", 1, 0},
+	}
+	lx := New("foo = {'bar' = 8080}")
+	expect(t, lx, expectedItems)
+	lx = New("foo = {\"bar\" = 8080}")
+	expect(t, lx, expectedItems)
+}
+
+func TestSpecialCharsMapQuotedKeys(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{MapStart, "", 1, 7},
+		{Key, "bar-1.2.3", 1, 8},
+		{MapStart, "", 1, 22},
+		{Key, "port", 1, 23},
+		{Integer, "8080", 1, 28},
+		{MapEnd, "", 1, 34},
+		{MapEnd, "", 1, 35},
+		{EOF, "", 1, 0},
+	}
+	lx := New("foo = {'bar-1.2.3' = { port:8080 }}")
+	expect(t, lx, expectedItems)
+	lx = New("foo = {\"bar-1.2.3\" = { port:8080 }}")
+	expect(t, lx, expectedItems)
+}
+
+var mlnestedmap = `
+systems {
+  allinone {
+    description: "This is a description."
+  }
+}
+`
+
+func TestDoubleNestedMapsNewLines(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "systems", 2, 1},
+		{MapStart, "", 2, 10},
+		{Key, "allinone", 3, 3},
+		{MapStart, "", 3, 13},
+		{Key, "description", 4, 5},
+		{String, "This is a description.", 4, 19},
+		{MapEnd, "", 5, 4},
+		{MapEnd, "", 6, 2},
+		{EOF, "", 7, 0},
+	}
+	lx := New(mlnestedmap)
+	expect(t, lx, expectedItems)
+}
+
+var blockexample = `
+numbers (
+1234567890
+)
+`
+
+func TestBlockString(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "numbers", 2, 1},
+		{String, "\n1234567890\n", 4, 10},
+	}
+	lx := New(blockexample)
+	expect(t, lx, expectedItems)
+}
+
+func TestBlockStringEOF(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "numbers", 2, 1},
+		{String, "\n1234567890\n", 4, 10},
+	}
+	blockbytes := []byte(blockexample[0 : len(blockexample)-1])
+	blockbytes = append(blockbytes, 0)
+	lx := New(string(blockbytes))
+	expect(t, lx, expectedItems)
+}
+
+var mlblockexample = `
+numbers (
+  12(34)56
+  (
+    7890
+  )
+)
+`
+
+func TestBlockStringMultiLine(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "numbers", 2, 1},
+		{String, "\n  12(34)56\n  (\n    7890\n  )\n", 7, 10},
+	}
+	lx := New(mlblockexample)
+	expect(t, lx, expectedItems)
+}
+
+func TestUnquotedIPAddr(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "listen", 1, 0},
+		{String, "127.0.0.1:4222", 1, 8},
+		{EOF, "", 1, 0},
+	}
+	lx := New("listen: 127.0.0.1:4222")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "listen", 1, 0},
+		{String, "127.0.0.1", 1, 8},
+		{EOF, "", 1, 0},
+	}
+	lx = New("listen: 127.0.0.1")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "listen", 1, 0},
+		{String, "apcera.me:80", 1, 8},
+		{EOF, "", 1, 0},
+	}
+	lx = New("listen: apcera.me:80")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "listen", 1, 0},
+		{String, "nats.io:-1", 1, 8},
+		{EOF, "", 1, 0},
+	}
+	lx = New("listen: nats.io:-1")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "listen", 1, 0},
+		{Integer, "-1", 1, 8},
+		{EOF, "", 1, 0},
+	}
+	lx = New("listen: -1")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "listen", 1, 0},
+		{String, ":-1", 1, 8},
+		{EOF, "", 1, 0},
+	}
+	lx = New("listen: :-1")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "listen", 1, 0},
+		{String, ":80", 1, 9},
+		{EOF, "", 1, 0},
+	}
+	lx = New("listen = :80")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "listen", 1, 0},
+		{ArrayStart, "", 1, 10},
+		{String, "localhost:4222", 1, 10},
+		{String, "localhost:4333", 1, 26},
+		{ArrayEnd, "", 1, 41},
+		{EOF, "", 1, 0},
+	}
+	lx = New("listen = [localhost:4222, localhost:4333]")
+	expect(t, lx, expectedItems)
+}
+
+var arrayOfMaps = `
+authorization {
+    users = [
+      {user: alice, password: foo}
+      {user: bob,   password: bar}
+    ]
+    timeout: 0.5
+}
+`
+
+func TestArrayOfMaps(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "authorization", 2, 1},
+		{MapStart, "", 2, 16},
+		{Key, "users", 3, 5},
+		{ArrayStart, "", 3, 14},
+		{MapStart, "", 4, 8},
+		{Key, "user", 4, 8},
+		{String, "alice", 4, 14},
+		{Key, "password", 4, 21},
+		{String, "foo", 4, 31},
+		{MapEnd, "", 4, 35},
+		{MapStart, "", 5, 8},
+		{Key, "user", 5, 8},
+		{String, "bob", 5, 14},
+		{Key, "password", 5, 21},
+		{String, "bar", 5, 31},
+		{MapEnd, "", 5, 35},
+		{ArrayEnd, "", 6, 6},
+		{Key, "timeout", 7, 5},
+		{Float, "0.5", 7, 14},
+		{MapEnd, "", 8, 2},
+		{EOF, "", 9, 0},
+	}
+	lx := New(arrayOfMaps)
+	expect(t, lx, expectedItems)
+}
+
+func TestInclude(t *testing.T) {
+	expectedItems := []Item{
+		{Include, "users.conf", 1, 9},
+		{EOF, "", 1, 0},
+	}
+	lx := New("include \"users.conf\"")
+	expect(t, lx, expectedItems)
+
+	lx = New("include 'users.conf'")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Include, "users.conf", 1, 8},
+		{EOF, "", 1, 0},
+	}
+	lx = New("include users.conf")
+	expect(t, lx, expectedItems)
+}
+
+func TestOptionalInclude(t *testing.T) {
+	expect(t, New("include? 'local.conf'"), []Item{
+		{OptionalInclude, "local.conf", 1, 10},
+		{EOF, "", 1, 0},
+	})
+	expect(t, New("foo { include? local.conf }"), []Item{
+		{Key, "foo", 1, 0},
+		{MapStart, "", 1, 5},
+		{OptionalInclude, "local.conf", 1, 15},
+		{MapEnd, "", 1, 27},
+		{EOF, "", 1, 0},
+	})
+}
+
+func TestValueInclude(t *testing.T) {
+	expect(t, New("acme = include 'acme.conf'"), []Item{
+		{Key, "acme", 1, 0},
+		{Include, "acme.conf", 1, 16},
+		{EOF, "", 1, 0},
+	})
+	expect(t, New("t { acme: include? acme.conf }"), []Item{
+		{Key, "t", 1, 0},
+		{MapStart, "", 1, 3},
+		{Key, "acme", 1, 4},
+		{OptionalInclude, "acme.conf", 1, 19},
+		{MapEnd, "", 1, 30},
+		{EOF, "", 1, 0},
+	})
+	expect(t, New("a = [include 'a.conf', \"b\"]"), []Item{
+		{Key, "a", 1, 0},
+		{ArrayStart, "", 1, 5},
+		{Include, "a.conf", 1, 14},
+		{String, "b", 1, 24},
+		{ArrayEnd, "", 1, 27},
+		{EOF, "", 1, 0},
+	})
+	// Without a following value the keyword is a plain string.
+	expect(t, New("mode = include"), []Item{
+		{Key, "mode", 1, 0},
+		{String, "include", 1, 7},
+		{EOF, "", 1, 0},
+	})
+}
+
+func TestCall(t *testing.T) {
+	lx := New(`a = file("x(1).txt"), b = f('a', ")"); c = g(h(1))` + "\nd = other(x)")
+	lx.SetFuncs(func(name string) bool { return name != "other" })
+	expect(t, lx, []Item{
+		{Key, "a", 1, 0},
+		{Call, `file("x(1).txt")`, 1, 4},
+		{Key, "b", 1, 22},
+		{Call, `f('a', ")")`, 1, 26},
+		{Key, "c", 1, 39},
+		{Call, "g(h(1))", 1, 43},
+		{Key, "d", 2, 1},
+		{String, "other(x)", 2, 5},
+		{EOF, "", 2, 0},
+	})
+}
+
+func TestMapInclude(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{MapStart, "", 1, 5},
+		{Include, "users.conf", 1, 14},
+		{MapEnd, "", 1, 26},
+		{EOF, "", 1, 0},
+	}
+
+	lx := New("foo { include users.conf }")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{MapStart, "", 1, 5},
+		{Include, "users.conf", 1, 13},
+		{MapEnd, "", 1, 24},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo {include users.conf}")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{MapStart, "", 1, 5},
+		{Include, "users.conf", 1, 15},
+		{MapEnd, "", 1, 28},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo { include 'users.conf' }")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "foo", 1, 0},
+		{MapStart, "", 1, 5},
+		{Include, "users.conf", 1, 15},
+		{MapEnd, "", 1, 27},
+		{EOF, "", 1, 0},
+	}
+	lx = New("foo { include \"users.conf\"}")
+	expect(t, lx, expectedItems)
+}
+
+func TestMapSpread(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "foo", 1, 0},
+		{MapStart, "", 1, 5},
+		{Spread, "defaults", 1, 7},
+		{Key, "port", 1, 20},
+		{Integer, "1", 1, 27},
+		{MapEnd, "", 1, 30},
+		{EOF, "", 1, 0},
+	}
+	lx := New("foo { $defaults...; port = 1 }")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Spread, "defaults", 1, 1},
+		{Key, "port", 2, 1},
+		{Integer, "1", 2, 8},
+		{EOF, "", 2, 0},
+	}
+	lx = New("$defaults...\nport = 1")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "$foo", 1, 0},
+		{Variable, "bar...", 1, 8},
+		{EOF, "", 1, 0},
+	}
+	lx = New("$foo = $bar...")
+	expect(t, lx, expectedItems)
+}
+
+func TestJSONCompat(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		input    string
+		expected []Item
+	}{
+		{
+			name: "should omit initial and final brackets at top level with a single item",
+			input: `
+                        {
+                          "http_port": 8223
+                        }
+                        `,
+			expected: []Item{
+				{Key, "http_port", 3, 28},
+				{Integer, "8223", 3, 40},
+				{Key, "}", 4, 25},
+				{EOF, "", 0, 0},
+			},
+		},
+		{
+			name: "should omit trailing commas at top level with two items",
+			input: `
+                        {
+                          "http_port": 8223,
+                          "port": 4223
+                        }
+                        `,
+			expected: []Item{
+				{Key, "http_port", 3, 28},
+				{Integer, "8223", 3, 40},
+				{Key, "port", 4, 28},
+				{Integer, "4223", 4, 35},
+				{Key, "}", 5, 25},
+				{EOF, "", 0, 0},
+			},
+		},
+		{
+			name: "should omit trailing commas at top level with multiple items",
+			input: `
+                        {
+                          "http_port": 8223,
+                          "port": 4223,
+                          "max_payload": "5MB",
+                          "debug": true,
+                          "max_control_line": 1024
+                        }
+                        `,
+			expected: []Item{
+				{Key, "http_port", 3, 28},
+				{Integer, "8223", 3, 40},
+				{Key, "port", 4, 28},
+				{Integer, "4223", 4, 35},
+				{Key, "max_payload", 5, 28},
+				{String, "5MB", 5, 43},
+				{Key, "debug", 6, 28},
+				{Bool, "true", 6, 36},
+				{Key, "max_control_line", 7, 28},
+				{Integer, "1024", 7, 47},
+				{Key, "}", 8, 25},
+				{EOF, "", 0, 0},
+			},
+		},
+		{
+			name: "should support JSON not prettified",
+			input: `{"http_port": 8224,"port": 4224}
+                        `,
+			expected: []Item{
+				{Key, "http_port", 1, 2},
+				{Integer, "8224", 1, 14},
+				{Key, "port", 1, 20},
+				{Integer, "4224", 1, 27},
+				{EOF, "", 0, 0},
+			},
+		},
+		{
+			name: "should support JSON not prettified with final bracket after newline",
+			input: `{"http_port": 8225,"port": 4225
+                        }
+                        `,
+			expected: []Item{
+				{Key, "http_port", 1, 2},
+				{Integer, "8225", 1, 14},
+				{Key, "port", 1, 20},
+				{Integer, "4225", 1, 27},
+				{Key, "}", 2, 25},
+				{EOF, "", 0, 0},
+			},
+		},
+		{
+			name: "should support uglified JSON with inner blocks",
+			input: `{"http_port": 8227,"port": 4227,"write_deadline": "1h","cluster": {"port": 6222,"routes": ["nats://127.0.0.1:4222","nats://127.0.0.1:4223","nats://127.0.0.1:4224"]}}
+                        `,
+			expected: []Item{
+				{Key, "http_port", 1, 2},
+				{Integer, "8227", 1, 14},
+				{Key, "port", 1, 20},
+				{Integer, "4227", 1, 27},
+				{Key, "write_deadline", 1, 33},
+				{String, "1h", 1, 51},
+				{Key, "cluster", 1, 56},
+				{MapStart, "", 1, 67},
+				{Key, "port", 1, 68},
+				{Integer, "6222", 1, 75},
+				{Key, "routes", 1, 81},
+				{ArrayStart, "", 1, 91},
+				{String, "nats://127.0.0.1:4222", 1, 92},
+				{String, "nats://127.0.0.1:4223", 1, 116},
+				{String, "nats://127.0.0.1:4224", 1, 140},
+				{ArrayEnd, "", 1, 163},
+				{MapEnd, "", 1, 164},
+				{Key, "}", 14, 25},
+				{EOF, "", 0, 0},
+			},
+		},
+		{
+			name: "should support prettified JSON with inner blocks",
+			input: `
+                        {
+                          "http_port": 8227,
+                          "port": 4227,
+                          "write_deadline": "1h",
+                          "cluster": {
+                            "port": 6222,
+                            "routes": [
+                              "nats://127.0.0.1:4222",
+                              "nats://127.0.0.1:4223",
+                              "nats://127.0.0.1:4224"
+                            ]
+                          }
+                        }
+                        `,
+			expected: []Item{
+				{Key, "http_port", 3, 28},
+				{Integer, "8227", 3, 40},
+				{Key, "port", 4, 28},
+				{Integer, "4227", 4, 35},
+				{Key, "write_deadline", 5, 28},
+				{String, "1h", 5, 46},
+				{Key, "cluster", 6, 28},
+				{MapStart, "", 6, 39},
+				{Key, "port", 7, 30},
+				{Integer, "6222", 7, 37},
+				{Key, "routes", 8, 30},
+				{ArrayStart, "", 8, 40},
+				{String, "nats://127.0.0.1:4222", 9, 32},
+				{String, "nats://127.0.0.1:4223", 10, 32},
+				{String, "nats://127.0.0.1:4224", 11, 32},
+				{ArrayEnd, "", 12, 30},
+				{MapEnd, "", 13, 28},
+				{Key, "}", 14, 25},
+				{EOF, "", 0, 0},
+			},
+		},
+		{
+			name: "should support JSON with blocks",
+			input: `{
+                          "jetstream": {
+                            "store_dir": "/tmp/nats"
+                            "max_mem": 1000000,
+                          },
+                          "port": 4222,
+                          "server_name": "nats1"
+                        }
+                        `,
+			expected: []Item{
+				{Key, "jetstream", 2, 28},
+				{MapStart, "", 2, 41},
+				{Key, "store_dir", 3, 30},
+				{String, "/tmp/nats", 3, 43},
+				{Key, "max_mem", 4, 30},
+				{Integer, "1000000", 4, 40},
+				{MapEnd, "", 5, 28},
+				{Key, "port", 6, 28},
+				{Integer, "4222", 6, 35},
+				{Key, "server_name", 7, 28},
+				{String, "nats1", 7, 43},
+				{Key, "}", 8, 25},
+				{EOF, "", 0, 0},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			lx := New(test.input)
+			expect(t, lx, test.expected)
+		})
+	}
+}
+
+func TestMultiBytePositions(t *testing.T) {
+	expectedItems := []Item{
+		{Key, "föö", 1, 0},
+		{String, "bär", 1, 7},
+		{Key, "bäz", 1, 13},
+		{Integer, "1", 1, 19},
+		{CommentStart, "", 2, 2},
+		{Text, " ünïcödé", 2, 2},
+		{Key, "x", 3, 1},
+		{String, "☃", 3, 6},
+		{EOF, "", 3, 0},
+	}
+	lx := New("föö = 'bär'; bäz = 1\n# ünïcödé\nx = \"☃\"")
+	expect(t, lx, expectedItems)
+
+	lx = New("a = 'ü'\nb = ü]")
+	expect(t, lx, []Item{
+		{Key, "a", 1, 0},
+		{String, "ü", 1, 5},
+		{Key, "b", 2, 1},
+		{String, "ü", 2, 5},
+		{Error, "Expected a top-level value to end with a new line, comment or EOF, but got ']' instead.", 2, 7},
+	})
+}
+
+func TestTabWidthPositions(t *testing.T) {
+	input := "a {\n\tb = 1\n\t\tc = 2\n}"
+	lx := New(input)
+	expect(t, lx, []Item{
+		{Key, "a", 1, 0},
+		{MapStart, "", 1, 3},
+		{Key, "b", 2, 2},
+		{Integer, "1", 2, 6},
+		{Key, "c", 3, 3},
+	})
+
+	lx = New(input)
+	lx.SetTabWidth(4)
+	expect(t, lx, []Item{
+		{Key, "a", 1, 0},
+		{MapStart, "", 1, 3},
+		{Key, "b", 2, 5},
+		{Integer, "1", 2, 9},
+		{Key, "c", 3, 9},
+	})
+}
+
+func TestLongLinePositions(t *testing.T) {
+	lx := New(strings.Repeat("ké = 'ü'; ", 1000))
+	for i := 0; i < 1000; i++ {
+		if it := lx.Next(); it.Type != Key || it.Pos != 10*i {
+			t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", it, Item{Key, "ké", 1, 10 * i})
+		}
+		if it := lx.Next(); it.Type != String || it.Pos != 10*i+6 {
+			t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", it, Item{String, "ü", 1, 10*i + 6})
+		}
+	}
+
+	lx = New(strings.Repeat("k\t= 1;", 1000))
+	lx.SetTabWidth(4)
+	for i := 0; i < 1000; i++ {
+		if it := lx.Next(); it.Type != Key || it.Pos != 8*i {
+			t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", it, Item{Key, "k", 1, 8 * i})
+		}
+		if it := lx.Next(); it.Type != Integer || it.Pos != 8*i+6 {
+			t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", it, Item{Integer, "1", 1, 8*i + 6})
+		}
+	}
+}
+
+func TestSchemaBlock(t *testing.T) {
+	expectedItems := []Item{
+		{Schema, "\n  port: int & >0 # {\n  tls { name: =~\"}\" }\n", 4, 9},
+		{Key, "port", 5, 1},
+		{Integer, "1", 5, 8},
+		{EOF, "", 5, 0},
+	}
+	lx := New("@schema {\n  port: int & >0 # {\n  tls { name: =~\"}\" }\n}\nport = 1")
+	expect(t, lx, expectedItems)
+
+	expectedItems = []Item{
+		{Key, "@schemas", 1, 0},
+		{MapStart, "", 1, 10},
+		{MapEnd, "", 1, 11},
+		{EOF, "", 1, 0},
+	}
+	lx = New("@schemas {}")
+	expect(t, lx, expectedItems)
+}
+
+func TestDirective(t *testing.T) {
+	lx := New("import_users 'users.csv'\nauth { import_users users.csv }\nimport_users = 1\nother x")
+	lx.SetDirectives(func(name string) bool { return name == "import_users" })
+	expect(t, lx, []Item{
+		{Directive, "import_users users.csv", 1, 14},
+		{Key, "auth", 2, 1},
+		{MapStart, "", 2, 7},
+		{Directive, "import_users users.csv", 2, 21},
+		{MapEnd, "", 2, 32},
+		{Key, "import_users", 3, 1},
+		{Integer, "1", 3, 16},
+		{Key, "other", 4, 1},
+		{String, "x", 4, 7},
+		{EOF, "", 4, 0},
+	})
+}
+
+func TestDirectiveValue(t *testing.T) {
+	lx := New("users = load_csv 'users.csv'\nroutes = [load_jsonl r.jsonl]\nname = load_csv\n")
+	lx.SetDirectives(func(name string) bool { return name == "load_csv" || name == "load_jsonl" })
+	expect(t, lx, []Item{
+		{Key, "users", 1, 0},
+		{Directive, "load_csv users.csv", 1, 18},
+		{Key, "routes", 2, 1},
+		{ArrayStart, "", 2, 11},
+		{Directive, "load_jsonl r.jsonl", 2, 22},
+		{ArrayEnd, "", 2, 30},
+		{Key, "name", 3, 1},
+		{String, "load_csv", 3, 8},
+		{EOF, "", 4, 0},
+	})
+}
@@ -0,0 +1,100 @@
+package conf
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// WithMaxBytes limits the total size of a config and all the include
+// files it pulls in. Parsing fails with a *LimitError once more than n
+// bytes were read.
+func WithMaxBytes(n int64) Option {
+	return func(o *options) {
+		o.maxBytes = n
+	}
+}
+
+// WithMaxIncludes limits how many include files a config may pull in,
+// counting every include, nested or repeated. Parsing fails with a
+// *LimitError once more than n includes were processed.
+func WithMaxIncludes(n int) Option {
+	return func(o *options) {
+		o.maxIncludes = n
+	}
+}
+
+// LimitError is returned when a config exceeds a limit set with
+// WithMaxBytes or WithMaxIncludes.
+type LimitError struct {
+	// Limit is "bytes" or "includes".
+	Limit string
+	Max   int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("config exceeds the limit of %d %s", e.Max, e.Limit)
+}
+
+// addBytes counts n more bytes read for the parse.
+func (p *parser) addBytes(n int) error {
+	p.state.bytes += int64(n)
+	if max := p.opts.maxBytes; max > 0 && p.state.bytes > max {
+		return &LimitError{Limit: "bytes", Max: max}
+	}
+	return nil
+}
+
+// readLimit returns how many bytes of a config file to read at most so
+// that it exceeds a limit set with WithMaxBytes, or 0 without one.
+func (o *options) readLimit() int64 {
+	if o.maxBytes > 0 {
+		return o.maxBytes + 1
+	}
+	return 0
+}
+
+// readFile reads the file fp, stopping after limit bytes when limit is
+// above 0, so files beyond a byte limit are not read into memory whole.
+func readFile(fp string, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return os.ReadFile(fp)
+	}
+	f, err := os.Open(fp)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(io.LimitReader(f, limit))
+}
+
+// readLimit returns how many bytes of a file to read at most so that the
+// parse exceeds a limit set with WithMaxBytes, or 0 without one.
+func (p *parser) readLimit() int64 {
+	if n := p.opts.maxBytes; n > 0 {
+		return max(n-p.state.bytes, 0) + 1
+	}
+	return 0
+}
+
+// readCounted reads the file fp for the parse, no further than past the
+// limit of WithMaxBytes, and counts the bytes read.
+func (p *parser) readCounted(fp string) ([]byte, error) {
+	data, err := readFile(fp, p.readLimit())
+	if err != nil {
+		return nil, err
+	}
+	if err := p.addBytes(len(data)); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// addInclude counts one more include file for the parse.
+func (p *parser) addInclude() error {
+	p.state.includes++
+	if max := p.opts.maxIncludes; max > 0 && p.state.includes > max {
+		return &LimitError{Limit: "includes", Max: int64(max)}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package conf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMaxIncludes(t *testing.T) {
+	// Every level includes the next one twice, doubling the work.
+	files := map[string]string{"l5.conf": "v = 1"}
+	for i := 0; i < 5; i++ {
+		next := "l" + string(rune('1'+i)) + ".conf"
+		files["l"+string(rune('0'+i))+".conf"] = "a = include '" + next + "'\nb = include '" + next + "'"
+	}
+	r := mapResolver(files)
+
+	if _, err := Parse("include 'l0.conf'", WithIncludeResolver(r), WithMaxIncludes(63)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err := Parse("include 'l0.conf'", WithIncludeResolver(r), WithMaxIncludes(62))
+	var le *LimitError
+	if !errors.As(err, &le) || le.Limit != "includes" || le.Max != 62 {
+		t.Fatalf("Expected includes *LimitError, got %v", err)
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	r := mapResolver(map[string]string{"big.conf": "v = \"" + strings.Repeat("x", 100) + "\""})
+	data := "include 'big.conf'"
+	if _, err := Parse(data, WithIncludeResolver(r), WithMaxBytes(200)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, max := range []int64{10, 100} {
+		_, err := Parse(data, WithIncludeResolver(r), WithMaxBytes(max))
+		var le *LimitError
+		if !errors.As(err, &le) || le.Limit != "bytes" || le.Max != max {
+			t.Fatalf("Expected bytes *LimitError, got %v", err)
+		}
+	}
+	if _, err := ParseWithChecks(data, WithIncludeResolver(r), WithMaxBytes(100)); err == nil ||
+		err.Error() != "config exceeds the limit of 100 bytes (:1:9)" {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestMaxBytesCachedInclude(t *testing.T) {
+	dir := t.TempDir()
+	big := "v = \"" + strings.Repeat("x", 100) + "\""
+	if err := os.WriteFile(filepath.Join(dir, "big.conf"), []byte(big), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "mid.conf"), []byte("include 'big.conf'"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fp := filepath.Join(dir, "main.conf")
+	if err := os.WriteFile(fp, []byte("include 'mid.conf'"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := NewIncludeCache()
+	if _, err := ParseFile(fp, WithIncludeCache(cache)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, opt := range []Option{WithMaxBytes(100), WithMaxIncludes(1)} {
+		if _, err := ParseFile(fp, WithIncludeCache(cache), opt); !errors.As(err, new(*LimitError)) {
+			t.Fatalf("Expected *LimitError for a cached include, got %v", err)
+		}
+	}
+	if s := cache.Stats(); s.Hits != 2 {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", s.Hits, 2)
+	}
+}
+
+func TestReadFileLimit(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "big.conf")
+	if err := os.WriteFile(fp, []byte(strings.Repeat("x", 1000)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	data, err := readFile(fp, 11)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(data) != 11 {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", len(data), 11)
+	}
+	_, err = ParseFile(fp, WithMaxBytes(10))
+	var le *LimitError
+	if !errors.As(err, &le) || le.Limit != "bytes" {
+		t.Fatalf("Expected bytes *LimitError, got %v", err)
+	}
+}
+
+func TestMaxBytesFiles(t *testing.T) {
+	dir := t.TempDir()
+	big := strings.Repeat("x", 100000)
+	writeTestFile(t, filepath.Join(dir, "big.txt"), big)
+	writeTestFile(t, filepath.Join(dir, "big.csv"), "name\n"+big+"\n")
+	for name, data := range map[string]string{
+		"func.conf":      `a = file("big.txt")`,
+		"directive.conf": "users = load_csv big.csv",
+		"sidecar.conf":   "a = 1",
+	} {
+		fp := filepath.Join(dir, name)
+		writeTestFile(t, fp, data)
+		if name == "sidecar.conf" {
+			writeTestFile(t, filepath.Join(dir, "sidecar.schema"), "a: int # "+big)
+		}
+		if _, err := ParseFile(fp); err != nil {
+			t.Fatalf("Unexpected error for %s: %v", name, err)
+		}
+		var le *LimitError
+		if _, err := ParseFile(fp, WithMaxBytes(1000)); !errors.As(err, &le) || le.Limit != "bytes" {
+			t.Fatalf("Expected bytes *LimitError for %s, got %v", name, err)
+		}
+	}
+}
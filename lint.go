@@ -0,0 +1,187 @@
+package conf
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Finding is a problem reported by a lint Rule.
+type Finding struct {
+	Rule    string
+	Path    string
+	File    string
+	Line    int
+	Pos     int
+	Message string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s [%s] (%s:%d:%d)", f.Path, f.Message, f.Rule, f.File, f.Line, f.Pos)
+}
+
+// NewFinding returns a finding for the value t at path, e.g. for custom
+// rules passed to Lint.
+func NewFinding(path string, t *Token, format string, args ...any) Finding {
+	return Finding{
+		Path:    path,
+		File:    t.SourceFile(),
+		Line:    t.Line(),
+		Pos:     t.Position(),
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// Rule checks a config from a parse with checks, whose values carry the
+// position they were defined at, and reports the problems it finds.
+type Rule interface {
+	Name() string
+	Check(m map[string]any, report func(Finding))
+}
+
+type funcRule struct {
+	name string
+	fn   func(m map[string]any, report func(Finding))
+}
+
+func (r funcRule) Name() string {
+	return r.name
+}
+
+func (r funcRule) Check(m map[string]any, report func(Finding)) {
+	r.fn(m, report)
+}
+
+// RuleFunc returns a Rule with the given name that checks configs with fn.
+func RuleFunc(name string, fn func(m map[string]any, report func(Finding))) Rule {
+	return funcRule{name, fn}
+}
+
+// The built-in rules. DeprecatedKeys needs the deprecations to check for
+// and is not part of DefaultRules.
+var (
+	// DuplicateKeys reports keys set more than once in the same map.
+	// Keys replacing values copied from an include file or a map spread
+	// are overrides, not duplicates.
+	DuplicateKeys = RuleFunc("duplicate-keys", checkDuplicateKeys)
+
+	// UnusedVariables reports upper case keys, the convention for values
+	// meant to be referenced as variables, that are never referenced.
+	UnusedVariables = RuleFunc("unused-variables", checkUnusedVariables)
+
+	// SuspiciousBools reports quoted strings that read as bools, such as
+	// "true" or "off", which were likely meant as bools.
+	SuspiciousBools = RuleFunc("suspicious-bools", checkSuspiciousBools)
+
+	// UnquotedIPv6 reports arrays holding a single IPv6 address, which is
+	// what an unquoted bracketed address such as [::1] parses to.
+	UnquotedIPv6 = RuleFunc("unquoted-ipv6", checkUnquotedIPv6)
+
+	// DefaultRules are the rules Lint checks when given none.
+	DefaultRules = []Rule{DuplicateKeys, UnusedVariables, SuspiciousBools, UnquotedIPv6}
+)
+
+// DeprecatedKeys reports keys that are set under a deprecated key path.
+func DeprecatedKeys(deps map[string]Deprecation) Rule {
+	canonical := make(map[string]Deprecation, len(deps))
+	for path, d := range deps {
+		canonical[canonicalPath(path)] = d
+	}
+	return RuleFunc("deprecated-keys", func(m map[string]any, report func(Finding)) {
+		WalkTokens(m, func(path string, t *Token) {
+			d, ok := canonical[path]
+			if !ok {
+				return
+			}
+			msg := "key is deprecated"
+			if d.NewKey != "" {
+				msg += fmt.Sprintf(", use '%s' instead", canonicalPath(d.NewKey))
+			}
+			report(NewFinding(path, t, "%s%s", msg, d.suffix()))
+		})
+	})
+}
+
+// Lint checks m, from a parse with checks, with the given rules, or with
+// DefaultRules if there are none. Findings are sorted by position.
+func Lint(m map[string]any, rules ...Rule) []Finding {
+	if len(rules) == 0 {
+		rules = DefaultRules
+	}
+	var findings []Finding
+	for _, r := range rules {
+		r.Check(m, func(f Finding) {
+			if f.Rule == "" {
+				f.Rule = r.Name()
+			}
+			findings = append(findings, f)
+		})
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Pos < b.Pos
+	})
+	return findings
+}
+
+func checkDuplicateKeys(m map[string]any, report func(Finding)) {
+	WalkTokens(m, func(path string, t *Token) {
+		for prev := t.Replaced(); prev != nil && !t.merged && !prev.merged; prev = prev.Replaced() {
+			report(NewFinding(path, t, "key was already set at %s:%d:%d", prev.SourceFile(), prev.Line(), prev.Position()))
+			t = prev
+		}
+	})
+}
+
+func checkUnusedVariables(m map[string]any, report func(Finding)) {
+	WalkTokens(m, func(path string, t *Token) {
+		elems, err := parsePath(path)
+		if err != nil || len(elems) == 0 || t.IsUsedVariable() {
+			return
+		}
+		if last := elems[len(elems)-1]; !last.isIdx && isVariableName(last.key) {
+			report(NewFinding(path, t, "variable '%s' is never referenced", last.key))
+		}
+	})
+}
+
+// isVariableName reports whether key is written in upper case, with at
+// least one letter.
+func isVariableName(key string) bool {
+	return strings.ContainsFunc(key, unicode.IsUpper) && !strings.ContainsFunc(key, unicode.IsLower)
+}
+
+func checkSuspiciousBools(m map[string]any, report func(Finding)) {
+	WalkTokens(m, func(path string, t *Token) {
+		s, ok := t.Value().(string)
+		if !ok {
+			return
+		}
+		switch strings.ToLower(s) {
+		case "true", "false", "yes", "no", "on", "off":
+			report(NewFinding(path, t, "string '%s' reads as a bool, remove the quotes if a bool is meant", s))
+		}
+	})
+}
+
+func checkUnquotedIPv6(m map[string]any, report func(Finding)) {
+	WalkTokens(m, func(path string, t *Token) {
+		arr, ok := t.Value().([]any)
+		if !ok || len(arr) != 1 {
+			return
+		}
+		s, ok := plainValue(arr[0]).(string)
+		if !ok || !strings.Contains(s, ":") || net.ParseIP(s) == nil {
+			return
+		}
+		report(NewFinding(path, t, "array holds just the IPv6 address '%s', quote '[%s]' if an address is meant", s, s))
+	})
+}
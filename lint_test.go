@@ -0,0 +1,96 @@
+package conf
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	data := `
+		PASS = secret
+		UNUSED = 1
+		port = 4222
+		debug = "true"
+		listen = [::1]
+		users = [{user: a, password: $PASS}]
+		server {
+			port = 1
+			port = 2
+		}
+		port = 4333
+	`
+	m, err := ParseWithChecks(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var got []string
+	for _, f := range Lint(m) {
+		got = append(got, f.String())
+	}
+	expected := []string{
+		"UNUSED: variable 'UNUSED' is never referenced [unused-variables] (:3:3)",
+		"debug: string 'true' reads as a bool, remove the quotes if a bool is meant [suspicious-bools] (:5:3)",
+		"listen: array holds just the IPv6 address '::1', quote '[::1]' if an address is meant [unquoted-ipv6] (:6:3)",
+		"server.port: key was already set at :9:4 [duplicate-keys] (:10:4)",
+		"port: key was already set at :4:3 [duplicate-keys] (:12:3)",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", got, expected)
+	}
+}
+
+func TestLintOverridesAreNotDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "base.conf"), []byte("port = 4222\nhost = a"), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	main := filepath.Join(dir, "main.conf")
+	data := `
+		include base.conf
+		port = 4333
+		defaults { verify = true }
+		server { $defaults...; verify = false }
+	`
+	if err := os.WriteFile(main, []byte(data), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	m, err := ParseFileWithChecks(main)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if findings := Lint(m, DuplicateKeys); len(findings) != 0 {
+		t.Fatalf("Expected no findings, got: %v", findings)
+	}
+	if tk := m["port"].(*Token); tk.Replaced() == nil || tk.Replaced().Value() != int64(4222) {
+		t.Fatalf("Expected the included port to be recorded as replaced, got: %+v", tk.Replaced())
+	}
+}
+
+func TestLintCustomRules(t *testing.T) {
+	m, err := ParseWithChecks("listen = 4222\ncluster { listen = 6222 }")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	noPorts := RuleFunc("no-bare-ports", func(m map[string]any, report func(Finding)) {
+		WalkTokens(m, func(path string, tk *Token) {
+			if _, ok := tk.Value().(int64); ok {
+				report(NewFinding(path, tk, "listen on an address, not just a port"))
+			}
+		})
+	})
+	deprecated := DeprecatedKeys(map[string]Deprecation{"cluster.listen": {NewKey: "cluster.bind"}})
+	var got []string
+	for _, f := range Lint(m, noPorts, deprecated) {
+		got = append(got, f.String())
+	}
+	expected := []string{
+		"listen: listen on an address, not just a port [no-bare-ports] (:1:0)",
+		"cluster.listen: listen on an address, not just a port [no-bare-ports] (:2:11)",
+		"cluster.listen: key is deprecated, use 'cluster.bind' instead [deprecated-keys] (:2:11)",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", got, expected)
+	}
+}
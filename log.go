@@ -0,0 +1,25 @@
+package conf
+
+import (
+	"context"
+	"log/slog"
+)
+
+// WithLogger makes the parser emit debug events to l for include
+// resolution, variable lookups, environment variable fallbacks and
+// duplicate keys. Each event carries the file and line it relates to.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// debug logs a debug event at the position of it.
+func (p *parser) debug(it item, msg string, args ...any) {
+	l := p.opts.logger
+	if l == nil || !l.Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
+	args = append(args, "file", p.file, "line", it.Line, "pos", it.Pos)
+	l.Debug(msg, args...)
+}
@@ -0,0 +1,51 @@
+package conf
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWithLogger(t *testing.T) {
+	dir := t.TempDir()
+	main := filepath.Join(dir, "main.conf")
+	data := "port = 1\nport = 2\nlimit = $port\ninclude 'inc.conf'\nhome = $__CONF_LOG_TEST__\n"
+	if err := os.WriteFile(main, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "inc.conf"), []byte("name = x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("__CONF_LOG_TEST__", "/home/x")
+
+	var buf bytes.Buffer
+	l := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	if _, err := ParseFile(main, WithLogger(l)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out := buf.String()
+	for _, ex := range []string{
+		`msg="duplicate key" key=port`,
+		`msg="variable resolved" name=port depth=1`,
+		`msg="resolving include" include=inc.conf`,
+		`msg="variable resolved from environment" name=__CONF_LOG_TEST__`,
+		"line=3",
+	} {
+		if !strings.Contains(out, ex) {
+			t.Errorf("Expected log to contain %q:\n%s", ex, out)
+		}
+	}
+
+	// Nothing is logged above debug level.
+	buf.Reset()
+	l = slog.New(slog.NewTextHandler(&buf, nil))
+	if _, err := ParseFile(main, WithLogger(l)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("Expected no output, got:\n%s", buf.String())
+	}
+}
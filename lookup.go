@@ -0,0 +1,174 @@
+package conf
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pathElem is one level of a key path, either a map key or an array index.
+type pathElem struct {
+	key   string
+	index int
+	isIdx bool
+	// wildcard is an unquoted * key or a [*] index, matching every key
+	// or element for Set and Delete.
+	wildcard bool
+}
+
+// parsePath splits a key path such as "cluster.routes[2].url" into its
+// elements. Keys containing dots, brackets or quotes are double quoted, as
+// in `routes."nats.>"`.
+func parsePath(path string) ([]pathElem, error) {
+	if path == "" {
+		return nil, nil
+	}
+	var elems []pathElem
+	rest := path
+	for {
+		key, after, ok := cutKey(rest)
+		if !ok {
+			return nil, fmt.Errorf("invalid key path '%s'", path)
+		}
+		elems = append(elems, pathElem{key: key, wildcard: rest[:len(rest)-len(after)] == "*"})
+		rest = after
+		for strings.HasPrefix(rest, "[") {
+			idx, after, ok := strings.Cut(rest[1:], "]")
+			if !ok {
+				return nil, fmt.Errorf("invalid key path '%s'", path)
+			}
+			if idx == "*" {
+				elems = append(elems, pathElem{index: -1, isIdx: true, wildcard: true})
+				rest = after
+				continue
+			}
+			n, err := strconv.Atoi(idx)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid array index '%s' in key path '%s'", idx, path)
+			}
+			elems = append(elems, pathElem{index: n, isIdx: true})
+			rest = after
+		}
+		if rest == "" {
+			return elems, nil
+		}
+		if rest[0] != '.' {
+			return nil, fmt.Errorf("invalid key path '%s'", path)
+		}
+		rest = rest[1:]
+	}
+}
+
+// cutKey cuts the key off the start of a key path.
+func cutKey(path string) (key, rest string, ok bool) {
+	if !strings.HasPrefix(path, `"`) {
+		i := strings.IndexAny(path, ".[")
+		if i < 0 {
+			i = len(path)
+		}
+		return path[:i], path[i:], i > 0
+	}
+	for i := 1; i < len(path); i++ {
+		switch path[i] {
+		case '\\':
+			i++
+		case '"':
+			key, err := strconv.Unquote(path[:i+1])
+			return key, path[i+1:], err == nil
+		}
+	}
+	return "", "", false
+}
+
+// quoteKey returns key as written in a key path.
+func quoteKey(key string) string {
+	if key == "" || strings.ContainsAny(key, `.[]"`) {
+		return strconv.Quote(key)
+	}
+	return key
+}
+
+// pathKeys splits a key path without array indexes into its keys.
+func pathKeys(path string) ([]string, error) {
+	elems, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(elems) == 0 {
+		return nil, fmt.Errorf("empty key path")
+	}
+	keys := make([]string, len(elems))
+	for i, e := range elems {
+		if e.isIdx {
+			return nil, fmt.Errorf("unexpected array index in key path '%s'", path)
+		}
+		keys[i] = e.key
+	}
+	return keys, nil
+}
+
+// canonicalPath returns path with keys quoted only where needed, the way
+// paths are reported while parsing.
+func canonicalPath(path string) string {
+	elems, err := parsePath(path)
+	if err != nil {
+		return path
+	}
+	return formatPath(elems)
+}
+
+// formatPath joins the elements of a key path in the notation of Lookup.
+func formatPath(elems []pathElem) string {
+	var sb strings.Builder
+	for _, e := range elems {
+		if e.isIdx {
+			if e.wildcard {
+				sb.WriteString("[*]")
+			} else {
+				fmt.Fprintf(&sb, "[%d]", e.index)
+			}
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteByte('.')
+		}
+		sb.WriteString(quoteKey(e.key))
+	}
+	return sb.String()
+}
+
+// Lookup returns the value at the key path in m. Levels are separated by
+// dots and array elements are addressed by index, as in
+// "cluster.routes[2]". Keys containing dots are quoted, as in
+// `routes."nats.>".url`. Tokens from a pedantic parse are returned as is.
+// An empty path returns m itself. Paths with wildcards are not found.
+func Lookup(m map[string]any, path string) (any, bool) {
+	elems, err := parsePath(path)
+	if err != nil {
+		return nil, false
+	}
+	var v any = m
+	for _, e := range elems {
+		if e.wildcard {
+			return nil, false
+		}
+		switch c := plainValue(v).(type) {
+		case map[string]any:
+			if e.isIdx {
+				return nil, false
+			}
+			var ok bool
+			if v, ok = c[e.key]; !ok {
+				return nil, false
+			}
+		case []any:
+			if !e.isIdx || e.index >= len(c) {
+				return nil, false
+			}
+			v = c[e.index]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
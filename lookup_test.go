@@ -0,0 +1,67 @@
+package conf
+
+import (
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	m, err := ParseWithChecks(`
+		cluster {
+			name = c1
+			routes = [ { url = "nats://a" }, { url = "nats://b" } ]
+		}
+	`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, tt := range []struct {
+		path string
+		ex   any
+		ok   bool
+	}{
+		{"cluster.name", "c1", true},
+		{"cluster.routes[1].url", "nats://b", true},
+		{"cluster.routes[2].url", nil, false},
+		{"cluster.missing", nil, false},
+		{"cluster.name.x", nil, false},
+		{"cluster[0]", nil, false},
+		{"cluster..name", nil, false},
+	} {
+		v, ok := Lookup(m, tt.path)
+		if ok != tt.ok || plainValue(v) != tt.ex {
+			t.Errorf("Lookup(%q) = %v, %v; expected %v, %v", tt.path, v, ok, tt.ex, tt.ok)
+		}
+	}
+	quoted, err := Parse(`
+		routes {
+			"nats.>" { url = "nats://a" }
+			"path /api" = [1, 2
+			]
+			'say "hi"' = 3
+		}
+	`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, tt := range []struct {
+		path string
+		ex   any
+		ok   bool
+	}{
+		{`routes."nats.>".url`, "nats://a", true},
+		{`"routes"."nats.>"."url"`, "nats://a", true},
+		{`routes.path /api[1]`, int64(2), true},
+		{`routes."say \"hi\""`, int64(3), true},
+		{`routes.nats.>.url`, nil, false},
+		{`routes."nats.>`, nil, false},
+		{`routes."nats.>"x`, nil, false},
+	} {
+		v, ok := Lookup(quoted, tt.path)
+		if ok != tt.ok || v != tt.ex {
+			t.Errorf("Lookup(%q) = %v, %v; expected %v, %v", tt.path, v, ok, tt.ex, tt.ok)
+		}
+	}
+	if v, ok := Lookup(m, ""); !ok || v.(map[string]any)["cluster"] == nil {
+		t.Errorf("Expected empty path to return the whole config")
+	}
+}
@@ -0,0 +1,247 @@
+package conf
+
+import (
+	"bytes"
+	"encoding"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MarshalStruct encodes the struct v, or a pointer to one, in the conf
+// format, so settings changed at runtime can be saved in the format they
+// are loaded from. Fields are written in their order, under the key named
+// by their conf tag, or the snake case of their name as with confgen:
+//
+//	type Server struct {
+//		Port    int           `conf:"port" comment:"Client port"`
+//		Timeout time.Duration `conf:",omitempty"`
+//		Secret  string        `conf:"-"`
+//	}
+//
+// Fields tagged omitempty are left out when they hold their zero value or
+// an empty slice or map, and nil pointers and interfaces always are. The
+// comment tag is written as a comment above the key, with a line of its
+// own for every line of it. The fields of embedded structs are written as
+// fields of the struct embedding them, and struct fields as nested maps.
+//
+// Durations are written as strings such as "1m30s" and values implementing
+// encoding.TextMarshaler as the string they marshal to.
+func MarshalStruct(v any) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("can not marshal %T, expected a struct", v)
+	}
+	var buf bytes.Buffer
+	if err := encodeStruct(&buf, rv, 0); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// structField is a field of a struct as MarshalStruct writes it.
+type structField struct {
+	key       string
+	comment   string
+	omitEmpty bool
+	value     reflect.Value
+}
+
+// structFields returns the fields of the struct rv to write, with those of
+// embedded structs in place.
+func structFields(rv reflect.Value) []structField {
+	var fields []structField
+	rt := rv.Type()
+	for i := range rt.NumField() {
+		f := rt.Field(i)
+		tag, hasTag := f.Tag.Lookup("conf")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		fv := rv.Field(i)
+		if f.Anonymous && !hasTag {
+			if fv.Kind() == reflect.Pointer {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				fields = append(fields, structFields(fv)...)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = SnakeCaseKeys(f.Name)
+		}
+		fields = append(fields, structField{
+			key:       name,
+			comment:   f.Tag.Get("comment"),
+			omitEmpty: opts == "omitempty",
+			value:     fv,
+		})
+	}
+	return fields
+}
+
+func encodeStruct(buf *bytes.Buffer, rv reflect.Value, depth int) error {
+	indent := strings.Repeat(encodeIndent, depth)
+	for _, f := range structFields(rv) {
+		fv := f.value
+		if f.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		for fv.Kind() == reflect.Pointer || fv.Kind() == reflect.Interface {
+			if fv.IsNil() {
+				break
+			}
+			fv = fv.Elem()
+		}
+		if (fv.Kind() == reflect.Pointer || fv.Kind() == reflect.Interface) && fv.IsNil() {
+			continue
+		}
+		ek, err := encodeKey(f.key)
+		if err != nil {
+			return err
+		}
+		if f.comment != "" {
+			for _, line := range strings.Split(f.comment, "\n") {
+				buf.WriteString(strings.TrimRight(indent+"# "+line, " "))
+				buf.WriteByte('\n')
+			}
+		}
+		buf.WriteString(indent)
+		buf.WriteString(ek)
+		if fv.Kind() == reflect.Struct && !isTextValue(fv) {
+			buf.WriteString(" {\n")
+			if err := encodeStruct(buf, fv, depth+1); err != nil {
+				return err
+			}
+			buf.WriteString(indent)
+			buf.WriteString("}\n")
+			continue
+		}
+		v, err := goValue(fv)
+		if err != nil {
+			return fmt.Errorf("key '%s': %v", f.key, err)
+		}
+		buf.WriteString(": ")
+		if err := encodeValue(buf, v, depth); err != nil {
+			return fmt.Errorf("key '%s': %v", f.key, err)
+		}
+		buf.WriteByte('\n')
+	}
+	return nil
+}
+
+// isTextValue reports whether rv is written as a value of its own rather
+// than as a map of its fields.
+func isTextValue(rv reflect.Value) bool {
+	if _, ok := rv.Interface().(time.Time); ok {
+		return true
+	}
+	_, ok := rv.Interface().(encoding.TextMarshaler)
+	return ok
+}
+
+// isEmptyValue reports whether rv is left out by omitempty.
+func isEmptyValue(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map:
+		return rv.Len() == 0
+	}
+	return rv.IsZero()
+}
+
+// goValue converts rv to the types of a parsed config.
+func goValue(rv reflect.Value) (any, error) {
+	if !rv.IsValid() {
+		return nil, fmt.Errorf("can not encode nil")
+	}
+	switch v := rv.Interface().(type) {
+	case time.Duration:
+		return v.String(), nil
+	case time.Time:
+		return v, nil
+	case []byte:
+		return v, nil
+	case encoding.TextMarshaler:
+		text, err := v.MarshalText()
+		return string(text), err
+	}
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return nil, fmt.Errorf("can not encode nil")
+		}
+		return goValue(rv.Elem())
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Bool:
+		return rv.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if rv.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("can not encode integer %d", rv.Uint())
+		}
+		return int64(rv.Uint()), nil
+	case reflect.Float32:
+		// Keep the shortest decimal of the float32, 0.1 rather than the
+		// digits of its float64 conversion.
+		return strconv.ParseFloat(strconv.FormatFloat(rv.Float(), 'g', -1, 32), 64)
+	case reflect.Float64:
+		return rv.Float(), nil
+	case reflect.Slice, reflect.Array:
+		a := make([]any, 0, rv.Len())
+		for i := range rv.Len() {
+			e, err := goValue(rv.Index(i))
+			if err != nil {
+				return nil, fmt.Errorf("index %d: %v", i, err)
+			}
+			a = append(a, e)
+		}
+		return a, nil
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("can not encode map with %s keys", rv.Type().Key())
+		}
+		m := make(map[string]any, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			e, err := goValue(iter.Value())
+			if err != nil {
+				return nil, fmt.Errorf("key '%s': %v", iter.Key().String(), err)
+			}
+			m[iter.Key().String()] = e
+		}
+		return m, nil
+	case reflect.Struct:
+		m := make(map[string]any)
+		for _, f := range structFields(rv) {
+			if f.omitEmpty && isEmptyValue(f.value) {
+				continue
+			}
+			if (f.value.Kind() == reflect.Pointer || f.value.Kind() == reflect.Interface) && f.value.IsNil() {
+				continue
+			}
+			e, err := goValue(f.value)
+			if err != nil {
+				return nil, fmt.Errorf("key '%s': %v", f.key, err)
+			}
+			m[f.key] = e
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("can not encode value of type %s", rv.Type())
+}
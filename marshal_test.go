@@ -0,0 +1,95 @@
+package conf
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type marshalLimits struct {
+	MaxConn int `comment:"Per client"`
+}
+
+type marshalServer struct {
+	marshalLimits
+	Host     string        `comment:"Address to listen on.\nUse 0.0.0.0 for all."`
+	Port     uint16        `conf:"port"`
+	Debug    bool          `conf:",omitempty"`
+	Ratio    float32       `conf:"ratio"`
+	Timeout  time.Duration `conf:"timeout,omitempty"`
+	Started  time.Time
+	Addr     netip.Addr
+	TLS      *marshalTLS `comment:"TLS settings"`
+	NoTLS    *marshalTLS
+	Routes   []marshalTLS
+	Tags     map[string]string `conf:",omitempty"`
+	Secret   string            `conf:"-"`
+	internal string
+}
+
+type marshalTLS struct {
+	Cert string `conf:"cert"`
+}
+
+func TestMarshalStruct(t *testing.T) {
+	v := &marshalServer{
+		marshalLimits: marshalLimits{MaxConn: 10},
+		Host:          "localhost",
+		Port:          4222,
+		Ratio:         0.1,
+		Timeout:       90 * time.Second,
+		Started:       time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Addr:          netip.MustParseAddr("10.0.0.1"),
+		TLS:           &marshalTLS{Cert: "a.pem"},
+		Routes:        []marshalTLS{{Cert: "b.pem"}},
+		Secret:        "s3cr3t",
+		internal:      "x",
+	}
+	out, err := MarshalStruct(v)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `# Per client
+max_conn: 10
+# Address to listen on.
+# Use 0.0.0.0 for all.
+host: "localhost"
+port: 4222
+ratio: 0.1
+timeout: "1m30s"
+started: 2024-01-02T03:04:05Z
+addr: "10.0.0.1"
+# TLS settings
+tls {
+  cert: "a.pem"
+}
+routes: [
+  {
+    cert: "b.pem"
+  }
+]
+`
+	if string(out) != expected {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", string(out), expected)
+	}
+
+	m, err := Parse(string(out))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(m["tls"], map[string]any{"cert": "a.pem"}) || m["ratio"] != 0.1 {
+		t.Fatalf("Unexpected config: %+v", m)
+	}
+
+	for _, bad := range []any{
+		42,
+		struct{ C chan int }{make(chan int)},
+		struct{ M map[int]string }{map[int]string{1: "a"}},
+		struct{ U uint64 }{1 << 63},
+	} {
+		if _, err := MarshalStruct(bad); err == nil {
+			t.Fatalf("Expected an error for %T", bad)
+		}
+	}
+}
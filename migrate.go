@@ -0,0 +1,177 @@
+package conf
+
+import (
+	"fmt"
+	"os"
+)
+
+// Migration upgrades configs of the version before it to its version.
+type Migration struct {
+	// Version is the version of configs after the migration, counting up
+	// from 1.
+	Version     int64
+	Description string
+	Migrate     func(m map[string]any) error
+}
+
+// Migrator upgrades configs written for earlier versions of an application
+// by applying its migrations in order, such as renaming keys, splitting
+// blocks or converting units:
+//
+//	mg, err := conf.NewMigrator("config_version",
+//		conf.Migration{Version: 1, Description: "rename port", Migrate: func(m map[string]any) error {
+//			return conf.Move(m, "port", "listen.port")
+//		}},
+//		conf.Migration{Version: 2, Description: "timeouts in seconds", Migrate: func(m map[string]any) error {
+//			if ms, ok := m["timeout_ms"].(int64); ok {
+//				delete(m, "timeout_ms")
+//				return conf.Set(m, "timeout", fmt.Sprintf("%ds", ms/1000))
+//			}
+//			return nil
+//		}},
+//	)
+//
+// The version of a config is the integer at the version key, and configs
+// without one are at version 0.
+type Migrator struct {
+	key        string
+	migrations []Migration
+}
+
+// NewMigrator returns a Migrator recording the version of configs at the
+// key path key. Migrations must be given in the order of their versions,
+// which must be unique and above 0.
+func NewMigrator(key string, migrations ...Migration) (*Migrator, error) {
+	if _, err := parsePath(key); err != nil || key == "" {
+		return nil, fmt.Errorf("invalid version key '%s'", key)
+	}
+	var last int64
+	for _, mg := range migrations {
+		if mg.Version <= last {
+			return nil, fmt.Errorf("migration %d must have a version above %d", mg.Version, last)
+		}
+		if mg.Migrate == nil {
+			return nil, fmt.Errorf("migration %d has no function", mg.Version)
+		}
+		last = mg.Version
+	}
+	return &Migrator{key: key, migrations: migrations}, nil
+}
+
+// Latest returns the version of configs after all migrations.
+func (mg *Migrator) Latest() int64 {
+	if len(mg.migrations) == 0 {
+		return 0
+	}
+	return mg.migrations[len(mg.migrations)-1].Version
+}
+
+// Version returns the version recorded in m.
+func (mg *Migrator) Version(m map[string]any) (int64, error) {
+	v, ok := Lookup(m, mg.key)
+	if !ok {
+		return 0, nil
+	}
+	if tk, ok := v.(*Token); ok {
+		v = tk.Value()
+	}
+	version, ok := v.(int64)
+	if !ok || version < 0 {
+		return 0, fmt.Errorf("invalid config version %v at key '%s'", v, mg.key)
+	}
+	return version, nil
+}
+
+// Migrate returns a copy of m with the migrations above its version
+// applied and the latest version recorded, along with the migrations
+// applied. m is left unchanged. A config of a version above the latest
+// one fails, as it was written for a newer application.
+func (mg *Migrator) Migrate(m map[string]any) (map[string]any, []Migration, error) {
+	version, err := mg.Version(m)
+	if err != nil {
+		return nil, nil, err
+	}
+	if version > mg.Latest() {
+		return nil, nil, fmt.Errorf("config version %d is newer than the latest version %d", version, mg.Latest())
+	}
+	out := stripValue(m).(map[string]any)
+	var applied []Migration
+	for _, migration := range mg.migrations {
+		if migration.Version <= version {
+			continue
+		}
+		if err := migration.Migrate(out); err != nil {
+			return nil, nil, fmt.Errorf("migration %d (%s): %v", migration.Version, migration.Description, err)
+		}
+		applied = append(applied, migration)
+	}
+	if len(applied) > 0 {
+		if err := Set(out, mg.key, mg.Latest()); err != nil {
+			return nil, nil, err
+		}
+	}
+	return out, applied, nil
+}
+
+// MigrateFile migrates the config file fp, parsed with opts, and rewrites
+// it as Marshal encodes the migrated config when migrations were applied,
+// returning them. Comments and formatting are lost. The file is replaced
+// through a temporary file, so it is never left partially written.
+//
+// Only files that hold the whole config as written are rewritten. Files
+// that include or read other files, refer to variables or environment
+// variables, or need decrypting or converting before they are parsed are
+// refused, since rewriting them would write out the values pulled in, such
+// as the secret of password = $DB_PASSWORD, in plain text.
+func (mg *Migrator) MigrateFile(fp string, opts ...Option) ([]Migration, error) {
+	raw, err := os.ReadFile(fp)
+	if err != nil {
+		return nil, &OpenError{Path: fp, Err: err}
+	}
+	if input, err := newOptions(opts).prepareInput(fp, string(raw)); err != nil || input != string(raw) {
+		return nil, fmt.Errorf("can not migrate %s: the file is encrypted or encoded", fp)
+	}
+	r, err := Load(fp, opts...)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(r.Files) > 1:
+		return nil, fmt.Errorf("can not migrate %s: it reads the file %s", fp, r.Files[1])
+	case len(r.EnvVars) > 0:
+		return nil, fmt.Errorf("can not migrate %s: it refers to the environment variable %s", fp, r.EnvVars[0])
+	case len(r.Variables) > 0:
+		return nil, fmt.Errorf("can not migrate %s: it refers to the variable %s", fp, r.Variables[0])
+	}
+	out, applied, err := mg.Migrate(r.Config)
+	if err != nil || len(applied) == 0 {
+		return nil, err
+	}
+	data, err := Marshal(out)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(fp)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFile(fp, data, fi.Mode().Perm()); err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+// Move moves the value at the key path from to the key path to in m, in
+// the notation of Lookup, for migrations renaming keys or moving them
+// between blocks. A value already at to is replaced. Moving a key that is
+// not set does nothing.
+func Move(m map[string]any, from, to string) error {
+	v, ok := Lookup(m, from)
+	if !ok {
+		return nil
+	}
+	if _, err := Delete(m, from); err != nil {
+		return err
+	}
+	return Set(m, to, v)
+}
@@ -0,0 +1,148 @@
+package conf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testMigrator(t *testing.T) *Migrator {
+	mg, err := NewMigrator("config_version",
+		Migration{Version: 1, Description: "move port into listen", Migrate: func(m map[string]any) error {
+			return Move(m, "port", "listen.port")
+		}},
+		Migration{Version: 2, Description: "split tls into server and client", Migrate: func(m map[string]any) error {
+			if err := Move(m, "tls.cert", "tls.server.cert"); err != nil {
+				return err
+			}
+			return Move(m, "tls.ca", "tls.client.ca")
+		}},
+		Migration{Version: 3, Description: "timeout in seconds", Migrate: func(m map[string]any) error {
+			if ms, ok := m["timeout_ms"].(int64); ok {
+				delete(m, "timeout_ms")
+				return Set(m, "timeout", fmt.Sprintf("%ds", ms/1000))
+			}
+			return nil
+		}},
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return mg
+}
+
+func TestMigrator(t *testing.T) {
+	mg := testMigrator(t)
+	m, err := ParseWithChecks("config_version = 1\nlisten { port = 4222 }\ntls { cert = a.pem, ca = ca.pem }\ntimeout_ms = 2000\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	out, applied, err := mg.Migrate(m)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]any{
+		"config_version": int64(3),
+		"listen":         map[string]any{"port": int64(4222)},
+		"tls": map[string]any{
+			"server": map[string]any{"cert": "a.pem"},
+			"client": map[string]any{"ca": "ca.pem"},
+		},
+		"timeout": "2s",
+	}
+	if !reflect.DeepEqual(out, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", out, expected)
+	}
+	if len(applied) != 2 || applied[0].Version != 2 || applied[1].Version != 3 {
+		t.Fatalf("Unexpected migrations applied: %+v", applied)
+	}
+	if _, ok := Lookup(m, "tls.cert"); !ok {
+		t.Fatalf("Expected the config to be left unchanged, got %+v", m)
+	}
+
+	// Configs at the latest version are left as they are.
+	if _, applied, err := mg.Migrate(out); err != nil || len(applied) != 0 {
+		t.Fatalf("Expected no migrations, got %+v, %v", applied, err)
+	}
+}
+
+func TestMigrateFile(t *testing.T) {
+	mg := testMigrator(t)
+	fp := filepath.Join(t.TempDir(), "app.conf")
+	writeTestFile(t, fp, "# old config\nport = 4222\ntimeout_ms = 5000\n")
+	applied, err := mg.MigrateFile(fp)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(applied) != 3 {
+		t.Fatalf("Unexpected migrations applied: %+v", applied)
+	}
+	data, _ := os.ReadFile(fp)
+	expected := "config_version: 3\nlisten {\n  port: 4222\n}\ntimeout: \"5s\"\n"
+	if string(data) != expected {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", string(data), expected)
+	}
+	if applied, err := mg.MigrateFile(fp); err != nil || len(applied) != 0 {
+		t.Fatalf("Expected no migrations, got %+v, %v", applied, err)
+	}
+}
+
+func TestMigrateFileRefused(t *testing.T) {
+	t.Setenv("MIGRATE_DB_PASSWORD", "s3cr3t")
+	mg := testMigrator(t)
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "tls.conf"), "cert = a.pem\n")
+	for data, expected := range map[string]string{
+		"port = 1\npassword = $MIGRATE_DB_PASSWORD\n":         "refers to the environment variable MIGRATE_DB_PASSWORD",
+		"port = 1\npassword = env(\"MIGRATE_DB_PASSWORD\")\n": "refers to the environment variable MIGRATE_DB_PASSWORD",
+		"p = 1\nport = $p\n":                                  "refers to the variable p",
+		"port = 1\ntls { include tls.conf }\n":                "reads the file " + filepath.Join(dir, "tls.conf"),
+		"\xff\xfep\x00=\x001\x00":                             "the file is encrypted or encoded",
+	} {
+		fp := filepath.Join(dir, "app.conf")
+		writeTestFile(t, fp, data)
+		if _, err := mg.MigrateFile(fp); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("Expected error containing %q, got %v", expected, err)
+		}
+		if got, _ := os.ReadFile(fp); string(got) != data {
+			t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", string(got), data)
+		}
+	}
+}
+
+func TestMigratorErrors(t *testing.T) {
+	noop := func(map[string]any) error { return nil }
+	for _, test := range []struct {
+		migrations []Migration
+		err        string
+	}{
+		{[]Migration{{Version: 0, Migrate: noop}}, "migration 0 must have a version above 0"},
+		{[]Migration{{Version: 2, Migrate: noop}, {Version: 1, Migrate: noop}}, "migration 1 must have a version above 2"},
+		{[]Migration{{Version: 1}}, "migration 1 has no function"},
+	} {
+		_, err := NewMigrator("version", test.migrations...)
+		if err == nil || err.Error() != test.err {
+			t.Fatalf("Expected error %q, got %v", test.err, err)
+		}
+	}
+
+	mg := testMigrator(t)
+	for _, test := range []struct {
+		data, err string
+	}{
+		{"config_version = 4", "config version 4 is newer than the latest version 3"},
+		{"config_version = one", "invalid config version one at key 'config_version'"},
+		{"port = 1, listen = 2", "migration 1 (move port into listen): "},
+	} {
+		m, err := Parse(test.data)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, _, err := mg.Migrate(m); err == nil || !strings.HasPrefix(err.Error(), test.err) {
+			t.Fatalf("Expected error %q, got %v", test.err, err)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package conf
+
+import (
+	"strings"
+	"unicode"
+)
+
+// KeyNormalizer maps a key as written in a config file to its canonical form.
+type KeyNormalizer func(key string) string
+
+// WithKeyNormalizer rewrites every key with fn as it is parsed, so keys
+// written in different styles end up under one canonical key. Variable
+// references are normalized the same way before they are looked up, and
+// key paths given to other options refer to the normalized keys.
+func WithKeyNormalizer(fn KeyNormalizer) Option {
+	return func(o *options) {
+		o.normalizeKey = fn
+	}
+}
+
+// LowerCaseKeys normalizes keys to lower case, e.g. "MaxConn" to "maxconn".
+func LowerCaseKeys(key string) string {
+	return strings.ToLower(key)
+}
+
+// SnakeCaseKeys normalizes camel case keys to snake case, e.g.
+// "MaxConnections" and "maxConnections" to "max_connections". Dashes are
+// treated as underscores.
+func SnakeCaseKeys(key string) string {
+	var sb strings.Builder
+	runes := []rune(key)
+	for i, r := range runes {
+		switch {
+		case r == '-':
+			sb.WriteByte('_')
+		case unicode.IsUpper(r):
+			// Start a new word at a lower to upper transition, and at the
+			// last upper case letter of an acronym as in "HTTPPort".
+			if i > 0 && runes[i-1] != '_' && runes[i-1] != '-' &&
+				(unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+					(i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				sb.WriteByte('_')
+			}
+			sb.WriteRune(unicode.ToLower(r))
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// FoldKeys normalizes keys to lower case with underscores and dashes
+// removed, so "MaxConnections", "max_connections" and "maxconnections" are
+// all the same key.
+func FoldKeys(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == '-' {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, key)
+}
+
+func (p *parser) normalizeKey(key string) string {
+	if p.opts.normalizeKey == nil {
+		return key
+	}
+	return p.opts.normalizeKey(key)
+}
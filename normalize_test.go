@@ -0,0 +1,61 @@
+package conf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeyNormalizers(t *testing.T) {
+	for _, tt := range []struct {
+		key, lower, snake, fold string
+	}{
+		{"MaxConnections", "maxconnections", "max_connections", "maxconnections"},
+		{"maxConnections", "maxconnections", "max_connections", "maxconnections"},
+		{"max_connections", "max_connections", "max_connections", "maxconnections"},
+		{"max-connections", "max-connections", "max_connections", "maxconnections"},
+		{"HTTPPort", "httpport", "http_port", "httpport"},
+		{"tls_v13", "tls_v13", "tls_v13", "tlsv13"},
+	} {
+		if got := LowerCaseKeys(tt.key); got != tt.lower {
+			t.Errorf("LowerCaseKeys(%q) = %q, expected %q", tt.key, got, tt.lower)
+		}
+		if got := SnakeCaseKeys(tt.key); got != tt.snake {
+			t.Errorf("SnakeCaseKeys(%q) = %q, expected %q", tt.key, got, tt.snake)
+		}
+		if got := FoldKeys(tt.key); got != tt.fold {
+			t.Errorf("FoldKeys(%q) = %q, expected %q", tt.key, got, tt.fold)
+		}
+	}
+}
+
+func TestParseWithKeyNormalizer(t *testing.T) {
+	data := `
+		MaxConnections = 10
+		Cluster { ListenPort = 6222; Routes = [ { RouteURL = a } ] }
+		port = $Cluster
+	`
+	ex := map[string]any{
+		"max_connections": int64(10),
+		"cluster": map[string]any{
+			"listen_port": int64(6222),
+			"routes":      []any{map[string]any{"route_url": "a"}},
+		},
+	}
+	ex["port"] = ex["cluster"]
+	m, err := Parse(data, WithKeyNormalizer(SnakeCaseKeys))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(m, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, ex)
+	}
+
+	// Different spellings collapse into a single key.
+	m, err = Parse("MaxConn = 1; max_conn = 2; maxconn = 3", WithKeyNormalizer(FoldKeys))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(m, map[string]any{"maxconn": int64(3)}) {
+		t.Fatalf("Unexpected result: %+v", m)
+	}
+}
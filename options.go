@@ -0,0 +1,158 @@
+package conf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Option configures optional parser behavior. Options apply to the whole
+// parse, including every include file it pulls in.
+type Option func(*options)
+
+type options struct {
+	logger           *slog.Logger
+	includeCache     IncludeCache
+	deprecations     map[string]Deprecation
+	version          string
+	warn             func(Warning)
+	normalizeKey     KeyNormalizer
+	tabWidth         int
+	utf16            bool
+	types            map[string]Kind
+	homogeneous      bool
+	privatePrefix    string
+	stripVariables   bool
+	env              envPolicy
+	noFileFunc       bool
+	funcs            map[string]Func
+	resolver         IncludeResolver
+	includeRoot      string
+	maxBytes         int64
+	maxIncludes      int
+	decryptor        Decryptor
+	fileDecryptors   []FileDecryptor
+	stats            func(ParseStats)
+	units            bool
+	arrayStrategy    ArrayStrategy
+	varResolvers     map[string]VariableResolver
+	location         *time.Location
+	ranges           map[string]valueRange
+	enums            map[string][]string
+	enumKeys         map[string][]string
+	contextHook      func(Context, any) error
+	directives       map[string]DirectiveFunc
+	repeatedBlocks   bool
+	pathMode         PathMode
+	strictDuplicates bool
+	policies         []namedPolicy
+	lateBinding      bool
+
+	// err is an invalid option, reported by every parse.
+	err error
+
+	// track records the files, variables and environment variables used,
+	// for Load.
+	track bool
+
+	literalPrefixes []string
+	isLiteral       func(string) bool
+
+	// shareReferences, noVariables and noSuffixes are inverted so
+	// copying, resolving variables and expanding suffixes are the
+	// defaults.
+	shareReferences bool
+	noVariables     bool
+	noSuffixes      bool
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithIncludeCache reuses parsed include files from the given cache.
+// Includes are cached until they, or the files they read, change on disk.
+// Includes looking up environment variables, with $NAME or env(), or
+// calling functions other than file() are never cached, so they are
+// evaluated again by every parse.
+//
+// The cache is not used by parses with options a cached include would
+// skip or that make includes change between parses: WithDeprecations,
+// WithTypes, WithRanges, WithEnums, WithPolicy, WithStripVariables,
+// WithRepeatedBlocks, WithContextHook, WithIncludeResolver,
+// WithVariableResolver, WithDirective, and Load, which tracks the files
+// and variables a config uses.
+func WithIncludeCache(c IncludeCache) Option {
+	return func(o *options) {
+		o.includeCache = c
+	}
+}
+
+// cache returns the include cache to use. Includes are not cached when
+// options depend on where the include is mounted, report warnings, track
+// variable references or call hooks while parsing, since a cached include
+// would skip them, when includes do not come from the file system, or when
+// variables or directives are resolved from outside the config and may
+// change between parses. Options added here must be listed in the doc of
+// WithIncludeCache.
+func (o *options) cache() IncludeCache {
+	if len(o.deprecations) > 0 || len(o.types) > 0 || o.stripVariables || o.track || o.contextHook != nil ||
+		o.repeatedBlocks || o.resolver != nil || o.varResolvers != nil || o.directives != nil ||
+		len(o.ranges) > 0 || len(o.enums) > 0 || len(o.policies) > 0 {
+		return nil
+	}
+	return o.includeCache
+}
+
+// fingerprint identifies the options that change the values of a parsed
+// include, for the keys of an IncludeCache. Functions are identified by
+// their code, so distinct closures of the same function are not told
+// apart.
+func (o *options) fingerprint() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%v|%v|%q|%v|%q|%v|%v|%v|%v|%v|%v|%v|%v|%v|%q|%v|%v|%v|%v|%d|",
+		o.utf16, o.homogeneous, o.privatePrefix, o.env.disabled, o.env.prefixes, o.env.allow, o.env.deny,
+		o.noFileFunc, o.units, o.arrayStrategy, o.pathMode, o.strictDuplicates, o.lateBinding,
+		o.location, o.includeRoot, o.literalPrefixes, o.shareReferences, o.noVariables, o.noSuffixes, o.tabWidth)
+	names := make([]string, 0, len(o.funcs))
+	for name := range o.funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "%s=%s|", name, identity(o.funcs[name]))
+	}
+	fmt.Fprintf(h, "%s|%s|%s|", identity(o.normalizeKey), identity(o.isLiteral), identity(o.decryptor))
+	for _, d := range o.fileDecryptors {
+		fmt.Fprintf(h, "%s|", identity(d))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// identity returns a string identifying v, by address for functions and
+// pointers, which can not be compared by value.
+func identity(v any) string {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Func, reflect.Pointer, reflect.Map, reflect.Chan, reflect.UnsafePointer:
+		return fmt.Sprintf("%T@%x", v, rv.Pointer())
+	}
+	return fmt.Sprintf("%T:%v", v, v)
+}
+
+// WithTabWidth sets how many columns a tab advances to the next tab stop
+// when reporting positions, so they line up with editors. The default is
+// to count a tab as a single column.
+func WithTabWidth(n int) Option {
+	return func(o *options) {
+		o.tabWidth = n
+	}
+}
@@ -1,62 +1,126 @@
 package conf
 
 import (
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 	"unicode"
+
+	"github.com/ninepeach/go-conf/lexer"
 )
 
 type parser struct {
 	mapping  map[string]any
-	lx       *lexer
+	lx       *lexer.Lexer
 	ctx      any
 	ctxs     []any
 	keys     []string
 	ikeys    []item
 	fp       string
+	file     string
 	pedantic bool
+	opts     *options
+
+	// inherit are the options include files are parsed with, those of the
+	// parse without the pragmas of this file.
+	inherit *options
+
+	// prefix is the key path an include file is mounted at, empty for the
+	// top level file.
+	prefix string
+
+	// state is shared with the parsers of all include files.
+	state *parseState
+
+	// includes is the chain of files that included this one, used to
+	// detect include cycles.
+	includes []string
+
+	// opens holds the start items of the maps and arrays not closed yet.
+	opens []item
+
+	// merging is set while the values of an include file are merged into
+	// the current context. Those were already checked by the include parser.
+	merging bool
+
+	// used records the keys referenced as variables, to strip them from
+	// the result with WithStripVariables.
+	used []usedVar
+
+	// afterKey is set when the previous item was a key, so the current item
+	// is its value.
+	afterKey bool
+
+	// scopes are the top level maps of the documents parsed before this one
+	// by ParseAll, searched for variables after the contexts.
+	scopes []map[string]any
+
+	// valueDoc is set when the document holds a single value rather than
+	// keys. The value is collected in an array context on top of mapping.
+	valueDoc bool
+
+	// deps records the include files this parse depended on, mapped to the
+	// hash of their contents. Only tracked when an IncludeCache is in use.
+	deps map[string]string
+
+	// last is the token of the value set last in a parse with checks, and
+	// lastLine the line it ended on, to attach a comment following it.
+	last     *Token
+	lastLine int
+
+	// fromEnv is set when the value of the current item was looked up in
+	// the environment, for the context hook.
+	fromEnv bool
+
+	// noCalls is set when parsing values from the environment, in which
+	// function calls and directives are plain strings.
+	noCalls bool
 }
 
-func Parse(data string) (map[string]any, error) {
-	p, err := parseData(data, "", false)
+func Parse(data string, opts ...Option) (map[string]any, error) {
+	p, err := parseData(data, "", false, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return p.mapping, nil
 }
 
-func ParseWithChecks(data string) (map[string]any, error) {
-	p, err := parseData(data, "", true)
+func ParseWithChecks(data string, opts ...Option) (map[string]any, error) {
+	p, err := parseData(data, "", true, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return p.mapping, nil
 }
 
-func ParseFile(fp string) (map[string]any, error) {
-	data, err := os.ReadFile(fp)
+func ParseFile(fp string, opts ...Option) (map[string]any, error) {
+	data, err := readFile(fp, newOptions(opts).readLimit())
 	if err != nil {
-		return nil, fmt.Errorf("error opening config file: %v", err)
+		return nil, &OpenError{Path: fp, Err: err}
 	}
-	p, err := parseData(string(data), fp, false)
+	p, err := parseData(string(data), fp, false, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return p.mapping, nil
 }
 
-func ParseFileWithChecks(fp string) (map[string]any, error) {
-	data, err := os.ReadFile(fp)
+func ParseFileWithChecks(fp string, opts ...Option) (map[string]any, error) {
+	data, err := readFile(fp, newOptions(opts).readLimit())
 	if err != nil {
-		return nil, err
+		return nil, &OpenError{Path: fp, Err: err}
 	}
 
-	p, err := parseData(string(data), fp, true)
+	p, err := parseData(string(data), fp, true, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -64,38 +128,192 @@ func ParseFileWithChecks(fp string) (map[string]any, error) {
 	return p.mapping, nil
 }
 
-func parseData(data, fp string, pedantic bool) (p *parser, err error) {
-	p = &parser{
+// ParseValue parses a document holding a single value, such as a file
+// containing just [ "a", "b" ], and returns that value. Documents of keys
+// are returned as a map, as from Parse.
+func ParseValue(data string, opts ...Option) (any, error) {
+	p, err := parseDataWithOptions(data, "", false, true, newOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+	return p.result(), nil
+}
+
+// ParseExactValue returns the value text holds when all of it is a single
+// value written as in a config file, such as 4222, true, "a b" or [a, b],
+// and reports false otherwise. Text with comments, several values or
+// values left over, variable references and calls is not a single value,
+// so callers can keep such text as a string rather than have it read as
+// something else, such as "x; y=1" as x.
+func ParseExactValue(text string) (any, bool) {
+	lx := lexer.NewValue(text)
+	it := lx.Next()
+	if it.Type == lexer.EOF {
+		return nil, false
+	}
+	for ; it.Type != lexer.EOF; it = lx.Next() {
+		switch it.Type {
+		case lexer.String, lexer.Bool, lexer.Integer, lexer.Float, lexer.Datetime, lexer.Bytes,
+			lexer.ArrayStart, lexer.ArrayEnd, lexer.MapStart, lexer.MapEnd, lexer.Key:
+		default:
+			return nil, false
+		}
+	}
+	p := newParser(text, "", false, newOptions(nil))
+	p.parseAsValue(text)
+	// Read calls and directives as strings, as they were checked above.
+	p.lx.SetFuncs(nil)
+	p.lx.SetDirectives(nil)
+	p.state = &parseState{}
+	if err := p.parseDocument(text); err != nil {
+		return nil, false
+	}
+	return p.result(), true
+}
+
+func parseData(data, fp string, pedantic bool, opts ...Option) (*parser, error) {
+	return parseDataWithOptions(data, fp, pedantic, false, newOptions(opts))
+}
+
+// parseDataWithOptions parses data, as a value document if value is set
+// and data holds one.
+func parseDataWithOptions(data, fp string, pedantic, value bool, o *options) (_ *parser, err error) {
+	if o.err != nil {
+		return nil, o.err
+	}
+	state := &parseState{}
+	if len(o.policies) > 0 {
+		state.positions = make(map[string]schemaPos)
+	}
+	if o.stats != nil {
+		defer o.reportStats(fp, state, time.Now(), &err)
+	}
+	data, err = o.prepareInput(fp, data)
+	if err != nil {
+		return nil, &ParseError{File: fp, Err: err}
+	}
+	p := newParser(data, fp, pedantic, o)
+	if value && lexer.IsValue(data) {
+		p.parseAsValue(data)
+	}
+	p.state = state
+	if err := p.parseDocument(data); err != nil {
+		return nil, err
+	}
+	p.stripVariables()
+	if err := state.validateSchemas(p.mapping, pedantic); err != nil {
+		return nil, err
+	}
+	if err := state.checkPolicies(o, fp, p.mapping, pedantic); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// parseDocument parses the top level document data and applies the
+// deprecated key moves. The parser state must be set up.
+func (p *parser) parseDocument(data string) error {
+	if p.file != "" {
+		p.includes = []string{absPath(p.file)}
+	}
+	if err := p.addBytes(len(data)); err != nil {
+		return &ParseError{File: p.file, Err: err}
+	}
+	if err := p.applyPragmas(data); err != nil {
+		return err
+	}
+	if err := p.addSchemaFile(); err != nil {
+		return err
+	}
+	if err := p.parse(); err != nil {
+		return err
+	}
+	return p.applyMoves()
+}
+
+func newParser(data, fp string, pedantic bool, o *options) *parser {
+	p := &parser{
 		mapping:  make(map[string]any),
-		lx:       lex(data),
 		ctxs:     []any{make(map[string]any)},
 		keys:     make([]string, 0),
 		ikeys:    make([]item, 0),
-		fp:       filepath.Dir(fp),
+		fp:       baseDir(fp, o.pathMode),
+		file:     fp,
 		pedantic: pedantic,
+		opts:     o,
+		inherit:  o,
 	}
-
+	if o.cache() != nil {
+		p.deps = make(map[string]string)
+	}
+	p.setLexer(lexer.New(data))
 	p.pushContext(p.mapping)
+	return p
+}
 
+// setLexer makes p read its items from lx, set up for the parse.
+func (p *parser) setLexer(lx *lexer.Lexer) {
+	if p.opts.tabWidth > 0 {
+		lx.SetTabWidth(p.opts.tabWidth)
+	}
+	lx.SetStrict(p.pedantic)
+	lx.SetFuncs(p.isFunc)
+	lx.SetDirectives(p.isDirective)
+	p.lx = lx
+}
+
+// parseAsValue sets p up to parse data as a value document.
+func (p *parser) parseAsValue(data string) {
+	p.setLexer(lexer.NewValue(data))
+	p.valueDoc = true
+	p.pushContext(make([]any, 0, 1))
+}
+
+// result returns what the document parsed to, the value of a value
+// document or the mapping otherwise.
+func (p *parser) result() any {
+	if !p.valueDoc {
+		return p.mapping
+	}
+	if vals, ok := p.ctx.([]any); ok && len(vals) > 0 {
+		return vals[0]
+	}
+	return nil
+}
+
+func (p *parser) parse() error {
 	var prevItem item
 	for {
 		it := p.next()
-		if it.typ == itemEOF && prevItem.typ == itemKey && prevItem.val != mapEndString {
-			return nil, fmt.Errorf("config is invalid (%s:%d:%d)", fp, it.line, it.pos)
+		if it.Type == itemEOF && len(p.opens) > 0 {
+			open := p.opens[len(p.opens)-1]
+			kind := "map"
+			if open.Type == itemArrayStart {
+				kind = "array"
+			}
+			return p.errorf(open, "%s opened at line %d never closed", kind, open.Line)
+		}
+		if it.Type == itemEOF && prevItem.Type == itemKey {
+			if prevItem.Val != mapEndString {
+				return p.errorf(it, "config is invalid")
+			}
+			if p.pedantic {
+				return p.errorf(prevItem, "unexpected '%s' with no matching '%c'", mapEndString, mapStart)
+			}
 		}
 		prevItem = it
-		if err := p.processItem(it, fp); err != nil {
-			return nil, err
+		if err := p.processItem(it, p.file); err != nil {
+			return err
 		}
-		if it.typ == itemEOF {
+		if it.Type == itemEOF {
 			break
 		}
 	}
-	return p, nil
+	return nil
 }
 
 func (p *parser) next() item {
-	return p.lx.nextItem()
+	return p.lx.Next()
 }
 
 func (p *parser) pushContext(ctx any) {
@@ -103,129 +321,244 @@ func (p *parser) pushContext(ctx any) {
 	p.ctx = ctx
 }
 
-func (p *parser) popContext() any {
-	if len(p.ctxs) == 0 {
-		panic("BUG: empty context stack")
+func (p *parser) popContext() (any, error) {
+	// The first context is never popped, it is only there so that
+	// variable lookups always have a map to fall back to.
+	if len(p.ctxs) <= 1 {
+		return nil, errors.New("BUG: empty context stack")
 	}
 	last := p.ctxs[len(p.ctxs)-1]
 	p.ctxs = p.ctxs[:len(p.ctxs)-1]
 	p.ctx = p.ctxs[len(p.ctxs)-1]
-	return last
+	return last, nil
+}
+
+// closeOpen pops the innermost open map or array and returns the item
+// that opened it.
+func (p *parser) closeOpen() item {
+	if len(p.opens) == 0 {
+		return item{}
+	}
+	open := p.opens[len(p.opens)-1]
+	p.opens = p.opens[:len(p.opens)-1]
+	return open
 }
 
 func (p *parser) pushKey(key string) {
 	p.keys = append(p.keys, key)
 }
 
-func (p *parser) popKey() string {
+func (p *parser) popKey() (string, error) {
 	if len(p.keys) == 0 {
-		panic("BUG: empty keys stack")
+		return "", errors.New("BUG: empty keys stack")
 	}
 	last := p.keys[len(p.keys)-1]
 	p.keys = p.keys[:len(p.keys)-1]
-	return last
+	return last, nil
 }
 
 func (p *parser) pushItemKey(key item) {
 	p.ikeys = append(p.ikeys, key)
 }
 
-func (p *parser) popItemKey() item {
+func (p *parser) popItemKey() (item, error) {
 	if len(p.ikeys) == 0 {
-		panic("BUG: empty item keys stack")
+		return item{}, errors.New("BUG: empty item keys stack")
 	}
 	last := p.ikeys[len(p.ikeys)-1]
 	p.ikeys = p.ikeys[:len(p.ikeys)-1]
-	return last
+	return last, nil
 }
 
 func (p *parser) processItem(it item, fp string) error {
-	setValue := func(it item, v any) {
+	// Array elements are reported at their start, which for maps and
+	// arrays is the opening bracket rather than the item closing them.
+	elemStart := it
+	setRef := func(it item, v any, ref *varRef) error {
+		if err := p.checkArrayElem(elemStart, v); err != nil {
+			return err
+		}
+		if p.opts.ranges != nil {
+			if err := p.checkRange(it, v); err != nil {
+				return err
+			}
+		}
+		if p.opts.enums != nil {
+			if err := p.checkEnum(it, v); err != nil {
+				return err
+			}
+		}
+		if p.opts.contextHook != nil {
+			if err := p.callContextHook(it, v); err != nil {
+				return err
+			}
+		}
 		if p.pedantic {
-			p.setValue(&token{it, v, false, fp})
-		} else {
-			p.setValue(v)
+			tk := &Token{item: it, value: v, sourceFile: fp, ref: ref}
+			p.last, p.lastLine = tk, it.Line
+			return p.setValue(tk)
 		}
+		return p.setValue(v)
 	}
+	setValue := func(it item, v any) error {
+		return setRef(it, v, nil)
+	}
+
+	isValue := p.afterKey
+	p.afterKey = it.Type == itemKey
+	p.fromEnv = false
 
-	switch it.typ {
+	switch it.Type {
 	case itemError:
-		return fmt.Errorf("Parse error on line %d: '%s'", it.line, it.val)
+		return p.errorf(it, "parse error: %s", it.Val)
 	case itemKey:
-		p.pushKey(it.val)
+		p.last = nil
+		p.pushKey(p.normalizeKey(it.Val))
+		p.pushItemKey(it)
+	case itemText:
 		if p.pedantic {
-			p.pushItemKey(it)
+			p.attachComment(it)
 		}
 	case itemMapStart:
-		newCtx := make(map[string]any)
+		p.last = nil
+		newCtx := p.newMap()
 		p.pushContext(newCtx)
+		p.opens = append(p.opens, it)
 	case itemMapEnd:
-		setValue(it, p.popContext())
+		elemStart = p.closeOpen()
+		ctx, err := p.popContext()
+		if err != nil {
+			return p.errorf(it, "%w", err)
+		}
+		return setValue(it, ctx)
 	case itemString:
-		setValue(it, it.val)
-	case itemInteger:
-		num, err := parseInteger(it.val)
+		val, err := p.decrypt(it, it.Val)
 		if err != nil {
 			return err
 		}
-		setValue(it, num)
+		return setValue(it, val)
+	case itemInteger:
+		if _, suffix := parseNumberSuffix(it.Val); suffix != "" && !p.expandSuffix() {
+			return setValue(it, it.Val)
+		}
+		num, err := parseInteger(it.Val)
+		if err != nil {
+			return p.errorf(it, "%w", err)
+		}
+		if p.opts.units {
+			return setValue(it, withUnit(it.Val, num.(int64)))
+		}
+		return setValue(it, num)
 	case itemFloat:
-		num, err := strconv.ParseFloat(it.val, 64)
+		num, err := strconv.ParseFloat(it.Val, 64)
 		if err != nil {
-			return fmt.Errorf("expected float, but got '%s'", it.val)
+			return p.errorf(it, "expected float, but got '%s'", it.Val)
 		}
-		setValue(it, num)
+		return setValue(it, num)
 	case itemBool:
-		setValue(it, parseBool(it.val))
+		return setValue(it, parseBool(it.Val))
+	case itemBytes:
+		b, err := parseBytes(it.Val)
+		if err != nil {
+			return p.errorf(it, "%w", err)
+		}
+		return setValue(it, b)
 	case itemDatetime:
-		dt, err := time.Parse("2006-01-02T15:04:05Z", it.val)
+		dt, err := parseDatetime(it.Val, p.opts.location)
+		if err != nil {
+			return p.errorf(it, "invalid DateTime: '%s'", it.Val)
+		}
+		return setValue(it, dt)
+	case itemCall:
+		v, err := p.call(it)
 		if err != nil {
-			return fmt.Errorf("invalid DateTime: '%s'", it.val)
+			return err
 		}
-		setValue(it, dt)
+		return setValue(it, v)
 	case itemArrayStart:
+		p.last = nil
 		p.pushContext([]any{})
+		p.opens = append(p.opens, it)
 	case itemArrayEnd:
-		setValue(it, p.popContext())
+		elemStart = p.closeOpen()
+		ctx, err := p.popContext()
+		if err != nil {
+			return p.errorf(it, "%w", err)
+		}
+		return setValue(it, ctx)
 	case itemVariable:
-		value, found, err := p.lookupVariable(it.val)
+		if strings.HasSuffix(it.Val, spreadSuffix) && !p.isLiteral(it.Val) {
+			return p.spread(it, setValue)
+		}
+		if late, ok := p.lateRef(it); ok {
+			return setRef(it, late, nil)
+		}
+		value, ref, err := p.resolveVariable(it)
 		if err != nil {
-			return fmt.Errorf("variable reference for '%s' on line %d could not be parsed: %s",
-				it.val, it.line, err)
+			return err
 		}
-		if !found {
-			return fmt.Errorf("variable reference for '%s' on line %d can not be found",
-				it.val, it.line)
+		// Maps and arrays are copied, so every reference to a block can be
+		// changed without affecting the others.
+		return setRef(it, p.resolved(value), ref)
+	case itemSpread:
+		return p.spreadMap(it)
+	case itemSchema:
+		return p.addSchema(it)
+	case itemDirective:
+		_, inArray := p.ctx.([]any)
+		mount := isValue || inArray
+		v, err := p.directive(it, mount)
+		if err != nil {
+			return err
 		}
-
-		if p.pedantic {
-			switch tk := value.(type) {
-			case *token:
-				// Mark the looked up variable as used, and make
-				// the variable reference become handled as a token.
-				tk.usedVariable = true
-				p.setValue(&token{it, tk.Value(), false, fp})
-			default:
-				// Special case to add position context to bcrypt references.
-				p.setValue(&token{it, value, false, fp})
-			}
-		} else {
-			p.setValue(value)
+		if mount {
+			return setValue(it, v)
 		}
-	case itemInclude:
-		m, err := parseIncludeFile(p, it.val)
+		m, ok := v.(map[string]any)
+		if !ok {
+			name, _, _ := strings.Cut(it.Val, " ")
+			return p.errorf(it, "directive %s returned %s '%v' and must be set as the value of a key",
+				name, kindOf(v), v)
+		}
+		return p.mergeDirective(it, m)
+	case itemInclude, itemOptionalInclude:
+		_, inArray := p.ctx.([]any)
+		mount := isValue || inArray
+		v, used, err := parseIncludeFile(p, it, mount)
 		if err != nil {
-			return fmt.Errorf("error parsing include file '%s', %v", it.val, err)
+			return err
+		}
+		if mount {
+			// Mounted under a key or in an array, the include becomes a map
+			// value, or the value of a file holding just one. A missing
+			// optional include mounts an empty map.
+			if v == nil {
+				v = p.newMap()
+			}
+			if m, ok := v.(map[string]any); ok {
+				p.adoptUsed(used, m)
+			}
+			return setValue(it, v)
+		}
+		m, ok := v.(map[string]any)
+		if !ok && v != nil {
+			return p.errorf(it, "include file '%s' holds a single value and must be set as the value of a key", it.Val)
 		}
+		if ctx, ok := p.ctx.(map[string]any); ok {
+			p.adoptUsed(used, ctx)
+		}
+		p.merging = true
+		defer func() { p.merging = false }()
 		for k, v := range m {
 			p.pushKey(k)
-			if p.pedantic {
-				switch tk := v.(type) {
-				case *token:
-					p.pushItemKey(tk.item)
-				}
+			if tk, ok := v.(*Token); ok {
+				p.pushItemKey(tk.item)
+			} else {
+				p.pushItemKey(it)
+			}
+			if err := p.setValue(v); err != nil {
+				return err
 			}
-			p.setValue(v)
 		}
 	}
 
@@ -287,6 +620,31 @@ func applySuffix(num int64, suffix string) any {
 	}
 }
 
+// parseBytes decodes a bytes literal as emitted by the lexer, the encoding
+// name followed by the quote and payload, e.g. `hex"6869`.
+func parseBytes(val string) ([]byte, error) {
+	enc, payload, _ := strings.Cut(val, `"`)
+	switch enc {
+	case "hex":
+		b, err := hex.DecodeString(payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex literal '%s'", payload)
+		}
+		return b, nil
+	case "base64":
+		// Accept the standard and URL alphabets, with or without padding.
+		for _, e := range []*base64.Encoding{
+			base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding,
+		} {
+			if b, err := e.DecodeString(payload); err == nil {
+				return b, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid base64 literal '%s'", payload)
+	}
+	return nil, fmt.Errorf("unknown bytes literal encoding '%s'", enc)
+}
+
 func parseBool(val string) bool {
 	switch strings.ToLower(val) {
 	case "true", "yes", "on":
@@ -300,48 +658,270 @@ func parseBool(val string) bool {
 // Used to map an environment value into a temporary map to pass to secondary Parse call.
 const pkey = "pk"
 
-// We special case raw strings here that are bcrypt'd. This allows us not to force quoting the strings
-const bcryptPrefix = "2a$"
+// parseNested parses text as the value of a key with the options and
+// state of p, so the environment policy, the include root,
+// WithoutFileFunc and the limits apply to the values in it, such as the
+// arguments of a call, as they do to the rest of the config. Calls and
+// directives are only evaluated when calls is set, so the value of an
+// environment variable such as uuid() or file("/x") stays a string.
+func (p *parser) parseNested(text string, calls bool) (any, error) {
+	ip := newParser(fmt.Sprintf("%s=%s", pkey, text), p.file, false, p.opts)
+	ip.noCalls = p.noCalls || !calls
+	ip.state = p.state
+	ip.includes = p.includes
+	// The key the value is parsed under is not one of the config.
+	keys := p.state.keys
+	err := ip.parse()
+	p.state.keys = keys
+	if err != nil {
+		return nil, err
+	}
+	p.addDeps(ip.deps)
+	p.fromEnv = p.fromEnv || ip.fromEnv
+	return ip.mapping[pkey], nil
+}
 
-func (p *parser) lookupVariable(varReference string) (any, bool, error) {
-	// Handle special cases like bcrypt, then check contexts and env vars.
-	if strings.HasPrefix(varReference, bcryptPrefix) {
+// resolveVariable returns the value of the variable reference it, or an
+// error when it can not be found. Parses with checks also get what the
+// reference resolved to, unless it was a literal.
+func (p *parser) resolveVariable(it item) (any, *varRef, error) {
+	if r, ref, ok := p.variableResolver(it.Val); ok && !p.isLiteral(it.Val) {
+		value, err := r.Resolve(ref)
+		if err != nil {
+			return nil, nil, p.errorf(it, "variable reference for '%s' could not be resolved: %w", it.Val, err)
+		}
+		p.debug(it, "variable resolved by resolver", "name", it.Val)
+		p.track(&p.state.variables, it.Val)
+		var vref *varRef
+		if p.pedantic {
+			vref = &varRef{name: it.Val}
+		}
+		return value, vref, nil
+	}
+	value, found, err := p.lookupVariable(it)
+	if err != nil {
+		return nil, nil, p.errorf(it, "variable reference for '%s' could not be parsed: %w", it.Val, err)
+	}
+	if !found {
+		return nil, nil, p.errorf(it, "variable reference for '%s' can not be found", it.Val)
+	}
+
+	var ref *varRef
+	if p.pedantic && !p.isLiteral(it.Val) {
+		ref = &varRef{name: it.Val}
+	}
+	// Mark the looked up variable as used, and make the variable
+	// reference become handled as a token. Bcrypt references get
+	// position context this way too.
+	if tk, ok := value.(*Token); ok {
+		tk.usedVariable = true
+		value = tk.Value()
+		if ref != nil {
+			ref.def = tk
+		}
+	}
+	return value, ref, nil
+}
+
+func (p *parser) lookupVariable(it item) (any, bool, error) {
+	varReference := it.Val
+	// Handle literals like password hashes, then check contexts and env vars.
+	if p.isLiteral(varReference) {
 		return "$" + varReference, true, nil
 	}
+	key := p.normalizeKey(varReference)
 	for i := len(p.ctxs) - 1; i >= 0; i-- {
 		ctx := p.ctxs[i]
 		if m, ok := ctx.(map[string]any); ok {
-			if v, ok := m[varReference]; ok {
+			if v, ok := m[key]; ok {
+				p.debug(it, "variable resolved", "name", varReference, "depth", i)
+				p.markUsed(m, key, i)
+				p.track(&p.state.variables, varReference)
 				return v, ok, nil
 			}
 		}
 	}
-	if vStr, ok := os.LookupEnv(varReference); ok {
-		if vmap, err := Parse(fmt.Sprintf("%s=%s", pkey, vStr)); err == nil {
-			v, ok := vmap[pkey]
+	for i := len(p.scopes) - 1; i >= 0; i-- {
+		if v, ok := p.scopes[i][key]; ok {
+			p.debug(it, "variable resolved from earlier document", "name", varReference, "document", i)
+			p.markUsed(p.scopes[i], key, -1)
+			p.track(&p.state.variables, varReference)
 			return v, ok, nil
-		} else {
+		}
+	}
+	if !p.opts.env.allowed(varReference) {
+		p.debug(it, "environment variable not allowed", "name", varReference)
+		return nil, false, nil
+	}
+	p.state.envLookups++
+	p.track(&p.state.envVars, varReference)
+	p.fromEnv = true
+	if vStr, ok := os.LookupEnv(varReference); ok {
+		p.debug(it, "variable resolved from environment", "name", varReference)
+		v, err := p.parseNested(vStr, false)
+		if err != nil {
 			return nil, false, err
 		}
+		return v, v != nil, nil
 	}
+	p.debug(it, "variable not found", "name", varReference)
 	return nil, false, nil
 }
 
-func parseIncludeFile(p *parser, fileName string) (map[string]any, error) {
-	var m map[string]any
-	var err error // Declare err outside the if block
+// parseIncludeFile parses the include file of it. Files that are mounted
+// under a key or in an array may hold a single value instead of keys.
+func parseIncludeFile(p *parser, it item, mount bool) (any, []usedVar, error) {
+	fp := includePath(p.fp, it.Val)
+	if err := p.addInclude(); err != nil {
+		return nil, nil, p.errorf(it, "%w", err)
+	}
+
+	cache := p.opts.cache()
+	key := IncludeKey{Path: fp, Pedantic: p.pedantic}
+	if cache != nil {
+		key.Path = absPath(fp)
+		key.Options = p.inherit.fingerprint()
+		// Check the include as when it is read, so the cache never serves
+		// a file outside the include root or one including itself.
+		stack := append(p.includes[:len(p.includes):len(p.includes)], key.Path)
+		if err := checkRoot(p.opts.includeRoot, fp); err != nil {
+			return nil, nil, p.includeError(it, stack, &OpenError{Path: fp, Err: err})
+		}
+		if err := p.checkCycle(it, stack); err != nil {
+			return nil, nil, err
+		}
+		if ci, ok := cache.Get(key); ok {
+			p.debug(it, "include resolved from cache", "include", it.Val, "path", key.Path)
+			if err := p.addBytes(int(ci.bytes)); err != nil {
+				return nil, nil, p.errorf(it, "%w", err)
+			}
+			p.state.keys += ci.keys
+			p.state.secrets = append(p.state.secrets, ci.secrets...)
+			for i := 0; i < ci.includes; i++ {
+				if err := p.addInclude(); err != nil {
+					return nil, nil, p.errorf(it, "%w", err)
+				}
+			}
+			p.addDeps(ci.Deps)
+			if ci.Mapping == nil {
+				return deepCopy(ci.Value), nil, nil
+			}
+			return deepCopyMap(ci.Mapping), nil, nil
+		}
+	}
+
+	p.debug(it, "resolving include", "include", it.Val, "path", fp)
+	r := p.opts.includeResolver()
+	if fr, ok := r.(fileResolver); ok {
+		fr.limit = p.readLimit()
+		r = fr
+	}
+	data, rfp, err := r.Resolve(p.file, it.Val)
+	if rfp != "" {
+		fp = rfp
+	}
+	abs := absPath(fp)
+	stack := append(p.includes[:len(p.includes):len(p.includes)], abs)
+	if err != nil {
+		if it.Type == itemOptionalInclude && errors.Is(err, fs.ErrNotExist) {
+			p.debug(it, "skipping missing optional include", "include", it.Val, "path", fp)
+			p.trackInclude(it, fp, true)
+			if p.deps != nil {
+				// Record the file as missing so cached includes go
+				// stale once it is created.
+				p.deps[abs] = ""
+			}
+			return nil, nil, nil
+		}
+		return nil, nil, p.includeError(it, stack, &OpenError{Path: fp, Err: err})
+	}
+	if err := p.checkCycle(it, stack); err != nil {
+		return nil, nil, err
+	}
+	if err := p.addBytes(len(data)); err != nil {
+		return nil, nil, p.errorf(it, "%w", err)
+	}
+	p.track(&p.state.files, fp)
+	p.trackInclude(it, fp, false)
+	input, err := p.opts.prepareInput(fp, string(data))
+	if err != nil {
+		return nil, nil, p.includeError(it, stack, &ParseError{File: fp, Err: err})
+	}
+	ip := newParser(input, fp, p.pedantic, p.inherit)
+	ip.prefix = p.keyPrefix()
+	ip.state = p.state
+	ip.includes = stack
+	if err := ip.applyPragmas(input); err != nil {
+		return nil, nil, p.includeError(it, stack, err)
+	}
+	if mount && lexer.IsValue(input) {
+		ip.parseAsValue(input)
+	}
+	schemas, bytes, includes, keys := len(p.state.schemas), p.state.bytes, p.state.includes, p.state.keys
+	envLookups, calls, secrets := p.state.envLookups, p.state.calls, len(p.state.secrets)
+	if err := ip.parse(); err != nil {
+		return nil, nil, p.includeError(it, stack, err)
+	}
+
+	// Includes declaring schemas, or including files that do, are not
+	// cached, as a cache hit would not add their schemas to the parse.
+	// Neither are includes looking up environment variables or calling
+	// functions, so every parse evaluates them again.
+	if cache != nil && len(p.state.schemas) == schemas && p.state.envLookups == envLookups && p.state.calls == calls {
+		ip.deps[key.Path] = hashData(data)
+		p.addDeps(ip.deps)
+		ci := &CachedInclude{Deps: ip.deps, bytes: int64(len(data)) + p.state.bytes - bytes,
+			includes: p.state.includes - includes, keys: p.state.keys - keys,
+			secrets: slices.Clone(p.state.secrets[secrets:])}
+		if ip.valueDoc {
+			ci.Value = deepCopy(ip.result())
+		} else {
+			ci.Mapping = deepCopyMap(ip.mapping)
+		}
+		cache.Put(key, ci)
+	}
+	return ip.result(), ip.used, nil
+}
+
+// checkCycle fails when the include at the end of stack, the absolute
+// paths of the files including it, is already being parsed.
+func (p *parser) checkCycle(it item, stack []string) error {
+	for _, inc := range p.includes {
+		if inc == stack[len(stack)-1] {
+			return p.includeError(it, stack, fmt.Errorf("include cycle detected: %s",
+				strings.Join(stack, " -> ")))
+		}
+	}
+	return nil
+}
+
+// absPath returns the absolute form of fp, or fp itself if that fails.
+func absPath(fp string) string {
+	if abs, err := filepath.Abs(fp); err == nil {
+		return abs
+	}
+	return fp
+}
 
-	if p.pedantic {
-		m, err = ParseFileWithChecks(filepath.Join(p.fp, fileName)) // Assign error to the variable
-	} else {
-		m, err = ParseFile(filepath.Join(p.fp, fileName)) // Assign error to the variable
+// addDep records the file fp, read with the contents data, among the files
+// the config was built from. Cached includes go stale when it changes.
+func (p *parser) addDep(fp string, data []byte) {
+	if p.deps != nil {
+		p.deps[absPath(fp)] = hashData(data)
 	}
+	p.track(&p.state.files, fp)
+}
 
-	// Return both the map and the error
-	return m, err
+func (p *parser) addDeps(deps map[string]string) {
+	if p.deps == nil {
+		return
+	}
+	for k, v := range deps {
+		p.deps[k] = v
+	}
 }
 
-func (p *parser) setValue(val any) {
+func (p *parser) setValue(val any) error {
 	// Test to see if we are on an array or a map
 
 	// Array processing
@@ -352,16 +932,64 @@ func (p *parser) setValue(val any) {
 
 	// Map processing
 	if ctx, ok := p.ctx.(map[string]any); ok {
-		key := p.popKey()
+		key, err := p.popKey()
+		if err != nil {
+			return err
+		}
+		it, err := p.popItemKey()
+		if err != nil {
+			return err
+		}
+		if p.opts.strictDuplicates {
+			if err := p.checkDuplicate(ctx, key, it, val); err != nil {
+				return err
+			}
+		}
+		if _, ok := ctx[key]; ok {
+			p.debug(it, "duplicate key", "key", joinPath(p.keyPrefix(), key))
+		}
+		if !p.merging {
+			p.state.keys++
+		}
+
+		if len(p.opts.deprecations) > 0 && !p.merging {
+			var err error
+			key, err = p.deprecatedKey(ctx, key, it, val)
+			if err != nil || key == "" {
+				return err
+			}
+		}
+
+		if len(p.opts.enumKeys) > 0 && !p.merging {
+			if err := p.checkEnumKey(it, key); err != nil {
+				return err
+			}
+		}
+
+		p.recordPosition(joinPath(p.keyPrefix(), key), it)
+
+		if p.opts.repeatedBlocks {
+			val = p.collectBlock(ctx, joinPath(p.keyPrefix(), key), key, val)
+		}
+
+		if len(p.opts.types) > 0 && !p.merging {
+			var err error
+			if val, err = p.checkType(joinPath(p.keyPrefix(), key), it, val); err != nil {
+				return err
+			}
+		}
 
 		if p.pedantic {
 			// Change the position to the beginning of the key
 			// since more useful when reporting errors.
 			switch v := val.(type) {
-			case *token:
-				it := p.popItemKey()
-				v.item.pos = it.pos
-				v.item.line = it.line
+			case *Token:
+				v.item.Pos = it.Pos
+				v.item.Line = it.Line
+				if prev, ok := ctx[key].(*Token); ok && prev != v {
+					v.replaced = prev
+				}
+				v.merged = p.merging
 				ctx[key] = v
 			}
 		} else {
@@ -369,35 +997,152 @@ func (p *parser) setValue(val any) {
 			ctx[key] = val
 		}
 	}
+	return nil
+}
+
+// keyPrefix returns the key path of the map currently being parsed.
+func (p *parser) keyPrefix() string {
+	path := p.prefix
+	for _, k := range p.keys {
+		path = joinPath(path, k)
+	}
+	return path
+}
+
+// warnf reports a warning at the position of it.
+func (p *parser) warnf(it item, format string, args ...any) {
+	if p.opts.warn == nil {
+		return
+	}
+	p.opts.warn(Warning{
+		File:    p.file,
+		Line:    it.Line,
+		Pos:     it.Pos,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// parseState is shared by a parse and the parses of its include files.
+type parseState struct {
+	// moves are values of renamed keys that live under a different parent
+	// than the deprecated key, set once the whole config has been parsed.
+	moves []pendingMove
+
+	// bytes and includes count the input read, see WithMaxBytes and
+	// WithMaxIncludes.
+	bytes    int64
+	includes int
+
+	// keys and envLookups are counted for WithStats. envLookups and calls,
+	// the calls of functions other than file(), also keep the includes
+	// making them out of the include cache, as their values may change
+	// between parses.
+	keys       int
+	envLookups int
+	calls      int
+
+	// schemas are the schema blocks seen so far, and positions where the
+	// keys set after the first of them were set.
+	schemas   []schemaBlock
+	positions map[string]schemaPos
+
+	// blocks holds the paths of the arrays of repeated blocks, see
+	// WithRepeatedBlocks.
+	blocks map[string]bool
+
+	// merged holds the paths of the keys set by includes and map spreads,
+	// which may be overridden with WithStrictDuplicates.
+	merged map[string]bool
+
+	// files, inclusions, variables and envVars are only tracked for Load.
+	files      []string
+	inclusions []Include
+	variables  []string
+	envVars    []string
+
+	// maps are the maps of the config taken from the pool, only recorded
+	// for Load, see Result.Release.
+	maps []map[string]any
+
+	// secrets are the values decrypted or read with file(), which a Store
+	// redacts whatever key they are under.
+	secrets []string
 }
 
-type token struct {
+// Token is a value from a parse with checks, together with the position
+// it was defined at. Maps and arrays in such a parse hold tokens as well.
+type Token struct {
 	item         item
 	value        any
 	usedVariable bool
 	sourceFile   string
+
+	// replaced is the earlier definition of the same key this one
+	// replaced, and merged is set for values copied in from an include
+	// file or a map spread rather than written in the map itself.
+	replaced *Token
+	merged   bool
+
+	// ref is set for values resolved from a variable reference.
+	ref *varRef
+
+	// comment is the comment following the value on its last line.
+	comment string
+}
+
+// varRef is a variable reference a value was resolved from.
+type varRef struct {
+	name string
+	// def is the definition the reference resolved to, nil for
+	// environment variables.
+	def *Token
 }
 
-func (t *token) MarshalJSON() ([]byte, error) {
+func (t *Token) MarshalJSON() ([]byte, error) {
 	return json.Marshal(t.value)
 }
 
-func (t *token) Value() any {
+func (t *Token) Value() any {
 	return t.value
 }
 
-func (t *token) Line() int {
-	return t.item.line
+func (t *Token) Line() int {
+	return t.item.Line
 }
 
-func (t *token) IsUsedVariable() bool {
+func (t *Token) IsUsedVariable() bool {
 	return t.usedVariable
 }
 
-func (t *token) SourceFile() string {
+func (t *Token) SourceFile() string {
 	return t.sourceFile
 }
 
-func (t *token) Position() int {
-	return t.item.pos
+func (t *Token) Position() int {
+	return t.item.Pos
+}
+
+// Variable returns the name of the variable reference t was resolved
+// from, or "" if the value was set directly.
+func (t *Token) Variable() string {
+	if t.ref == nil {
+		return ""
+	}
+	return t.ref.name
+}
+
+// VariableDefinition returns the definition the variable reference of t
+// resolved to. It is nil if t was set directly or from an environment
+// variable.
+func (t *Token) VariableDefinition() *Token {
+	if t.ref == nil {
+		return nil
+	}
+	return t.ref.def
+}
+
+// Replaced returns the earlier definition of the same key that t replaced,
+// or nil if there was none.
+func (t *Token) Replaced() *Token {
+	return t.replaced
 }
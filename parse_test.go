@@ -71,6 +71,32 @@ func TestVariableParsing(t *testing.T) {
 	}
 }
 
+func TestVariableBlockCopies(t *testing.T) {
+	data := `
+		tls_defaults = { verify = true, ciphers = [a, b] }
+		server_a { tls = $tls_defaults }
+		server_b { tls = $tls_defaults }
+	`
+	for _, parse := range []func(string, ...Option) (map[string]any, error){Parse, ParseWithChecks} {
+		m, err := parse(data)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		tlsA, _ := Lookup(m, "server_a.tls")
+		plainValue(tlsA).(map[string]any)["verify"] = false
+		ciphers, _ := Lookup(m, "server_a.tls.ciphers")
+		plainValue(ciphers).([]any)[0] = "c"
+
+		ex := map[string]any{"verify": true, "ciphers": []any{"a", "b"}}
+		for _, path := range []string{"tls_defaults", "server_b.tls"} {
+			v, _ := Lookup(m, path)
+			if s := stripValue(v); !reflect.DeepEqual(s, ex) {
+				t.Fatalf("Mismatch in %s:\nReceived: '%+v'\nExpected: '%+v'\n", path, s, ex)
+			}
+		}
+	}
+}
+
 func TestMissingVariable(t *testing.T) {
 	_, err := Parse("foo=$index")
 	if err == nil || !strings.Contains(err.Error(), "variable reference") {
@@ -94,6 +120,45 @@ func TestConvenientNumbers(t *testing.T) {
 	testParse(t, `k = 8k; kb = 4kb; ki = 3ki; m = 1m; mb = 2MB; mi = 2Mi`, ex)
 }
 
+func TestSignedAndExponentNumbers(t *testing.T) {
+	ex := map[string]any{
+		"a": float64(-1500), "b": float64(0.5), "c": float64(0.002), "d": int64(-4096),
+		"e": int64(7), "f": []any{int64(1), float64(20), int64(-3)},
+	}
+	testParse(t, `a = -1.5e3; b = +.5; c = 2E-3; d = -4kb; e = +7; f = [1, 2e1, -3]`, ex)
+
+	_, err := Parse("a = 1\nb = -12abc\n")
+	if err == nil {
+		t.Fatal("Expected an error for an invalid number")
+	}
+	if expected := "parse error: Invalid character 'a' in number '-12', quote '-12abc' if it is a string. (:2:8)"; err.Error() != expected {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", err.Error(), expected)
+	}
+}
+
+func TestBytesLiterals(t *testing.T) {
+	ex := map[string]any{
+		"key":   []byte("hello"),
+		"raw":   []byte("hello"),
+		"url":   []byte{0xfb, 0xff},
+		"nonce": []byte{0xde, 0xad, 0xbe, 0xef},
+		"list":  []any{[]byte{0}, []byte("hi")},
+	}
+	testParse(t, `
+		key = base64"aGVsbG8="
+		raw = base64"aGVsbG8"
+		url = base64"-_8="
+		nonce = hex"DEADbeef"
+		list = [hex"00", base64"aGk="]
+	`, ex)
+
+	for _, conf := range []string{`a = hex"abc"`, `a = base64"!!"`} {
+		if _, err := Parse(conf); err == nil {
+			t.Errorf("Expected error for %s", conf)
+		}
+	}
+}
+
 func TestSample(t *testing.T) {
 	sample := `
 		foo {
@@ -250,3 +315,332 @@ func TestJSONParseCompat(t *testing.T) {
 		})
 	}
 }
+
+func TestOptionalIncludes(t *testing.T) {
+	dir := t.TempDir()
+	main := filepath.Join(dir, "main.conf")
+	if err := os.WriteFile(main, []byte("a = 1\ninclude? 'local.conf'\nb { include? \"missing.conf\" }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, parse := range []func(string, ...Option) (map[string]any, error){ParseFile, ParseFileWithChecks} {
+		m, err := parse(main)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(m) != 2 || len(plainValue(m["b"]).(map[string]any)) != 0 {
+			t.Fatalf("Unexpected result: %+v", m)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "local.conf"), []byte("a = 2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := ParseFile(main)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m["a"] != int64(2) {
+		t.Fatalf("Expected override from local.conf, got %+v", m)
+	}
+
+	// Files that exist but can not be parsed are still errors.
+	if err := os.WriteFile(filepath.Join(dir, "local.conf"), []byte("a = [1, 2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseFile(main); err == nil {
+		t.Fatal("Expected error for broken optional include")
+	}
+}
+
+func TestMountedIncludes(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.conf": "tenants {\n  acme = include 'acme.conf'\n  beta: include? 'beta.conf'\n}\nall = [include 'acme.conf', include 'acme.conf']",
+		"acme.conf": "name = acme\nlimits { conn = 10 }",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	acme := map[string]any{"name": "acme", "limits": map[string]any{"conn": int64(10)}}
+	ex := map[string]any{
+		"tenants": map[string]any{"acme": acme, "beta": map[string]any{}},
+		"all":     []any{acme, acme},
+	}
+	m, err := ParseFile(filepath.Join(dir, "main.conf"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(m, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, ex)
+	}
+	m, err = ParseFileWithChecks(filepath.Join(dir, "main.conf"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if s := stripValue(m); !reflect.DeepEqual(s, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", s, ex)
+	}
+
+	// Options keyed by path see the mount point.
+	_, err = ParseFile(filepath.Join(dir, "main.conf"),
+		WithTypes(map[string]Kind{"tenants.acme.limits.conn": KindString}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = ParseFileWithChecks(filepath.Join(dir, "main.conf"),
+		WithTypes(map[string]Kind{"tenants.acme.limits.conn": KindString}))
+	if err == nil || !strings.Contains(err.Error(), "tenants.acme.limits.conn") {
+		t.Fatalf("Expected type error at the mounted path, got %v", err)
+	}
+}
+
+func TestIncludeCycle(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.conf"), []byte("a = 1\ninclude 'b.conf'"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "b.conf"), []byte("b = 1\ninclude 'a.conf'"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, parse := range []func(string, ...Option) (map[string]any, error){ParseFile, ParseFileWithChecks} {
+		_, err := parse(filepath.Join(dir, "a.conf"))
+		if err == nil || !strings.Contains(err.Error(), "include cycle") {
+			t.Fatalf("Expected include cycle error, got %v", err)
+		}
+	}
+}
+
+func TestParserStackErrors(t *testing.T) {
+	p := newParser("", "", false, newOptions(nil))
+	if _, err := p.popContext(); err != nil {
+		t.Fatalf("Unexpected error popping the top level context: %v", err)
+	}
+	if _, err := p.popContext(); err == nil {
+		t.Fatal("Expected error popping an empty context stack")
+	}
+	if _, err := p.popKey(); err == nil {
+		t.Fatal("Expected error popping an empty key stack")
+	}
+	if _, err := p.popItemKey(); err == nil {
+		t.Fatal("Expected error popping an empty item key stack")
+	}
+	if it := p.next(); it.Type != itemEOF {
+		t.Fatalf("Expected EOF, got %v", it)
+	}
+	// The lexer keeps reporting EOF once it stopped.
+	if it := p.next(); it.Type != itemEOF {
+		t.Fatalf("Expected EOF, got %v", it)
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	for _, seed := range []string{
+		"foo = 1",
+		"a { b = [1, 2, {c = d}] }",
+		"a = [}",
+		"a = {]",
+		"a = $b",
+		"a = (\nblock\n)\n",
+		"{ a = 1 }",
+		"a = 2016-05-04T18:53:41Z",
+		"a = 1kb; b = -2.5",
+		"a = \"\\x4\"",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data string) {
+		// Includes are resolved relative to the working directory, so
+		// keep the fuzzer away from the file system.
+		if strings.Contains(strings.ToLower(data), "include") {
+			t.Skip()
+		}
+		Parse(data)
+		ParseWithChecks(data)
+	})
+}
+
+func TestUnclosedAtEOF(t *testing.T) {
+	for _, tt := range []struct {
+		conf string
+		err  string
+	}{
+		{"a = [ '", "array opened at line 1 never closed"},
+		{"a {\n  b = 1\n  c {\n   d = '", "map opened at line 3 never closed"},
+		{"x = 1\nfoo = { bar = \"", "map opened at line 2 never closed"},
+	} {
+		for _, pedantic := range []bool{false, true} {
+			_, err := parseData(tt.conf, "", pedantic)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Expected error %q for %q, got %v", tt.err, tt.conf, err)
+			}
+		}
+	}
+}
+
+func TestStrayClosingBrace(t *testing.T) {
+	for _, conf := range []string{
+		"a { b = 1 }}",
+		"a = 1\n}",
+		"{ a = 1 }\n}",
+		"a = 1 }",
+	} {
+		if _, err := Parse(conf); err != nil {
+			t.Errorf("Unexpected error for %q: %v", conf, err)
+		}
+		_, err := ParseWithChecks(conf)
+		if err == nil || !strings.Contains(err.Error(), "no matching '{'") {
+			t.Errorf("Expected error for %q, got %v", conf, err)
+		}
+	}
+}
+
+func TestQuotedKeysWithDots(t *testing.T) {
+	m, err := Parse(`
+		"my.key.with.dots" = 1
+		"path /api" {
+			timeout = 5
+		}
+		routes {
+			'user@example.com': admin
+			"nats.>" = 2
+		}
+	`, WithTypes(map[string]Kind{`routes."nats.>"`: KindString}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]any{
+		"my.key.with.dots": int64(1),
+		"path /api":        map[string]any{"timeout": int64(5)},
+		"routes": map[string]any{
+			"user@example.com": "admin",
+			"nats.>":           "2",
+		},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, expected)
+	}
+
+	changes := Diff(map[string]any{}, m)
+	var paths []string
+	for _, c := range changes {
+		paths = append(paths, c.Path)
+	}
+	expectedPaths := []string{`"my.key.with.dots"`, "path /api", "routes"}
+	if !reflect.DeepEqual(paths, expectedPaths) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", paths, expectedPaths)
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	for _, tt := range []struct {
+		data string
+		ex   any
+	}{
+		{`[ "a", "b" ]`, []any{"a", "b"}},
+		{"# servers\n[\n  nats://a:4222\n  nats://b:4222\n]\n", []any{"nats://a:4222", "nats://b:4222"}},
+		{"[{ port = 1 }, { port = 2\n}]", []any{map[string]any{"port": int64(1)}, map[string]any{"port": int64(2)}}},
+		{`"hello"`, "hello"},
+		{"4222 // port", int64(4222)},
+		{"true", true},
+		{"2s", "2s"},
+		{"a = 1\nb = [x]", map[string]any{"a": int64(1), "b": []any{"x"}}},
+		{"", map[string]any{}},
+	} {
+		v, err := ParseValue(tt.data)
+		if err != nil {
+			t.Fatalf("Unexpected error for %q: %v", tt.data, err)
+		}
+		if !reflect.DeepEqual(v, tt.ex) {
+			t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", v, tt.ex)
+		}
+	}
+
+	_, err := ParseValue("[a, b]\nc = 1")
+	if err == nil || !strings.Contains(err.Error(), "Expected the document to end after its value") {
+		t.Fatalf("Expected an error for keys after the value, got %v", err)
+	}
+}
+
+func TestValueIncludes(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.conf":    "servers = include 'servers.conf'\nall = [include 'servers.conf']\nport: include port.conf",
+		"servers.conf": "# routes\n[\n  nats://a:4222\n  nats://b:4222\n]",
+		"port.conf":    "4222",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	servers := []any{"nats://a:4222", "nats://b:4222"}
+	ex := map[string]any{
+		"servers": servers,
+		"all":     []any{servers},
+		"port":    int64(4222),
+	}
+	for _, opts := range [][]Option{nil, {WithIncludeCache(NewIncludeCache())}} {
+		m, err := ParseFile(filepath.Join(dir, "main.conf"), opts...)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(m, ex) {
+			t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, ex)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "merge.conf"), []byte("include 'servers.conf'"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseFile(filepath.Join(dir, "merge.conf")); err == nil {
+		t.Fatal("Expected an error merging a value include")
+	}
+}
+
+func TestTabWidthPositions(t *testing.T) {
+	m, err := ParseWithChecks("a {\n\tb = 1\n\t\tc = 2\n}", WithTabWidth(8))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tk := m["a"].(*Token).Value().(map[string]any)["c"].(*Token)
+	if tk.Line() != 3 || tk.Position() != 17 {
+		t.Fatalf("Unexpected position %d:%d", tk.Line(), tk.Position())
+	}
+}
+
+func TestTokenLiterals(t *testing.T) {
+	nkey := "UDXU4RCSJNZOIQHZNWXHXORDPRTGNJAHAHFRGZNEEJCPQTT2M7NLCNF4"
+	jwt := "0eyJ0eXAiOiJKV1QiLCJhbGciOiJlZDI1NTE5LW5rZXkifQ.eyJqdGkiOiJBQkMifQ.-_8x"
+	ex := map[string]any{
+		"operator":         jwt,
+		"resolver_preload": map[string]any{nkey: jwt},
+		"keys":             []any{nkey, "-" + nkey},
+	}
+	testParse(t, fmt.Sprintf("operator = %s\nresolver_preload { %s: %s }\nkeys = [%s, -%s]", jwt, nkey, jwt, nkey, nkey), ex)
+}
+
+func TestParseExactValue(t *testing.T) {
+	t.Setenv("X", "leaked")
+	for text, expected := range map[string]any{
+		"4222":          int64(4222),
+		" true ":        true,
+		"[a, b]":        []any{"a", "b"},
+		"{a: 1}":        map[string]any{"a": int64(1)},
+		"'a b'":         "a b",
+		"http://x:80/y": "http://x:80/y",
+		`env("X")`:      `env("X")`,
+		"uuid()":        "uuid()",
+	} {
+		v, ok := ParseExactValue(text)
+		if !ok || !reflect.DeepEqual(v, expected) {
+			t.Fatalf("Mismatch for %q:\nReceived: '%+v'\nExpected: '%+v'\n", text, v, expected)
+		}
+	}
+	for _, text := range []string{"", "x; y=1", "a b c", "hello # x", "$HOME", "1, 2", "[$a]"} {
+		if v, ok := ParseExactValue(text); ok {
+			t.Fatalf("Expected %q not to be a single value, got %+v", text, v)
+		}
+	}
+}
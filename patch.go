@@ -0,0 +1,443 @@
+package conf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PatchOp is an operation of a JSON Patch, RFC 6902.
+type PatchOp struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	From  string `json:"from,omitempty"`
+	Value any    `json:"value,omitempty"`
+}
+
+// MarshalJSON writes the value of add, replace and test operations even
+// when it is a zero value, such as false.
+func (op PatchOp) MarshalJSON() ([]byte, error) {
+	type plain PatchOp
+	if op.Op != "add" && op.Op != "replace" && op.Op != "test" {
+		return json.Marshal(plain(op))
+	}
+	return json.Marshal(struct {
+		plain
+		Value any `json:"value"`
+	}{plain(op), op.Value})
+}
+
+// ApplyPatch returns a copy of m with patch applied, which is either a
+// JSON Patch, RFC 6902, as a JSON array of operations, or a JSON merge
+// patch, RFC 7386, as a JSON object. m is left unchanged, so configs held
+// by a Store can be patched and the result passed to Store.Update:
+//
+//	m, err := conf.ApplyPatch(s.Load(), body)
+//	if err != nil {
+//		return err
+//	}
+//	_, err = s.Update(m)
+//
+// A JSON Patch is applied as a whole or not at all, and fails on the
+// first operation that fails, including a failed test. JSON numbers become
+// integers when they are whole and floats otherwise. Configs have no null
+// values, so null removes a key in a merge patch, keys set to null are left
+// out of the maps of operation values, and a null operation value fails.
+// Tokens of a parse with checks are replaced by their values.
+func ApplyPatch(m map[string]any, patch []byte) (map[string]any, error) {
+	d := json.NewDecoder(bytes.NewReader(patch))
+	d.UseNumber()
+	var p any
+	if err := d.Decode(&p); err != nil {
+		return nil, fmt.Errorf("invalid patch: %v", err)
+	}
+	doc := stripValue(m).(map[string]any)
+	switch pp := p.(type) {
+	case map[string]any:
+		return mergePatch(doc, pp).(map[string]any), nil
+	case []any:
+		var ops []PatchOp
+		if err := json.Unmarshal(patch, &ops); err != nil {
+			return nil, fmt.Errorf("invalid patch: %v", err)
+		}
+		var res any = doc
+		for i, op := range ops {
+			// Take the values from the decoding with numbers.
+			op.Value = pp[i].(map[string]any)["value"]
+			var err error
+			if res, err = applyOp(res, op); err != nil {
+				return nil, fmt.Errorf("patch operation %d: %s '%s': %v", i, op.Op, op.Path, err)
+			}
+		}
+		return res.(map[string]any), nil
+	}
+	return nil, fmt.Errorf("invalid patch: expected an array or an object, got %s", kindOf(jsonValue(p)))
+}
+
+// mergePatch applies the merge patch p to target, RFC 7386.
+func mergePatch(target any, p any) any {
+	pm, ok := p.(map[string]any)
+	if !ok {
+		return jsonValue(p)
+	}
+	tm, ok := target.(map[string]any)
+	if !ok {
+		tm = make(map[string]any)
+	}
+	for k, v := range pm {
+		if v == nil {
+			delete(tm, k)
+			continue
+		}
+		tm[k] = mergePatch(tm[k], v)
+	}
+	return tm
+}
+
+// applyOp applies the JSON Patch operation op to doc and returns it.
+func applyOp(doc any, op PatchOp) (any, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	value := func() (any, error) {
+		if op.Value == nil {
+			return nil, fmt.Errorf("missing or null value")
+		}
+		return jsonValue(op.Value), nil
+	}
+	switch op.Op {
+	case "add", "replace":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		return setPointer(doc, path, v, op.Op == "add")
+	case "remove":
+		_, doc, err = removePointer(doc, path)
+		return doc, err
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		var v any
+		if op.Op == "move" {
+			if len(from) < len(path) && reflect.DeepEqual(from, path[:len(from)]) {
+				return nil, fmt.Errorf("can not move '%s' into itself", op.From)
+			}
+			v, doc, err = removePointer(doc, from)
+		} else {
+			v, err = getPointer(doc, from)
+			v = deepCopy(v)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("from '%s': %v", op.From, err)
+		}
+		return setPointer(doc, path, v, true)
+	case "test":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		got, err := getPointer(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonEqual(got, v) {
+			return nil, fmt.Errorf("test failed, value is %v", got)
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("unknown operation")
+}
+
+// jsonEqual reports whether a and b are equal as JSON values, so numbers
+// are equal when they are, whether integers or floats, as JSON does not
+// tell 1 from 1.0.
+func jsonEqual(a, b any) bool {
+	switch av := a.(type) {
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, e := range av {
+			be, ok := bv[k]
+			if !ok || !jsonEqual(e, be) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		bv, ok := b.([]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !jsonEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	case int64:
+		if bv, ok := b.(float64); ok {
+			return intEqualsFloat(av, bv)
+		}
+	case float64:
+		if bv, ok := b.(int64); ok {
+			return intEqualsFloat(bv, av)
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// intEqualsFloat reports whether f is exactly the integer i.
+func intEqualsFloat(i int64, f float64) bool {
+	return f >= math.MinInt64 && f < math.MaxInt64 && f == math.Trunc(f) && int64(f) == i
+}
+
+// parsePointer splits a JSON pointer, RFC 6901, into its reference tokens.
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if p[0] != '/' {
+		return nil, fmt.Errorf("invalid JSON pointer '%s'", p)
+	}
+	toks := strings.Split(p[1:], "/")
+	for i, t := range toks {
+		toks[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+	return toks, nil
+}
+
+// arrayIndex returns the index tok refers to in an array of length n,
+// which may be n itself, as with "-", when end is set.
+func arrayIndex(tok string, n int, end bool) (int, error) {
+	if tok == "-" && end {
+		return n, nil
+	}
+	i, err := strconv.Atoi(tok)
+	if err != nil || i < 0 || tok != strconv.Itoa(i) {
+		return 0, fmt.Errorf("invalid array index '%s'", tok)
+	}
+	if i > n || i == n && !end {
+		return 0, fmt.Errorf("array index %d out of range", i)
+	}
+	return i, nil
+}
+
+// getPointer returns the value at path in doc.
+func getPointer(doc any, path []string) (any, error) {
+	for _, tok := range path {
+		switch c := doc.(type) {
+		case map[string]any:
+			v, ok := c[tok]
+			if !ok {
+				return nil, fmt.Errorf("key '%s' not found", tok)
+			}
+			doc = v
+		case []any:
+			i, err := arrayIndex(tok, len(c), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = c[i]
+		default:
+			return nil, fmt.Errorf("can not look up '%s' in %s", tok, kindOf(doc))
+		}
+	}
+	return doc, nil
+}
+
+// setPointer sets the value at path in doc, inserting it into arrays when
+// add is set and replacing an existing value otherwise, and returns doc.
+func setPointer(doc any, path []string, v any, add bool) (any, error) {
+	if len(path) == 0 {
+		if _, ok := v.(map[string]any); !ok {
+			return nil, fmt.Errorf("the config must be a map, got %s", kindOf(v))
+		}
+		return v, nil
+	}
+	return updatePointer(doc, path, func(c any, tok string) (any, error) {
+		switch c := c.(type) {
+		case map[string]any:
+			if _, ok := c[tok]; !ok && !add {
+				return nil, fmt.Errorf("key '%s' not found", tok)
+			}
+			c[tok] = v
+			return c, nil
+		case []any:
+			i, err := arrayIndex(tok, len(c), add)
+			if err != nil {
+				return nil, err
+			}
+			if !add {
+				c[i] = v
+				return c, nil
+			}
+			return append(c[:i], append([]any{v}, c[i:]...)...), nil
+		}
+		return nil, fmt.Errorf("can not set '%s' in %s", tok, kindOf(c))
+	})
+}
+
+// removePointer removes the value at path from doc and returns it along
+// with doc.
+func removePointer(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("can not remove the config")
+	}
+	var removed any
+	doc, err := updatePointer(doc, path, func(c any, tok string) (any, error) {
+		switch c := c.(type) {
+		case map[string]any:
+			v, ok := c[tok]
+			if !ok {
+				return nil, fmt.Errorf("key '%s' not found", tok)
+			}
+			removed = v
+			delete(c, tok)
+			return c, nil
+		case []any:
+			i, err := arrayIndex(tok, len(c), false)
+			if err != nil {
+				return nil, err
+			}
+			removed = c[i]
+			return append(c[:i], c[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("can not remove '%s' from %s", tok, kindOf(c))
+	})
+	return removed, doc, err
+}
+
+// updatePointer calls fn with the map or array holding the last token of
+// path and that token, and stores the map or array fn returns in place of
+// it, as arrays change when elements are inserted or removed.
+func updatePointer(doc any, path []string, fn func(c any, tok string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+	child, err := getPointer(doc, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	nc, err := updatePointer(child, path[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+	switch c := doc.(type) {
+	case map[string]any:
+		c[path[0]] = nc
+	case []any:
+		i, _ := arrayIndex(path[0], len(c), false)
+		c[i] = nc
+	}
+	return doc, nil
+}
+
+// PatchFromDiff returns the JSON Patch, RFC 6902, of the changes returned
+// by Diff, which turns the old config into the new one with ApplyPatch.
+// Values are written as ToJSON writes them by default, so times become
+// strings.
+func PatchFromDiff(changes []Change) ([]byte, error) {
+	type patchChange struct {
+		Change
+		elems []pathElem
+	}
+	pcs := make([]patchChange, len(changes))
+	for i, c := range changes {
+		elems, err := parsePath(c.Path)
+		if err != nil {
+			return nil, err
+		}
+		pcs[i] = patchChange{c, elems}
+	}
+	// Removed array elements go last to first, so every index is still
+	// valid when its removal applies, and added ones first to last. An
+	// array either grows or shrinks, so removals can go first.
+	sort.SliceStable(pcs, func(i, j int) bool {
+		ri, rj := pcs[i].Kind == Removed, pcs[j].Kind == Removed
+		if ri != rj {
+			return ri
+		}
+		c := comparePath(pcs[i].elems, pcs[j].elems)
+		if ri {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	ops := make([]PatchOp, 0, len(pcs))
+	for _, c := range pcs {
+		op := PatchOp{Path: jsonPointer(c.elems)}
+		v := c.New
+		switch c.Kind {
+		case Added:
+			op.Op = "add"
+		case Removed:
+			op.Op = "remove"
+			v = nil
+		case Modified:
+			op.Op = "replace"
+		}
+		if v != nil {
+			data, err := ToJSON(map[string]any{"v": v}, JSONOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", c.Path, err)
+			}
+			var raw struct{ V json.RawMessage }
+			if err := json.Unmarshal(data, &raw); err != nil {
+				return nil, err
+			}
+			op.Value = raw.V
+		}
+		ops = append(ops, op)
+	}
+	return json.Marshal(ops)
+}
+
+// comparePath orders key paths by their keys and the numeric value of
+// their indexes.
+func comparePath(a, b []pathElem) int {
+	for i := range min(len(a), len(b)) {
+		ea, eb := a[i], b[i]
+		switch {
+		case ea.isIdx && eb.isIdx:
+			if ea.index != eb.index {
+				return ea.index - eb.index
+			}
+		case ea.isIdx != eb.isIdx:
+			if ea.isIdx {
+				return -1
+			}
+			return 1
+		default:
+			if c := strings.Compare(ea.key, eb.key); c != 0 {
+				return c
+			}
+		}
+	}
+	return len(a) - len(b)
+}
+
+// jsonPointer returns the JSON pointer of a key path.
+func jsonPointer(elems []pathElem) string {
+	var sb strings.Builder
+	for _, e := range elems {
+		sb.WriteByte('/')
+		if e.isIdx {
+			sb.WriteString(strconv.Itoa(e.index))
+			continue
+		}
+		sb.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(e.key))
+	}
+	return sb.String()
+}
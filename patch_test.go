@@ -0,0 +1,201 @@
+package conf
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyPatch(t *testing.T) {
+	m, err := ParseWithChecks(`
+		port = 4222
+		debug = true
+		tls { cert = a.pem; key = a.key }
+		servers = [a, b, c]
+		"a/b" = 1
+	`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	before := stripValue(m)
+
+	patched, err := ApplyPatch(m, []byte(`[
+		{"op": "test", "path": "/port", "value": 4222},
+		{"op": "replace", "path": "/port", "value": 4223},
+		{"op": "remove", "path": "/debug"},
+		{"op": "add", "path": "/servers/1", "value": "x"},
+		{"op": "add", "path": "/servers/-", "value": "d"},
+		{"op": "move", "path": "/tls/certificate", "from": "/tls/cert"},
+		{"op": "copy", "path": "/backup", "from": "/tls"},
+		{"op": "replace", "path": "/a~1b", "value": 1.5},
+		{"op": "add", "path": "/limits", "value": {"max": 10, "none": null, "off": false}}
+	]`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]any{
+		"port":    int64(4223),
+		"tls":     map[string]any{"certificate": "a.pem", "key": "a.key"},
+		"backup":  map[string]any{"certificate": "a.pem", "key": "a.key"},
+		"servers": []any{"a", "x", "b", "c", "d"},
+		"a/b":     1.5,
+		"limits":  map[string]any{"max": int64(10), "off": false},
+	}
+	if !reflect.DeepEqual(patched, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", patched, expected)
+	}
+	if !reflect.DeepEqual(stripValue(m), before) {
+		t.Fatalf("Expected the config to be left unchanged, got %+v", m)
+	}
+
+	patched, err = ApplyPatch(m, []byte(`{
+		"port": 4300,
+		"debug": null,
+		"tls": {"key": null, "ca": "ca.pem"},
+		"servers": ["z"],
+		"auth": {"user": "u", "token": null}
+	}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected = map[string]any{
+		"port":    int64(4300),
+		"tls":     map[string]any{"cert": "a.pem", "ca": "ca.pem"},
+		"servers": []any{"z"},
+		"a/b":     int64(1),
+		"auth":    map[string]any{"user": "u"},
+	}
+	if !reflect.DeepEqual(patched, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", patched, expected)
+	}
+}
+
+func TestApplyPatchTestNumbers(t *testing.T) {
+	m := map[string]any{"n": int64(1), "f": 2.0, "a": []any{int64(3), map[string]any{"x": 4.5}}}
+	for _, patch := range []string{
+		`[{"op": "test", "path": "/n", "value": 1.0}]`,
+		`[{"op": "test", "path": "/n", "value": 1}]`,
+		`[{"op": "test", "path": "/f", "value": 2}]`,
+		`[{"op": "test", "path": "/a", "value": [3.0, {"x": 4.5}]}]`,
+	} {
+		if _, err := ApplyPatch(m, []byte(patch)); err != nil {
+			t.Fatalf("Unexpected error for %s: %v", patch, err)
+		}
+	}
+	for _, patch := range []string{
+		`[{"op": "test", "path": "/n", "value": 1.5}]`,
+		`[{"op": "test", "path": "/n", "value": "1"}]`,
+		`[{"op": "test", "path": "/f", "value": 2.5}]`,
+		`[{"op": "test", "path": "/a", "value": [3, {"x": 4}]}]`,
+	} {
+		if _, err := ApplyPatch(m, []byte(patch)); err == nil || !strings.Contains(err.Error(), "test failed") {
+			t.Fatalf("Expected the test of %s to fail, got %v", patch, err)
+		}
+	}
+}
+
+func TestApplyPatchErrors(t *testing.T) {
+	m := map[string]any{
+		"port":    int64(4222),
+		"servers": []any{"a"},
+		"tls":     map[string]any{"cert": "a.pem"},
+	}
+	for _, test := range []struct {
+		patch string
+		err   string
+	}{
+		{`[{"op": "test", "path": "/port", "value": 1}]`, "patch operation 0: test '/port': test failed, value is 4222"},
+		{`[{"op": "add", "path": "/x", "value": 1}, {"op": "remove", "path": "/y"}]`, "patch operation 1: remove '/y': key 'y' not found"},
+		{`[{"op": "replace", "path": "/x", "value": 1}]`, "key 'x' not found"},
+		{`[{"op": "add", "path": "/servers/2", "value": "b"}]`, "array index 2 out of range"},
+		{`[{"op": "add", "path": "/servers/01", "value": "b"}]`, "invalid array index '01'"},
+		{`[{"op": "add", "path": "/port/x", "value": 1}]`, "can not set 'x' in int"},
+		{`[{"op": "add", "path": "/x"}]`, "missing or null value"},
+		{`[{"op": "move", "path": "/tls/old", "from": "/tls"}]`, "can not move '/tls' into itself"},
+		{`[{"op": "copy", "path": "/x", "from": "/y"}]`, "from '/y': key 'y' not found"},
+		{`[{"op": "remove", "path": ""}]`, "can not remove the config"},
+		{`[{"op": "replace", "path": "", "value": 1}]`, "the config must be a map, got int"},
+		{`[{"op": "add", "path": "port", "value": 1}]`, "invalid JSON pointer 'port'"},
+		{`[{"op": "merge", "path": "/port"}]`, "unknown operation"},
+		{`"port"`, "invalid patch: expected an array or an object, got string"},
+		{`[`, "invalid patch"},
+	} {
+		_, err := ApplyPatch(m, []byte(test.patch))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("Expected error containing %q for %s, got %v", test.err, test.patch, err)
+		}
+	}
+	// Operations before the failing one are not applied.
+	expected := map[string]any{
+		"port":    int64(4222),
+		"servers": []any{"a"},
+		"tls":     map[string]any{"cert": "a.pem"},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, expected)
+	}
+}
+
+func TestPatchFromDiff(t *testing.T) {
+	var short, long []string
+	for i := range 3 {
+		short = append(short, fmt.Sprintf("s%d", i))
+	}
+	for i := range 12 {
+		long = append(long, fmt.Sprintf("s%d", i))
+	}
+	for _, test := range []struct {
+		old, new string
+	}{
+		{
+			`port = 4222, debug = true, tls { cert = a.pem }, servers = [a, b, c]`,
+			`port = 4223, tls { cert = b.pem, key = k.pem }, servers = [a, x], name = n1, off = false`,
+		},
+		{
+			fmt.Sprintf("servers = [%s]", strings.Join(short, ", ")),
+			fmt.Sprintf("servers = [%s]", strings.Join(long, ", ")),
+		},
+		{
+			fmt.Sprintf("servers = [%s], n = [[1, 2, 3]]", strings.Join(long, ", ")),
+			fmt.Sprintf("servers = [%s], n = [[1]]", strings.Join(short, ", ")),
+		},
+		{
+			`"a.b" { "c/d" = 1, "e~f" = 2 }, size = 4kb`,
+			`"a.b" { "c/d" = 2, "e~f" = [1] }, size = 1.5`,
+		},
+	} {
+		old, err := Parse(test.old)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		new, err := ParseWithChecks(test.new)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		patch, err := PatchFromDiff(Diff(old, new))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		patched, err := ApplyPatch(old, patch)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v for %s", err, patch)
+		}
+		if !reflect.DeepEqual(patched, stripValue(new)) {
+			t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", patched, stripValue(new))
+		}
+	}
+
+	patch, err := PatchFromDiff([]Change{
+		{Kind: Removed, Path: "a[2]", Old: "c"},
+		{Kind: Removed, Path: "a[10]", Old: "k"},
+		{Kind: Modified, Path: "debug", Old: true, New: false},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `[{"op":"remove","path":"/a/10"},{"op":"remove","path":"/a/2"},{"op":"replace","path":"/debug","value":false}]`
+	if string(patch) != expected {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", string(patch), expected)
+	}
+}
@@ -0,0 +1,138 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Policy checks parsed configs against rules of the application, such as
+// compliance rules, and returns the violations found. Policies written in a
+// policy language, such as CEL or Rego, are added by implementing Policy
+// with its evaluator:
+//
+//	conf.PolicyFunc(func(m map[string]any) []conf.Violation {
+//		out, _, err := prg.Eval(map[string]any{"config": m})
+//		...
+//	})
+type Policy interface {
+	Check(m map[string]any) []Violation
+}
+
+// PolicyFunc adapts a function to a Policy.
+type PolicyFunc func(m map[string]any) []Violation
+
+func (f PolicyFunc) Check(m map[string]any) []Violation {
+	return f(m)
+}
+
+// Violation is a breach of a Policy.
+type Violation struct {
+	// Path is the key path of the value in violation, in the notation of
+	// Lookup, or empty for the config as a whole.
+	Path    string
+	Message string
+}
+
+// PolicyError is returned for a config violating a policy set with
+// WithPolicy, at the position the key of the violation was set at. A
+// parse violating several policies or one in several places returns the
+// errors joined, in the order of the policies and their violations.
+type PolicyError struct {
+	Policy    string
+	Violation Violation
+	File      string
+	Line      int
+	Pos       int
+}
+
+func (e *PolicyError) Error() string {
+	msg := fmt.Sprintf("policy '%s' violated: %s", e.Policy, e.Violation.Message)
+	if e.Violation.Path != "" {
+		msg = fmt.Sprintf("policy '%s' violated by key '%s': %s", e.Policy, e.Violation.Path, e.Violation.Message)
+	}
+	if e.Line == 0 {
+		if e.File == "" {
+			return msg
+		}
+		return fmt.Sprintf("%s (%s)", msg, e.File)
+	}
+	return fmt.Sprintf("%s (%s:%d:%d)", msg, e.File, e.Line, e.Pos)
+}
+
+// WithPolicy checks every parsed config against the policy p named name,
+// once it is complete and its schemas are validated, so rules such as "no
+// plaintext passwords" or "TLS required when listening beyond localhost"
+// are enforced by every parse, reload and Load:
+//
+//	conf.WithPolicy("tls-required", conf.PolicyFunc(func(m map[string]any) []conf.Violation {
+//		if m["listen"] != "127.0.0.1" && m["tls"] == nil {
+//			return []conf.Violation{{Path: "listen", Message: "TLS is required"}}
+//		}
+//		return nil
+//	}))
+//
+// The policy sees the config without the tokens of a parse with checks.
+// Violations fail the parse with *PolicyError errors. Policies apply to
+// the merged config of ParseAll and ParseFiles rather than to each of the
+// documents.
+func WithPolicy(name string, p Policy) Option {
+	return func(o *options) {
+		o.policies = append(o.policies, namedPolicy{name: name, policy: p})
+	}
+}
+
+type namedPolicy struct {
+	name   string
+	policy Policy
+}
+
+// checkPolicies checks m, the config of the parse of the file fp, against
+// the policies of o.
+func (s *parseState) checkPolicies(o *options, fp string, m map[string]any, pedantic bool) error {
+	if len(o.policies) == 0 {
+		return nil
+	}
+	plain := m
+	if pedantic {
+		plain = StripTokens(m)
+	}
+	var errs []error
+	for _, np := range o.policies {
+		for _, v := range np.policy.Check(plain) {
+			e := &PolicyError{Policy: np.name, Violation: v, File: fp}
+			e.File, e.Line, e.Pos = s.position(m, v.Path, fp)
+			errs = append(errs, e)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// position returns where the key path was set, or where the closest key
+// leading to it was set, falling back to the file fp.
+func (s *parseState) position(m map[string]any, path, fp string) (string, int, int) {
+	elems, err := parsePath(path)
+	if err != nil {
+		return fp, 0, 0
+	}
+	for i := len(elems); i > 0; i-- {
+		p := formatPath(elems[:i])
+		if tk, ok := lookupToken(m, p); ok {
+			return tk.SourceFile(), tk.Line(), tk.Position()
+		}
+		if pos, ok := s.positions[p]; ok {
+			return pos.file, pos.line, pos.col
+		}
+	}
+	return fp, 0, 0
+}
+
+// lookupToken returns the token at the key path of m from a parse with
+// checks.
+func lookupToken(m map[string]any, path string) (*Token, bool) {
+	v, ok := Lookup(m, path)
+	if !ok {
+		return nil, false
+	}
+	tk, ok := v.(*Token)
+	return tk, ok
+}
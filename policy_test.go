@@ -0,0 +1,75 @@
+package conf
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// plaintextPasswords reports passwords that are not bcrypt hashes.
+var plaintextPasswords = PolicyFunc(func(m map[string]any) []Violation {
+	var vs []Violation
+	for _, match := range Search(m, func(path string, v any) bool {
+		s, ok := v.(string)
+		return strings.HasSuffix(path, "password") && ok && !strings.HasPrefix(s, "$2a$")
+	}) {
+		vs = append(vs, Violation{Path: match.Path, Message: "plaintext password"})
+	}
+	return vs
+})
+
+// tlsRequired reports a listen address beyond localhost without TLS.
+var tlsRequired = PolicyFunc(func(m map[string]any) []Violation {
+	listen, _ := m["listen"].(string)
+	if listen != "" && !strings.HasPrefix(listen, "127.0.0.1:") && m["tls"] == nil {
+		return []Violation{{Path: "listen", Message: "TLS is required when listening beyond localhost"}}
+	}
+	return nil
+})
+
+func TestPolicy(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "server.conf")
+	writeTestFile(t, filepath.Join(dir, "users.conf"), "users = [\n  { user: a, password: secret }\n  { user: b, password: \"$2a$11$x\" }\n]\n")
+	writeTestFile(t, root, "listen: \"0.0.0.0:4222\"\ninclude users.conf\n")
+
+	opts := []Option{WithPolicy("no-plaintext-passwords", plaintextPasswords), WithPolicy("tls-required", tlsRequired)}
+	cached := append([]Option{WithIncludeCache(NewIncludeCache())}, opts...)
+	for _, parse := range []func() error{
+		func() error { _, err := ParseFile(root, opts...); return err },
+		// A cached include would not record the positions of its keys.
+		func() error { _, err := ParseFile(root, cached...); return err },
+		func() error { _, err := ParseFile(root, cached...); return err },
+		func() error { _, err := ParseFileWithChecks(root, opts...); return err },
+		func() error { _, err := Load(root, opts...); return err },
+	} {
+		err := parse()
+		var pe *PolicyError
+		if !errors.As(err, &pe) {
+			t.Fatalf("Expected a policy error, got %v", err)
+		}
+		expected := []string{
+			"policy 'no-plaintext-passwords' violated by key 'users[0].password': plaintext password (" + filepath.Join(dir, "users.conf") + ":",
+			"policy 'tls-required' violated by key 'listen': TLS is required when listening beyond localhost (" + root + ":1:0)",
+		}
+		lines := strings.Split(err.Error(), "\n")
+		if len(lines) != len(expected) {
+			t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", lines, expected)
+		}
+		for i, line := range lines {
+			if !strings.HasPrefix(line, expected[i]) {
+				t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", line, expected[i])
+			}
+		}
+	}
+
+	writeTestFile(t, root, "listen: \"127.0.0.1:4222\"\n")
+	if _, err := ParseFile(root, opts...); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err := ParseAll([]string{"listen: \"127.0.0.1:4222\"", "listen: \"10.0.0.1:4222\""}, opts...)
+	if err == nil || err.Error() != "policy 'tls-required' violated by key 'listen': TLS is required when listening beyond localhost (:1:0)" {
+		t.Fatalf("Expected error for the merged config, got %v", err)
+	}
+}
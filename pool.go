@@ -0,0 +1,36 @@
+package conf
+
+import "sync"
+
+// maxPooledMap is the number of keys above which a released map is left
+// to the garbage collector rather than pooled, so a few large maps do not
+// keep their memory alive in the pool for the small maps most parses
+// need.
+const maxPooledMap = 64
+
+// mapPool holds the maps of released results, see Result.Release.
+var mapPool = sync.Pool{
+	New: func() any { return make(map[string]any) },
+}
+
+// newMap returns an empty map for a map of the config, from the pool when
+// one is available. The maps of a parse for Load are recorded, so
+// Result.Release can return them to the pool.
+func (p *parser) newMap() map[string]any {
+	m := mapPool.Get().(map[string]any)
+	if p.opts.track {
+		p.state.maps = append(p.state.maps, m)
+	}
+	return m
+}
+
+// releaseMaps clears the maps and returns them to the pool.
+func releaseMaps(maps []map[string]any) {
+	for _, m := range maps {
+		if len(m) > maxPooledMap {
+			continue
+		}
+		clear(m)
+		mapPool.Put(m)
+	}
+}
@@ -0,0 +1,48 @@
+package conf
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResultRelease(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "app.conf")
+	data := "port = 4222\ntls { cert = a.pem, opts { verify = true } }\nroutes = [{url: a}, {url: b}]"
+	if err := os.WriteFile(fp, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ParseFile(fp)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for range 3 {
+		r, err := Load(fp)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(r.Config, expected) {
+			t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", r.Config, expected)
+		}
+		if len(r.maps) != 4 {
+			t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", len(r.maps), 4)
+		}
+		tls := r.Config["tls"].(map[string]any)
+		r.Release()
+		if r.Config != nil || len(tls) != 0 {
+			t.Fatalf("Expected the config to be released, got %+v", tls)
+		}
+		r.Release()
+	}
+
+	// Maps are not recorded outside of Load, so they are never released.
+	p, err := parseData(data, "", false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if p.state.maps != nil {
+		t.Fatalf("Unexpected maps recorded: %+v", p.state.maps)
+	}
+}
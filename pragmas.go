@@ -0,0 +1,89 @@
+package conf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// filePragmas are the pragmas a config file can use to change the options
+// it is parsed with, see applyPragmas.
+var filePragmas = map[string]Option{
+	"strict-duplicates": WithStrictDuplicates(),
+	"no-env":            WithoutEnv(),
+	"no-file":           WithoutFileFunc(),
+	"no-variables":      WithVariables(false),
+}
+
+// WithStrictDuplicates rejects keys set more than once in the same map,
+// which otherwise replace the earlier value. Keys set by include files and
+// map spreads may still be overridden, layers still replace the values of
+// earlier layers, and blocks collected with WithRepeatedBlocks are not
+// duplicates.
+func WithStrictDuplicates() Option {
+	return func(o *options) {
+		o.strictDuplicates = true
+	}
+}
+
+// applyPragmas applies the pragmas in the comments at the top of the file
+// data, before anything else, to the options p parses it with:
+//
+//	# conf: strict-duplicates, no-env
+//
+// The pragmas are strict-duplicates for WithStrictDuplicates, no-env for
+// WithoutEnv, no-file for WithoutFileFunc and no-variables for
+// WithVariables(false). They only apply to the file they are in, not to
+// the files it includes, so stricter rules can be adopted file by file.
+func (p *parser) applyPragmas(data string) error {
+	var opts []Option
+	for n, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		comment, ok := strings.CutPrefix(line, "#")
+		if !ok {
+			if comment, ok = strings.CutPrefix(line, "//"); !ok {
+				break
+			}
+		}
+		v, ok := annotation(comment, pragmaPrefix)
+		if !ok {
+			continue
+		}
+		for _, word := range pragmaWords(v) {
+			opt, ok := filePragmas[word]
+			if !ok {
+				return &ParseError{File: p.file, Line: n + 1, Err: fmt.Errorf("unknown pragma '%s'", word)}
+			}
+			opts = append(opts, opt)
+		}
+	}
+	if len(opts) == 0 {
+		return nil
+	}
+	o := *p.opts
+	for _, opt := range opts {
+		opt(&o)
+	}
+	p.opts = &o
+	return nil
+}
+
+// checkDuplicate reports an error when key is already set in ctx, unless
+// it was set by an include or map spread, or val is a repeated block.
+func (p *parser) checkDuplicate(ctx map[string]any, key string, it item, val any) error {
+	path := joinPath(p.keyPrefix(), key)
+	if p.merging {
+		if p.state.merged == nil {
+			p.state.merged = make(map[string]bool)
+		}
+		p.state.merged[path] = true
+		return nil
+	}
+	prev, ok := ctx[key]
+	if !ok || p.state.merged[path] || p.collects(path, prev, val) {
+		return nil
+	}
+	return p.errorf(it, "duplicate key '%s'", path)
+}
@@ -0,0 +1,82 @@
+package conf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStrictDuplicates(t *testing.T) {
+	for _, tc := range []struct {
+		name, data, err string
+	}{
+		{"unique", "a = 1\nb { a = 2 }", ""},
+		{"duplicate", "a = 1\nb = 2\na = 3", "duplicate key 'a' (:3:1)"},
+		{"nested", "b {\n  a = 1\n  a = 2\n}", "duplicate key 'b.a' (:3:3)"},
+		{"spread", "defaults { a = 1 }\nb { $defaults...\n  a = 2 }", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(tc.data, WithStrictDuplicates())
+			if tc.err == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tc.err {
+				t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", err, tc.err)
+			}
+		})
+	}
+
+	if _, err := Parse("s { a = 1 }\ns { a = 2 }", WithStrictDuplicates(), WithRepeatedBlocks()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestPragmas(t *testing.T) {
+	t.Setenv("CONF_TEST_PRAGMA", "x")
+	for _, tc := range []struct {
+		name, data, err string
+	}{
+		{"none", "a = 1\na = $CONF_TEST_PRAGMA", ""},
+		{"strict", "# conf: strict-duplicates\na = 1\na = 2", "duplicate key 'a' (:3:1)"},
+		{"after header comments", "# Service config.\n\n// conf: no-env\na = $CONF_TEST_PRAGMA",
+			"variable reference for 'CONF_TEST_PRAGMA' can not be found (:4:6)"},
+		{"several", "#conf: strict-duplicates, no-env\na = 1", ""},
+		{"not at the top", "a = 1\n# conf: strict-duplicates\na = 2", ""},
+		{"unknown", "# conf: strict-everything", "unknown pragma 'strict-everything' (:1:0)"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(tc.data)
+			if tc.err == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tc.err {
+				t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestPragmasInclude(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"app.conf":    "# conf: strict-duplicates\ninclude lax.conf\ninclude strict.conf",
+		"lax.conf":    "a = 1\na = 2",
+		"strict.conf": "# conf: strict-duplicates\nb = 1\nb = 2",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := ParseFile(filepath.Join(dir, "app.conf"))
+	expected := "error parsing include file 'strict.conf', duplicate key 'b' (" + filepath.Join(dir, "strict.conf") + ":3:1)"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", err, expected)
+	}
+}
@@ -0,0 +1,120 @@
+package conf
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// maxExactInt is the largest integer a float64 holds exactly.
+const maxExactInt = 1 << 53
+
+// ToProtoValues converts a config to the values a google.protobuf.Struct
+// holds, which are nil, float64, string, bool, []any and map[string]any,
+// so it converts without loss with structpb:
+//
+//	s, err := structpb.NewStruct(conf.ToProtoValues(m))
+//
+// Integers and sizes become numbers when a float64 holds them exactly and
+// decimal strings otherwise, datetimes become RFC 3339 strings and bytes
+// become base64 strings, as in the JSON mapping of protobuf.
+// FromProtoValues converts them back.
+func ToProtoValues(m map[string]any) map[string]any {
+	return toProtoValue(m).(map[string]any)
+}
+
+func toProtoValue(v any) any {
+	v = plainValue(v)
+	if n, ok := unitValue(v); ok {
+		v = n
+	}
+	switch vv := v.(type) {
+	case map[string]any:
+		pm := make(map[string]any, len(vv))
+		for k, e := range vv {
+			pm[k] = toProtoValue(e)
+		}
+		return pm
+	case []any:
+		arr := make([]any, len(vv))
+		for i, e := range vv {
+			arr[i] = toProtoValue(e)
+		}
+		return arr
+	case int64:
+		if vv < -maxExactInt || vv > maxExactInt {
+			return strconv.FormatInt(vv, 10)
+		}
+		return float64(vv)
+	case time.Time:
+		return vv.Format(time.RFC3339Nano)
+	case []byte:
+		return base64.StdEncoding.EncodeToString(vv)
+	}
+	return v
+}
+
+// FromProtoValues converts the values of a google.protobuf.Struct, as
+// returned by its AsMap method, back to a config. Whole numbers become
+// integers. Values whose kind is declared in types by their full key path,
+// as with WithTypes, are converted to it, which restores integers kept as
+// strings by ToProtoValues, datetimes from RFC 3339 strings and bytes from
+// base64 strings.
+func FromProtoValues(m map[string]any, types map[string]Kind) (map[string]any, error) {
+	canonical := make(map[string]Kind, len(types))
+	for path, k := range types {
+		canonical[canonicalPath(path)] = k
+	}
+	v, err := fromProtoValue(m, "", canonical)
+	if err != nil {
+		return nil, err
+	}
+	return v.(map[string]any), nil
+}
+
+func fromProtoValue(v any, path string, types map[string]Kind) (any, error) {
+	switch vv := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(vv))
+		for k, e := range vv {
+			cv, err := fromProtoValue(e, joinPath(path, k), types)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = cv
+		}
+		return m, nil
+	case []any:
+		arr := make([]any, len(vv))
+		for i, e := range vv {
+			cv, err := fromProtoValue(e, fmt.Sprintf("%s[%d]", path, i), types)
+			if err != nil {
+				return nil, err
+			}
+			arr[i] = cv
+		}
+		return arr, nil
+	case float64:
+		if vv == math.Trunc(vv) && math.Abs(vv) <= maxExactInt {
+			v = int64(vv)
+		}
+	}
+
+	want, ok := types[path]
+	if !ok || want == KindAny || kindOf(v) == want {
+		return v, nil
+	}
+	if s, ok := v.(string); ok && want == KindBytes {
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("expected base64 bytes for key '%s': %v", path, err)
+		}
+		return b, nil
+	}
+	if cv, ok := coerce(v, want); ok {
+		return cv, nil
+	}
+	return nil, fmt.Errorf("expected %s for key '%s', got %s '%v'", want, path, kindOf(v), v)
+}
@@ -0,0 +1,79 @@
+package conf
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestProtoValues(t *testing.T) {
+	m, err := ParseWithChecks(`
+		port = 4222
+		big = 9007199254740993
+		ratio = 2.0
+		max_payload = 1mb
+		started = 2024-05-01T10:00:00Z
+		name = west
+		tags = [a, 1]
+		cluster { enabled = true }
+	`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	pv := ToProtoValues(m)
+	ex := map[string]any{
+		"port":        float64(4222),
+		"big":         "9007199254740993",
+		"ratio":       2.0,
+		"max_payload": float64(1 << 20),
+		"started":     "2024-05-01T10:00:00Z",
+		"name":        "west",
+		"tags":        []any{"a", float64(1)},
+		"cluster":     map[string]any{"enabled": true},
+	}
+	if !reflect.DeepEqual(pv, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", pv, ex)
+	}
+
+	// The values survive a round trip through JSON, as a Struct would.
+	data, err := json.Marshal(pv)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	back, err := FromProtoValues(decoded, map[string]Kind{
+		"big":     KindInt,
+		"ratio":   KindFloat,
+		"started": KindTime,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	exBack := map[string]any{
+		"port":        int64(4222),
+		"big":         int64(9007199254740993),
+		"ratio":       2.0,
+		"max_payload": int64(1 << 20),
+		"started":     time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		"name":        "west",
+		"tags":        []any{"a", int64(1)},
+		"cluster":     map[string]any{"enabled": true},
+	}
+	if !reflect.DeepEqual(back, exBack) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", back, exBack)
+	}
+
+	bytes, err := FromProtoValues(map[string]any{"key": ToProtoValues(map[string]any{"k": []byte("secret")})["k"]},
+		map[string]Kind{"key": KindBytes})
+	if err != nil || string(bytes["key"].([]byte)) != "secret" {
+		t.Fatalf("Unexpected bytes: %+v, %v", bytes, err)
+	}
+	if _, err := FromProtoValues(map[string]any{"port": "abc"}, map[string]Kind{"port": KindInt}); err == nil ||
+		err.Error() != "expected integer for key 'port', got string 'abc'" {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package conf
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WithRanges constrains values by their full key path. A range holds a
+// minimum, a maximum or both, separated by a comma. Bounds are numbers,
+// sizes such as 512k or 1gb, or durations such as 1s or 10m; bounds that
+// read as a duration are durations:
+//
+//	conf.WithRanges(map[string]string{
+//		"port":        "min=1,max=65535",
+//		"max_payload": "max=1gb",
+//		"timeout":     "min=1s,max=10m",
+//	})
+//
+// Values of keys with duration bounds must be durations, which are written
+// like strings, e.g. 30s or 1h30m. Their suffixes are never expanded, so
+// 10m is ten minutes rather than ten million. Values outside their range
+// are reported as written, at their position. Every parse fails when a
+// range is invalid.
+func WithRanges(ranges map[string]string) Option {
+	return func(o *options) {
+		if o.ranges == nil {
+			o.ranges = make(map[string]valueRange, len(ranges))
+		}
+		for path, spec := range ranges {
+			r, err := parseRange(spec)
+			if err != nil {
+				o.err = fmt.Errorf("invalid range '%s' for key '%s': %v", spec, path, err)
+				return
+			}
+			o.ranges[canonicalPath(path)] = r
+		}
+	}
+}
+
+// valueRange is a range declared with WithRanges.
+type valueRange struct {
+	duration bool
+	min, max *rangeBound
+}
+
+type rangeBound struct {
+	n       float64
+	literal string
+}
+
+func parseRange(spec string) (valueRange, error) {
+	var r valueRange
+	kinds := make(map[bool]bool)
+	for _, part := range strings.Split(spec, ",") {
+		name, lit, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return r, fmt.Errorf("expected min=value or max=value, got '%s'", part)
+		}
+		n, duration, err := parseBound(lit)
+		if err != nil {
+			return r, err
+		}
+		kinds[duration] = true
+		b := &rangeBound{n: n, literal: lit}
+		switch name {
+		case "min":
+			r.min = b
+		case "max":
+			r.max = b
+		default:
+			return r, fmt.Errorf("unknown bound '%s'", name)
+		}
+		r.duration = duration
+	}
+	if len(kinds) > 1 {
+		return r, fmt.Errorf("bounds mix durations and numbers")
+	}
+	if r.min != nil && r.max != nil && r.min.n > r.max.n {
+		return r, fmt.Errorf("minimum %s is above maximum %s", r.min.literal, r.max.literal)
+	}
+	return r, nil
+}
+
+// parseBound parses the literal of a bound, reporting whether it is a
+// duration, in which case n is in nanoseconds.
+func parseBound(lit string) (n float64, duration bool, err error) {
+	if f, err := strconv.ParseFloat(lit, 64); err == nil {
+		return f, false, nil
+	}
+	if d, err := time.ParseDuration(lit); err == nil {
+		return float64(d), true, nil
+	}
+	if f, ok := sizeValue(lit); ok {
+		return f, false, nil
+	}
+	return 0, false, fmt.Errorf("invalid bound '%s'", lit)
+}
+
+// sizeValue parses an integer with a known suffix, such as 4kb.
+func sizeValue(s string) (float64, bool) {
+	_, suffix := parseNumberSuffix(s)
+	if suffix == "" || applySuffix(1, suffix) == int64(1) {
+		return 0, false
+	}
+	num, err := parseInteger(s)
+	if err != nil {
+		return 0, false
+	}
+	return float64(num.(int64)), true
+}
+
+// durationRange reports whether the current key has duration bounds, so
+// suffixes of its value are not expanded.
+func (p *parser) durationRange() bool {
+	r, ok := p.opts.ranges[p.keyPrefix()]
+	return ok && r.duration
+}
+
+// checkRange reports an error when val, set from it under the current key,
+// is outside the range declared for the key.
+func (p *parser) checkRange(it item, val any) error {
+	if _, ok := p.ctx.(map[string]any); !ok || len(p.keys) == 0 {
+		return nil
+	}
+	path := p.keyPrefix()
+	r, ok := p.opts.ranges[path]
+	if !ok {
+		return nil
+	}
+	v := plainValue(val)
+	lit := fmt.Sprint(stripValue(v))
+	switch it.Type {
+	case itemInteger, itemFloat, itemString:
+		lit = it.Val
+	}
+
+	var n float64
+	if r.duration {
+		s, ok := v.(string)
+		d, err := time.ParseDuration(s)
+		if !ok || err != nil {
+			return p.errorf(it, "expected a duration for key '%s', got '%s'", path, lit)
+		}
+		n = float64(d)
+	} else {
+		switch vv := v.(type) {
+		case int64:
+			n = float64(vv)
+		case float64:
+			n = vv
+		case ByteSize, SIQuantity:
+			i, _ := unitValue(vv)
+			n = float64(i)
+		case string:
+			f, err := strconv.ParseFloat(vv, 64)
+			if err != nil {
+				if f, ok = sizeValue(vv); !ok {
+					return p.errorf(it, "expected a number for key '%s', got '%s'", path, lit)
+				}
+			}
+			n = f
+		default:
+			return p.errorf(it, "expected a number for key '%s', got '%s'", path, lit)
+		}
+	}
+	if r.min != nil && n < r.min.n {
+		return p.errorf(it, "value '%s' for key '%s' is below the minimum of %s", lit, path, r.min.literal)
+	}
+	if r.max != nil && n > r.max.n {
+		return p.errorf(it, "value '%s' for key '%s' is above the maximum of %s", lit, path, r.max.literal)
+	}
+	return nil
+}
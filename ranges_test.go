@@ -0,0 +1,74 @@
+package conf
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testRanges = map[string]string{
+	"port":               "min=1,max=65535",
+	"limits.max_payload": "max=1gb",
+	"timeouts.read":      "min=1s,max=10m",
+	"ratio":              "min=0.5",
+}
+
+func TestWithRanges(t *testing.T) {
+	data := `
+port = 4222
+limits { max_payload = 512mb }
+timeouts { read = 10m }
+ratio = 2.5
+`
+	m, err := Parse(data, WithRanges(testRanges))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ex := map[string]any{
+		"port":     int64(4222),
+		"limits":   map[string]any{"max_payload": int64(512 * 1024 * 1024)},
+		"timeouts": map[string]any{"read": "10m"},
+		"ratio":    2.5,
+	}
+	if !reflect.DeepEqual(m, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, ex)
+	}
+}
+
+func TestWithRangesViolations(t *testing.T) {
+	for data, expected := range map[string]string{
+		"port = 0":                         "value '0' for key 'port' is below the minimum of 1 (:1:7)",
+		"port = 70k":                       "value '70k' for key 'port' is above the maximum of 65535 (:1:7)",
+		"limits {\n  max_payload = 2gb\n}": "value '2gb' for key 'limits.max_payload' is above the maximum of 1gb (:2:17)",
+		"timeouts { read = 500ms }":        "value '500ms' for key 'timeouts.read' is below the minimum of 1s (:1:18)",
+		"timeouts { read = 1h }":           "value '1h' for key 'timeouts.read' is above the maximum of 10m (:1:18)",
+		"timeouts { read = 30 }":           "expected a duration for key 'timeouts.read', got '30' (:1:18)",
+		"ratio = 0.25":                     "value '0.25' for key 'ratio' is below the minimum of 0.5 (:1:8)",
+		"port = abc":                       "expected a number for key 'port', got 'abc' (:1:7)",
+	} {
+		_, err := Parse(data, WithRanges(testRanges))
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("Expected error containing %q for %q, got %v", expected, data, err)
+		}
+	}
+
+	// Parses with checks report the same violations.
+	if _, err := ParseWithChecks("port = 0", WithRanges(testRanges)); err == nil {
+		t.Fatal("Expected a range error")
+	}
+}
+
+func TestWithRangesInvalid(t *testing.T) {
+	for spec, expected := range map[string]string{
+		"min=1s,max=1gb": "bounds mix durations and numbers",
+		"max=lots":       "invalid bound 'lots'",
+		"limit=1":        "unknown bound 'limit'",
+		"min=10,max=1":   "minimum 10 is above maximum 1",
+		"10":             "expected min=value or max=value, got '10'",
+	} {
+		_, err := Parse("port = 1", WithRanges(map[string]string{"port": spec}))
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("Expected error containing %q for %q, got %v", expected, spec, err)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Reload is what a reload handler is called with.
+type Reload struct {
+	// Config is the new config, which must not be modified.
+	Config map[string]any
+
+	// Changes are the changes at or below the path of the handler.
+	Changes []Change
+
+	// DryRun is set when the config is only checked, by Store.Validate.
+	// The handler must then report whether it could apply the changes,
+	// without applying them.
+	DryRun bool
+}
+
+// ReloadFunc applies a reload to the component of a reload handler.
+type ReloadFunc func(r *Reload) error
+
+// reloadHandler is a ReloadFunc registered with Store.Handle.
+type reloadHandler struct {
+	name    string
+	pattern []pathElem
+	after   []string
+	fn      ReloadFunc
+}
+
+// Handle registers fn as the reload handler called name for the values at
+// or below the key path pattern, matched as with SubscribePath. On every
+// reload, update or rollback that changes such values, fn is called with
+// those changes once the new config is swapped in.
+//
+// Handlers run in the order of their dependencies: fn runs after the
+// handlers named in after, such as a listener restarted after the TLS
+// config it uses was reloaded. Handlers without dependencies between them
+// run in the order they were registered. All handlers run even when some
+// fail, and their errors are returned together by the reload, as are
+// dependencies on unknown handlers and dependency cycles, in which case no
+// handler runs. Handlers run synchronously and must not call Reload.
+func (s *Store) Handle(name, pattern string, fn ReloadFunc, after ...string) error {
+	elems, err := parsePath(pattern)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, h := range s.handlers {
+		if h.name == name {
+			return fmt.Errorf("reload handler '%s' is already registered", name)
+		}
+	}
+	s.handlers = append(s.handlers, &reloadHandler{name: name, pattern: elems, after: after, fn: fn})
+	return nil
+}
+
+// runHandlers calls the handlers of the values changed by changes, in
+// the order of their dependencies. The caller must hold s.mu.
+func (s *Store) runHandlers(m map[string]any, changes []Change, dryRun bool) error {
+	order, err := s.handlerOrder()
+	if err != nil {
+		return err
+	}
+	paths := make([][]pathElem, len(changes))
+	for i, c := range changes {
+		paths[i], _ = parsePath(c.Path)
+	}
+	var errs []error
+	for _, h := range order {
+		var matched []Change
+		for i, c := range changes {
+			if pathOverlaps(h.pattern, paths[i]) {
+				matched = append(matched, c)
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+		if err := h.fn(&Reload{Config: m, Changes: matched, DryRun: dryRun}); err != nil {
+			errs = append(errs, fmt.Errorf("reload handler '%s': %w", h.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// handlerOrder returns the handlers sorted so every handler comes after
+// the ones it depends on, and otherwise in the order they were registered.
+func (s *Store) handlerOrder() ([]*reloadHandler, error) {
+	byName := make(map[string]*reloadHandler, len(s.handlers))
+	for _, h := range s.handlers {
+		byName[h.name] = h
+	}
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int, len(s.handlers))
+	order := make([]*reloadHandler, 0, len(s.handlers))
+	var visit func(h *reloadHandler, chain []string) error
+	visit = func(h *reloadHandler, chain []string) error {
+		switch state[h.name] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("reload handler dependency cycle: %s -> %s", strings.Join(chain, " -> "), h.name)
+		}
+		state[h.name] = visiting
+		for _, name := range h.after {
+			dep, ok := byName[name]
+			if !ok {
+				return fmt.Errorf("reload handler '%s' depends on unknown handler '%s'", h.name, name)
+			}
+			if err := visit(dep, append(chain, h.name)); err != nil {
+				return err
+			}
+		}
+		state[h.name] = done
+		order = append(order, h)
+		return nil
+	}
+	for _, h := range s.handlers {
+		if err := visit(h, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
@@ -0,0 +1,183 @@
+package conf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStoreHandle(t *testing.T) {
+	docs := []string{
+		"tls { cert = a.pem }\nlistener { port = 4222 }\nlog { level = info }",
+		"tls { cert = b.pem }\nlistener { port = 4222 }\nlog { level = info }",
+		"tls { cert = b.pem }\nlistener { port = 4223 }\nlog { level = debug }",
+	}
+	s, err := NewStoreFunc(func() (map[string]any, error) {
+		m, err := Parse(docs[0])
+		docs = docs[1:]
+		return m, err
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var calls []string
+	handler := func(name string, err error) ReloadFunc {
+		return func(r *Reload) error {
+			for _, c := range r.Changes {
+				calls = append(calls, name+" "+c.Path)
+			}
+			return err
+		}
+	}
+	errLog := errors.New("log file is read-only")
+	// Registered before its dependencies, which must still run first.
+	if err := s.Handle("listener", "listener", handler("listener", nil), "tls"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := s.Handle("log", "log", handler("log", errLog)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := s.Handle("tls", "tls.*", handler("tls", nil)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := s.Handle("tls", "tls", handler("tls", nil)); err == nil {
+		t.Fatal("Expected an error for a duplicate handler")
+	}
+
+	if _, err := s.Reload(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{"tls tls.cert"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", calls, expected)
+	}
+
+	calls = nil
+	changes, err := s.Reload()
+	if !errors.Is(err, errLog) || !strings.Contains(err.Error(), "reload handler 'log'") {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", err, errLog)
+	}
+	if len(changes) != 2 || s.Load()["log"].(map[string]any)["level"] != "debug" {
+		t.Fatalf("Expected the config to be swapped in, got %+v", s.Load())
+	}
+	expected = []string{"listener listener.port", "log log.level"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", calls, expected)
+	}
+}
+
+func TestStoreHandleOrder(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		handlers [][]string
+		expected string
+	}{
+		{
+			name:     "dependencies first",
+			handlers: [][]string{{"c", "b"}, {"b", "a"}, {"a"}, {"d"}},
+			expected: "a b c d",
+		},
+		{
+			name:     "unknown dependency",
+			handlers: [][]string{{"a", "b"}},
+			expected: "reload handler 'a' depends on unknown handler 'b'",
+		},
+		{
+			name:     "cycle",
+			handlers: [][]string{{"a", "c"}, {"b", "a"}, {"c", "b"}},
+			expected: "reload handler dependency cycle: a -> c -> b -> a",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := NewStoreFunc(func() (map[string]any, error) {
+				return map[string]any{}, nil
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var ran []string
+			for _, h := range test.handlers {
+				err := s.Handle(h[0], "", func(*Reload) error {
+					ran = append(ran, h[0])
+					return nil
+				}, h[1:]...)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+			_, err = s.Update(map[string]any{"port": int64(4222)})
+			got := strings.Join(ran, " ")
+			if err != nil {
+				got = err.Error()
+			}
+			if got != test.expected {
+				t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestStoreValidate(t *testing.T) {
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "server.conf")
+	if err := os.WriteFile(fp, []byte("port = 4222\ntls { cert = a.pem }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewStore(fp)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var dryRuns []bool
+	errCert := errors.New("certificate not found")
+	err = s.Handle("tls", "tls", func(r *Reload) error {
+		dryRuns = append(dryRuns, r.DryRun)
+		if r.Config["tls"].(map[string]any)["cert"] == "missing.pem" {
+			return errCert
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	notified := 0
+	s.Subscribe(func([]Change) { notified++ })
+
+	next := filepath.Join(dir, "next.conf")
+	if err := os.WriteFile(next, []byte("port = 4222\ntls { cert = b.pem }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := s.Validate(next)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Path != "tls.cert" {
+		t.Fatalf("Unexpected changes: %+v", changes)
+	}
+
+	if err := os.WriteFile(fp, []byte("port = 4222\ntls { cert = missing.pem }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Validate(""); !errors.Is(err, errCert) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", err, errCert)
+	}
+	s.SetValidator(func(m map[string]any) error { return errCert })
+	var rejected *RejectedError
+	if _, err := s.Validate(next); !errors.As(err, &rejected) {
+		t.Fatalf("Expected the config to be rejected, got %v", err)
+	}
+	if _, err := s.Validate(filepath.Join(dir, "bogus.conf")); err == nil {
+		t.Fatal("Expected an error for a missing file")
+	}
+
+	expected := []bool{true, true}
+	if !reflect.DeepEqual(dryRuns, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", dryRuns, expected)
+	}
+	if cert := s.Load()["tls"].(map[string]any)["cert"]; cert != "a.pem" || notified != 0 || len(s.History()) != 1 {
+		t.Fatalf("Expected the store to be unchanged, got %+v", s.Load())
+	}
+}
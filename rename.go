@@ -0,0 +1,166 @@
+package conf
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// RenameKey renames the key at oldPath to newPath in the config file root
+// and the files it includes, as the EditSet method of the same name does,
+// and returns the files it rewrote. The options are those of the parse of
+// the files.
+func RenameKey(root, oldPath, newPath string, opts ...Option) ([]string, error) {
+	e, err := NewEditSet(root, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.RenameKey(oldPath, newPath); err != nil {
+		return nil, err
+	}
+	return e.Commit()
+}
+
+// RenameKey renames the key at oldPath to newPath, key paths in the
+// notation of Lookup, in whichever files define it. Every definition of the
+// key is renamed, and every $ reference to one of them is rewritten to the
+// new name:
+//
+//	port = 4222
+//	monitor { port = $port }
+//
+// renaming port to client_port becomes
+//
+//	client_port = 4222
+//	monitor { port = $client_port }
+//
+// When newPath is in another map than oldPath the key is moved: the value
+// of the definition in effect is written, as it is in the file, to the map
+// of newPath, with the maps leading to it added as needed, and the other
+// definitions are removed. References then have to be in the scope of the
+// new key for the rename to succeed.
+func (e *EditSet) RenameKey(oldPath, newPath string) error {
+	oelems, err := renamePath(oldPath)
+	if err != nil {
+		return err
+	}
+	nelems, err := renamePath(newPath)
+	if err != nil {
+		return err
+	}
+	if len(nelems) > len(oelems) && reflect.DeepEqual(nelems[:len(oelems)], oelems) {
+		return fmt.Errorf("can not rename '%s' to '%s' inside it", oldPath, newPath)
+	}
+	newKey := nelems[len(nelems)-1].key
+	ek, err := encodeKey(newKey)
+	if err != nil {
+		return err
+	}
+	move := !reflect.DeepEqual(oelems[:len(oelems)-1], nelems[:len(nelems)-1])
+
+	return e.edit(func(m map[string]any) error {
+		v, ok := Lookup(m, oldPath)
+		if !ok {
+			return fmt.Errorf("key '%s' is not set", oldPath)
+		}
+		if _, ok := Lookup(m, newPath); ok {
+			return fmt.Errorf("can not rename '%s', key '%s' is already set", oldPath, newPath)
+		}
+		tk, ok := v.(*Token)
+		if !ok {
+			return fmt.Errorf("key '%s' has no position", oldPath)
+		}
+		var defs []*Token
+		for t := tk; t != nil; t = t.Replaced() {
+			defs = append(defs, t)
+		}
+
+		var edits []textEdit
+		var werr error
+		var visit func(path string, t *Token)
+		visit = func(path string, t *Token) {
+			// Definitions replaced later are still in the files, so the
+			// references in them are renamed as well.
+			if r := t.Replaced(); r != nil {
+				walkTokens(path, r, visit)
+			}
+			def := t.VariableDefinition()
+			if werr != nil || def == nil || !slices.Contains(defs, def) {
+				return
+			}
+			f, d, err := e.locate(path, t)
+			if err != nil {
+				werr = err
+				return
+			}
+			edits = append(edits, textEdit{f: f, start: d.valStart, end: d.valEnd, text: "$" + newKey})
+		}
+		WalkTokens(m, visit)
+		if werr != nil {
+			return werr
+		}
+
+		if move {
+			f, d, err := e.locate(oldPath, tk)
+			if err != nil {
+				return err
+			}
+			text := strings.ReplaceAll(string(f.src[d.valStart:d.valEnd]), "\n"+lineIndent(f.src, d.keyStart), "\n")
+			ed, err := e.addition(m, newPath, text)
+			if err != nil {
+				return err
+			}
+			edits = append(edits, ed)
+		}
+		for _, t := range defs {
+			f, d, err := e.locate(oldPath, t)
+			if err != nil {
+				return err
+			}
+			if move {
+				edits = append(edits, f.removal(d))
+			} else {
+				edits = append(edits, textEdit{f: f, start: d.keyStart, end: d.keyEnd, text: ek})
+			}
+		}
+		applyEdits(uniqueEdits(edits))
+		return nil
+	})
+}
+
+// renamePath parses a key path ending in a key.
+func renamePath(path string) ([]pathElem, error) {
+	elems, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(elems) == 0 || elems[len(elems)-1].isIdx {
+		return nil, fmt.Errorf("can not rename '%s', it is not a key", path)
+	}
+	for _, el := range elems {
+		if el.wildcard {
+			return nil, fmt.Errorf("can not rename '%s', it has wildcards", path)
+		}
+	}
+	return elems, nil
+}
+
+// uniqueEdits drops repeated edits, as the values of a map referenced as a
+// variable are found both in the map and where it is referenced.
+func uniqueEdits(edits []textEdit) []textEdit {
+	type site struct {
+		f          *editFile
+		start, end int
+	}
+	seen := make(map[site]bool, len(edits))
+	var unique []textEdit
+	for _, ed := range edits {
+		s := site{ed.f, ed.start, ed.end}
+		if !seen[s] {
+			seen[s] = true
+			unique = append(unique, ed)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,107 @@
+package conf
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRenameKey(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "server.conf")
+	inc := filepath.Join(dir, "monitor.conf")
+	writeTestFile(t, root, `port = 4000
+port = 4222 # client port
+include monitor.conf
+routes = [$port, 1]
+`)
+	writeTestFile(t, inc, "http_port = 8222\nmonitor {\n  port = $http_port\n  opts { debug: true, p: $http_port }\n}\n")
+
+	written, err := RenameKey(root, "port", "client_port")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(written, []string{root}) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", written, []string{root})
+	}
+	expected := `client_port = 4000
+client_port = 4222 # client port
+include monitor.conf
+routes = [$client_port, 1]
+`
+	if data, _ := os.ReadFile(root); string(data) != expected {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", string(data), expected)
+	}
+	if _, err := RenameKey(root, "http_port", "monitor_port"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected = "monitor_port = 8222\nmonitor {\n  port = $monitor_port\n  opts { debug: true, p: $monitor_port }\n}\n"
+	if data, _ := os.ReadFile(inc); string(data) != expected {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", string(data), expected)
+	}
+
+	// Renaming a key to another map moves it there.
+	if _, err := RenameKey(root, "monitor.opts", "server.monitor_opts"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(inc); string(data) != "monitor_port = 8222\nmonitor {\n  port = $monitor_port\n}\n" {
+		t.Fatalf("Unexpected content of %s: %s", inc, data)
+	}
+	if data, _ := os.ReadFile(root); !strings.HasSuffix(string(data), "server {\n  monitor_opts: { debug: true, p: $monitor_port }\n}\n") {
+		t.Fatalf("Unexpected content of %s: %s", root, data)
+	}
+	m, err := ParseFile(root)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	em := map[string]any{
+		"client_port":  int64(4222),
+		"monitor_port": int64(8222),
+		"routes":       []any{int64(4222), int64(1)},
+		"monitor":      map[string]any{"port": int64(8222)},
+		"server":       map[string]any{"monitor_opts": map[string]any{"debug": true, "p": int64(8222)}},
+	}
+	if !reflect.DeepEqual(m, em) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, em)
+	}
+}
+
+func TestRenameKeyReplacedReferences(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "app.conf")
+	writeTestFile(t, root, "port = 1\na = $port\na = 2\nb { x = $port }\nb { y = 3 }\n")
+	if _, err := RenameKey(root, "port", "listen"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "listen = 1\na = $listen\na = 2\nb { x = $listen }\nb { y = 3 }\n"
+	if data, _ := os.ReadFile(root); string(data) != expected {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", string(data), expected)
+	}
+}
+
+func TestRenameKeyErrors(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "app.conf")
+	src := "a { port = 1, b = $port }\nc = 2\n"
+	writeTestFile(t, root, src)
+	for _, test := range []struct {
+		old, new string
+		err      string
+	}{
+		{"a.port", "port", "variable reference for 'port'"},
+		{"a", "a.b.c", "inside it"},
+		{"a.port", "c", "key 'c' is already set"},
+		{"x", "y", "key 'x' is not set"},
+		{"c", "d[0]", "it is not a key"},
+		{"*", "d", "it has wildcards"},
+	} {
+		_, err := RenameKey(root, test.old, test.new)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("Expected error containing %q for %s, got %v", test.err, test.old, err)
+		}
+	}
+	if data, _ := os.ReadFile(root); string(data) != src {
+		t.Fatalf("Unexpected content of %s: %s", root, data)
+	}
+}
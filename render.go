@@ -0,0 +1,75 @@
+package conf
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"text/template"
+)
+
+// Render evaluates the config template at templateFile against inventory
+// and parses the result, so one template yields the config of every host
+// of an inventory.
+//
+// Templates use the syntax of text/template, restricted to the inventory
+// data and the functions below: {{ .name }} inserts a value, and
+// {{ if .tls }} ... {{ end }} or {{ range .routes }} ... {{ end }} select
+// the parts rendered. Referencing a key the inventory does not hold is an
+// error. Include paths are relative to the template, and positions in
+// parse errors refer to the rendered config.
+//
+//	value v        v written as a config value, e.g. a list as an array
+//	quote v        v as a quoted string
+//	default d v    v, or d when v is empty
+func Render(templateFile string, inventory map[string]any, opts ...Option) (map[string]any, error) {
+	data, err := os.ReadFile(templateFile)
+	if err != nil {
+		return nil, &OpenError{Path: templateFile, Err: err}
+	}
+	out, err := renderTemplate(filepath.Base(templateFile), string(data), inventory)
+	if err != nil {
+		return nil, &ParseError{File: templateFile, Err: err}
+	}
+	p, err := parseData(out, templateFile, false, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return p.mapping, nil
+}
+
+// templateFuncs are the functions available in templates.
+var templateFuncs = template.FuncMap{
+	"value": func(v any) (string, error) {
+		var buf bytes.Buffer
+		if err := encodeValue(&buf, v, 0); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	},
+	"quote": func(v any) string {
+		return quoteString(fmt.Sprint(v))
+	},
+	"default": func(d, v any) any {
+		if v == nil {
+			return d
+		}
+		if rv := reflect.ValueOf(v); rv.IsZero() || (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Map) && rv.Len() == 0 {
+			return d
+		}
+		return v
+	},
+}
+
+func renderTemplate(name, text string, inventory map[string]any) (string, error) {
+	t, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, inventory); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
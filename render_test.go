@@ -0,0 +1,60 @@
+package conf
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	dir := t.TempDir()
+	tmpl := `
+host = {{ quote .hostname }}
+port = {{ .port }}
+routes = {{ value .routes }}
+log_level = {{ default "info" .log_level }}
+{{ if .tls }}
+tls { cert = {{ quote .tls.cert }} }
+{{ end }}
+include 'common.conf'
+`
+	fp := filepath.Join(dir, "server.conf.tmpl")
+	if err := os.WriteFile(fp, []byte(tmpl), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "common.conf"), []byte("max_conn = 100"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	hosts := map[string]map[string]any{
+		"a": {"hostname": "a.example.com", "port": 4222, "routes": []any{"nats://b:6222"}, "log_level": "", "tls": map[string]any{"cert": "/etc/a.pem"}},
+		"b": {"hostname": "b.example.com", "port": 4223, "routes": []any{}, "log_level": "debug", "tls": false},
+	}
+	expected := map[string]map[string]any{
+		"a": {"host": "a.example.com", "port": int64(4222), "routes": []any{"nats://b:6222"}, "log_level": "info", "tls": map[string]any{"cert": "/etc/a.pem"}, "max_conn": int64(100)},
+		"b": {"host": "b.example.com", "port": int64(4223), "routes": []any{}, "log_level": "debug", "max_conn": int64(100)},
+	}
+	for name, inv := range hosts {
+		m, err := Render(fp, inv)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(m, expected[name]) {
+			t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, expected[name])
+		}
+	}
+
+	_, err := Render(fp, map[string]any{"hostname": "c"})
+	if err == nil || !strings.Contains(err.Error(), `map has no entry for key "port"`) {
+		t.Fatalf("Expected a missing key error, got %v", err)
+	}
+	// Only the template functions listed for Render are available.
+	if err := os.WriteFile(fp, []byte(`x = {{ exec "ls" }}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Render(fp, nil); err == nil || !strings.Contains(err.Error(), `function "exec" not defined`) {
+		t.Fatalf("Expected an undefined function error, got %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// ErrOutsideRoot is returned for includes and file() paths outside the
+// directory set with WithIncludeRoot.
+var ErrOutsideRoot = errors.New("path is outside the include root")
+
+// IncludeResolver loads include files. Resolve returns the contents of the
+// include name found in the file parent, which is empty for includes in
+// data passed to Parse, along with the path identifying the include. That
+// path is the parent of nested includes and is used in errors and to
+// detect include cycles. Errors for missing includes should wrap
+// fs.ErrNotExist so optional includes can be skipped.
+type IncludeResolver interface {
+	Resolve(parent, name string) ([]byte, string, error)
+}
+
+// IncludeResolverFunc adapts a function to an IncludeResolver.
+type IncludeResolverFunc func(parent, name string) ([]byte, string, error)
+
+func (f IncludeResolverFunc) Resolve(parent, name string) ([]byte, string, error) {
+	return f(parent, name)
+}
+
+// WithIncludeResolver loads include files with r instead of reading them
+// relative to the including file. Includes are not cached with an
+// IncludeCache when a resolver is set.
+func WithIncludeResolver(r IncludeResolver) Option {
+	return func(o *options) {
+		o.resolver = r
+	}
+}
+
+// WithIncludeRoot rejects includes and file() paths that resolve outside
+// dir once symbolic links are evaluated, such as include '../../etc/passwd',
+// for config files from less trusted sources. It does not apply to the file
+// passed to ParseFile, nor to includes loaded by an IncludeResolver.
+func WithIncludeRoot(dir string) Option {
+	return func(o *options) {
+		o.includeRoot = dir
+	}
+}
+
+// PathMode is how the relative paths of includes, file() and directives
+// are resolved when the file they are in is reached through a symbolic
+// link, such as a config in a symlinked release directory.
+type PathMode int
+
+const (
+	// LogicalPaths resolves paths against the directory of the file as it
+	// was named, without evaluating symbolic links.
+	LogicalPaths PathMode = iota
+	// PhysicalPaths resolves paths against the directory the file is in
+	// once symbolic links are evaluated.
+	PhysicalPaths
+)
+
+func (m PathMode) String() string {
+	switch m {
+	case LogicalPaths:
+		return "logical"
+	case PhysicalPaths:
+		return "physical"
+	}
+	return fmt.Sprintf("PathMode(%d)", int(m))
+}
+
+// WithPathMode sets how relative paths in a config file are resolved,
+// which by default is against its logical directory. With /etc/app.conf a
+// link to /srv/release/app.conf, include tls.conf reads /etc/tls.conf with
+// LogicalPaths and /srv/release/tls.conf with PhysicalPaths.
+func WithPathMode(m PathMode) Option {
+	return func(o *options) {
+		o.pathMode = m
+	}
+}
+
+// baseDir returns the directory relative paths in file are resolved
+// against.
+func baseDir(file string, mode PathMode) string {
+	if mode == PhysicalPaths && file != "" {
+		if real, err := filepath.EvalSymlinks(file); err == nil {
+			file = real
+		}
+	}
+	return filepath.Dir(file)
+}
+
+// resolvedPath returns the absolute path of fp with symbolic links
+// evaluated, or its absolute path if that fails.
+func resolvedPath(fp string) string {
+	if real, err := filepath.EvalSymlinks(fp); err == nil {
+		fp = real
+	}
+	return absPath(fp)
+}
+
+// fileResolver reads includes from the file system relative to the
+// directory of the including file, optionally confined to root.
+type fileResolver struct {
+	root string
+	mode PathMode
+	// limit is the number of bytes to read at most, if above 0.
+	limit int64
+}
+
+func (r fileResolver) Resolve(parent, name string) ([]byte, string, error) {
+	fp := includePath(baseDir(parent, r.mode), name)
+	if err := checkRoot(r.root, fp); err != nil {
+		return nil, fp, err
+	}
+	data, err := readFile(fp, r.limit)
+	return data, fp, err
+}
+
+// includePath returns the path of the file name of an include, file() or
+// directive, relative to the directory dir. Names may separate directories
+// with '/' or '\' on any platform, so configs written on Windows can be
+// shared with other platforms, and names starting with a drive letter or
+// as UNC paths, such as C:\conf\app.conf or \\server\share\app.conf, are
+// absolute.
+func includePath(dir, name string) string {
+	abs := isWindowsAbs(name)
+	name = filepath.FromSlash(strings.ReplaceAll(name, `\`, "/"))
+	if abs || filepath.IsAbs(name) {
+		return filepath.Clean(name)
+	}
+	return filepath.Join(dir, name)
+}
+
+// isWindowsAbs reports whether name is an absolute Windows path, starting
+// with a drive letter or two separators.
+func isWindowsAbs(name string) bool {
+	isSep := func(c byte) bool { return c == '/' || c == '\\' }
+	if len(name) >= 2 && isSep(name[0]) && isSep(name[1]) {
+		return true
+	}
+	return len(name) >= 3 && name[1] == ':' && isSep(name[2]) &&
+		('a' <= name[0] && name[0] <= 'z' || 'A' <= name[0] && name[0] <= 'Z')
+}
+
+// checkRoot returns an error wrapping ErrOutsideRoot if fp is not within
+// root after evaluating symbolic links. Any path is allowed without a root.
+func checkRoot(root, fp string) error {
+	if root == "" {
+		return nil
+	}
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	path, err := filepath.Abs(fp)
+	if err != nil {
+		return err
+	}
+	// Compare the path with its links evaluated, as the root is. Paths of
+	// missing files are evaluated as far as they exist, so a missing file
+	// inside the root is reported as missing rather than outside.
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		real = evalExisting(path)
+	}
+	if !within(root, real) {
+		return fmt.Errorf("%s: %w", fp, ErrOutsideRoot)
+	}
+	return err
+}
+
+// evalExisting returns path with the links of the longest part of it that
+// exists evaluated.
+func evalExisting(path string) string {
+	dir, rest := filepath.Dir(path), filepath.Base(path)
+	for {
+		if real, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(real, rest)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return path
+		}
+		rest = filepath.Join(filepath.Base(dir), rest)
+		dir = parent
+	}
+}
+
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// includeResolver returns the resolver for include files.
+func (o *options) includeResolver() IncludeResolver {
+	if o.resolver != nil {
+		return o.resolver
+	}
+	return fileResolver{root: o.includeRoot, mode: o.pathMode}
+}
@@ -0,0 +1,306 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// mapResolver serves includes from memory, relative to the parent like
+// the file system resolver.
+func mapResolver(files map[string]string) IncludeResolver {
+	return IncludeResolverFunc(func(parent, name string) ([]byte, string, error) {
+		fp := path.Join(path.Dir(parent), name)
+		data, ok := files[fp]
+		if !ok {
+			return nil, fp, fmt.Errorf("%s: %w", fp, fs.ErrNotExist)
+		}
+		return []byte(data), fp, nil
+	})
+}
+
+func TestIncludeResolver(t *testing.T) {
+	r := mapResolver(map[string]string{
+		"base.conf":        "name = base\ninclude 'tls/tls.conf'",
+		"tls/tls.conf":     "tls { include 'ciphers.conf' }",
+		"tls/ciphers.conf": "ciphers = [a, b]",
+	})
+	ex := map[string]any{
+		"name":  "base",
+		"port":  int64(4222),
+		"tls":   map[string]any{"ciphers": []any{"a", "b"}},
+		"local": map[string]any{},
+	}
+	data := "include 'base.conf'\ninclude? 'missing.conf'\nport = 4222\nlocal = include? 'local.conf'"
+	for _, parse := range []func(string, ...Option) (map[string]any, error){Parse, ParseWithChecks} {
+		m, err := parse(data, WithIncludeResolver(r), WithIncludeCache(NewIncludeCache()))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if s := stripValue(m); !reflect.DeepEqual(s, ex) {
+			t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", s, ex)
+		}
+	}
+}
+
+func TestIncludeResolverErrors(t *testing.T) {
+	r := mapResolver(map[string]string{
+		"a.conf": "include 'b.conf'",
+		"b.conf": "include 'a.conf'",
+	})
+	_, err := Parse("include 'a.conf'", WithIncludeResolver(r))
+	if err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Fatalf("Expected include cycle error, got %v", err)
+	}
+
+	_, err = Parse("include 'c.conf'", WithIncludeResolver(r))
+	var oe *OpenError
+	if !errors.As(err, &oe) || oe.Path != "c.conf" || !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Expected *OpenError for c.conf, got %v", err)
+	}
+}
+
+func TestIncludeRoot(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	files := map[string]string{
+		"outside.conf":        "secret = 1",
+		"root/main.conf":      "include 'sub/inner.conf'",
+		"root/sub/inner.conf": "inner = 1",
+		"root/escape.conf":    "include '../outside.conf'",
+		"root/link.conf":      "include 'outside-link.conf'",
+		"root/inlink.conf":    "include 'inner-link.conf'",
+		"root/file.conf":      "secret = file('../outside.conf')",
+	}
+	for name, data := range files {
+		fp := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fp, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(dir, "outside.conf"), filepath.Join(root, "outside-link.conf")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(root, "sub", "inner.conf"), filepath.Join(root, "inner-link.conf")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"main.conf", "inlink.conf"} {
+		m, err := ParseFile(filepath.Join(root, name), WithIncludeRoot(root))
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", name, err)
+		}
+		if m["inner"] != int64(1) {
+			t.Fatalf("Unexpected result for %s: %+v", name, m)
+		}
+	}
+	for _, name := range []string{"escape.conf", "link.conf", "file.conf"} {
+		_, err := ParseFile(filepath.Join(root, name), WithIncludeRoot(root))
+		if !errors.Is(err, ErrOutsideRoot) {
+			t.Fatalf("Expected ErrOutsideRoot for %s, got %v", name, err)
+		}
+		if _, err := ParseFile(filepath.Join(root, name)); err != nil {
+			t.Fatalf("Unexpected error without a root for %s: %v", name, err)
+		}
+	}
+}
+
+func TestIncludeRootNested(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(dir, "outside.conf")
+	writeTestFile(t, outside, "leak = true")
+	t.Setenv("CONF_TEST_FILE", `file("`+outside+`")`)
+	t.Setenv("CONF_TEST_INCLUDE", `include "`+outside+`"`)
+
+	opts := []Option{WithIncludeRoot(root), WithoutFileFunc()}
+	for data, expected := range map[string]any{
+		`a = env("CONF_TEST_NOPE", file("` + outside + `"))`: `file("` + outside + `")`,
+		`a = $CONF_TEST_FILE`:                                `file("` + outside + `")`,
+	} {
+		fp := filepath.Join(root, "app.conf")
+		writeTestFile(t, fp, data)
+		m, err := ParseFile(fp, opts...)
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", data, err)
+		}
+		if m["a"] != expected {
+			t.Fatalf("Mismatch for %s:\nReceived: '%+v'\nExpected: '%+v'\n", data, m["a"], expected)
+		}
+	}
+	for _, data := range []string{
+		`a = env("CONF_TEST_NOPE", include "` + outside + `")`,
+		`a = $CONF_TEST_INCLUDE`,
+		`a = env("CONF_TEST_INCLUDE")`,
+	} {
+		fp := filepath.Join(root, "app.conf")
+		writeTestFile(t, fp, data)
+		if _, err := ParseFile(fp, opts...); !errors.Is(err, ErrOutsideRoot) {
+			t.Fatalf("Expected ErrOutsideRoot for %s, got %v", data, err)
+		}
+	}
+}
+
+func TestIncludeRootLink(t *testing.T) {
+	dir := t.TempDir()
+	real := filepath.Join(dir, "real")
+	link := filepath.Join(dir, "link")
+	writeTestFile(t, filepath.Join(dir, "outside.conf"), "secret = 1")
+	if err := os.Mkdir(real, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(real, link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	writeTestFile(t, filepath.Join(real, "main.conf"), "include x.conf")
+	writeTestFile(t, filepath.Join(real, "x.conf"), "x = 1")
+	writeTestFile(t, filepath.Join(real, "missing.conf"), "include sub/none.conf")
+	writeTestFile(t, filepath.Join(real, "escape.conf"), "include ../outside.conf")
+
+	m, err := ParseFile(filepath.Join(link, "main.conf"), WithIncludeRoot(link))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m["x"] != int64(1) {
+		t.Fatalf("Unexpected result: %+v", m)
+	}
+	_, err = ParseFile(filepath.Join(link, "missing.conf"), WithIncludeRoot(link))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Expected a missing file error, got %v", err)
+	}
+	_, err = ParseFile(filepath.Join(link, "escape.conf"), WithIncludeRoot(link))
+	if !errors.Is(err, ErrOutsideRoot) {
+		t.Fatalf("Expected ErrOutsideRoot, got %v", err)
+	}
+}
+
+func TestIncludePath(t *testing.T) {
+	dir := filepath.FromSlash("/etc/app")
+	tests := []struct {
+		name, expected string
+	}{
+		{"tls.conf", "/etc/app/tls.conf"},
+		{"conf.d/tls.conf", "/etc/app/conf.d/tls.conf"},
+		{`conf.d\tls.conf`, "/etc/app/conf.d/tls.conf"},
+		{`..\shared\users.conf`, "/etc/shared/users.conf"},
+		{"/opt/app/users.conf", "/opt/app/users.conf"},
+	}
+	for i := range tests {
+		tests[i].expected = filepath.FromSlash(tests[i].expected)
+	}
+	if runtime.GOOS == "windows" {
+		dir = `C:\app`
+		tests = []struct {
+			name, expected string
+		}{
+			{"tls.conf", `C:\app\tls.conf`},
+			{`conf.d/tls.conf`, `C:\app\conf.d\tls.conf`},
+			{`D:\shared\users.conf`, `D:\shared\users.conf`},
+			{`D:/shared/users.conf`, `D:\shared\users.conf`},
+			{`\\server\share\users.conf`, `\\server\share\users.conf`},
+			{`//server/share/users.conf`, `\\server\share\users.conf`},
+		}
+	} else {
+		// Absolute Windows paths are not joined to the directory, so they
+		// fail as missing files rather than resolving somewhere else.
+		tests = append(tests, struct {
+			name, expected string
+		}{`C:\shared\users.conf`, "C:/shared/users.conf"})
+	}
+	for _, tc := range tests {
+		if got := includePath(dir, tc.name); got != tc.expected {
+			t.Fatalf("Mismatch for '%s':\nReceived: '%+v'\nExpected: '%+v'\n", tc.name, got, tc.expected)
+		}
+	}
+}
+
+func TestIncludeBackslashes(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "conf.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"app.conf":        `include conf.d\tls.conf` + "\nsecret = file('conf.d\\secret')",
+		"conf.d/tls.conf": `include "..\users.conf"` + "\ntls { cert = c.pem }",
+		"conf.d/secret":   "s3cr3t\n",
+		"users.conf":      "users = [{user: a}]",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := ParseFile(filepath.Join(dir, "app.conf"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]any{
+		"tls":    map[string]any{"cert": "c.pem"},
+		"users":  []any{map[string]any{"user": "a"}},
+		"secret": "s3cr3t",
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, expected)
+	}
+}
+
+func TestPathMode(t *testing.T) {
+	dir := t.TempDir()
+	release := filepath.Join(dir, "release")
+	etc := filepath.Join(dir, "etc")
+	for _, d := range []string{release, etc} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		filepath.Join(release, "app.conf"): "include tls.conf\nsecret = file(secret)",
+		filepath.Join(release, "tls.conf"): "tls = release",
+		filepath.Join(release, "secret"):   "release",
+		filepath.Join(etc, "tls.conf"):     "tls = etc",
+		filepath.Join(etc, "secret"):       "etc",
+	}
+	for fp, data := range files {
+		if err := os.WriteFile(fp, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fp := filepath.Join(etc, "app.conf")
+	if err := os.Symlink(filepath.Join(release, "app.conf"), fp); err != nil {
+		t.Skipf("Symbolic links not supported: %v", err)
+	}
+
+	for _, tc := range []struct {
+		mode     PathMode
+		expected string
+	}{
+		{LogicalPaths, "etc"},
+		{PhysicalPaths, "release"},
+	} {
+		r, err := Load(fp, WithPathMode(tc.mode))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := map[string]any{"tls": tc.expected, "secret": tc.expected}
+		if !reflect.DeepEqual(r.Config, expected) {
+			t.Fatalf("Mismatch for %s:\nReceived: '%+v'\nExpected: '%+v'\n", tc.mode, r.Config, expected)
+		}
+		if len(r.ResolvedFiles) != 3 || r.ResolvedFiles[0] != resolvedPath(filepath.Join(release, "app.conf")) ||
+			r.ResolvedFiles[1] != resolvedPath(filepath.Join(dir, tc.expected, "tls.conf")) {
+			t.Fatalf("Unexpected resolved files for %s: %+v", tc.mode, r.ResolvedFiles)
+		}
+	}
+}
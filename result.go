@@ -0,0 +1,110 @@
+package conf
+
+import (
+	"slices"
+)
+
+// Result is a parsed config file together with what went into it.
+type Result struct {
+	// Config is the parsed config, as returned by ParseFile.
+	Config map[string]any
+
+	// Files are the config file and the files read for it, such as include
+	// and schema files, in the order they were read.
+	Files []string
+
+	// Includes are the include directives of the config file and its
+	// include files, in the order they were parsed, see IncludeGraph.
+	Includes []Include
+
+	// ResolvedFiles are the absolute paths of Files, with symbolic links
+	// evaluated.
+	ResolvedFiles []string
+
+	// Variables are the variable references resolved from keys of the
+	// config or a VariableResolver, in the order they were first used.
+	Variables []string
+
+	// EnvVars are the environment variables looked up, by variable
+	// references and env(), whether they were set or not.
+	EnvVars []string
+
+	// Warnings are the warnings found while parsing. They are passed to
+	// the handler of WithWarningHandler as well.
+	Warnings []Warning
+
+	// Stats are the stats of the parse. They are passed to the callback of
+	// WithStats as well.
+	Stats ParseStats
+
+	checksum string
+	maps     []map[string]any
+}
+
+// Checksum returns the Checksum of the config.
+func (r *Result) Checksum() string {
+	return r.checksum
+}
+
+// Load parses the config file at fp as ParseFile does and returns it with
+// the files, variables and environment variables it was built from, the
+// warnings found and the stats of the parse. Include files are not served
+// from an IncludeCache, since their variables would not be tracked.
+func Load(fp string, opts ...Option) (*Result, error) {
+	r := &Result{}
+	o := newOptions(opts)
+	o.track = true
+	warn := o.warn
+	o.warn = func(w Warning) {
+		r.Warnings = append(r.Warnings, w)
+		if warn != nil {
+			warn(w)
+		}
+	}
+	stats := o.stats
+	o.stats = func(s ParseStats) {
+		r.Stats = s
+		if stats != nil {
+			stats(s)
+		}
+	}
+
+	data, err := readFile(fp, o.readLimit())
+	if err != nil {
+		return nil, &OpenError{Path: fp, Err: err}
+	}
+	p, err := parseDataWithOptions(string(data), fp, false, false, o)
+	if err != nil {
+		return nil, err
+	}
+	r.Config = p.mapping
+	r.Files = append([]string{fp}, p.state.files...)
+	for _, f := range r.Files {
+		r.ResolvedFiles = append(r.ResolvedFiles, resolvedPath(f))
+	}
+	r.Includes = p.state.inclusions
+	r.Variables = p.state.variables
+	r.EnvVars = p.state.envVars
+	r.maps = p.state.maps
+	r.checksum = Checksum(r.Config)
+	return r, nil
+}
+
+// Release returns the maps of Config to a pool the maps of later parses
+// are taken from, which saves allocations and garbage collection in
+// services that parse configs often. Config is set to nil, and neither it
+// nor the values below it, including those passed to the hook of
+// WithContextHook, must be used afterwards. Release is optional, the
+// config is garbage collected as usual otherwise.
+func (r *Result) Release() {
+	releaseMaps(r.maps)
+	r.maps = nil
+	r.Config = nil
+}
+
+// track records name in list for Load, once.
+func (p *parser) track(list *[]string, name string) {
+	if p.opts.track && !slices.Contains(*list, name) {
+		*list = append(*list, name)
+	}
+}
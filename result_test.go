@@ -0,0 +1,73 @@
+package conf
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"app.conf": `
+			PORT = 4222
+			port = $PORT
+			max_conn = 10
+			host = $CONF_TEST_LOAD_HOST
+			user = env("CONF_TEST_LOAD_UNSET", "nobody")
+			include tls.conf
+		`,
+		"tls.conf": "TLS_PORT = 4443\ntls { port = $TLS_PORT }",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("CONF_TEST_LOAD_HOST", "localhost")
+
+	var warnings []Warning
+	fp := filepath.Join(dir, "app.conf")
+	r, err := Load(fp,
+		WithDeprecations(map[string]Deprecation{"max_conn": {NewKey: "max_connections"}}),
+		WithWarningHandler(func(w Warning) { warnings = append(warnings, w) }),
+		WithIncludeCache(NewIncludeCache()),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	m, err := ParseFile(fp, WithDeprecations(map[string]Deprecation{"max_conn": {NewKey: "max_connections"}}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(r.Config, m) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", r.Config, m)
+	}
+	if r.Checksum() != Checksum(m) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", r.Checksum(), Checksum(m))
+	}
+
+	for _, tc := range []struct {
+		got, want []string
+	}{
+		{r.Files, []string{fp, filepath.Join(dir, "tls.conf")}},
+		{r.Variables, []string{"PORT", "TLS_PORT"}},
+		{r.EnvVars, []string{"CONF_TEST_LOAD_HOST", "CONF_TEST_LOAD_UNSET"}},
+	} {
+		if !reflect.DeepEqual(tc.got, tc.want) {
+			t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", tc.got, tc.want)
+		}
+	}
+	if len(r.Warnings) != 1 || !reflect.DeepEqual(r.Warnings, warnings) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", r.Warnings, warnings)
+	}
+	if r.Stats.File != fp || r.Stats.Includes != 1 || r.Stats.EnvLookups != 2 {
+		t.Fatalf("Unexpected stats: %+v", r.Stats)
+	}
+
+	if _, err := Load(filepath.Join(dir, "missing.conf")); err == nil {
+		t.Fatal("Expected an error for a missing file")
+	}
+}
@@ -0,0 +1,216 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/ninepeach/go-conf/lexer"
+)
+
+// EventKind is the kind of an Event.
+type EventKind int
+
+const (
+	EventKey EventKind = iota
+	EventValue
+	EventMapStart
+	EventMapEnd
+	EventArrayStart
+	EventArrayEnd
+	EventVariable
+	EventInclude
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventKey:
+		return "Key"
+	case EventValue:
+		return "Value"
+	case EventMapStart:
+		return "MapStart"
+	case EventMapEnd:
+		return "MapEnd"
+	case EventArrayStart:
+		return "ArrayStart"
+	case EventArrayEnd:
+		return "ArrayEnd"
+	case EventVariable:
+		return "Variable"
+	case EventInclude:
+		return "Include"
+	}
+	return fmt.Sprintf("EventKind(%d)", int(k))
+}
+
+// Event is a step in a config reported by Scan.
+type Event struct {
+	Kind EventKind
+	// Path is the key path of the key or value, e.g. "cluster.routes[2]".
+	// It is empty for the top level map.
+	Path string
+	// Value is the parsed value for EventValue, the key for EventKey, the
+	// name of the variable for EventVariable and the file name for
+	// EventInclude.
+	Value any
+	Line  int
+	Pos   int
+}
+
+// EventHandler receives the events of Scan.
+type EventHandler interface {
+	HandleEvent(ev Event) error
+}
+
+// EventHandlerFunc adapts a function to an EventHandler.
+type EventHandlerFunc func(ev Event) error
+
+func (f EventHandlerFunc) HandleEvent(ev Event) error {
+	return f(ev)
+}
+
+// ErrStopScan can be returned by an EventHandler to end Scan early without
+// an error.
+var ErrStopScan = errors.New("stop scan")
+
+// scanFrame is an open map or array while scanning.
+type scanFrame struct {
+	path  string
+	array bool
+	index int
+	open  item
+}
+
+// Scan reads a config from r and reports its keys and values to h as they
+// are found, without building a map. Variables and includes are reported
+// as found but not resolved. Scan stops at the first error returned by h,
+// which it returns unless it is ErrStopScan.
+func Scan(r io.Reader, h EventHandler) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	input, err := normalizeInput(string(data), false)
+	if err != nil {
+		return &ParseError{Err: err}
+	}
+	err = scan(lexer.New(input), h)
+	if errors.Is(err, ErrStopScan) {
+		return nil
+	}
+	return err
+}
+
+func scan(lx *lexer.Lexer, h EventHandler) error {
+	errorf := func(it item, format string, args ...any) error {
+		return &ParseError{Line: it.Line, Pos: it.Pos, Err: fmt.Errorf(format, args...)}
+	}
+	stack := []scanFrame{{}}
+	var key string
+	// valuePath returns the path of the next value in the current frame.
+	valuePath := func() string {
+		top := &stack[len(stack)-1]
+		if top.array {
+			top.index++
+			return fmt.Sprintf("%s[%d]", top.path, top.index-1)
+		}
+		return joinPath(top.path, key)
+	}
+	emit := func(kind EventKind, path string, v any, it item) error {
+		return h.HandleEvent(Event{kind, path, v, it.Line, it.Pos})
+	}
+
+	for {
+		it := lx.Next()
+		var err error
+		switch it.Type {
+		case itemEOF:
+			if len(stack) > 1 {
+				open := stack[len(stack)-1].open
+				kind := "map"
+				if open.Type == itemArrayStart {
+					kind = "array"
+				}
+				return errorf(open, "%s opened at line %d never closed", kind, open.Line)
+			}
+			return nil
+		case itemError:
+			return errorf(it, "parse error: %s", it.Val)
+		case itemKey:
+			key = it.Val
+			err = emit(EventKey, joinPath(stack[len(stack)-1].path, key), key, it)
+		case itemMapStart, itemArrayStart:
+			path := valuePath()
+			kind := EventMapStart
+			if it.Type == itemArrayStart {
+				kind = EventArrayStart
+			}
+			stack = append(stack, scanFrame{path: path, array: it.Type == itemArrayStart, open: it})
+			err = emit(kind, path, nil, it)
+		case itemMapEnd, itemArrayEnd:
+			if len(stack) == 1 || stack[len(stack)-1].array != (it.Type == itemArrayEnd) {
+				end := '}'
+				if it.Type == itemArrayEnd {
+					end = ']'
+				}
+				return errorf(it, "unexpected '%c'", end)
+			}
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			kind := EventMapEnd
+			if it.Type == itemArrayEnd {
+				kind = EventArrayEnd
+			}
+			err = emit(kind, top.path, nil, it)
+		case itemVariable:
+			err = emit(EventVariable, valuePath(), it.Val, it)
+		case itemSpread:
+			err = emit(EventVariable, stack[len(stack)-1].path, it.Val+spreadSuffix, it)
+		case itemInclude, itemOptionalInclude:
+			if stack[len(stack)-1].array {
+				err = emit(EventInclude, valuePath(), it.Val, it)
+			} else {
+				err = emit(EventInclude, stack[len(stack)-1].path, it.Val, it)
+			}
+		case itemCommentStart, itemText, itemSchema:
+		default:
+			var v any
+			if v, err = scanValue(it); err != nil {
+				return errorf(it, "%w", err)
+			}
+			err = emit(EventValue, valuePath(), v, it)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// scanValue converts a scalar item to its value.
+func scanValue(it item) (any, error) {
+	switch it.Type {
+	case itemString:
+		return it.Val, nil
+	case itemInteger:
+		return parseInteger(it.Val)
+	case itemFloat:
+		f, err := strconv.ParseFloat(it.Val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected float, but got '%s'", it.Val)
+		}
+		return f, nil
+	case itemBool:
+		return parseBool(it.Val), nil
+	case itemBytes:
+		return parseBytes(it.Val)
+	case itemDatetime:
+		dt, err := parseDatetime(it.Val, nil)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DateTime: '%s'", it.Val)
+		}
+		return dt, nil
+	}
+	return nil, fmt.Errorf("unexpected %s", it.Type)
+}
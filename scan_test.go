@@ -0,0 +1,112 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScan(t *testing.T) {
+	data := `
+		port = 4222
+		cluster {
+			routes = [nats://a, {url = b}]
+			pass = $PASS
+			include 'cluster.conf'
+		}
+	`
+	var got []string
+	err := Scan(strings.NewReader(data), EventHandlerFunc(func(ev Event) error {
+		s := fmt.Sprintf("%s %s", ev.Kind, ev.Path)
+		if ev.Value != nil {
+			s += fmt.Sprintf(" %v", ev.Value)
+		}
+		got = append(got, s)
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ex := []string{
+		"Key port port",
+		"Value port 4222",
+		"Key cluster cluster",
+		"MapStart cluster",
+		"Key cluster.routes routes",
+		"ArrayStart cluster.routes",
+		"Value cluster.routes[0] nats://a",
+		"MapStart cluster.routes[1]",
+		"Key cluster.routes[1].url url",
+		"Value cluster.routes[1].url b",
+		"MapEnd cluster.routes[1]",
+		"ArrayEnd cluster.routes",
+		"Key cluster.pass pass",
+		"Variable cluster.pass PASS",
+		"Include cluster cluster.conf",
+		"MapEnd cluster",
+	}
+	if !reflect.DeepEqual(got, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", got, ex)
+	}
+}
+
+func TestScanStop(t *testing.T) {
+	var n int
+	err := Scan(strings.NewReader("a = 1\nb = 2\nc = 3"), EventHandlerFunc(func(ev Event) error {
+		if ev.Kind == EventValue {
+			n++
+			if ev.Path == "b" {
+				return ErrStopScan
+			}
+		}
+		return nil
+	}))
+	if err != nil || n != 2 {
+		t.Fatalf("Expected to stop after 2 values, got %d and %v", n, err)
+	}
+
+	errHandler := errors.New("handler failed")
+	err = Scan(strings.NewReader("a = 1"), EventHandlerFunc(func(ev Event) error { return errHandler }))
+	if !errors.Is(err, errHandler) {
+		t.Fatalf("Expected handler error, got %v", err)
+	}
+}
+
+func TestScanDatetimes(t *testing.T) {
+	data := "utc = 2024-05-01T10:00:00Z\noffset = 2024-05-01T10:00:00+08:00\nlocal = 2024-05-01T10:00:00\n"
+	got := make(map[string]time.Time)
+	err := Scan(strings.NewReader(data), EventHandlerFunc(func(ev Event) error {
+		if ev.Kind == EventValue {
+			got[ev.Path] = ev.Value.(time.Time)
+		}
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	m, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for k, v := range m {
+		if !got[k].Equal(v.(time.Time)) {
+			t.Fatalf("Mismatch for %s:\nReceived: '%+v'\nExpected: '%+v'\n", k, got[k], v)
+		}
+	}
+	if v, ok, err := Extract(data, "offset"); err != nil || !ok || !v.(time.Time).Equal(m["offset"].(time.Time)) {
+		t.Fatalf("Mismatch:\nReceived: '%+v', %v\nExpected: '%+v'\n", v, err, m["offset"])
+	}
+}
+
+func TestScanErrors(t *testing.T) {
+	for _, data := range []string{"a {\n  b = 1\n", "a = [1, 2", "a = 1\nb = \"x"} {
+		err := Scan(strings.NewReader(data), EventHandlerFunc(func(Event) error { return nil }))
+		var pe *ParseError
+		if !errors.As(err, &pe) {
+			t.Fatalf("Expected *ParseError for %q, got %v", data, err)
+		}
+	}
+}
@@ -0,0 +1,615 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// schemaExt is the extension of sidecar schema files, which hold the
+// fields of a schema block for the file of the same name, such as
+// app.schema for app.conf.
+const schemaExt = ".schema"
+
+// schemaField is a field of a schema block.
+type schemaField struct {
+	key      string
+	required bool
+	expr     *schemaExpr
+	fields   []*schemaField
+	pos      schemaPos
+}
+
+// schemaPos is the position of a key or schema field.
+type schemaPos struct {
+	file      string
+	line, col int
+}
+
+func (sp schemaPos) errorf(format string, args ...any) error {
+	return &ParseError{File: sp.file, Line: sp.line, Pos: sp.col, Err: fmt.Errorf(format, args...)}
+}
+
+// schemaBlock is the fields of a schema block, @schema { ... } at the top
+// of a file, which constrain the keys below prefix as described in
+// GRAMMAR.md.
+type schemaBlock struct {
+	prefix string
+	fields []*schemaField
+}
+
+// schemaExpr is a constraint: alternatives of terms that must all match.
+type schemaExpr struct {
+	src    string
+	alts   [][]schemaTerm
+	def    any
+	hasDef bool
+}
+
+// schemaTerm is a single constraint.
+type schemaTerm struct {
+	typ   string // a type name, for type terms
+	op    string // a comparison or match operator, or "==" for literals
+	value any    // the operand, a string, float64 or bool
+	re    *regexp.Regexp
+	elem  *schemaExpr // for lists
+	group *schemaExpr // for parenthesized constraints
+}
+
+// addSchema parses the schema block it and records it for the keys below
+// the current key path.
+func (p *parser) addSchema(it item) error {
+	// Items carry the line they end on, while positions in the schema
+	// start from the line of its opening brace.
+	start := schemaPos{file: p.file, line: it.Line - strings.Count(it.Val, "\n"), col: it.Pos}
+	fields, err := parseSchema(it.Val, start)
+	if err != nil {
+		return err
+	}
+	p.state.schemas = append(p.state.schemas, schemaBlock{prefix: p.keyPrefix(), fields: fields})
+	if p.state.positions == nil {
+		p.state.positions = make(map[string]schemaPos)
+	}
+	return nil
+}
+
+// addSchemaFile records the fields of the sidecar schema file of the file
+// being parsed, if it exists.
+func (p *parser) addSchemaFile() error {
+	if p.file == "" {
+		return nil
+	}
+	fp := strings.TrimSuffix(p.file, filepath.Ext(p.file)) + schemaExt
+	if fp == p.file {
+		return nil
+	}
+	data, err := p.readCounted(fp)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	var le *LimitError
+	if errors.As(err, &le) {
+		return &ParseError{File: fp, Err: err}
+	}
+	if err != nil {
+		return &OpenError{Path: fp, Err: err}
+	}
+	p.addDep(fp, data)
+	fields, err := parseSchema(string(data), schemaPos{file: fp, line: 1, col: 0})
+	if err != nil {
+		return err
+	}
+	p.state.schemas = append(p.state.schemas, schemaBlock{prefix: p.prefix, fields: fields})
+	if p.state.positions == nil {
+		p.state.positions = make(map[string]schemaPos)
+	}
+	return nil
+}
+
+// recordPosition remembers where the key at path was set, to report
+// schema violations there.
+func (p *parser) recordPosition(path string, it item) {
+	if p.state.positions != nil && !p.merging {
+		p.state.positions[path] = schemaPos{file: p.file, line: it.Line, col: it.Pos}
+	}
+}
+
+// validateSchemas checks m against the schema blocks of the parse and
+// sets the defaults of missing keys.
+func (s *parseState) validateSchemas(m map[string]any, pedantic bool) error {
+	for _, b := range s.schemas {
+		v, ok := Lookup(m, b.prefix)
+		if !ok {
+			continue
+		}
+		sub, ok := plainValue(v).(map[string]any)
+		if !ok {
+			continue
+		}
+		if err := s.validateFields(sub, b.prefix, b.fields, pedantic); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *parseState) validateFields(m map[string]any, prefix string, fields []*schemaField, pedantic bool) error {
+	for _, f := range fields {
+		path := joinPath(prefix, f.key)
+		v, ok := m[f.key]
+		if !ok {
+			switch {
+			case f.expr != nil && f.expr.hasDef:
+				if pedantic {
+					m[f.key] = NewToken(f.expr.def, f.pos.file, f.pos.line, f.pos.col)
+				} else {
+					m[f.key] = f.expr.def
+				}
+			case f.required:
+				return f.pos.errorf("missing required key '%s'", path)
+			}
+			continue
+		}
+		pos, ok := s.positions[path]
+		if !ok {
+			pos = schemaPos{file: f.pos.file}
+		}
+		if f.expr != nil && !f.expr.match(v) {
+			return pos.errorf("value '%v' for key '%s' does not satisfy '%s'", stripValue(v), path, f.expr.src)
+		}
+		if f.fields != nil {
+			sub, ok := plainValue(v).(map[string]any)
+			if !ok {
+				return pos.errorf("expected a map for key '%s', got %s '%v'", path, kindOf(v), stripValue(v))
+			}
+			if err := s.validateFields(sub, path, f.fields, pedantic); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// match reports whether v satisfies the constraint.
+func (e *schemaExpr) match(v any) bool {
+	for _, terms := range e.alts {
+		ok := true
+		for _, t := range terms {
+			if !t.match(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *schemaTerm) match(v any) bool {
+	v = plainValue(v)
+	if n, ok := unitValue(v); ok {
+		v = n
+	}
+	switch {
+	case t.group != nil:
+		return t.group.match(v)
+	case t.elem != nil:
+		arr, ok := v.([]any)
+		if !ok {
+			return false
+		}
+		for _, e := range arr {
+			if !t.elem.match(e) {
+				return false
+			}
+		}
+		return true
+	case t.typ != "":
+		k := kindOf(v)
+		switch t.typ {
+		case "_":
+			return true
+		case "int":
+			return k == KindInt
+		case "float":
+			return k == KindFloat
+		case "number":
+			return k == KindInt || k == KindFloat
+		case "string":
+			return k == KindString
+		case "bool":
+			return k == KindBool
+		case "bytes":
+			return k == KindBytes
+		case "time":
+			return k == KindTime
+		}
+		return false
+	case t.re != nil:
+		s, ok := v.(string)
+		return ok && t.re.MatchString(s) == (t.op == "=~")
+	}
+
+	// Comparisons and literals.
+	var c int
+	switch want := t.value.(type) {
+	case float64:
+		var f float64
+		switch vv := v.(type) {
+		case int64:
+			f = float64(vv)
+		case float64:
+			f = vv
+		default:
+			return t.op == "!="
+		}
+		c = compareFloats(f, want)
+	case string:
+		s, ok := v.(string)
+		if !ok {
+			return t.op == "!="
+		}
+		c = strings.Compare(s, want)
+	case bool:
+		b, ok := v.(bool)
+		if !ok || b != want {
+			return t.op == "!="
+		}
+	}
+	switch t.op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// schemaParser parses the text of a schema block.
+type schemaParser struct {
+	src  string
+	off  int
+	pos  schemaPos
+	line int
+	col  int
+	// end is the offset after the last term, before any comment.
+	end int
+}
+
+// parseSchema parses the fields of a schema block whose text starts at
+// start.
+func parseSchema(src string, start schemaPos) ([]*schemaField, error) {
+	sp := &schemaParser{src: src, pos: start, line: start.line, col: start.col}
+	return sp.fields(false)
+}
+
+func (sp *schemaParser) errorf(format string, args ...any) error {
+	return &ParseError{File: sp.pos.file, Line: sp.line, Pos: sp.col,
+		Err: fmt.Errorf("invalid schema: "+format, args...)}
+}
+
+func (sp *schemaParser) peek() byte {
+	if sp.off >= len(sp.src) {
+		return 0
+	}
+	return sp.src[sp.off]
+}
+
+func (sp *schemaParser) advance(n int) {
+	for ; n > 0 && sp.off < len(sp.src); n-- {
+		if sp.src[sp.off] == '\n' {
+			sp.line++
+			sp.col = 1
+		} else {
+			sp.col++
+		}
+		sp.off++
+	}
+}
+
+// skip skips white space and comments, and newlines too if newlines is
+// set.
+func (sp *schemaParser) skip(newlines bool) {
+	for sp.off < len(sp.src) {
+		switch c := sp.peek(); {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n' && newlines:
+			sp.advance(1)
+		case c == '#' || strings.HasPrefix(sp.src[sp.off:], "//"):
+			for sp.off < len(sp.src) && sp.peek() != '\n' {
+				sp.advance(1)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func isSchemaIdent(c byte, first bool) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+		!first && (c == '-' || c >= '0' && c <= '9')
+}
+
+func (sp *schemaParser) ident() string {
+	start := sp.off
+	for sp.off < len(sp.src) && isSchemaIdent(sp.src[sp.off], sp.off == start) {
+		sp.advance(1)
+	}
+	return sp.src[start:sp.off]
+}
+
+// fields parses fields up to the end of the text, or up to a closing brace
+// if nested is set.
+func (sp *schemaParser) fields(nested bool) ([]*schemaField, error) {
+	fields := []*schemaField{}
+	for {
+		sp.skip(true)
+		switch c := sp.peek(); {
+		case c == 0:
+			if nested {
+				return nil, sp.errorf("missing '}'")
+			}
+			return fields, nil
+		case c == '}' && nested:
+			sp.advance(1)
+			return fields, nil
+		case c == ',':
+			sp.advance(1)
+			continue
+		}
+
+		f := &schemaField{pos: schemaPos{file: sp.pos.file, line: sp.line, col: sp.col}}
+		if sp.peek() == '"' {
+			s, err := sp.quoted()
+			if err != nil {
+				return nil, err
+			}
+			f.key = s
+		} else if f.key = sp.ident(); f.key == "" {
+			return nil, sp.errorf("expected a key, got '%c'", sp.peek())
+		}
+		switch sp.peek() {
+		case '!':
+			f.required = true
+			sp.advance(1)
+		case '?':
+			sp.advance(1)
+		}
+		sp.skip(false)
+		if sp.peek() == ':' {
+			sp.advance(1)
+			sp.skip(false)
+		}
+		if sp.peek() == '{' {
+			sp.advance(1)
+			nested, err := sp.fields(true)
+			if err != nil {
+				return nil, err
+			}
+			f.fields = nested
+		} else {
+			start := sp.off
+			e, err := sp.expr()
+			if err != nil {
+				return nil, err
+			}
+			e.src = sp.src[start:sp.end]
+			f.expr = e
+		}
+		fields = append(fields, f)
+
+		sp.skip(false)
+		switch c := sp.peek(); {
+		case c == 0, c == '\n', c == ',', c == '}' && nested:
+		default:
+			return nil, sp.errorf("unexpected '%c' after the field '%s'", c, f.key)
+		}
+	}
+}
+
+// expr parses alternatives separated by '|'.
+func (sp *schemaParser) expr() (*schemaExpr, error) {
+	e := &schemaExpr{}
+	for {
+		sp.skip(false)
+		if sp.peek() == '*' {
+			sp.advance(1)
+			if e.hasDef {
+				return nil, sp.errorf("more than one default")
+			}
+			t, err := sp.term()
+			if err != nil {
+				return nil, err
+			}
+			if t.op != "==" {
+				return nil, sp.errorf("a default must be a literal")
+			}
+			sp.end = sp.off
+			e.def, e.hasDef = configLiteral(t.value), true
+			e.alts = append(e.alts, []schemaTerm{t})
+		} else {
+			terms, err := sp.conjunction()
+			if err != nil {
+				return nil, err
+			}
+			e.alts = append(e.alts, terms)
+		}
+		sp.skip(false)
+		if sp.peek() != '|' {
+			return e, nil
+		}
+		sp.advance(1)
+	}
+}
+
+// configLiteral converts a literal of a schema to the type parsed configs
+// hold it as.
+func configLiteral(v any) any {
+	if f, ok := v.(float64); ok && f == float64(int64(f)) {
+		return int64(f)
+	}
+	return v
+}
+
+// conjunction parses terms separated by '&'.
+func (sp *schemaParser) conjunction() ([]schemaTerm, error) {
+	var terms []schemaTerm
+	for {
+		t, err := sp.term()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, t)
+		sp.end = sp.off
+		sp.skip(false)
+		if sp.peek() != '&' {
+			return terms, nil
+		}
+		sp.advance(1)
+	}
+}
+
+// term parses a single constraint.
+func (sp *schemaParser) term() (schemaTerm, error) {
+	sp.skip(false)
+	rest := sp.src[sp.off:]
+	for _, op := range []string{"=~", "!~", ">=", "<=", "!=", ">", "<"} {
+		if !strings.HasPrefix(rest, op) {
+			continue
+		}
+		sp.advance(len(op))
+		sp.skip(false)
+		v, err := sp.literal()
+		if err != nil {
+			return schemaTerm{}, err
+		}
+		t := schemaTerm{op: op, value: v}
+		switch op {
+		case "=~", "!~":
+			s, ok := v.(string)
+			if !ok {
+				return t, sp.errorf("expected a regular expression after '%s'", op)
+			}
+			if t.re, err = regexp.Compile(s); err != nil {
+				return t, sp.errorf("%v", err)
+			}
+		default:
+			if _, ok := v.(bool); ok {
+				return t, sp.errorf("can not compare with a bool")
+			}
+		}
+		return t, nil
+	}
+
+	switch c := sp.peek(); {
+	case c == '(':
+		sp.advance(1)
+		e, err := sp.expr()
+		if err != nil {
+			return schemaTerm{}, err
+		}
+		if sp.skip(false); sp.peek() != ')' {
+			return schemaTerm{}, sp.errorf("missing ')'")
+		}
+		sp.advance(1)
+		return schemaTerm{group: e}, nil
+	case strings.HasPrefix(rest, "[..."):
+		sp.advance(4)
+		e, err := sp.expr()
+		if err != nil {
+			return schemaTerm{}, err
+		}
+		if sp.skip(false); sp.peek() != ']' {
+			return schemaTerm{}, sp.errorf("missing ']'")
+		}
+		sp.advance(1)
+		return schemaTerm{elem: e}, nil
+	case isSchemaIdent(c, true):
+		start, line, col := sp.off, sp.line, sp.col
+		switch name := sp.ident(); name {
+		case "_", "int", "float", "number", "string", "bool", "bytes", "time":
+			return schemaTerm{typ: name}, nil
+		case "true", "false":
+			return schemaTerm{op: "==", value: name == "true"}, nil
+		default:
+			sp.off, sp.line, sp.col = start, line, col
+			return schemaTerm{}, sp.errorf("unknown type '%s'", name)
+		}
+	}
+	v, err := sp.literal()
+	if err != nil {
+		return schemaTerm{}, err
+	}
+	return schemaTerm{op: "==", value: v}, nil
+}
+
+// literal parses a string, number or bool.
+func (sp *schemaParser) literal() (any, error) {
+	switch c := sp.peek(); {
+	case c == '"':
+		return sp.quoted()
+	case c == '-' || c == '+' || c == '.' || c >= '0' && c <= '9':
+		start := sp.off
+		for sp.off < len(sp.src) && strings.IndexByte("+-.0123456789eE", sp.src[sp.off]) >= 0 {
+			sp.advance(1)
+		}
+		lit := sp.src[start:sp.off]
+		f, err := strconv.ParseFloat(lit, 64)
+		if err != nil {
+			return nil, sp.errorf("invalid number '%s'", lit)
+		}
+		return f, nil
+	case strings.HasPrefix(sp.src[sp.off:], "true"):
+		sp.advance(4)
+		return true, nil
+	case strings.HasPrefix(sp.src[sp.off:], "false"):
+		sp.advance(5)
+		return false, nil
+	case c == 0 || c == '\n':
+		return nil, sp.errorf("missing constraint")
+	}
+	return nil, sp.errorf("unexpected '%c'", sp.peek())
+}
+
+// quoted parses a double quoted string.
+func (sp *schemaParser) quoted() (string, error) {
+	end := sp.off + 1
+	for ; end < len(sp.src) && sp.src[end] != '"'; end++ {
+		if sp.src[end] == '\\' {
+			end++
+		}
+	}
+	if end >= len(sp.src) {
+		return "", sp.errorf("unterminated string")
+	}
+	s, err := strconv.Unquote(sp.src[sp.off : end+1])
+	if err != nil {
+		// Regular expressions keep backslashes that are not Go escapes.
+		s = sp.src[sp.off+1 : end]
+	}
+	sp.advance(end + 1 - sp.off)
+	return s, nil
+}
@@ -0,0 +1,121 @@
+package conf
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testSchema = `@schema {
+  port: int & >0 & <65536
+  log_level: "debug" | *"info" | "warn"
+  name!: string & =~"^[a-z]+$"
+  ratio: number & >=0 & <=1  # a fraction
+  tls {
+    cert_file: string
+    verify: bool
+  }
+  routes: [...string & =~"^nats://"]
+  timeout: string | int
+}
+`
+
+func TestSchema(t *testing.T) {
+	m, err := Parse(testSchema + `
+port = 4222
+name = west
+ratio = 0.5
+tls { cert_file = c.pem, verify = true }
+routes = ["nats://a", "nats://b"]
+timeout = 30
+`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ex := map[string]any{
+		"port":      int64(4222),
+		"log_level": "info",
+		"name":      "west",
+		"ratio":     0.5,
+		"tls":       map[string]any{"cert_file": "c.pem", "verify": true},
+		"routes":    []any{"nats://a", "nats://b"},
+		"timeout":   int64(30),
+	}
+	if !reflect.DeepEqual(m, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, ex)
+	}
+
+	// Defaults of a parse with checks are tokens at the schema field.
+	m, err = ParseWithChecks(testSchema + "name = west")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if tk, ok := m["log_level"].(*Token); !ok || tk.Value() != "info" || tk.Line() != 3 {
+		t.Fatalf("Unexpected default: %+v", m["log_level"])
+	}
+}
+
+func TestSchemaViolations(t *testing.T) {
+	for data, expected := range map[string]string{
+		"name = west\nport = 0":                "value '0' for key 'port' does not satisfy 'int & >0 & <65536' (:14:1)",
+		"name = west\nport = abc":              "value 'abc' for key 'port' does not satisfy 'int & >0 & <65536' (:14:1)",
+		"name = west\nlog_level = trace":       "value 'trace' for key 'log_level' does not satisfy '\"debug\" | *\"info\" | \"warn\"' (:14:1)",
+		"name = West":                          "value 'West' for key 'name' does not satisfy 'string & =~\"^[a-z]+$\"' (:13:1)",
+		"port = 1":                             "missing required key 'name' (:4:3)",
+		"name = west\nratio = 1.5":             "value '1.5' for key 'ratio' does not satisfy 'number & >=0 & <=1' (:14:1)",
+		"name = west\ntls = yes":               "expected a map for key 'tls', got bool 'true' (:14:1)",
+		"name = west\ntls { verify = 1 }":      "value '1' for key 'tls.verify' does not satisfy 'bool' (:14:7)",
+		"name = west\nroutes = [\"http://a\"]": "value '[http://a]' for key 'routes' does not satisfy '[...string & =~\"^nats://\"]' (:14:1)",
+		"name = west\ntimeout = true":          "value 'true' for key 'timeout' does not satisfy 'string | int' (:14:1)",
+	} {
+		_, err := Parse(testSchema + data)
+		if err == nil || err.Error() != expected {
+			t.Fatalf("Expected error %q for %q, got %v", expected, data, err)
+		}
+	}
+
+	for schema, expected := range map[string]string{
+		"@schema {\n  port: integer\n}": "invalid schema: unknown type 'integer' (:2:9)",
+		"@schema {\n  port: int &\n}":   "invalid schema: missing constraint (:2:14)",
+		"@schema { port: >true }":       "invalid schema: can not compare with a bool (:1:21)",
+		"@schema { a: *1 | *2 }":        "invalid schema: more than one default (:1:19)",
+		"@schema { port: int int }":     "invalid schema: unexpected 'i' after the field 'port' (:1:20)",
+		"@schema { port: int":           "parse error: Unexpected EOF processing schema block.",
+	} {
+		_, err := Parse(schema)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("Expected error %q for %q, got %v", expected, schema, err)
+		}
+	}
+}
+
+func TestSchemaFile(t *testing.T) {
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "app.conf")
+	if err := os.WriteFile(fp, []byte("port = 4222\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "app.schema"), []byte("port: int & <1024\nhost!: string\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := ParseFile(fp)
+	expected := "value '4222' for key 'port' does not satisfy 'int & <1024' (" + fp + ":1:0)"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("Expected error %q, got %v", expected, err)
+	}
+
+	// Layers are checked together, so a later layer can set required keys.
+	over := filepath.Join(dir, "override.conf")
+	if err := os.WriteFile(over, []byte("port = 80\nhost = example.com\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := ParseFiles([]string{fp, over})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m["port"] != int64(80) || m["host"] != "example.com" {
+		t.Fatalf("Unexpected config: %+v", m)
+	}
+}
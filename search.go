@@ -0,0 +1,78 @@
+package conf
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Match is a value found by Search.
+type Match struct {
+	// Path is the key path of the value, in the notation of Lookup.
+	Path string
+	// Value is the value with the tokens of a parse with checks removed.
+	Value any
+	// Token is the value with its position, nil unless the config is
+	// from a parse with checks.
+	Token *Token
+}
+
+func (m Match) String() string {
+	if m.Token == nil {
+		return fmt.Sprintf("%s = %v", m.Path, m.Value)
+	}
+	return fmt.Sprintf("%s = %v (%s)", m.Path, m.Value, tokenPosition(m.Token))
+}
+
+// Search returns the values of m that match reports true for, depth first
+// and in key order. match is called for every value, maps and arrays as
+// well as the values in them, with its key path and the value with tokens
+// removed:
+//
+//	m, err := conf.ParseFileWithChecks("server.conf")
+//	...
+//	for _, found := range conf.Search(m, func(path string, v any) bool {
+//		return strings.HasSuffix(path, "password")
+//	}) {
+//		fmt.Println(found) // auth.password = s3cret (server.conf:12:4)
+//	}
+//
+// Matches of a config from a parse with checks have the file and line
+// the value was set at.
+func Search(m map[string]any, match func(path string, value any) bool) []Match {
+	var found []Match
+	searchValue("", m, match, &found)
+	return found
+}
+
+// SearchValue returns the values of m equal to value, such as every
+// address set to "0.0.0.0". Integers are int64 as in parsed configs.
+func SearchValue(m map[string]any, value any) []Match {
+	return Search(m, func(_ string, v any) bool {
+		return reflect.DeepEqual(v, value)
+	})
+}
+
+func searchValue(path string, v any, match func(string, any) bool, found *[]Match) {
+	tk, _ := v.(*Token)
+	if path != "" {
+		if sv := stripValue(v); match(path, sv) {
+			*found = append(*found, Match{Path: path, Value: sv, Token: tk})
+		}
+	}
+	switch vv := plainValue(v).(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(vv))
+		for k := range vv {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			searchValue(joinPath(path, k), vv[k], match, found)
+		}
+	case []any:
+		for i, e := range vv {
+			searchValue(fmt.Sprintf("%s[%d]", path, i), e, match, found)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package conf
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	data := `
+		listen = 0.0.0.0
+		cluster {
+			listen = 127.0.0.1
+			routes = [0.0.0.0, 10.0.0.1]
+		}
+		auth { password = s3cret, user = admin }
+	`
+	m, err := ParseWithChecks(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	found := SearchValue(m, "0.0.0.0")
+	var got []string
+	for _, f := range found {
+		got = append(got, f.String())
+	}
+	expected := []string{
+		"cluster.routes[0] = 0.0.0.0 (:5:14)",
+		"listen = 0.0.0.0 (:2:3)",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", got, expected)
+	}
+
+	found = Search(m, func(path string, v any) bool {
+		return strings.HasSuffix(path, "password")
+	})
+	if len(found) != 1 || found[0].Path != "auth.password" || found[0].Value != "s3cret" || found[0].Token.Line() != 7 {
+		t.Fatalf("Unexpected matches: %v", found)
+	}
+
+	// Maps and arrays are matched as well, with their tokens removed.
+	found = Search(m, func(path string, v any) bool {
+		_, ok := v.(map[string]any)
+		return ok
+	})
+	if len(found) != 2 || found[0].Path != "auth" || !reflect.DeepEqual(found[0].Value, map[string]any{"password": "s3cret", "user": "admin"}) {
+		t.Fatalf("Unexpected matches: %v", found)
+	}
+
+	// Configs without checks have no positions.
+	m, err = Parse(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	found = SearchValue(m, "10.0.0.1")
+	if len(found) != 1 || found[0].Token != nil || found[0].String() != "cluster.routes[1] = 10.0.0.1" {
+		t.Fatalf("Unexpected matches: %v", found)
+	}
+}
@@ -0,0 +1,192 @@
+package conf
+
+import (
+	"fmt"
+)
+
+// Set sets the value at the key path in m, in the notation of Lookup,
+// creating the maps and arrays leading to it as needed:
+//
+//	conf.Set(m, "cluster.routes[2].url", "nats://c")
+//
+// An index may address an element of an array or the one just past its
+// end, which appends to the array. A * key or a [*] index is a wildcard
+// matching every key of a map or element of an array that exists, as in
+// "accounts.*.limits.max_conns", so nothing is created for them. Keys
+// named * are quoted, as in `"*"`. The value is stored as given, so it
+// should be of the types of parsed configs, such as int64 for integers.
+//
+// Set fails when a level of the path holds a value that is not a map or
+// an array as the path expects, or when an index is past the end of its
+// array.
+func Set(m map[string]any, path string, value any) error {
+	elems, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	if len(elems) == 0 {
+		return fmt.Errorf("empty key path")
+	}
+	_, err = setElem(m, elems, "", value)
+	return err
+}
+
+// setElem sets value at elems below v, which is at the key path prefix,
+// and returns v, which is a new array when an element was appended.
+func setElem(v any, elems []pathElem, prefix string, value any) (any, error) {
+	if tk, ok := v.(*Token); ok {
+		nv, err := setElem(tk.value, elems, prefix, value)
+		tk.value = nv
+		return tk, err
+	}
+	e, rest := elems[0], elems[1:]
+	// Wildcards match nothing below missing values.
+	missingWildcard := len(rest) > 0 && rest[0].wildcard
+	switch c := v.(type) {
+	case map[string]any:
+		if e.isIdx {
+			return v, fmt.Errorf("expected an array at '%s', got a map", prefix)
+		}
+		if e.wildcard {
+			for k, ev := range c {
+				nv, err := setChild(ev, rest, joinPath(prefix, k), value)
+				if err != nil {
+					return v, err
+				}
+				c[k] = nv
+			}
+			return v, nil
+		}
+		if _, ok := c[e.key]; !ok && missingWildcard {
+			return v, nil
+		}
+		nv, err := setChild(c[e.key], rest, joinPath(prefix, e.key), value)
+		if err != nil {
+			return v, err
+		}
+		c[e.key] = nv
+		return v, nil
+	case []any:
+		if !e.isIdx {
+			return v, fmt.Errorf("expected a map at '%s', got an array", prefix)
+		}
+		if e.wildcard {
+			for i, ev := range c {
+				nv, err := setChild(ev, rest, fmt.Sprintf("%s[%d]", prefix, i), value)
+				if err != nil {
+					return v, err
+				}
+				c[i] = nv
+			}
+			return v, nil
+		}
+		if e.index > len(c) {
+			return v, fmt.Errorf("index %d is past the end of the array at '%s' of length %d", e.index, prefix, len(c))
+		}
+		if e.index == len(c) && missingWildcard {
+			return v, nil
+		}
+		var ev any
+		if e.index < len(c) {
+			ev = c[e.index]
+		}
+		nv, err := setChild(ev, rest, fmt.Sprintf("%s[%d]", prefix, e.index), value)
+		if err != nil {
+			return v, err
+		}
+		if e.index == len(c) {
+			return append(c, nv), nil
+		}
+		c[e.index] = nv
+		return v, nil
+	}
+	want := "a map"
+	if e.isIdx {
+		want = "an array"
+	}
+	return v, fmt.Errorf("expected %s at '%s', got %s '%v'", want, prefix, kindOf(v), stripValue(plainValue(v)))
+}
+
+// setChild returns v, at the key path prefix, with value set at elems
+// below it, creating v when it is missing.
+func setChild(v any, elems []pathElem, prefix string, value any) (any, error) {
+	if len(elems) == 0 {
+		return value, nil
+	}
+	if v == nil {
+		if elems[0].isIdx {
+			v = []any{}
+		} else {
+			v = make(map[string]any)
+		}
+	}
+	return setElem(v, elems, prefix, value)
+}
+
+// Delete removes the values at the key path in m, in the notation of Set,
+// and reports how many were removed. Removing an array element moves the
+// elements after it down. Missing values are ignored.
+func Delete(m map[string]any, path string) (int, error) {
+	elems, err := parsePath(path)
+	if err != nil {
+		return 0, err
+	}
+	if len(elems) == 0 {
+		return 0, fmt.Errorf("empty key path")
+	}
+	_, n := deleteElem(m, elems)
+	return n, nil
+}
+
+// deleteElem removes the values at elems below v and returns v, which is
+// a new array when elements were removed, and how many were removed.
+func deleteElem(v any, elems []pathElem) (any, int) {
+	if tk, ok := v.(*Token); ok {
+		nv, n := deleteElem(tk.value, elems)
+		tk.value = nv
+		return tk, n
+	}
+	e, rest := elems[0], elems[1:]
+	var n int
+	switch c := v.(type) {
+	case map[string]any:
+		if e.isIdx {
+			return v, 0
+		}
+		for k, ev := range c {
+			if !e.wildcard && k != e.key {
+				continue
+			}
+			if len(rest) == 0 {
+				delete(c, k)
+				n++
+				continue
+			}
+			nv, dn := deleteElem(ev, rest)
+			c[k] = nv
+			n += dn
+		}
+	case []any:
+		if !e.isIdx {
+			return v, 0
+		}
+		if len(rest) == 0 {
+			if e.wildcard {
+				return c[:0], len(c)
+			}
+			if e.index >= len(c) {
+				return v, 0
+			}
+			return append(c[:e.index:e.index], c[e.index+1:]...), 1
+		}
+		for i, ev := range c {
+			if !e.wildcard && i != e.index {
+				continue
+			}
+			nv, dn := deleteElem(ev, rest)
+			c[i] = nv
+			n += dn
+		}
+	}
+	return v, n
+}
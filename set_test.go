@@ -0,0 +1,142 @@
+package conf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSet(t *testing.T) {
+	m, err := Parse(`
+		cluster {
+			routes = [ { url = "nats://a" }, { url = "nats://b" } ]
+		}
+		accounts {
+			a { limits { max_conns = 10 } }
+			b { users = [] }
+		}
+	`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Wildcards match the values set before them.
+	for _, tt := range []struct {
+		path string
+		v    any
+	}{
+		{"cluster.routes[1].url", "nats://b2"},
+		{"cluster.routes[2].url", "nats://c"},
+		{"cluster.name", "west"},
+		{"tls.certs[0]", "a.pem"},
+		{"accounts.*.limits.max_conns", int64(100)},
+		{"cluster.routes[*].pool_size", int64(3)},
+		{`routes."nats.>".url`, "nats://d"},
+		{"accounts.b.users[*].password", "x"},
+		{"missing.*.x", "x"},
+	} {
+		if err := Set(m, tt.path, tt.v); err != nil {
+			t.Fatalf("Unexpected error for %q: %v", tt.path, err)
+		}
+	}
+	ex := map[string]any{
+		"cluster": map[string]any{
+			"name": "west",
+			"routes": []any{
+				map[string]any{"url": "nats://a", "pool_size": int64(3)},
+				map[string]any{"url": "nats://b2", "pool_size": int64(3)},
+				map[string]any{"url": "nats://c", "pool_size": int64(3)},
+			},
+		},
+		"accounts": map[string]any{
+			"a": map[string]any{"limits": map[string]any{"max_conns": int64(100)}},
+			"b": map[string]any{"users": []any{}, "limits": map[string]any{"max_conns": int64(100)}},
+		},
+		"tls":    map[string]any{"certs": []any{"a.pem"}},
+		"routes": map[string]any{"nats.>": map[string]any{"url": "nats://d"}},
+	}
+	if !reflect.DeepEqual(m, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, ex)
+	}
+
+	for path, expected := range map[string]string{
+		"cluster.routes[5]":  "index 5 is past the end of the array at 'cluster.routes' of length 3",
+		"cluster.name.first": "expected a map at 'cluster.name', got string 'west'",
+		"cluster[0]":         "expected an array at 'cluster', got a map",
+		"cluster.routes.url": "expected a map at 'cluster.routes', got an array",
+		"":                   "empty key path",
+		"cluster..name":      "invalid key path 'cluster..name'",
+	} {
+		if err := Set(m, path, "x"); err == nil || err.Error() != expected {
+			t.Fatalf("Expected error %q for %q, got %v", expected, path, err)
+		}
+	}
+}
+
+func TestSetTokens(t *testing.T) {
+	m, err := ParseWithChecks("cluster { routes = [\"nats://a\"] }")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := Set(m, "cluster.routes[1]", "nats://b"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	v, _ := Lookup(m, "cluster.routes")
+	routes := stripValue(plainValue(v))
+	ex := []any{"nats://a", "nats://b"}
+	if !reflect.DeepEqual(routes, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", routes, ex)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	m, err := Parse(`
+		cluster {
+			name = west
+			routes = [ { url = "nats://a" }, { url = "nats://b", pool_size = 3 }, { url = "nats://c" } ]
+		}
+		accounts {
+			a { limits { max_conns = 10 } }
+			b { limits { max_conns = 20, max_subs = 5 } }
+		}
+		tags = [a, b]
+	`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, tt := range []struct {
+		path string
+		n    int
+	}{
+		{"cluster.name", 1},
+		{"cluster.routes[*].pool_size", 1},
+		{"cluster.routes[0]", 1},
+		{"accounts.*.limits.max_conns", 2},
+		{"tags[*]", 2},
+		{"cluster.missing", 0},
+		{"cluster.routes[9]", 0},
+		{"missing.*.x", 0},
+	} {
+		n, err := Delete(m, tt.path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if n != tt.n {
+			t.Fatalf("Mismatch for %q:\nReceived: '%+v'\nExpected: '%+v'\n", tt.path, n, tt.n)
+		}
+	}
+	ex := map[string]any{
+		"cluster": map[string]any{
+			"routes": []any{map[string]any{"url": "nats://b"}, map[string]any{"url": "nats://c"}},
+		},
+		"accounts": map[string]any{
+			"a": map[string]any{"limits": map[string]any{}},
+			"b": map[string]any{"limits": map[string]any{"max_subs": int64(5)}},
+		},
+		"tags": []any{},
+	}
+	if !reflect.DeepEqual(m, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, ex)
+	}
+	if _, err := Delete(m, ""); err == nil {
+		t.Fatal("Expected an error for an empty path")
+	}
+}
@@ -0,0 +1,54 @@
+package conf
+
+import "time"
+
+// ParseStats describes the work done by a parse, e.g. to export config
+// load metrics.
+type ParseStats struct {
+	// File is the top level config file, empty when parsing data.
+	File string
+
+	// Bytes is the size of the config and all include files read. Include
+	// files served from an IncludeCache count with the size they had when
+	// they were read.
+	Bytes int64
+
+	// Keys counts the keys set, including those of include files, served
+	// from an IncludeCache or not.
+	Keys int
+
+	// Includes counts the include directives processed, including those
+	// of include files served from an IncludeCache.
+	Includes int
+
+	// EnvLookups counts the environment variables looked up, by variable
+	// references and env().
+	EnvLookups int
+
+	Duration time.Duration
+
+	// Err is the error the parse failed with, if any.
+	Err error
+}
+
+// WithStats calls fn with the stats of every parse once it is done,
+// whether it failed or not.
+func WithStats(fn func(ParseStats)) Option {
+	return func(o *options) {
+		o.stats = fn
+	}
+}
+
+// reportStats passes the stats of a parse that started at start and
+// failed with *err to the stats callback.
+func (o *options) reportStats(fp string, state *parseState, start time.Time, err *error) {
+	o.stats(ParseStats{
+		File:       fp,
+		Bytes:      state.bytes,
+		Keys:       state.keys,
+		Includes:   state.includes,
+		EnvLookups: state.envLookups,
+		Duration:   time.Since(start),
+		Err:        *err,
+	})
+}
@@ -0,0 +1,72 @@
+package conf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithStats(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.conf": "include 'tls.conf'\nport = 4222\nuser = $CONF_STATS_USER\nhome = env(\"CONF_STATS_HOME\", \"/\")",
+		"tls.conf":  "tls { cert = a.pem, key = a.key }",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("CONF_STATS_USER", "admin")
+
+	var stats []ParseStats
+	fp := filepath.Join(dir, "main.conf")
+	if _, err := ParseFile(fp, WithStats(func(s ParseStats) { stats = append(stats, s) })); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(stats) != 1 {
+		t.Fatalf("Expected one report, got %d", len(stats))
+	}
+	s := stats[0]
+	size := int64(len(files["main.conf"]) + len(files["tls.conf"]))
+	if s.File != fp || s.Bytes != size || s.Keys != 6 || s.Includes != 1 || s.EnvLookups != 2 || s.Err != nil {
+		t.Fatalf("Unexpected stats: %+v", s)
+	}
+	if s.Duration <= 0 {
+		t.Fatalf("Expected a duration, got %v", s.Duration)
+	}
+
+	// Includes served from a cache count as when they were read.
+	cache := NewIncludeCache()
+	for i := 0; i < 2; i++ {
+		if _, err := ParseFile(fp, WithIncludeCache(cache), WithStats(func(s ParseStats) { stats = append(stats, s) })); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if cs := cache.Stats(); cs.Hits != 1 {
+		t.Fatalf("Expected a cache hit, got %+v", cs)
+	}
+	for _, cs := range stats[1:] {
+		if cs.Bytes != s.Bytes || cs.Keys != s.Keys || cs.Includes != s.Includes {
+			t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", cs, s)
+		}
+	}
+	stats = stats[:1]
+
+	_, err := Parse("a = $CONF_STATS_MISSING", WithStats(func(s ParseStats) { stats = append(stats, s) }))
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	if s := stats[len(stats)-1]; !errors.Is(s.Err, err) || s.EnvLookups != 1 {
+		t.Fatalf("Unexpected stats: %+v", s)
+	}
+
+	_, err = ParseAll([]string{"a = 1", "b { c = 2 }"}, WithStats(func(s ParseStats) { stats = append(stats, s) }))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if s := stats[len(stats)-1]; s.Keys != 3 || s.Bytes != 16 {
+		t.Fatalf("Unexpected stats: %+v", s)
+	}
+}
@@ -0,0 +1,494 @@
+package conf
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultHistoryLimit is the number of versions a Store retains by default.
+const DefaultHistoryLimit = 10
+
+// Store holds the current parsed config of a file. Reads are lock free and
+// safe from any number of goroutines while Reload swaps in a new version.
+type Store struct {
+	fp   string
+	opts []Option
+	load func() (map[string]any, error)
+
+	cur atomic.Pointer[map[string]any]
+
+	// mu serializes reloads and guards the subscribers, reload handlers,
+	// history and validator.
+	mu       sync.Mutex
+	subs     []subscription
+	nextID   int
+	validate func(map[string]any) error
+	handlers []*reloadHandler
+
+	// history holds the retained versions, oldest first. The last entry
+	// is the current config.
+	history      []Version
+	historyLimit int
+	nextVersion  uint64
+
+	// deps maps the config file and the include files the current config
+	// was built from to the hash of their contents, see Watch.
+	deps map[string]string
+
+	// late holds the values the references kept by WithLateBinding in the
+	// current config resolved to, by the key paths holding them, see
+	// Refresh.
+	late map[string]any
+
+	// secrets holds the values decrypted or read with file() by any
+	// config the store parsed, see Redacted. It only grows, so it covers
+	// the configs of the history as well.
+	secrets atomic.Pointer[map[string]bool]
+}
+
+// Version is a config held by a Store at some point in time.
+type Version struct {
+	ID   uint64
+	Time time.Time
+	// Checksum is the Checksum of Config.
+	Checksum string
+	// Config must not be modified.
+	Config map[string]any
+	// Changes are relative to the version that preceded it.
+	Changes []Change
+}
+
+// NewStore parses the config file at fp and returns a Store holding it.
+//
+// Parsed include files are kept in an IncludeCache, so a reload only
+// parses again the include files that changed, and the files including
+// them, splicing in the others from the cache. Pass WithIncludeCache to
+// use another cache. Options that turn off the cache, listed with
+// WithIncludeCache, make every reload parse all include files again.
+func NewStore(fp string, opts ...Option) (*Store, error) {
+	opts = append([]Option{WithIncludeCache(NewIncludeCache())}, opts...)
+	s := &Store{fp: fp, opts: opts}
+	s.load = s.parse
+	return s.init()
+}
+
+// NewStoreFunc returns a Store holding the config returned by load, which
+// Reload calls again for every reload. It is meant for configs that do not
+// come from a file, such as those fetched from a config service. Watch
+// does nothing for such stores.
+func NewStoreFunc(load func() (map[string]any, error)) (*Store, error) {
+	s := &Store{load: load}
+	return s.init()
+}
+
+func (s *Store) init() (*Store, error) {
+	m, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	s.historyLimit = DefaultHistoryLimit
+	s.cur.Store(&m)
+	s.record(m, Checksum(m), nil)
+	s.resolveLateValues(m)
+	return s, nil
+}
+
+// Load returns the current config. The returned map is shared with other
+// readers and must not be modified.
+func (s *Store) Load() map[string]any {
+	return *s.cur.Load()
+}
+
+// Redacted returns a copy of the current config with secrets redacted as
+// Redact does with IsSecretKey. Values decrypted with WithDecryptor or read
+// with file() are redacted too, whatever key they are under.
+func (s *Store) Redacted() map[string]any {
+	var secrets map[string]bool
+	if p := s.secrets.Load(); p != nil {
+		secrets = *p
+	}
+	return redactValue(s.Load(), IsSecretKey, secrets).(map[string]any)
+}
+
+// Reload parses the config file again, or calls the load function of a
+// store from NewStoreFunc, and swaps it in. Include files that did not
+// change are taken from the include cache of the store, except those
+// looking up environment variables or calling functions, see
+// WithIncludeCache. Subscribers and the reload
+// handlers registered with Handle are notified of the changes when there
+// are any. On error, including a config rejected by the validator, the
+// current config is kept. Errors of reload handlers are returned with the
+// changes, as the new config is swapped in by then.
+func (s *Store) Reload() ([]Change, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return s.swap(m)
+}
+
+// Update swaps in m, a config loaded by other means than the store, such
+// as one pushed by a config service. Subscribers are notified and m is
+// validated as with a reload.
+func (s *Store) Update(m map[string]any) ([]Change, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.swap(m)
+}
+
+// SetValidator sets fn to be called with every new config before it is
+// swapped in by a reload, update or rollback. A config fn returns an error
+// for is not swapped in and subscribers are not notified, so a bad edit
+// keeps the current config active, and the error is returned wrapped in a
+// *RejectedError. fn must not modify the config, nor call methods of the
+// store. A nil fn removes the validator.
+func (s *Store) SetValidator(fn func(m map[string]any) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.validate = fn
+}
+
+// RejectedError is returned for a config the validator of a Store
+// rejected.
+type RejectedError struct {
+	Err error
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("config rejected: %v", e.Err)
+}
+
+func (e *RejectedError) Unwrap() error {
+	return e.Err
+}
+
+// parse parses the config file and records the files it was built from.
+func (s *Store) parse() (map[string]any, error) {
+	m, deps, secrets, err := s.parseFile(s.fp)
+	if err != nil {
+		return nil, err
+	}
+	s.deps = deps
+	s.addSecrets(secrets)
+	return m, nil
+}
+
+// addSecrets adds secrets to those the store redacts, before the config
+// holding them is swapped in.
+func (s *Store) addSecrets(secrets []string) {
+	cur := s.secrets.Load()
+	if cur == nil {
+		cur = &map[string]bool{}
+	}
+	var m map[string]bool
+	for _, v := range secrets {
+		if (*cur)[v] || m[v] {
+			continue
+		}
+		if m == nil {
+			m = maps.Clone(*cur)
+		}
+		m[v] = true
+	}
+	if m != nil {
+		s.secrets.Store(&m)
+	}
+}
+
+// parseFile parses the config file at fp with the options of the store and
+// returns it with the hashes of the files it was built from and the values
+// it decrypted or read with file().
+func (s *Store) parseFile(fp string) (map[string]any, map[string]string, []string, error) {
+	data, err := readFile(fp, newOptions(s.opts).readLimit())
+	if err != nil {
+		return nil, nil, nil, &OpenError{Path: fp, Err: err}
+	}
+	p, err := parseData(string(data), fp, false, s.opts...)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	deps := make(map[string]string, len(p.deps)+1)
+	for dep, sum := range p.deps {
+		deps[dep] = sum
+	}
+	deps[absPath(fp)] = hashData(data)
+	return p.mapping, deps, p.state.secrets, nil
+}
+
+// Validate checks the config file at fp as a reload would, without
+// applying anything, as a test of a config before it is deployed. The file
+// is parsed with the options of the store, which checks it against its
+// schema blocks and sidecar schema file, passed to the validator, and the
+// reload handlers of the changes it makes are called with DryRun set. The
+// store is left unchanged and subscribers are not notified. An empty fp
+// checks the file of the store, or the config returned by the load
+// function of a store from NewStoreFunc.
+//
+// Validate returns the changes the config would make, and the errors as a
+// reload returns them.
+func (s *Store) Validate(fp string) ([]Change, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if fp == "" {
+		fp = s.fp
+	}
+	var m map[string]any
+	var err error
+	if fp == "" {
+		m, err = s.load()
+	} else {
+		m, _, _, err = s.parseFile(fp)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.validate != nil {
+		if err := s.validate(m); err != nil {
+			return nil, &RejectedError{Err: err}
+		}
+	}
+	changes := Diff(s.Load(), m)
+	if len(changes) == 0 {
+		return changes, nil
+	}
+	return changes, s.runHandlers(m, changes, true)
+}
+
+// Watch polls the config file and the files it includes every interval
+// and reloads the store once any of them changed and stayed unchanged for
+// an interval, until ctx is done. It returns the error of ctx.
+//
+// fn, if not nil, is called after every reload Watch makes, with the
+// changes or with the error of the reload. A config that fails to parse,
+// or that the validator rejects, is never swapped in, so fn sees the error
+// and the current config is kept until the files are fixed. fn must not
+// call Reload.
+//
+// Values bound late with WithLateBinding are resolved again every interval
+// as Refresh does, and fn is called with the changes, or the error, when
+// any of them changed or failed to resolve.
+func (s *Store) Watch(ctx context.Context, interval time.Duration, fn func(changes []Change, err error)) error {
+	s.mu.Lock()
+	seen := s.deps
+	s.mu.Unlock()
+	var pending map[string]string
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+		if changes, err := s.Refresh(); (len(changes) > 0 || err != nil) && fn != nil {
+			fn(changes, err)
+		}
+		s.mu.Lock()
+		sums := s.fileSums()
+		s.mu.Unlock()
+		if maps.Equal(sums, seen) {
+			pending = nil
+			continue
+		}
+		// Wait for the files to settle so a file caught in the middle
+		// of being written is not loaded.
+		if !maps.Equal(sums, pending) {
+			pending = sums
+			continue
+		}
+		pending = nil
+		changes, err := s.Reload()
+		if err == nil {
+			// The reload may have added or dropped include files.
+			s.mu.Lock()
+			sums = s.deps
+			s.mu.Unlock()
+		}
+		seen = sums
+		if fn != nil {
+			fn(changes, err)
+		}
+	}
+}
+
+// fileSums returns the current hashes of the files the config was built
+// from, with an empty hash for missing files. The caller must hold s.mu.
+func (s *Store) fileSums() map[string]string {
+	sums := make(map[string]string, len(s.deps))
+	for fp := range s.deps {
+		data, err := os.ReadFile(fp)
+		if err != nil {
+			sums[fp] = ""
+			continue
+		}
+		sums[fp] = hashData(data)
+	}
+	return sums
+}
+
+// Rollback makes the retained version with the given ID current again. The
+// restored config is recorded as a new version and subscribers are notified
+// as with a reload.
+func (s *Store) Rollback(id uint64) ([]Change, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, v := range s.history {
+		if v.ID == id {
+			return s.swap(v.Config)
+		}
+	}
+	return nil, fmt.Errorf("version %d is not in the store history", id)
+}
+
+// History returns the retained versions, oldest first. The last entry is
+// the current config.
+func (s *Store) History() []Version {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Version(nil), s.history...)
+}
+
+// SetHistoryLimit sets how many versions, including the current one, the
+// Store retains. Limits below one are treated as one.
+func (s *Store) SetHistoryLimit(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.historyLimit = max(n, 1)
+	s.trimHistory()
+}
+
+// Checksum returns the Checksum of the current config, to report which
+// version of the config is in use.
+func (s *Store) Checksum() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.history[len(s.history)-1].Checksum
+}
+
+// swap makes m the current config once the validator accepts it. A config
+// with the checksum of the current one is a no-op and is not swapped in.
+// The caller must hold s.mu.
+func (s *Store) swap(m map[string]any) ([]Change, error) {
+	sum := Checksum(m)
+	if sum == s.history[len(s.history)-1].Checksum {
+		return nil, nil
+	}
+	if s.validate != nil {
+		if err := s.validate(m); err != nil {
+			return nil, &RejectedError{Err: err}
+		}
+	}
+	changes := Diff(s.Load(), m)
+	s.cur.Store(&m)
+	s.resolveLateValues(m)
+	// Configs Diff finds no changes in, such as one holding -0.0 for 0.0,
+	// are recorded as well, so Checksum and History agree.
+	s.record(m, sum, changes)
+	if len(changes) == 0 {
+		return changes, nil
+	}
+	s.notify(changes)
+	return changes, s.runHandlers(m, changes, false)
+}
+
+func (s *Store) record(m map[string]any, sum string, changes []Change) {
+	s.nextVersion++
+	s.history = append(s.history, Version{
+		ID:       s.nextVersion,
+		Time:     time.Now(),
+		Checksum: sum,
+		Config:   m,
+		Changes:  changes,
+	})
+	s.trimHistory()
+}
+
+func (s *Store) trimHistory() {
+	if n := len(s.history) - s.historyLimit; n > 0 {
+		s.history = append(s.history[:0:0], s.history[n:]...)
+	}
+}
+
+// subscription is a callback registered with Subscribe.
+type subscription struct {
+	id int
+	fn func([]Change)
+}
+
+// Subscribe registers fn to be called with the changes of every reload that
+// modifies the config. Callbacks run synchronously from Reload, in the
+// order they were registered, while the store is locked: they may Load the
+// config, but must not call other methods of the store, such as Reload or
+// the returned function. The returned function removes the subscription.
+func (s *Store) Subscribe(fn func(changes []Change)) (unsubscribe func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.nextID
+	s.nextID++
+	s.subs = append(s.subs, subscription{id: id, fn: fn})
+	return func() {
+		s.mu.Lock()
+		s.subs = slices.DeleteFunc(s.subs, func(sub subscription) bool { return sub.id == id })
+		s.mu.Unlock()
+	}
+}
+
+// notify calls the subscribers with changes. The caller must hold s.mu.
+func (s *Store) notify(changes []Change) {
+	for _, sub := range s.subs {
+		sub.fn(changes)
+	}
+}
+
+// SubscribePath registers fn as Subscribe does, to be called only with the
+// changes to the values at or below the key path pattern, and only when
+// there are any. Unquoted * keys and [*] indexes in pattern match any key
+// or element, so "cluster.routes[*].url" follows the URLs of all routes
+// and "tls.*" everything below tls. Changes replacing a map or array that
+// holds values at pattern, such as the removal of tls for "tls.cert",
+// are passed as well.
+func (s *Store) SubscribePath(pattern string, fn func(changes []Change)) (unsubscribe func(), err error) {
+	elems, err := parsePath(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return s.Subscribe(func(changes []Change) {
+		var matched []Change
+		for _, c := range changes {
+			if path, err := parsePath(c.Path); err == nil && pathOverlaps(elems, path) {
+				matched = append(matched, c)
+			}
+		}
+		if len(matched) > 0 {
+			fn(matched)
+		}
+	}), nil
+}
+
+// pathOverlaps reports whether one of the key paths pattern and path is
+// below or at the other, with the wildcards of pattern matching any key or
+// index.
+func pathOverlaps(pattern, path []pathElem) bool {
+	for i := range min(len(pattern), len(path)) {
+		pe, e := pattern[i], path[i]
+		if pe.isIdx != e.isIdx {
+			return false
+		}
+		if !pe.wildcard && (pe.key != e.key || pe.index != e.index) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,438 @@
+package conf
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStoreReload(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "app.conf")
+	if err := os.WriteFile(fp, []byte("port = 4222"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewStore(fp)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if s.Load()["port"] != int64(4222) {
+		t.Fatalf("Unexpected config: %+v", s.Load())
+	}
+
+	var notified []Change
+	unsub := s.Subscribe(func(changes []Change) { notified = changes })
+
+	// Concurrent readers while reloading.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_ = s.Load()["port"]
+			}
+		}()
+	}
+	if err := os.WriteFile(fp, []byte("port = 4223"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Reload(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	wg.Wait()
+
+	if s.Load()["port"] != int64(4223) {
+		t.Fatalf("Expected reloaded config, got %+v", s.Load())
+	}
+	if len(notified) != 1 || notified[0].Path != "port" {
+		t.Fatalf("Unexpected notification: %+v", notified)
+	}
+
+	// A broken file keeps the current config.
+	if err := os.WriteFile(fp, []byte("port = [1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Reload(); err == nil {
+		t.Fatal("Expected error reloading invalid config")
+	}
+	if s.Load()["port"] != int64(4223) {
+		t.Fatalf("Expected config to be kept, got %+v", s.Load())
+	}
+
+	unsub()
+	notified = nil
+	if err := os.WriteFile(fp, []byte("port = 1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Reload(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if notified != nil {
+		t.Fatalf("Expected no notification after unsubscribe, got %+v", notified)
+	}
+}
+
+func TestStoreHistoryRollback(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "app.conf")
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(fp, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("port = 1")
+	s, err := NewStore(fp)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	s.SetHistoryLimit(3)
+	for _, data := range []string{"port = 2", "port = 2", "port = 3", "port = 4"} {
+		write(data)
+		if _, err := s.Reload(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	// Reloads without changes are not recorded, and only 3 are kept.
+	h := s.History()
+	if len(h) != 3 {
+		t.Fatalf("Expected 3 versions, got %d", len(h))
+	}
+	if h[0].Config["port"] != int64(2) || h[2].Config["port"] != int64(4) {
+		t.Fatalf("Unexpected history: %+v", h)
+	}
+	if len(h[1].Changes) != 1 || h[1].Changes[0].Old != int64(2) {
+		t.Fatalf("Unexpected changes: %+v", h[1].Changes)
+	}
+
+	if _, err := s.Rollback(h[0].ID); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if s.Load()["port"] != int64(2) {
+		t.Fatalf("Expected rollback to port 2, got %+v", s.Load())
+	}
+	if h := s.History(); h[len(h)-1].Config["port"] != int64(2) {
+		t.Fatalf("Expected rollback to be recorded, got %+v", h)
+	}
+	if _, err := s.Rollback(1); err == nil {
+		t.Fatal("Expected error rolling back to a dropped version")
+	}
+}
+
+func TestStoreChecksumHistory(t *testing.T) {
+	s, err := NewStoreFunc(func() (map[string]any, error) { return map[string]any{"a": 0.0}, nil })
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var order []int
+	for i := range 5 {
+		s.Subscribe(func([]Change) { order = append(order, i) })
+	}
+
+	// -0.0 equals 0.0, so there are no changes, but the checksum differs.
+	changes, err := s.Update(map[string]any{"a": math.Copysign(0, -1)})
+	if err != nil || len(changes) != 0 || len(order) != 0 {
+		t.Fatalf("Unexpected update: %+v, %v, notified %v", changes, err, order)
+	}
+	h := s.History()
+	if len(h) != 2 || h[1].Checksum != s.Checksum() || s.Checksum() != Checksum(s.Load()) {
+		t.Fatalf("Expected the checksum of the last version, got %s for %+v", s.Checksum(), h)
+	}
+
+	if _, err := s.Update(map[string]any{"a": 1.0}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := []int{0, 1, 2, 3, 4}; !reflect.DeepEqual(order, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", order, expected)
+	}
+}
+
+func TestStoreReloadIncludeEnv(t *testing.T) {
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "app.conf")
+	writeTestFile(t, fp, "a { include 'env.conf' }\nb { include 'func.conf' }\nc { include 'static.conf' }")
+	writeTestFile(t, filepath.Join(dir, "env.conf"), "v = $CONF_TEST_VALUE")
+	writeTestFile(t, filepath.Join(dir, "func.conf"), "v = next()")
+	writeTestFile(t, filepath.Join(dir, "static.conf"), "v = 1")
+	t.Setenv("CONF_TEST_VALUE", "1")
+	var n int64
+	s, err := NewStore(fp, WithFunc("next", func(...any) (any, error) { n++; return n, nil }))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Setenv("CONF_TEST_VALUE", "2")
+	if _, err := s.Reload(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ex := map[string]any{
+		"a": map[string]any{"v": int64(2)},
+		"b": map[string]any{"v": int64(2)},
+		"c": map[string]any{"v": int64(1)},
+	}
+	if !reflect.DeepEqual(s.Load(), ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", s.Load(), ex)
+	}
+}
+
+func TestStoreReloadIncremental(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"app.conf": "a { include 'a.conf' }\nb { include 'b.conf' }\nc = include 'c.conf'",
+		"a.conf":   "v = a",
+		"b.conf":   "v = b\nd { include 'd.conf' }",
+		"c.conf":   "v = c",
+		"d.conf":   "v = d",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cache := NewIncludeCache()
+	s, err := NewStore(filepath.Join(dir, "app.conf"), WithIncludeCache(cache))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "d.conf"), []byte("v = d2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := s.Reload()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Path != "b.d.v" {
+		t.Fatalf("Unexpected changes: %v", changes)
+	}
+	// Only d.conf and b.conf, which includes it, are parsed again.
+	if st := cache.Stats(); st.Hits != 2 || st.Misses != 6 {
+		t.Fatalf("Unexpected cache stats: %+v", st)
+	}
+}
+
+func TestStoreReloadIncludedSchema(t *testing.T) {
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "app.conf")
+	writeTestFile(t, filepath.Join(dir, "schema.conf"), "@schema {\n  port: int & >0\n}\n")
+	writeTestFile(t, fp, "include 'schema.conf'\nport = 4222\n")
+	s, err := NewStore(fp)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// The schema of the include applies on reloads as well, when nothing
+	// but the config file changed.
+	writeTestFile(t, fp, "include 'schema.conf'\nport = 0\n")
+	changes, err := s.Reload()
+	if err == nil {
+		t.Fatalf("Expected error for a value violating the schema, got changes %v", changes)
+	}
+	if port := s.Load()["port"]; port != int64(4222) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", port, int64(4222))
+	}
+}
+
+func TestStoreWatch(t *testing.T) {
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "app.conf")
+	inc := filepath.Join(dir, "limits.conf")
+	if err := os.WriteFile(fp, []byte("port = 4222\ninclude 'limits.conf'"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(inc, []byte("max_conn = 10"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewStore(fp)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	type result struct {
+		changes []Change
+		err     error
+	}
+	results := make(chan result)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.Watch(ctx, 5*time.Millisecond, func(changes []Change, err error) {
+			results <- result{changes, err}
+		})
+	}()
+	next := func() result {
+		t.Helper()
+		select {
+		case r := <-results:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for a reload")
+			return result{}
+		}
+	}
+
+	// Changes to include files are picked up.
+	if err := os.WriteFile(inc, []byte("max_conn = 20"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := next()
+	if r.err != nil || len(r.changes) != 1 || r.changes[0].Path != "max_conn" {
+		t.Fatalf("Unexpected reload: %+v", r)
+	}
+
+	// A broken edit is reported once and keeps the current config.
+	if err := os.WriteFile(fp, []byte("port = [1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if r := next(); r.err == nil {
+		t.Fatalf("Expected error reloading invalid config, got %+v", r)
+	}
+	if s.Load()["port"] != int64(4222) {
+		t.Fatalf("Expected config to be kept, got %+v", s.Load())
+	}
+
+	if err := os.WriteFile(fp, []byte("port = 4223\ninclude 'limits.conf'"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r = next()
+	if r.err != nil || len(r.changes) != 1 || r.changes[0].Path != "port" {
+		t.Fatalf("Unexpected reload: %+v", r)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", err, context.Canceled)
+	}
+}
+
+func TestStoreFunc(t *testing.T) {
+	docs := []string{"port = 4222", "port = 4333"}
+	s, err := NewStoreFunc(func() (map[string]any, error) {
+		m, err := Parse(docs[0])
+		docs = docs[1:]
+		return m, err
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	changes, err := s.Reload()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(changes) != 1 || s.Load()["port"] != int64(4333) {
+		t.Fatalf("Unexpected reload: %+v", changes)
+	}
+
+	changes, err = s.Update(map[string]any{"port": int64(4444)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(changes) != 1 || s.Load()["port"] != int64(4444) {
+		t.Fatalf("Unexpected update: %+v", changes)
+	}
+	if h := s.History(); len(h) != 3 {
+		t.Fatalf("Expected 3 versions, got %d", len(h))
+	}
+}
+
+func TestStoreValidator(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "app.conf")
+	if err := os.WriteFile(fp, []byte("port = 4222"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewStore(fp)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	errPort := errors.New("port must be above 1024")
+	var validated []map[string]any
+	s.SetValidator(func(m map[string]any) error {
+		validated = append(validated, m)
+		if port, _ := m["port"].(int64); port <= 1024 {
+			return errPort
+		}
+		return nil
+	})
+	notified := 0
+	s.Subscribe(func([]Change) { notified++ })
+
+	if err := os.WriteFile(fp, []byte("port = 80"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := s.Reload()
+	var rejected *RejectedError
+	if !errors.As(err, &rejected) || !errors.Is(err, errPort) || changes != nil {
+		t.Fatalf("Expected the config to be rejected, got %v", err)
+	}
+	if s.Load()["port"] != int64(4222) || notified != 0 || len(s.History()) != 1 {
+		t.Fatalf("Unexpected config after a rejected reload: %+v", s.Load())
+	}
+	if _, err := s.Update(map[string]any{"port": int64(443)}); !errors.Is(err, errPort) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", err, errPort)
+	}
+
+	if err := os.WriteFile(fp, []byte("port = 4223"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Reload(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if s.Load()["port"] != int64(4223) || notified != 1 || len(validated) != 3 {
+		t.Fatalf("Unexpected config after a valid reload: %+v", s.Load())
+	}
+
+	s.SetValidator(nil)
+	if _, err := s.Update(map[string]any{"port": int64(80)}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestStoreSubscribePath(t *testing.T) {
+	docs := []string{
+		"port = 4222\ntls { cert = a.pem, key = a.key }\ncluster { routes = [{url: a}, {url: b, weight: 1}] }",
+		"port = 4223\ntls { cert = b.pem, key = a.key }\ncluster { routes = [{url: a}, {url: b, weight: 2}] }",
+		"port = 4223\ncluster { routes = [{url: a}, {url: c, weight: 2}] }",
+	}
+	s, err := NewStoreFunc(func() (map[string]any, error) {
+		m, err := Parse(docs[0])
+		docs = docs[1:]
+		return m, err
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	got := make(map[string][]string)
+	for _, pattern := range []string{"port", "tls.*", "tls.cert", "cluster.routes[*].url", "cluster.*.weight", ""} {
+		_, err := s.SubscribePath(pattern, func(changes []Change) {
+			for _, c := range changes {
+				got[pattern] = append(got[pattern], c.Path)
+			}
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	for range 2 {
+		if _, err := s.Reload(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	expected := map[string][]string{
+		"port":                  {"port"},
+		"tls.*":                 {"tls.cert", "tls"},
+		"tls.cert":              {"tls.cert", "tls"},
+		"cluster.routes[*].url": {"cluster.routes[1].url"},
+		"":                      {"cluster.routes[1].weight", "port", "tls.cert", "cluster.routes[1].url", "tls"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", got, expected)
+	}
+
+	if _, err := s.SubscribePath("tls[", func([]Change) {}); err == nil {
+		t.Fatal("Expected an error for an invalid key path")
+	}
+}
@@ -0,0 +1,75 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TenantError is returned by ParseTenants for the config of a tenant that
+// failed to parse.
+type TenantError struct {
+	Tenant string
+	// File is the config file of the tenant.
+	File string
+	Err  error
+}
+
+func (e *TenantError) Error() string {
+	return fmt.Sprintf("tenant '%s': %v", e.Tenant, e.Err)
+}
+
+func (e *TenantError) Unwrap() error {
+	return e.Err
+}
+
+// ParseTenants parses the config of every tenant in the directory dir,
+// which holds a .conf file for each, named after the tenant, and returns
+// the configs by tenant:
+//
+//	tenants/
+//		acme.conf
+//		globex.conf
+//
+// The base config file base, if not empty, is applied to every tenant as
+// ParseFiles does, with the file of the tenant overriding it and able to
+// refer to its variables. base may be in dir, where it is not a tenant.
+// Every tenant is parsed on its own, so the variables of one are never
+// visible to another, and include paths are relative to the file they
+// appear in.
+//
+// Tenants that fail to parse are left out of the configs, and their errors
+// are returned together as *TenantError errors, so one broken tenant does
+// not keep the others from being loaded.
+func ParseTenants(dir, base string, opts ...Option) (map[string]map[string]any, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, &OpenError{Path: dir, Err: err}
+	}
+	if base != "" {
+		base = filepath.Clean(base)
+	}
+	tenants := make(map[string]map[string]any)
+	var errs []error
+	for _, e := range entries {
+		name := e.Name()
+		fp := filepath.Join(dir, name)
+		if e.IsDir() || strings.HasPrefix(name, ".") || filepath.Ext(name) != ".conf" || fp == base {
+			continue
+		}
+		paths := []string{fp}
+		if base != "" {
+			paths = []string{base, fp}
+		}
+		tenant := strings.TrimSuffix(name, ".conf")
+		m, err := ParseFiles(paths, opts...)
+		if err != nil {
+			errs = append(errs, &TenantError{Tenant: tenant, File: fp, Err: err})
+			continue
+		}
+		tenants[tenant] = m
+	}
+	return tenants, errors.Join(errs...)
+}
@@ -0,0 +1,67 @@
+package conf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTenants(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.conf")
+	writeTestFile(t, base, "region = eu\nlimits { max_conns = 100, max_subs = 10 }\n")
+	writeTestFile(t, filepath.Join(dir, "acme.conf"), "secret = a1\nlimits { max_conns = 500 }\ntoken = $secret\n")
+	writeTestFile(t, filepath.Join(dir, "globex.conf"), "name = globex\nzone = $region\n")
+	writeTestFile(t, filepath.Join(dir, "initech.conf"), "token = $secret\n")
+	writeTestFile(t, filepath.Join(dir, "notes.txt"), "not a tenant")
+	writeTestFile(t, filepath.Join(dir, ".hidden.conf"), "x = ")
+	if err := os.Mkdir(filepath.Join(dir, "archive.conf"), 0o755); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tenants, err := ParseTenants(dir, base)
+	expected := map[string]map[string]any{
+		"acme": {
+			"region": "eu",
+			"secret": "a1",
+			"token":  "a1",
+			"limits": map[string]any{"max_conns": int64(500), "max_subs": int64(10)},
+		},
+		"globex": {
+			"region": "eu",
+			"name":   "globex",
+			"zone":   "eu",
+			"limits": map[string]any{"max_conns": int64(100), "max_subs": int64(10)},
+		},
+	}
+	if !reflect.DeepEqual(tenants, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", tenants, expected)
+	}
+
+	// The variables of one tenant are not visible to another.
+	var te *TenantError
+	if !errors.As(err, &te) {
+		t.Fatalf("Expected a tenant error, got %v", err)
+	}
+	if te.Tenant != "initech" || te.File != filepath.Join(dir, "initech.conf") {
+		t.Fatalf("Unexpected tenant error: %+v", te)
+	}
+	if !strings.HasPrefix(err.Error(), "tenant 'initech': variable reference for 'secret' can not be found") {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Without a base, the base file is a tenant like any other.
+	tenants, err = ParseTenants(dir, "")
+	if err == nil || len(tenants) != 2 || tenants["base"] == nil {
+		t.Fatalf("Unexpected configs without base: %+v, %v", tenants, err)
+	}
+	if limits := tenants["acme"]["limits"]; !reflect.DeepEqual(limits, map[string]any{"max_conns": int64(500)}) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", limits, map[string]any{"max_conns": int64(500)})
+	}
+	if _, err := ParseTenants(filepath.Join(dir, "missing"), ""); err == nil {
+		t.Fatal("Expected error for a missing directory")
+	}
+}
@@ -0,0 +1,90 @@
+package conf
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// NewToken returns a token for value as defined in file at line and pos,
+// e.g. to build the expected result of a parse with checks in tests.
+func NewToken(value any, file string, line, pos int) *Token {
+	return &Token{item: item{Line: line, Pos: pos}, value: value, sourceFile: file}
+}
+
+// Equal reports whether t and o hold equal values defined at the same
+// position. Nested tokens are compared the same way.
+func (t *Token) Equal(o *Token) bool {
+	if t == nil || o == nil {
+		return t == o
+	}
+	return t.sourceFile == o.sourceFile && t.item.Line == o.item.Line &&
+		t.item.Pos == o.item.Pos && tokenValuesEqual(t.value, o.value)
+}
+
+func tokenValuesEqual(a, b any) bool {
+	switch av := a.(type) {
+	case *Token:
+		bv, ok := b.(*Token)
+		return ok && av.Equal(bv)
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, e := range av {
+			be, ok := bv[k]
+			if !ok || !tokenValuesEqual(e, be) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		bv, ok := b.([]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !tokenValuesEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// StripTokens returns a copy of m from a parse with checks with every
+// *Token replaced by its value, as Parse would have returned it.
+func StripTokens(m map[string]any) map[string]any {
+	return stripValue(m).(map[string]any)
+}
+
+// WalkTokens calls fn for every *Token in m, depth first and in key order,
+// with the key path of its value. Array elements are addressed by index as in Lookup, e.g.
+// "cluster.routes[2]".
+func WalkTokens(m map[string]any, fn func(path string, t *Token)) {
+	walkTokens("", m, fn)
+}
+
+func walkTokens(path string, v any, fn func(string, *Token)) {
+	if tk, ok := v.(*Token); ok {
+		fn(path, tk)
+		v = tk.Value()
+	}
+	switch vv := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(vv))
+		for k := range vv {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			walkTokens(joinPath(path, k), vv[k], fn)
+		}
+	case []any:
+		for i, e := range vv {
+			walkTokens(fmt.Sprintf("%s[%d]", path, i), e, fn)
+		}
+	}
+}
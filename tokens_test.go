@@ -0,0 +1,65 @@
+package conf
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestStripTokens(t *testing.T) {
+	data := "a = 1\nb { c = [x, {d = true}] }"
+	m, err := ParseWithChecks(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ex, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if s := StripTokens(m); !reflect.DeepEqual(s, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", s, ex)
+	}
+	if _, ok := m["a"].(*Token); !ok {
+		t.Fatalf("Expected the original map to keep its tokens, got %T", m["a"])
+	}
+}
+
+func TestWalkTokens(t *testing.T) {
+	m, err := ParseWithChecks("a = 1\nb { c = [x, {d = true}] }")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var got []string
+	WalkTokens(m, func(path string, tk *Token) {
+		got = append(got, fmt.Sprintf("%s@%d", path, tk.Line()))
+	})
+	ex := []string{"a@1", "b@2", "b.c@2", "b.c[0]@2", "b.c[1]@2", "b.c[1].d@2"}
+	if !reflect.DeepEqual(got, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", got, ex)
+	}
+}
+
+func TestNewToken(t *testing.T) {
+	m, err := ParseWithChecks("a = 1\nb { c = [x] }")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ex := map[string]any{
+		"a": NewToken(int64(1), "", 1, 0),
+		"b": NewToken(map[string]any{
+			"c": NewToken([]any{NewToken("x", "", 2, 10)}, "", 2, 5),
+		}, "", 2, 1),
+	}
+	for k, e := range ex {
+		if tk, _ := m[k].(*Token); !tk.Equal(e.(*Token)) {
+			t.Fatalf("Mismatch for %s:\nReceived: '%+v'\nExpected: '%+v'\n", k, tk, e)
+		}
+	}
+	if NewToken(1, "", 1, 0).Equal(NewToken(1, "", 1, 1)) {
+		t.Fatal("Expected tokens at different positions to differ")
+	}
+	tk := NewToken("v", "a.conf", 3, 4)
+	if tk.Value() != "v" || tk.SourceFile() != "a.conf" || tk.Line() != 3 || tk.Position() != 4 || tk.IsUsedVariable() {
+		t.Fatalf("Unexpected token getters: %+v", tk)
+	}
+}
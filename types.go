@@ -0,0 +1,190 @@
+package conf
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kind is the expected type of a config value.
+type Kind int
+
+const (
+	KindAny Kind = iota
+	KindString
+	KindInt
+	KindFloat
+	KindBool
+	KindTime
+	KindBytes
+	KindMap
+	KindArray
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindAny:
+		return "any"
+	case KindString:
+		return "string"
+	case KindInt:
+		return "integer"
+	case KindFloat:
+		return "float"
+	case KindBool:
+		return "bool"
+	case KindTime:
+		return "datetime"
+	case KindBytes:
+		return "bytes"
+	case KindMap:
+		return "map"
+	case KindArray:
+		return "array"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// kindOf returns the Kind of a parsed value.
+func kindOf(v any) Kind {
+	switch plainValue(v).(type) {
+	case string:
+		return KindString
+	case int64, ByteSize, SIQuantity:
+		return KindInt
+	case float64:
+		return KindFloat
+	case bool:
+		return KindBool
+	case time.Time:
+		return KindTime
+	case []byte:
+		return KindBytes
+	case map[string]any:
+		return KindMap
+	case []any:
+		return KindArray
+	}
+	return KindAny
+}
+
+// WithTypes declares the expected kind of values by their full key path.
+// Values of another kind are coerced when that is lossless, such as the
+// string "4222" to an integer, and rejected otherwise. Parses with checks
+// reject every mismatch instead of coercing. Integers with a suffix, such
+// as 8k, are kept as written for KindString keys.
+func WithTypes(types map[string]Kind) Option {
+	return func(o *options) {
+		o.types = make(map[string]Kind, len(types))
+		for path, k := range types {
+			o.types[canonicalPath(path)] = k
+		}
+	}
+}
+
+// WithHomogeneousArrays rejects arrays whose elements are not all of the
+// same kind, such as ["a", 1, true], reporting the first element that
+// differs from the first one.
+func WithHomogeneousArrays() Option {
+	return func(o *options) {
+		o.homogeneous = true
+	}
+}
+
+// checkArrayElem reports an error when val is appended to an array holding
+// elements of another kind and arrays must be homogeneous.
+func (p *parser) checkArrayElem(it item, val any) error {
+	arr, ok := p.ctx.([]any)
+	if !ok || !p.opts.homogeneous || len(arr) == 0 {
+		return nil
+	}
+	want, got := kindOf(arr[0]), kindOf(val)
+	if want == got {
+		return nil
+	}
+	return p.errorf(it, "mixed types in array, expected %s like the first element but got %s '%v'",
+		want, got, stripValue(val))
+}
+
+// checkType coerces val, set under the given key path, to the declared kind.
+func (p *parser) checkType(path string, it item, val any) (any, error) {
+	want, ok := p.opts.types[path]
+	if !ok || want == KindAny {
+		return val, nil
+	}
+	tk, isToken := val.(*Token)
+	v := plainValue(val)
+	got := kindOf(v)
+	if n, ok := unitValue(v); ok {
+		v = n
+	}
+	if got == want {
+		return val, nil
+	}
+
+	if !p.pedantic {
+		if cv, ok := coerce(v, want); ok {
+			if isToken {
+				tk.value = cv
+				return tk, nil
+			}
+			return cv, nil
+		}
+	}
+	return nil, p.errorf(it, "expected %s for key '%s', got %s '%v'",
+		want, path, got, stripValue(v))
+}
+
+// coerce converts v to the given kind when that loses no information.
+func coerce(v any, want Kind) (any, bool) {
+	switch want {
+	case KindString:
+		switch vv := v.(type) {
+		case int64:
+			return strconv.FormatInt(vv, 10), true
+		case float64:
+			return strconv.FormatFloat(vv, 'f', -1, 64), true
+		case bool:
+			return strconv.FormatBool(vv), true
+		}
+	case KindInt:
+		switch vv := v.(type) {
+		case string:
+			if n, err := parseInteger(strings.TrimSpace(vv)); err == nil {
+				return n, true
+			}
+		case float64:
+			if vv == math.Trunc(vv) && math.Abs(vv) < 1<<63 {
+				return int64(vv), true
+			}
+		}
+	case KindFloat:
+		switch vv := v.(type) {
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(vv), 64); err == nil {
+				return f, true
+			}
+		case int64:
+			// Integers past 2^53 that a float can not hold are rejected.
+			if f := float64(vv); f < 1<<63 && int64(f) == vv {
+				return f, true
+			}
+		}
+	case KindBool:
+		if s, ok := v.(string); ok {
+			switch strings.ToLower(strings.TrimSpace(s)) {
+			case "true", "yes", "on", "false", "no", "off":
+				return parseBool(strings.TrimSpace(s)), true
+			}
+		}
+	case KindTime:
+		if s, ok := v.(string); ok {
+			if t, err := time.Parse(time.RFC3339, strings.TrimSpace(s)); err == nil {
+				return t, true
+			}
+		}
+	}
+	return nil, false
+}
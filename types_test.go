@@ -0,0 +1,139 @@
+package conf
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithTypesCoerce(t *testing.T) {
+	data := `
+		port = "4222"
+		ratio = 2
+		exact = 9007199254740992
+		debug = "yes"
+		name = 42
+		cluster { started = "2024-01-02T03:04:05Z"; weight = 3.0 }
+	`
+	types := map[string]Kind{
+		"port":            KindInt,
+		"ratio":           KindFloat,
+		"exact":           KindFloat,
+		"debug":           KindBool,
+		"name":            KindString,
+		"cluster.started": KindTime,
+		"cluster.weight":  KindInt,
+	}
+	ex := map[string]any{
+		"port":  int64(4222),
+		"ratio": float64(2),
+		"exact": float64(1 << 53),
+		"debug": true,
+		"name":  "42",
+		"cluster": map[string]any{
+			"started": time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			"weight":  int64(3),
+		},
+	}
+	m, err := Parse(data, WithTypes(types))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(m, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, ex)
+	}
+}
+
+func TestWithTypesErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		data     string
+		pedantic bool
+		err      string
+	}{
+		{"not a number", `port = "abc"`, false,
+			"expected integer for key 'port', got string 'abc' (:1:0)"},
+		{"fraction", `port = 4222.5`, false,
+			"expected integer for key 'port', got float '4222.5' (:1:0)"},
+		{"map", "a {\n  port { x = 1 }\n}", false,
+			"expected integer for key 'a.port', got map 'map[x:1]' (:2:3)"},
+		{"pedantic", "\nport = \"4222\"", true,
+			"expected integer for key 'port', got string '4222' (:2:1)"},
+		{"imprecise float", `ratio = 9007199254740993`, false,
+			"expected float for key 'ratio', got integer '9007199254740993' (:1:0)"},
+		{"max int float", `ratio = 9223372036854775807`, false,
+			"expected float for key 'ratio', got integer '9223372036854775807' (:1:0)"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			types := map[string]Kind{"port": KindInt, "a.port": KindInt, "ratio": KindFloat}
+			var err error
+			if tt.pedantic {
+				_, err = ParseWithChecks(tt.data, WithTypes(types))
+			} else {
+				_, err = Parse(tt.data, WithTypes(types))
+			}
+			if err == nil || err.Error() != tt.err {
+				t.Fatalf("Expected error %q, got: %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestWithTypesPedanticToken(t *testing.T) {
+	m, err := ParseWithChecks("port = 4222", WithTypes(map[string]Kind{"port": KindInt}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tk, ok := m["port"].(*Token)
+	if !ok || tk.Value() != int64(4222) {
+		t.Fatalf("Unexpected result: %+v", m["port"])
+	}
+}
+
+func TestKindString(t *testing.T) {
+	if s := KindInt.String(); s != "integer" {
+		t.Fatalf("Unexpected kind name: %q", s)
+	}
+	if s := Kind(99).String(); !strings.HasPrefix(s, "Kind(") {
+		t.Fatalf("Unexpected kind name: %q", s)
+	}
+}
+
+func TestHomogeneousArrays(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		data string
+		err  string
+	}{
+		{"strings", `servers = ["a", "b", "c"]`, ""},
+		{"maps", `servers = [{a = 1}, {b = 2}]`, ""},
+		{"nested", `servers = [["a"], ["b"]]`, ""},
+		{"mixed", `servers = ["a", 1, true]`,
+			"mixed types in array, expected string like the first element but got integer '1' (:1:16)"},
+		{"map", "servers = [\n  \"a\"\n  {b = 2}\n]",
+			"mixed types in array, expected string like the first element but got map 'map[b:2]' (:3:4)"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, pedantic := range []bool{false, true} {
+				var err error
+				if pedantic {
+					_, err = ParseWithChecks(tt.data, WithHomogeneousArrays())
+				} else {
+					_, err = Parse(tt.data, WithHomogeneousArrays())
+				}
+				if tt.err == "" && err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if tt.err != "" && (err == nil || err.Error() != tt.err) {
+					t.Fatalf("Expected error %q, got: %v", tt.err, err)
+				}
+			}
+		})
+	}
+
+	// Arrays may be mixed unless asked otherwise.
+	if _, err := Parse(`servers = ["a", 1, true]`); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package conf
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ByteSize is an integer written with a binary size suffix, such as 4kb or
+// 2GiB, as returned by parses WithUnits. Bytes holds the expanded value and
+// Unit the suffix as written, so the value encodes back the same way.
+type ByteSize struct {
+	Bytes int64
+	Unit  string
+}
+
+// Int64 returns the size in bytes.
+func (s ByteSize) Int64() int64 {
+	return s.Bytes
+}
+
+// String returns the size as written, e.g. "4kb".
+func (s ByteSize) String() string {
+	return formatUnit(s.Bytes, s.Unit)
+}
+
+// MarshalJSON encodes the size as a plain number of bytes.
+func (s ByteSize) MarshalJSON() ([]byte, error) {
+	return strconv.AppendInt(nil, s.Bytes, 10), nil
+}
+
+// SIQuantity is an integer written with a decimal suffix, such as 8k or
+// 2M, as returned by parses WithUnits. Value holds the expanded value and
+// Unit the suffix as written.
+type SIQuantity struct {
+	Value int64
+	Unit  string
+}
+
+// Int64 returns the expanded value.
+func (q SIQuantity) Int64() int64 {
+	return q.Value
+}
+
+// String returns the quantity as written, e.g. "8k".
+func (q SIQuantity) String() string {
+	return formatUnit(q.Value, q.Unit)
+}
+
+// MarshalJSON encodes the quantity as a plain number.
+func (q SIQuantity) MarshalJSON() ([]byte, error) {
+	return strconv.AppendInt(nil, q.Value, 10), nil
+}
+
+// WithUnits returns integers written with a suffix as a ByteSize for
+// binary suffixes like kb, Ki and KiB, or as a SIQuantity for decimal ones
+// like k and M, instead of an int64. Integers without a suffix are still
+// returned as int64.
+func WithUnits() Option {
+	return func(o *options) {
+		o.units = true
+	}
+}
+
+// WithNumberSuffixes sets whether integers with a suffix, such as 8k or
+// 4kb, are expanded, which is the default. Without suffixes such values
+// are kept as strings, e.g. for configs listing video resolutions or model
+// names. Keys declared WithTypes override this: KindInt and KindFloat keys
+// always expand suffixes and KindString keys never do.
+func WithNumberSuffixes(enabled bool) Option {
+	return func(o *options) {
+		o.noSuffixes = !enabled
+	}
+}
+
+// expandSuffix reports whether the suffix of an integer set under the
+// current key is expanded.
+func (p *parser) expandSuffix() bool {
+	if p.opts.ranges != nil && p.durationRange() {
+		return false
+	}
+	if _, ok := p.ctx.(map[string]any); ok && len(p.opts.types) > 0 {
+		switch p.opts.types[p.keyPrefix()] {
+		case KindString:
+			return false
+		case KindInt, KindFloat:
+			return true
+		}
+	}
+	return !p.opts.noSuffixes
+}
+
+// withUnit wraps num, parsed from val, in the type matching its suffix.
+func withUnit(val string, num int64) any {
+	_, unit := parseNumberSuffix(val)
+	switch lower := strings.ToLower(unit); {
+	case unit == "":
+		return num
+	case strings.HasSuffix(lower, "b") || strings.HasSuffix(lower, "i"):
+		return ByteSize{Bytes: num, Unit: unit}
+	default:
+		return SIQuantity{Value: num, Unit: unit}
+	}
+}
+
+// formatUnit writes n, expanded from a number with the given suffix, with
+// that suffix again.
+func formatUnit(n int64, unit string) string {
+	if mult, ok := applySuffix(1, unit).(int64); ok && mult > 1 {
+		n /= mult
+	}
+	return strconv.FormatInt(n, 10) + unit
+}
+
+// unitValue returns the expanded value of a ByteSize or SIQuantity.
+func unitValue(v any) (int64, bool) {
+	switch vv := v.(type) {
+	case ByteSize:
+		return vv.Bytes, true
+	case SIQuantity:
+		return vv.Value, true
+	}
+	return 0, false
+}
@@ -0,0 +1,108 @@
+package conf
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWithUnits(t *testing.T) {
+	data := "max_payload = 4kb; buf = 2MiB; big = 1Gi; rate = 8k; neg = -2M; port = 4222"
+	ex := map[string]any{
+		"max_payload": ByteSize{Bytes: 4096, Unit: "kb"},
+		"buf":         ByteSize{Bytes: 2 * 1024 * 1024, Unit: "MiB"},
+		"big":         ByteSize{Bytes: 1024 * 1024 * 1024, Unit: "Gi"},
+		"rate":        SIQuantity{Value: 8000, Unit: "k"},
+		"neg":         SIQuantity{Value: -2000000, Unit: "M"},
+		"port":        int64(4222),
+	}
+	m, err := Parse(data, WithUnits())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(m, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, ex)
+	}
+
+	out, err := Marshal(m)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, s := range []string{"max_payload: 4kb\n", "buf: 2MiB\n", "big: 1Gi\n", "rate: 8k\n", "neg: -2M\n"} {
+		if !strings.Contains(string(out), s) {
+			t.Fatalf("Expected %q in:\n%s", s, out)
+		}
+	}
+	again, err := Parse(string(out), WithUnits())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(again, ex) {
+		t.Fatalf("Mismatch after round trip:\nReceived: '%+v'\nExpected: '%+v'\n", again, ex)
+	}
+
+	js, err := json.Marshal(m["max_payload"])
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(js) != "4096" {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", string(js), "4096")
+	}
+}
+
+func TestWithUnitsTypes(t *testing.T) {
+	m, err := Parse("size = 4kb; ratio = 2k", WithUnits(), WithTypes(map[string]Kind{
+		"size":  KindInt,
+		"ratio": KindFloat,
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ex := map[string]any{"size": ByteSize{Bytes: 4096, Unit: "kb"}, "ratio": float64(2000)}
+	if !reflect.DeepEqual(m, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, ex)
+	}
+
+	tm, err := ParseWithChecks("size = 4kb", WithUnits())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if v := tm["size"].(*Token).Value(); v != (ByteSize{Bytes: 4096, Unit: "kb"}) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", v, "4kb")
+	}
+}
+
+func TestWithoutNumberSuffixes(t *testing.T) {
+	data := "resolution = 8k; model = 4m; port = 4222; ratio = 1.5; limits { size = 4kb; rate = 2k }"
+	ex := map[string]any{
+		"resolution": "8k",
+		"model":      "4m",
+		"port":       int64(4222),
+		"ratio":      1.5,
+		"limits":     map[string]any{"size": int64(4096), "rate": "2k"},
+	}
+	m, err := Parse(data, WithNumberSuffixes(false), WithTypes(map[string]Kind{"limits.size": KindInt}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(m, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, ex)
+	}
+
+	m, err = Parse(data, WithTypes(map[string]Kind{"resolution": KindString}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m["resolution"] != "8k" || m["model"] != int64(4000000) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, "resolution = 8k, model = 4000000")
+	}
+
+	tm, err := ParseWithChecks("resolution = 8k", WithNumberSuffixes(false))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if v := tm["resolution"].(*Token).Value(); v != "8k" {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", v, "8k")
+	}
+}
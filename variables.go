@@ -0,0 +1,249 @@
+package conf
+
+import "strings"
+
+// WithPrivatePrefix removes keys starting with prefix, e.g. "_PASS" for the
+// prefix "_", from the result. Private keys can still be referenced as
+// variables while parsing, so secrets used to build other values do not
+// leak into the parsed config.
+func WithPrivatePrefix(prefix string) Option {
+	return func(o *options) {
+		o.privatePrefix = prefix
+	}
+}
+
+// WithStripVariables removes keys that were referenced as variables from
+// the result, leaving only the values they were used in.
+func WithStripVariables() Option {
+	return func(o *options) {
+		o.stripVariables = true
+	}
+}
+
+// DefaultLiteralPrefixes are the prefixes of unquoted values starting with
+// '$' that are kept as they are instead of being resolved as variables:
+// bcrypt and argon2 password hashes. Full argon2 hashes contain commas,
+// which end unquoted values, so they need to be quoted.
+var DefaultLiteralPrefixes = []string{"$2a$", "$2b$", "$2y$", "$argon2i$", "$argon2d$", "$argon2id$"}
+
+// WithLiteralPrefixes replaces DefaultLiteralPrefixes, e.g. to add other
+// hash formats. Prefixes include the leading '$'.
+func WithLiteralPrefixes(prefixes ...string) Option {
+	return func(o *options) {
+		o.literalPrefixes = prefixes
+	}
+}
+
+// WithLiteralFunc keeps values starting with '$' as they are when fn
+// reports true for them, in addition to the literal prefixes. fn is called
+// with the value including the '$'.
+func WithLiteralFunc(fn func(value string) bool) Option {
+	return func(o *options) {
+		o.isLiteral = fn
+	}
+}
+
+// VariableResolver resolves variable references of a scheme, such as
+// $vault:secret/data/db#password for the scheme "vault", to values kept
+// outside the config.
+type VariableResolver interface {
+	// Resolve returns the value of ref, the reference without the scheme
+	// and the colon following it.
+	Resolve(ref string) (any, error)
+}
+
+// VariableResolverFunc adapts a function to a VariableResolver.
+type VariableResolverFunc func(ref string) (any, error)
+
+func (f VariableResolverFunc) Resolve(ref string) (any, error) {
+	return f(ref)
+}
+
+// WithVariableResolver resolves variable references starting with scheme
+// and a colon with r. Include files are not cached when resolvers are
+// set, so every reload of a Store resolves the references again.
+func WithVariableResolver(scheme string, r VariableResolver) Option {
+	return func(o *options) {
+		if o.varResolvers == nil {
+			o.varResolvers = make(map[string]VariableResolver)
+		}
+		o.varResolvers[scheme] = r
+	}
+}
+
+// variableResolver returns the resolver for the scheme of the variable
+// reference name, if one is set, and the reference without the scheme.
+func (p *parser) variableResolver(name string) (VariableResolver, string, bool) {
+	scheme, ref, ok := strings.Cut(name, ":")
+	if !ok || p.opts.varResolvers == nil {
+		return nil, "", false
+	}
+	r, ok := p.opts.varResolvers[scheme]
+	return r, ref, ok
+}
+
+// WithVariables sets whether unquoted values starting with '$' are resolved
+// as variable references, which is the default. Without variables such
+// values are kept as they are, e.g. for configs full of shell snippets. A
+// single value can be kept literal by escaping it as \$VAR or $$VAR.
+func WithVariables(enabled bool) Option {
+	return func(o *options) {
+		o.noVariables = !enabled
+	}
+}
+
+// isLiteral reports whether $ref is a literal value rather than a
+// variable reference.
+func (p *parser) isLiteral(ref string) bool {
+	if p.opts.noVariables {
+		return true
+	}
+	prefixes := p.opts.literalPrefixes
+	if prefixes == nil {
+		prefixes = DefaultLiteralPrefixes
+	}
+	if hasLiteralPrefix("$"+ref, prefixes) {
+		return true
+	}
+	return p.opts.isLiteral != nil && p.opts.isLiteral("$"+ref)
+}
+
+func hasLiteralPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// spreadSuffix marks a variable reference whose elements are spliced into
+// the enclosing array, as in [$base_servers..., "extra.com"].
+const spreadSuffix = "..."
+
+// spread appends the elements of the array referenced by it, a variable
+// reference ending in spreadSuffix, to the array being parsed.
+func (p *parser) spread(it item, setValue func(item, any) error) error {
+	if _, ok := p.ctx.([]any); !ok {
+		return p.errorf(it, "variable reference '$%s' can only be spread into an array", it.Val)
+	}
+	ref := it
+	ref.Val = strings.TrimSuffix(it.Val, spreadSuffix)
+	value, _, err := p.resolveVariable(ref)
+	if err != nil {
+		return err
+	}
+	arr, ok := value.([]any)
+	if !ok {
+		return p.errorf(it, "expected array to spread for variable reference '%s', got %s '%v'",
+			ref.Val, kindOf(value), stripValue(value))
+	}
+	for _, e := range arr {
+		if err := setValue(it, p.resolved(plainValue(e))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// spreadMap copies the keys of the map referenced by the map spread it,
+// such as $tls_defaults..., into the map being parsed. Keys set after the
+// spread replace the copied ones.
+func (p *parser) spreadMap(it item) error {
+	value, _, err := p.resolveVariable(it)
+	if err != nil {
+		return err
+	}
+	m, ok := value.(map[string]any)
+	if !ok {
+		return p.errorf(it, "expected map to spread for variable reference '%s', got %s '%v'",
+			it.Val, kindOf(value), stripValue(value))
+	}
+	p.merging = true
+	defer func() { p.merging = false }()
+	for k, v := range m {
+		p.pushKey(k)
+		if tk, ok := v.(*Token); ok {
+			p.pushItemKey(tk.item)
+		} else {
+			p.pushItemKey(it)
+		}
+		if err := p.setValue(p.resolved(v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WithDeepCopy sets whether maps and arrays referenced as variables are
+// copied, which is the default. Without copies every reference shares the
+// same underlying value, so changing one changes them all, but large
+// blocks referenced many times use less memory.
+func WithDeepCopy(enabled bool) Option {
+	return func(o *options) {
+		o.shareReferences = !enabled
+	}
+}
+
+// resolved returns the value to set for a variable reference.
+func (p *parser) resolved(v any) any {
+	if p.opts.shareReferences {
+		return v
+	}
+	return deepCopy(v)
+}
+
+// usedVar records a key referenced as a variable in map m. top is set for
+// keys of the top level map of an include file, which are merged into the
+// map the include appears in.
+type usedVar struct {
+	m   map[string]any
+	key string
+	top bool
+}
+
+// markUsed records that key in the context at depth was referenced.
+func (p *parser) markUsed(m map[string]any, key string, depth int) {
+	if !p.opts.stripVariables {
+		return
+	}
+	p.used = append(p.used, usedVar{m, key, depth == 1})
+}
+
+// adoptUsed takes over the variables referenced in an include file whose
+// top level keys ended up in m.
+func (p *parser) adoptUsed(used []usedVar, m map[string]any) {
+	for _, u := range used {
+		if u.top {
+			u.m, u.top = m, false
+		}
+		p.used = append(p.used, u)
+	}
+}
+
+// stripVariables removes referenced and private keys from the result.
+func (p *parser) stripVariables() {
+	for _, u := range p.used {
+		delete(u.m, u.key)
+	}
+	if p.opts.privatePrefix != "" {
+		stripPrivate(p.result(), p.opts.privatePrefix)
+	}
+}
+
+func stripPrivate(v any, prefix string) {
+	switch vv := plainValue(v).(type) {
+	case map[string]any:
+		for k, e := range vv {
+			if strings.HasPrefix(k, prefix) {
+				delete(vv, k)
+				continue
+			}
+			stripPrivate(e, prefix)
+		}
+	case []any:
+		for _, e := range vv {
+			stripPrivate(e, prefix)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package conf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPrivateVariables(t *testing.T) {
+	data := `
+		_PASS = "s3cret"
+		auth {
+			_user = admin
+			users = [{user: $_user, password: $_PASS, _note: x}]
+		}
+	`
+	ex := map[string]any{
+		"auth": map[string]any{
+			"users": []any{map[string]any{"user": "admin", "password": "s3cret"}},
+		},
+	}
+	for _, parse := range []func(string, ...Option) (map[string]any, error){Parse, ParseWithChecks} {
+		m, err := parse(data, WithPrivatePrefix("_"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if s := stripValue(m); !reflect.DeepEqual(s, ex) {
+			t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", s, ex)
+		}
+	}
+
+	// Private keys are kept unless asked otherwise.
+	m, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := m["_PASS"]; !ok {
+		t.Fatalf("Expected _PASS in result, got %+v", m)
+	}
+}
+
+func TestStripVariables(t *testing.T) {
+	m, err := ParseFile("sample.conf", WithStripVariables())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ex := map[string]any{
+		"listen": "127.0.0.1:8080",
+		"name":   "node0",
+		"auth": map[string]any{
+			"users": []any{
+				map[string]any{"user": "user1", "password": "WSGrnSowBu6QkU9"},
+				map[string]any{"user": "user2", "password": "bo9V4j5B3VTLGns"},
+			},
+			"timeout": float64(0.5),
+		},
+	}
+	if !reflect.DeepEqual(m, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, ex)
+	}
+}
+
+func TestStripVariablesFromIncludes(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.conf":    "include 'secrets.conf'\ndb { password = $DB_PASS; opts = include 'opts.conf' }",
+		"secrets.conf": "DB_PASS = hunter2\nunused = 1",
+		"opts.conf":    "TIMEOUT = 5\nread_timeout = $TIMEOUT",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ex := map[string]any{
+		"unused": int64(1),
+		"db": map[string]any{
+			"password": "hunter2",
+			"opts":     map[string]any{"read_timeout": int64(5)},
+		},
+	}
+	m, err := ParseFile(filepath.Join(dir, "main.conf"), WithStripVariables())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(m, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, ex)
+	}
+}
+
+func TestWithDeepCopy(t *testing.T) {
+	data := "defaults { verify = true }\na { tls = $defaults }\nb { tls = $defaults }"
+	for _, enabled := range []bool{true, false} {
+		m, err := Parse(data, WithDeepCopy(enabled))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		tlsA, _ := Lookup(m, "a.tls")
+		tlsA.(map[string]any)["verify"] = false
+		verify, _ := Lookup(m, "b.tls.verify")
+		if shared := verify == false; shared == enabled {
+			t.Fatalf("WithDeepCopy(%v): unexpected sharing, b.tls.verify = %v", enabled, verify)
+		}
+	}
+}
+
+func TestLiteralPrefixes(t *testing.T) {
+	data := `
+		a = $2a$11$W2zko751KUvVy59mUTWmpOdWXFmbuhH8xCBXE9vfEKh7Jj4ZjsjNW
+		b = $2b$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy
+		c = $2y$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy
+		d = "$argon2id$v=19$m=65536,t=3,p=4$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG"
+		e = $argon2id$v=19$m=65536
+	`
+	m, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, k := range []string{"a", "b", "c"} {
+		if s, _ := m[k].(string); !strings.HasPrefix(s, "$2") || len(s) != 60 {
+			t.Fatalf("Unexpected value for %s: %v", k, m[k])
+		}
+	}
+	if m["d"] != "$argon2id$v=19$m=65536,t=3,p=4$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG" {
+		t.Fatalf("Unexpected value for d: %v", m["d"])
+	}
+	if m["e"] != "$argon2id$v=19$m=65536" {
+		t.Fatalf("Unexpected value for e: %v", m["e"])
+	}
+	if _, err := ParseWithChecks(data); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	m, err = Parse(`h = $6$rounds=5000$salt$hash`, WithLiteralPrefixes("$6$"))
+	if err != nil || m["h"] != "$6$rounds=5000$salt$hash" {
+		t.Fatalf("Unexpected result: %+v %v", m, err)
+	}
+	if _, err := Parse(`h = $2a$11$x`, WithLiteralPrefixes("$6$")); err == nil {
+		t.Fatal("Expected $2a$ to be a variable with other prefixes")
+	}
+	m, err = Parse(`h = $LITERAL_x`, WithLiteralFunc(func(v string) bool { return strings.HasPrefix(v, "$LITERAL_") }))
+	if err != nil || m["h"] != "$LITERAL_x" {
+		t.Fatalf("Unexpected result: %+v %v", m, err)
+	}
+}
+
+func TestEscapedVariables(t *testing.T) {
+	data := `
+		cron = "*/5 * * * *"
+		a = \$HOME
+		b = $$HOME
+		c = [$$1, \$2]
+		d = pa$$word
+	`
+	m, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]any{
+		"cron": "*/5 * * * *",
+		"a":    "$HOME",
+		"b":    "$HOME",
+		"c":    []any{"$1", "$2"},
+		"d":    "pa$$word",
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, expected)
+	}
+}
+
+func TestWithoutVariables(t *testing.T) {
+	data := `
+		foo = 1
+		a = $foo
+		b = $UNDEFINED_VARIABLE
+		c = $$foo
+	`
+	if _, err := Parse(data); err == nil {
+		t.Fatal("Expected an error for the undefined variable")
+	}
+	m, err := Parse(data, WithVariables(false))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]any{
+		"foo": int64(1),
+		"a":   "$foo",
+		"b":   "$UNDEFINED_VARIABLE",
+		"c":   "$foo",
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, expected)
+	}
+	if _, err := ParseWithChecks(data, WithVariables(false)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestArraySpread(t *testing.T) {
+	data := `
+		base_servers = ["a.com", "b.com"]
+		servers = [$base_servers..., "extra.com"]
+		nested = [[$base_servers...], $base_servers]
+		empty = []
+		none = [$empty...]
+	`
+	for _, parse := range []func(string, ...Option) (map[string]any, error){Parse, ParseWithChecks} {
+		m, err := parse(data)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := map[string]any{
+			"base_servers": []any{"a.com", "b.com"},
+			"servers":      []any{"a.com", "b.com", "extra.com"},
+			"nested":       []any{[]any{"a.com", "b.com"}, []any{"a.com", "b.com"}},
+			"empty":        []any{},
+			"none":         []any{},
+		}
+		if s := stripValue(m); !reflect.DeepEqual(s, expected) {
+			t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", s, expected)
+		}
+	}
+
+	for _, tt := range []struct {
+		data string
+		err  string
+	}{
+		{"a = [1]; b = $a...", "can only be spread into an array"},
+		{"a = 1; b = [$a...]", "expected array to spread for variable reference 'a', got integer '1'"},
+		{"b = [$missing...]", "variable reference for 'missing' can not be found"},
+	} {
+		_, err := Parse(tt.data)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Fatalf("Expected error containing %q for %q, got: %v", tt.err, tt.data, err)
+		}
+	}
+
+	m, err := Parse("a = [1]; b = [$a...]", WithVariables(false))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := []any{"$a..."}; !reflect.DeepEqual(m["b"], expected) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m["b"], expected)
+	}
+}
+
+func TestMapSpread(t *testing.T) {
+	data := `
+		tls_defaults { verify = true, ciphers = [a, b], port = 4222 }
+		server_a { $tls_defaults... }
+		server_b {
+			$tls_defaults...
+			port = 4333
+		}
+		server_c { port = 1; $tls_defaults..., name = c }
+	`
+	for _, parse := range []func(string, ...Option) (map[string]any, error){Parse, ParseWithChecks} {
+		m, err := parse(data)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defaults := map[string]any{"verify": true, "ciphers": []any{"a", "b"}, "port": int64(4222)}
+		expected := map[string]any{
+			"tls_defaults": defaults,
+			"server_a":     defaults,
+			"server_b":     map[string]any{"verify": true, "ciphers": []any{"a", "b"}, "port": int64(4333)},
+			"server_c":     map[string]any{"verify": true, "ciphers": []any{"a", "b"}, "port": int64(4222), "name": "c"},
+		}
+		if s := stripValue(m); !reflect.DeepEqual(s, expected) {
+			t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", s, expected)
+		}
+
+		ciphers, _ := Lookup(m, "server_a.ciphers")
+		plainValue(ciphers).([]any)[0] = "c"
+		if v, _ := Lookup(m, "tls_defaults.ciphers"); !reflect.DeepEqual(stripValue(v), []any{"a", "b"}) {
+			t.Fatalf("Expected spread values to be copied, got: %v", stripValue(v))
+		}
+	}
+
+	for _, tt := range []struct {
+		data string
+		err  string
+	}{
+		{"a = [1]; b { $a... }", "expected map to spread for variable reference 'a', got array '[1]'"},
+		{"b { $missing... }", "variable reference for 'missing' can not be found"},
+	} {
+		_, err := Parse(tt.data)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Fatalf("Expected error containing %q for %q, got: %v", tt.err, tt.data, err)
+		}
+	}
+}
+
+func TestVariableResolver(t *testing.T) {
+	secrets := map[string]any{"db#password": "s3cr$t", "db#port": int64(5432)}
+	r := VariableResolverFunc(func(ref string) (any, error) {
+		v, ok := secrets[ref]
+		if !ok {
+			return nil, fmt.Errorf("no secret '%s'", ref)
+		}
+		return v, nil
+	})
+	data := "db { password = $vault:db#password; port = $vault:db#port }\nhash = $2a$11$abc"
+	m, err := Parse(data, WithVariableResolver("vault", r))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ex := map[string]any{
+		"db":   map[string]any{"password": "s3cr$t", "port": int64(5432)},
+		"hash": "$2a$11$abc",
+	}
+	if !reflect.DeepEqual(m, ex) {
+		t.Fatalf("Mismatch:\nReceived: '%+v'\nExpected: '%+v'\n", m, ex)
+	}
+
+	_, err = Parse("password = $vault:db#user", WithVariableResolver("vault", r))
+	expected := "variable reference for 'vault:db#user' could not be resolved: no secret 'db#user' (:1:12)"
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Fatalf("Expected error containing %q, got %v", expected, err)
+	}
+
+	// Without a resolver for the scheme the reference is looked up as usual.
+	if _, err := Parse("password = $vault:db#password"); err == nil || !strings.Contains(err.Error(), "can not be found") {
+		t.Fatalf("Expected a not found error, got %v", err)
+	}
+
+	tm, err := ParseWithChecks("password = $vault:db#password", WithVariableResolver("vault", r))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	e, err := Explain(tm, "password")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(e.String(), "from $vault:db#password by the vault resolver\n") {
+		t.Fatalf("Unexpected explanation:\n%s", e)
+	}
+}
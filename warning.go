@@ -0,0 +1,22 @@
+package conf
+
+import "fmt"
+
+// Warning is a non fatal problem found while parsing.
+type Warning struct {
+	File    string
+	Line    int
+	Pos     int
+	Message string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s (%s:%d:%d)", w.Message, w.File, w.Line, w.Pos)
+}
+
+// WithWarningHandler calls fn for every warning found while parsing.
+func WithWarningHandler(fn func(Warning)) Option {
+	return func(o *options) {
+		o.warn = fn
+	}
+}